@@ -14,10 +14,36 @@ import (
 
 	"github.com/surge-proxy/surge-go/internal/api"
 	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/dns"
 	"github.com/surge-proxy/surge-go/internal/engine"
+	"github.com/surge-proxy/surge-go/internal/rule"
 	"github.com/surge-proxy/surge-go/internal/server"
+	"github.com/surge-proxy/surge-go/internal/state"
 )
 
+// testConfig reports the problems found in the rules, using the rule sets
+// cached by earlier runs, and exits with status 1 if any is an error
+func testConfig(cfg *config.SurgeConfig, configPath string) {
+	sets := rule.CachedRuleSets(cfg.Rules, engine.RuleSetCacheDirForConfig(configPath))
+	issues := engine.AnalyzeRules(cfg, sets)
+
+	errCount := 0
+	for _, issue := range issues {
+		log.Printf("%s: %s", configPath, issue)
+		if issue.Severity == rule.SeverityError {
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		log.Fatalf("Configuration test failed: %d errors, %d issues in total", errCount, len(issues))
+	}
+	if len(issues) > 0 {
+		log.Printf("Configuration OK, %d issues found", len(issues))
+		return
+	}
+	log.Println("Configuration OK")
+}
+
 func main() {
 	configPath := flag.String("c", "surge.conf", "Path to Surge configuration file")
 	testMode := flag.Bool("t", false, "Test configuration and exit")
@@ -43,7 +69,7 @@ func main() {
 		log.Println("✓ Configuration loaded and parsed")
 
 		if *testMode {
-			log.Println("Configuration OK")
+			testConfig(cfg, *configPath)
 			return
 		}
 	} else {
@@ -57,6 +83,12 @@ func main() {
 	// Initialize Engine
 	eng := engine.NewEngine(cfg)
 
+	// Restore runtime selections from the previous run
+	if err := eng.EnableStatePersistence(state.PathForConfig(*configPath)); err != nil {
+		log.Printf("Warning: failed to load runtime state: %v", err)
+	}
+	eng.EnableRuleSetCache(engine.RuleSetCacheDirForConfig(*configPath))
+
 	// Start Engine
 	if err := eng.Start(); err != nil {
 		log.Fatalf("Failed to start engine: %v", err)
@@ -83,6 +115,17 @@ func main() {
 
 	httpServer := server.NewHTTPServer(fmt.Sprintf(":%d", httpPort), eng, rewriter, bodyRewriter, mitm)
 	socksServer := server.NewSOCKS5Server(fmt.Sprintf(":%d", socksPort), eng)
+	if cfg.General != nil && len(cfg.General.InboundAuth) > 0 {
+		users, err := server.ParseUsers(cfg.General.InboundAuth)
+		if err != nil {
+			log.Fatalf("Invalid inbound-auth: %v", err)
+		}
+		httpServer.SetUsers(users)
+		socksServer.SetUsers(users)
+	}
+	if cfg.General != nil {
+		socksServer.SetSniffing(cfg.General.Sniffing)
+	}
 
 	// Start Servers
 	go func() {
@@ -99,8 +142,22 @@ func main() {
 		}
 	}()
 
+	// DNS server for LAN clients, answering from the engine's DNS manager
+	var dnsServer *dns.Server
+	if cfg.General != nil && cfg.General.DNSListen != "" {
+		dnsServer = dns.NewServer(cfg.General.DNSListen, eng.GetDNSManager)
+		go func() {
+			if err := dnsServer.Start(); err != nil {
+				log.Printf("DNS server error: %v", err)
+			}
+		}()
+	}
+
 	// Start API server
 	apiServer := api.NewServer(eng, *configPath)
+	if dnsServer != nil {
+		apiServer.SetDNSServer(dnsServer)
+	}
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.Fatalf("Failed to start API server: %v", err)
@@ -129,6 +186,16 @@ func main() {
 	var wg sync.WaitGroup
 	wg.Add(3)
 
+	if dnsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := dnsServer.Shutdown(ctx); err != nil {
+				log.Printf("DNS server shutdown error: %v", err)
+			}
+		}()
+	}
+
 	go func() {
 		defer wg.Done()
 		if err := httpServer.Shutdown(ctx); err != nil {
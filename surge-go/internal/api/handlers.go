@@ -2,8 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptrace"
 	"strconv"
@@ -11,6 +13,9 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/dns"
+	"github.com/surge-proxy/surge-go/internal/engine"
+	"github.com/surge-proxy/surge-go/internal/rule"
 	"github.com/surge-proxy/surge-go/internal/system"
 )
 
@@ -516,12 +521,23 @@ func (s *Server) handleRuleMatch(w http.ResponseWriter, r *http.Request) {
 		URL      string `json:"url"`
 		SourceIP string `json:"source_ip"`
 		Process  string `json:"process"`
+		Trace    bool   `json:"trace"` // Explain the match, also enabled by ?trace=1
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if trace, _ := strconv.ParseBool(r.URL.Query().Get("trace")); req.Trace || trace {
+		explanation, err := s.engine.ExplainMatch(req.URL, req.SourceIP, req.Process)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, explanation)
+		return
+	}
+
 	adapter, rule, err := s.engine.MatchRule(req.URL, req.SourceIP, req.Process)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -553,6 +569,35 @@ func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleDNSClients lists the clients of the DNS server, most recent first
+func (s *Server) handleDNSClients(w http.ResponseWriter, r *http.Request) {
+	clients := []dns.ClientSummary{}
+	if s.dnsServer != nil {
+		clients = s.dnsServer.Clients()
+	}
+	respondJSON(w, map[string]interface{}{
+		"enabled": s.dnsServer != nil,
+		"clients": clients,
+	})
+}
+
+// handleDNSClientQueries returns the recent queries of one DNS client
+func (s *Server) handleDNSClientQueries(w http.ResponseWriter, r *http.Request) {
+	client := mux.Vars(r)["client"]
+	var queries []dns.QueryRecord
+	if s.dnsServer != nil {
+		queries = s.dnsServer.ClientQueries(client)
+	}
+	if queries == nil {
+		http.Error(w, "no queries from "+client, http.StatusNotFound)
+		return
+	}
+	respondJSON(w, map[string]interface{}{
+		"client":  client,
+		"queries": queries,
+	})
+}
+
 func (s *Server) handleDNSDiagnose(w http.ResponseWriter, r *http.Request) {
 	if s.engine == nil || s.engine.DNSManager == nil {
 		respondJSON(w, map[string]int{})
@@ -573,6 +618,180 @@ func (s *Server) handleSystemGateway(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handleGetProxyHealth(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	members, err := s.engine.GetGroupHealth(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"name":    name,
+		"members": members,
+	})
+}
+
+func (s *Server) handleGetProxyHistory(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	history, err := s.engine.GetProxyHistory(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"name":    name,
+		"history": history,
+	})
+}
+
+func (s *Server) handleGetBandwidth(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]interface{}{
+		"limits": s.engine.GetBandwidthStatus(),
+	})
+}
+
+func (s *Server) handleGetQuotas(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]interface{}{
+		"quotas": s.engine.GetQuotaStatus(),
+		"events": s.engine.GetQuotaEvents(),
+	})
+}
+
+func (s *Server) handleGetRuleSets(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]interface{}{
+		"rulesets": s.engine.GetRuleSets(),
+	})
+}
+
+// handleRefreshRuleSet handles POST /api/rulesets/refresh?url=...
+func (s *Server) handleRefreshRuleSet(w http.ResponseWriter, r *http.Request) {
+	setURL := r.URL.Query().Get("url")
+	if setURL == "" {
+		http.Error(w, "url parameter required", http.StatusBadRequest)
+		return
+	}
+
+	statuses, err := s.engine.RefreshRuleSet(setURL)
+	if errors.Is(err, rule.ErrRuleSetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	resp := map[string]interface{}{
+		"success":  err == nil,
+		"rulesets": statuses,
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleGetRuntimeRules(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, map[string]interface{}{
+		"rules": s.engine.GetRuntimeRules(),
+	})
+}
+
+// handleAddRuntimeRule handles POST /api/rules/runtime. ttl is in seconds, 0
+// or absent keeps the rule until it is removed.
+func (s *Server) handleAddRuntimeRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rule    string `json:"rule"`
+		TTL     int    `json:"ttl"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TTL < 0 {
+		http.Error(w, "ttl must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.engine.AddRuntimeRule(req.Rule, time.Duration(req.TTL)*time.Second, req.Comment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	respondJSON(w, status)
+}
+
+func (s *Server) handleDeleteRuntimeRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.engine.RemoveRuntimeRule(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respondJSON(w, map[string]string{"status": "deleted"})
+}
+
+// handlePromoteRuntimeRule handles POST /api/rules/runtime/{id}/promote: the
+// rule is saved at the top of the config rules. It keeps applying as a runtime
+// rule until the config is reloaded.
+func (s *Server) handlePromoteRuntimeRule(w http.ResponseWriter, r *http.Request) {
+	if s.configManager == nil {
+		http.Error(w, "Config manager not initialized", http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	// Promote first, so that a rule that expired or was removed meanwhile
+	// never reaches the config
+	st, err := s.engine.PromoteRuntimeRule(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var expires time.Time
+	if st.ExpiresAt != nil {
+		expires = *st.ExpiresAt
+	}
+	unpromote := func() {
+		if err := s.engine.UnpromoteRuntimeRule(id, expires); err != nil {
+			log.Printf("Failed to restore runtime rule %d: %v", id, err)
+		}
+	}
+
+	line := st.Rule
+	rules := config.ParseRules([]string{line})
+	if len(rules) != 1 {
+		unpromote()
+		http.Error(w, "cannot convert rule: "+line, http.StatusBadRequest)
+		return
+	}
+	if st.Comment != "" {
+		rules[0].Comment = st.Comment
+	}
+
+	if err := s.configManager.InsertRule(0, rules[0]); err != nil {
+		unpromote()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.configManager.Save(); err != nil {
+		if err := s.configManager.DeleteRule(0); err != nil {
+			log.Printf("Failed to roll back promoted rule: %v", err)
+		}
+		unpromote()
+		http.Error(w, fmt.Sprintf("Failed to save config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, map[string]string{"status": "promoted", "rule": line})
+}
+
 func (s *Server) handleTestProxy(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"name"`
@@ -1037,9 +1256,32 @@ func (s *Server) handleValidateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, map[string]interface{}{
-		"valid": true,
-	})
+	// Rule analysis, with the rule sets loaded by the engine
+	cfg := s.configManager.GetConfig()
+	var issues []rule.Issue
+	if s.engine != nil {
+		issues = s.engine.AnalyzeConfig(cfg)
+	} else {
+		issues = engine.AnalyzeRules(cfg, nil)
+	}
+	errCount := 0
+	for _, issue := range issues {
+		if issue.Severity == rule.SeverityError {
+			errCount++
+		}
+	}
+	if issues == nil {
+		issues = []rule.Issue{}
+	}
+
+	resp := map[string]interface{}{
+		"valid":  errCount == 0,
+		"issues": issues,
+	}
+	if errCount > 0 {
+		resp["error"] = fmt.Sprintf("%d rule errors", errCount)
+	}
+	respondJSON(w, resp)
 }
 
 func (s *Server) handleReloadConfig(w http.ResponseWriter, r *http.Request) {
@@ -12,8 +12,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/dns"
 	"github.com/surge-proxy/surge-go/internal/engine"
 	"github.com/surge-proxy/surge-go/internal/policy"
+	"github.com/surge-proxy/surge-go/internal/rule"
 	"github.com/surge-proxy/surge-go/internal/system"
 )
 
@@ -25,6 +27,7 @@ type Server struct {
 	configManager *config.ConfigManager
 	sysProxyMgr   *system.ProxyManager
 	testClient    *http.Client
+	dnsServer     *dns.Server // nil unless dns-listen is set
 }
 
 // NewServer creates API server
@@ -62,6 +65,11 @@ func NewServer(eng *engine.Engine, configPath string) *Server {
 	return s
 }
 
+// SetDNSServer exposes the query log of the DNS server through the API
+func (s *Server) SetDNSServer(srv *dns.Server) {
+	s.dnsServer = srv
+}
+
 // setupRoutes configures API routes
 func (s *Server) setupRoutes() {
 	s.router = mux.NewRouter()
@@ -119,15 +127,28 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/api/rules/detail", s.handleGetRulesDetail).Methods("GET")
 	s.router.HandleFunc("/api/rules/reset-counters", s.handleResetRuleCounters).Methods("POST")
 	s.router.HandleFunc("/api/rules/{id}/toggle", s.handleToggleRule).Methods("POST")
+	s.router.HandleFunc("/api/rules/runtime", s.handleGetRuntimeRules).Methods("GET")
+	s.router.HandleFunc("/api/rules/runtime", s.handleAddRuntimeRule).Methods("POST")
+	s.router.HandleFunc("/api/rules/runtime/{id}", s.handleDeleteRuntimeRule).Methods("DELETE")
+	s.router.HandleFunc("/api/rules/runtime/{id}/promote", s.handlePromoteRuntimeRule).Methods("POST")
 	s.router.HandleFunc("/api/proxies/global", s.handleSetGlobalProxy).Methods("POST")
+	s.router.HandleFunc("/api/proxies/{name}/health", s.handleGetProxyHealth).Methods("GET")
+	s.router.HandleFunc("/api/proxies/{name}/history", s.handleGetProxyHistory).Methods("GET")
+	s.router.HandleFunc("/api/bandwidth", s.handleGetBandwidth).Methods("GET")
+	s.router.HandleFunc("/api/quotas", s.handleGetQuotas).Methods("GET")
+	s.router.HandleFunc("/api/rulesets", s.handleGetRuleSets).Methods("GET")
+	s.router.HandleFunc("/api/rulesets/refresh", s.handleRefreshRuleSet).Methods("POST")
 
 	// WebSocket
 	s.router.HandleFunc("/ws", s.handleWebSocket)
+	s.router.HandleFunc("/ws/quota", s.handleQuotaEvents)
 
 	// Backend Specific API
 	s.router.HandleFunc("/api/rules/match", s.handleRuleMatch).Methods("POST")
 	s.router.HandleFunc("/api/dns/query", s.handleDNSQuery).Methods("GET")
 	s.router.HandleFunc("/api/dns/diagnose", s.handleDNSDiagnose).Methods("GET")
+	s.router.HandleFunc("/api/dns/clients", s.handleDNSClients).Methods("GET")
+	s.router.HandleFunc("/api/dns/clients/{client}", s.handleDNSClientQueries).Methods("GET")
 	s.router.HandleFunc("/api/proxy/test", s.handleTestProxy).Methods("POST")
 	s.router.HandleFunc("/api/proxy/test-live", s.handleTestProxyLive).Methods("POST")
 	s.router.HandleFunc("/api/system/gateway", s.handleSystemGateway).Methods("GET")
@@ -273,6 +294,41 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleQuotaEvents streams quota exceeded events to the client
+func (s *Server) handleQuotaEvents(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := s.engine.SubscribeQuotaEvents()
+	defer unsubscribe()
+
+	// Detect the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
 func (s *Server) handleGetRules(w http.ResponseWriter, r *http.Request) {
 	// Return current rules from config
 	// For now, return empty array - will be populated from actual config
@@ -326,20 +382,35 @@ type RuleDTO struct {
 	HitCount int64  `json:"hit_count"`
 	Enabled  bool   `json:"enabled"`
 	Comment  string `json:"comment"`
+	Schedule string `json:"schedule,omitempty"` // schedule= option of the rule
+	Active   bool   `json:"active"`             // Enabled and allowed to match at this time
+
+	// Traffic of the connections routed by the rule
+	Upload            int64      `json:"upload"`
+	Download          int64      `json:"download"`
+	ActiveConnections int64      `json:"active_connections"`
+	LastHit           *time.Time `json:"last_hit,omitempty"`
 }
 
 func (s *Server) handleGetRulesDetail(w http.ResponseWriter, r *http.Request) {
 	rules := s.engine.RuleEngine.GetRules()
 	var dtos []RuleDTO
-	for i, rule := range rules {
+	for i, rl := range rules {
+		stats := rl.Stats().Snapshot()
 		dtos = append(dtos, RuleDTO{
-			ID:       i,
-			Type:     rule.Type(),
-			Payload:  rule.Payload(),
-			Adapter:  rule.Adapter(),
-			HitCount: rule.HitCount(),
-			Enabled:  rule.IsEnabled(),
-			Comment:  rule.Comment(),
+			ID:                i,
+			Type:              rl.Type(),
+			Payload:           rl.Payload(),
+			Adapter:           rl.Adapter(),
+			HitCount:          stats.HitCount,
+			Enabled:           rl.IsEnabled(),
+			Comment:           rl.Comment(),
+			Schedule:          rl.Schedule().String(),
+			Active:            rule.IsActive(rl),
+			Upload:            stats.Upload,
+			Download:          stats.Download,
+			ActiveConnections: stats.ActiveConnections,
+			LastHit:           stats.LastHit,
 		})
 	}
 	respondJSON(w, map[string]interface{}{
@@ -369,7 +440,7 @@ func (s *Server) handleToggleRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.engine.RuleEngine.ToggleRule(index, req.Enabled); err != nil {
+	if err := s.engine.ToggleRule(index, req.Enabled); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -5,10 +5,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/dns"
 	"github.com/surge-proxy/surge-go/internal/engine"
+	"github.com/surge-proxy/surge-go/internal/rule"
 )
 
 func newTestServer() *Server {
@@ -171,3 +179,258 @@ func TestServer_HandleDNSQuery(t *testing.T) {
 		t.Errorf("Expected status 500, got %d", w.Code)
 	}
 }
+
+func TestServer_RuleSets(t *testing.T) {
+	server := newTestServer()
+
+	path := filepath.Join(t.TempDir(), "set.list")
+	if err := os.WriteFile(path, []byte("DOMAIN,a.com\nDOMAIN,b.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setURL := "file://" + path
+	server.engine.RuleEngine = rule.NewEngine()
+	err := server.engine.RuleEngine.LoadRulesFromConfigs([]*config.RuleConfig{
+		{Type: "RULE-SET", Value: setURL, Policy: "Proxy", Enabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.engine.RuleEngine.Close()
+
+	req := httptest.NewRequest("POST", "/api/rulesets/refresh?url="+url.QueryEscape(setURL), nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/rulesets", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var response struct {
+		RuleSets []rule.RuleSetStatus `json:"rulesets"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.RuleSets) != 1 {
+		t.Fatalf("got %d rule sets, want 1", len(response.RuleSets))
+	}
+	if st := response.RuleSets[0]; st.URL != setURL || st.Entries != 2 || st.LastUpdate == nil || st.Source != rule.RuleSetSourceFile {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	req = httptest.NewRequest("POST", "/api/rulesets/refresh?url="+url.QueryEscape("http://unknown/x"), nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown rule set, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/rulesets/refresh", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a URL, got %d", w.Code)
+	}
+}
+
+func TestServer_RulesDetail_Schedule(t *testing.T) {
+	server := newTestServer()
+	server.engine.RuleEngine = rule.NewEngine()
+	err := server.engine.RuleEngine.LoadRulesFromConfigs([]*config.RuleConfig{
+		{Type: "DOMAIN", Value: "a.com", Policy: "Proxy", Enabled: true, Params: []string{"schedule=Mon-Sun UTC"}},
+		{Type: "DOMAIN", Value: "b.com", Policy: "Proxy", Enabled: false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/rules/detail", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var response struct {
+		Rules []RuleDTO `json:"rules"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(response.Rules))
+	}
+	if r := response.Rules[0]; r.Schedule != "Mon-Sun UTC" || !r.Active {
+		t.Errorf("unexpected scheduled rule: %+v", r)
+	}
+	if r := response.Rules[1]; r.Schedule != "" || r.Active {
+		t.Errorf("disabled rule should not be active: %+v", r)
+	}
+}
+
+func TestServer_ValidateConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "test.conf")
+	content := "[Rule]\nDOMAIN-SUFFIX,a.com,DIRECT\nDOMAIN,www.a.com,REJECT\nFINAL,Missing\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(engine.NewEngine(config.NewSurgeConfig()), configPath)
+
+	req := httptest.NewRequest("POST", "/api/config/validate", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var response struct {
+		Valid  bool         `json:"valid"`
+		Issues []rule.Issue `json:"issues"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Valid {
+		t.Error("a rule with an undefined policy should make the config invalid")
+	}
+	if len(response.Issues) != 2 {
+		t.Fatalf("got %d issues, want 2: %+v", len(response.Issues), response.Issues)
+	}
+	if got := response.Issues[0]; got.Kind != rule.IssueShadowed || got.Line != 3 || got.RelatedLine != 2 {
+		t.Errorf("unexpected issue: %+v", got)
+	}
+	if got := response.Issues[1]; got.Kind != rule.IssueUndefinedPolicy || got.Line != 4 {
+		t.Errorf("unexpected issue: %+v", got)
+	}
+}
+
+func TestServer_RuntimeRules(t *testing.T) {
+	server := newTestServer()
+	server.engine.RuleEngine = rule.NewEngine()
+	if err := server.engine.RuleEngine.LoadFromConfig([]string{"FINAL,DIRECT"}); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := config.NewConfigManager(filepath.Join(t.TempDir(), "surge.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.configManager = cm
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/rules/runtime", `{"rule": "DOMAIN,bad.com,REJECT", "ttl": 600, "comment": "incident"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add: status %d: %s", w.Code, w.Body.String())
+	}
+	var added rule.RuntimeRuleStatus
+	if err := json.NewDecoder(w.Body).Decode(&added); err != nil {
+		t.Fatal(err)
+	}
+	if added.ExpiresAt == nil || added.Policy != "REJECT" {
+		t.Errorf("unexpected rule: %+v", added)
+	}
+	if w := do("POST", "/api/rules/runtime", `{"rule": "DOMAIN,x.com,NoSuchProxy"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy: status %d", w.Code)
+	}
+
+	var list struct {
+		Rules []rule.RuntimeRuleStatus `json:"rules"`
+	}
+	if err := json.NewDecoder(do("GET", "/api/rules/runtime", "").Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Rules) != 1 || list.Rules[0].ID != added.ID {
+		t.Fatalf("unexpected list: %+v", list.Rules)
+	}
+	if len(cm.GetConfig().Rules) != 0 {
+		t.Error("runtime rule written to the config")
+	}
+
+	id := strconv.Itoa(added.ID)
+	if w := do("POST", "/api/rules/runtime/"+id+"/promote", ""); w.Code != http.StatusOK {
+		t.Fatalf("promote: status %d: %s", w.Code, w.Body.String())
+	}
+	if rules := cm.GetConfig().Rules; len(rules) != 1 || rules[0].Value != "bad.com" || rules[0].Comment != "incident" {
+		t.Errorf("promoted rule not in the config: %+v", rules)
+	}
+
+	if w := do("DELETE", "/api/rules/runtime/"+id, ""); w.Code != http.StatusOK {
+		t.Errorf("delete: status %d", w.Code)
+	}
+	if w := do("DELETE", "/api/rules/runtime/"+id, ""); w.Code != http.StatusNotFound {
+		t.Errorf("delete twice: status %d", w.Code)
+	}
+}
+
+func TestServer_PromoteRuntimeRuleRollback(t *testing.T) {
+	server := newTestServer()
+	server.engine.RuleEngine = rule.NewEngine()
+	if err := server.engine.RuleEngine.LoadFromConfig([]string{"FINAL,DIRECT"}); err != nil {
+		t.Fatal(err)
+	}
+	// Saving fails, the directory does not exist
+	cm, err := config.NewConfigManager(filepath.Join(t.TempDir(), "missing", "surge.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.configManager = cm
+
+	promote := func(id int) int {
+		req := httptest.NewRequest("POST", "/api/rules/runtime/"+strconv.Itoa(id)+"/promote", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	removed, _ := server.engine.AddRuntimeRule("DOMAIN,gone.com,REJECT", 0, "")
+	if err := server.engine.RemoveRuntimeRule(removed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := promote(removed.ID); code != http.StatusNotFound {
+		t.Errorf("removed rule: status %d, want 404", code)
+	}
+	if rules := cm.GetConfig().Rules; len(rules) != 0 {
+		t.Errorf("removed rule written to the config: %+v", rules)
+	}
+
+	added, _ := server.engine.AddRuntimeRule("DOMAIN,bad.com,REJECT", time.Hour, "")
+	if code := promote(added.ID); code != http.StatusInternalServerError {
+		t.Errorf("failed save: status %d, want 500", code)
+	}
+	if rules := cm.GetConfig().Rules; len(rules) != 0 {
+		t.Errorf("config not rolled back: %+v", rules)
+	}
+	list := server.engine.GetRuntimeRules()
+	if len(list) != 1 || list[0].Promoted || list[0].ExpiresAt == nil || !list[0].ExpiresAt.Equal(*added.ExpiresAt) {
+		t.Errorf("runtime rule not restored: %+v", list)
+	}
+}
+
+func TestServer_DNSClients(t *testing.T) {
+	server := newTestServer()
+
+	req := httptest.NewRequest("GET", "/api/dns/clients", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var response struct {
+		Enabled bool                `json:"enabled"`
+		Clients []dns.ClientSummary `json:"clients"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Enabled || response.Clients == nil || len(response.Clients) != 0 {
+		t.Errorf("without dns-listen: %+v", response)
+	}
+
+	server.SetDNSServer(dns.NewServer("127.0.0.1:0", func() *dns.Manager { return nil }))
+	req = httptest.NewRequest("GET", "/api/dns/clients/192.168.1.20", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a client without queries, got %d", w.Code)
+	}
+}
@@ -7,13 +7,18 @@ import (
 // GeneralConfig represents the [General] section
 type GeneralConfig struct {
 	TestTimeout                    int      `json:"test_timeout"`
+	HealthCheckConcurrency         int      `json:"health_check_concurrency"`
+	DialRetry                      bool     `json:"dial_retry"`
 	UDPPriority                    bool     `json:"udp_priority"`
 	InternetTestURL                string   `json:"internet_test_url"`
 	ProxyTestURL                   string   `json:"proxy_test_url"`
 	GeoIPMaxmindURL                string   `json:"geoip_maxmind_url"`
+	ASNDatabase                    string   `json:"asn_database"`     // Path of a GeoLite2-ASN mmdb for IP-ASN rules
+	GeositeDatabase                string   `json:"geosite_database"` // Path of a v2ray geosite.dat for GEOSITE rules
 	IPv6                           bool     `json:"ipv6"`
 	DNSServer                      []string `json:"dns_server"`
 	EncryptedDNSServer             []string `json:"encrypted_dns_server"`
+	DNSListen                      string   `json:"dns_listen"` // Address of the DNS server for LAN clients, e.g. 0.0.0.0:53
 	ShowErrorPageForReject         bool     `json:"show_error_page_for_reject"`
 	SkipProxy                      []string `json:"skip_proxy"`
 	AllowWifiAccess                bool     `json:"allow_wifi_access"`
@@ -35,6 +40,9 @@ type GeneralConfig struct {
 	TunExcludedRoutes              []string `json:"tun_excluded_routes"`
 	Replica                        bool     `json:"replica"`
 	Interface                      string   `json:"interface"`
+	InboundAuth                    []string `json:"inbound_auth"`               // user:password entries required by the HTTP and SOCKS5 listeners
+	Sniffing                       bool     `json:"sniffing"`                   // Read the TLS SNI or HTTP Host of SOCKS5 and TUN connections before routing
+	SniffOverrideDestination       bool     `json:"sniff_override_destination"` // Dial the sniffed domain instead of the requested IP
 }
 
 // ParseGeneral parses General configuration
@@ -47,6 +55,10 @@ func ParseGeneral(lines []string, cfg *GeneralConfig) {
 			switch key {
 			case "test-timeout":
 				cfg.TestTimeout = mustInt(value)
+			case "health-check-concurrency":
+				cfg.HealthCheckConcurrency = mustInt(value)
+			case "dial-retry":
+				cfg.DialRetry = value == "true"
 			case "udp-priority":
 				cfg.UDPPriority = value == "true"
 			case "internet-test-url":
@@ -55,12 +67,18 @@ func ParseGeneral(lines []string, cfg *GeneralConfig) {
 				cfg.ProxyTestURL = value
 			case "geoip-maxmind-url":
 				cfg.GeoIPMaxmindURL = value
+			case "asn-database":
+				cfg.ASNDatabase = value
+			case "geosite-database":
+				cfg.GeositeDatabase = value
 			case "ipv6":
 				cfg.IPv6 = value == "true"
 			case "dns-server":
 				cfg.DNSServer = splitList(value)
 			case "encrypted-dns-server":
 				cfg.EncryptedDNSServer = splitList(value)
+			case "dns-listen":
+				cfg.DNSListen = value
 			case "show-error-page-for-reject":
 				cfg.ShowErrorPageForReject = value == "true"
 			case "skip-proxy":
@@ -103,6 +121,12 @@ func ParseGeneral(lines []string, cfg *GeneralConfig) {
 				cfg.Replica = value == "true"
 			case "interface":
 				cfg.Interface = value
+			case "inbound-auth":
+				cfg.InboundAuth = splitList(value)
+			case "sniffing":
+				cfg.Sniffing = value == "true"
+			case "sniff-override-destination":
+				cfg.SniffOverrideDestination = value == "true"
 			}
 		}
 	}
@@ -10,6 +10,7 @@ func TestParseGeneral(t *testing.T) {
 		"loglevel = notify",
 		"ipv6 = true",
 		"dns-server = 8.8.8.8, 1.1.1.1",
+		"dns-listen = 0.0.0.0:53",
 		"test-timeout = 10",
 		"skip-proxy = 127.0.0.1, 192.168.0.0/16",
 		"allow-wifi-access = true",
@@ -30,6 +31,9 @@ func TestParseGeneral(t *testing.T) {
 	if !reflect.DeepEqual(cfg.DNSServer, []string{"8.8.8.8", "1.1.1.1"}) {
 		t.Errorf("DNSServer = %v, want [8.8.8.8 1.1.1.1]", cfg.DNSServer)
 	}
+	if cfg.DNSListen != "0.0.0.0:53" {
+		t.Errorf("DNSListen = %v, want 0.0.0.0:53", cfg.DNSListen)
+	}
 	if cfg.TestTimeout != 10 {
 		t.Errorf("TestTimeout = %v, want 10", cfg.TestTimeout)
 	}
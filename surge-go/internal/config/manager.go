@@ -59,7 +59,7 @@ func (m *ConfigManager) Load() error {
 		newConfig.ProxyGroups = ParseProxyGroups(groupLines)
 	}
 	if ruleLines, ok := sections["Rule"]; ok {
-		newConfig.Rules = ParseRules(ruleLines)
+		newConfig.Rules = parseRules(ruleLines, sectionLine(content, "Rule")+1)
 	}
 	if hostLines, ok := sections["Host"]; ok {
 		newConfig.Hosts = ParseHosts(hostLines)
@@ -73,6 +73,9 @@ func (m *ConfigManager) Load() error {
 	if mitmLines, ok := sections["MITM"]; ok {
 		ParseMITM(mitmLines, newConfig.MITM)
 	}
+	if bandwidthLines, ok := sections["Bandwidth"]; ok {
+		newConfig.Bandwidth = ParseBandwidth(bandwidthLines)
+	}
 
 	m.config = newConfig
 	return nil
@@ -80,11 +83,29 @@ func (m *ConfigManager) Load() error {
 
 // Save writes the configuration to file
 func (m *ConfigManager) Save() error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	content := m.serialize()
-	return os.WriteFile(m.configPath, []byte(content), 0644)
+	if err := os.WriteFile(m.configPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	m.renumberRules(content)
+	return nil
+}
+
+// renumberRules points the rules at their lines in the saved content, one per
+// rule. The rules are copied as callers may still hold the old ones.
+func (m *ConfigManager) renumberRules(content string) {
+	first := sectionLine(content, "Rule") + 1
+	for i, r := range m.config.Rules {
+		if r.Line == first+i {
+			continue
+		}
+		numbered := *r
+		numbered.Line = first + i
+		m.config.Rules[i] = &numbered
+	}
 }
 
 // serialize converts the config struct back to surge.conf format
@@ -104,9 +125,18 @@ func (m *ConfigManager) serialize() string {
 		if len(g.EncryptedDNSServer) > 0 {
 			sb.WriteString(fmt.Sprintf("encrypted-dns-server = %s\n", strings.Join(g.EncryptedDNSServer, ", ")))
 		}
+		if g.DNSListen != "" {
+			sb.WriteString(fmt.Sprintf("dns-listen = %s\n", g.DNSListen))
+		}
 		if g.TestTimeout > 0 {
 			sb.WriteString(fmt.Sprintf("test-timeout = %d\n", g.TestTimeout))
 		}
+		if g.HealthCheckConcurrency > 0 {
+			sb.WriteString(fmt.Sprintf("health-check-concurrency = %d\n", g.HealthCheckConcurrency))
+		}
+		if !g.DialRetry {
+			sb.WriteString("dial-retry = false\n")
+		}
 		if g.InternetTestURL != "" {
 			sb.WriteString(fmt.Sprintf("internet-test-url = %s\n", g.InternetTestURL))
 		}
@@ -125,6 +155,21 @@ func (m *ConfigManager) serialize() string {
 		if len(g.TunExcludedRoutes) > 0 {
 			sb.WriteString(fmt.Sprintf("tun-excluded-routes = %s\n", strings.Join(g.TunExcludedRoutes, ", ")))
 		}
+		if g.ASNDatabase != "" {
+			sb.WriteString(fmt.Sprintf("asn-database = %s\n", g.ASNDatabase))
+		}
+		if g.GeositeDatabase != "" {
+			sb.WriteString(fmt.Sprintf("geosite-database = %s\n", g.GeositeDatabase))
+		}
+		if len(g.InboundAuth) > 0 {
+			sb.WriteString(fmt.Sprintf("inbound-auth = %s\n", strings.Join(g.InboundAuth, ", ")))
+		}
+		if g.Sniffing {
+			sb.WriteString("sniffing = true\n")
+		}
+		if g.SniffOverrideDestination {
+			sb.WriteString("sniff-override-destination = true\n")
+		}
 	}
 	sb.WriteString("\n")
 
@@ -173,6 +218,15 @@ func (m *ConfigManager) serialize() string {
 		sb.WriteString("\n")
 	}
 
+	// [Bandwidth]
+	if len(m.config.Bandwidth) > 0 {
+		sb.WriteString("[Bandwidth]\n")
+		for _, b := range m.config.Bandwidth {
+			sb.WriteString(fmt.Sprintf("%s = %s\n", b.Device, b.Limit))
+		}
+		sb.WriteString("\n")
+	}
+
 	// [MITM]
 	if m.config.MITM != nil && m.config.MITM.Enabled {
 		sb.WriteString("[MITM]\n")
@@ -465,6 +519,25 @@ func serializeProxyGroup(g *ProxyGroupConfig) string {
 	if g.EvaluateBeforeUse {
 		parts = append(parts, "evaluate-before-use=true")
 	}
+	if g.Lazy {
+		parts = append(parts, "lazy=true")
+	}
+	if g.BandwidthLimit != "" {
+		parts = append(parts, fmt.Sprintf("bandwidth-limit=%s", g.BandwidthLimit))
+	}
+	if g.QuotaDaily != "" {
+		parts = append(parts, fmt.Sprintf("quota-daily=%s", g.QuotaDaily))
+	}
+	if g.QuotaMonthly != "" {
+		parts = append(parts, fmt.Sprintf("quota-monthly=%s", g.QuotaMonthly))
+	}
+	if g.Strategy != "" {
+		parts = append(parts, fmt.Sprintf("strategy=%s", g.Strategy))
+	}
+	if g.Default != "" {
+		parts = append(parts, fmt.Sprintf("default=%s", g.Default))
+	}
+	parts = append(parts, g.Conditions...)
 
 	return fmt.Sprintf("%s = %s\n", g.Name, strings.Join(parts, ", "))
 }
@@ -484,6 +557,9 @@ func serializeRule(r *RuleConfig) string {
 	if r.NoResolve {
 		parts = append(parts, "no-resolve")
 	}
+	if r.UpdateInterval > 0 {
+		parts = append(parts, fmt.Sprintf("update-interval=%d", r.UpdateInterval))
+	}
 
 	line := strings.Join(parts, ",")
 	if r.Comment != "" {
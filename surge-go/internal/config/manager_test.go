@@ -305,3 +305,110 @@ func TestConfigManager_ConcurrentAccess(t *testing.T) {
 
 	// No crash = success
 }
+
+func TestConfigManager_BandwidthRoundTrip(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "test.conf")
+	testConfig := `[Proxy]
+Metered = trojan, test.com, 443, password=pw, bandwidth-limit=5MB/s
+
+[Proxy Group]
+Proxy = select, Metered, bandwidth-limit=10MB/s
+
+[Bandwidth]
+192.168.1.20 = 2MB/s
+`
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manager, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+
+	cfg := manager.GetConfig()
+	if cfg.Proxies[0].BandwidthLimit != "5MB/s" {
+		t.Errorf("proxy limit = %q, want 5MB/s", cfg.Proxies[0].BandwidthLimit)
+	}
+	if cfg.ProxyGroups[0].BandwidthLimit != "10MB/s" {
+		t.Errorf("group limit = %q, want 10MB/s", cfg.ProxyGroups[0].BandwidthLimit)
+	}
+	if len(cfg.Bandwidth) != 1 || cfg.Bandwidth[0].Device != "192.168.1.20" || cfg.Bandwidth[0].Limit != "2MB/s" {
+		t.Errorf("unexpected device limits: %+v", cfg.Bandwidth)
+	}
+}
+
+func TestConfigManager_RuleSetIntervalRoundTrip(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "test.conf")
+	testConfig := `[Rule]
+RULE-SET,https://example.com/set.list,Proxy,update-interval=3600,no-resolve
+`
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manager, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+
+	r := manager.GetRules()[0]
+	if r.UpdateInterval != 3600 || !r.NoResolve || len(r.Params) != 0 {
+		t.Errorf("unexpected rule after round trip: %+v", r)
+	}
+}
+
+func TestConfigManager_RuleLines(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "test.conf")
+	testConfig := `[General]
+loglevel = info
+
+[Rule]
+# Comment
+DOMAIN,a.com,DIRECT
+
+DOMAIN,b.com,Proxy // note
+`
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config: %v", err)
+	}
+
+	manager, err := NewConfigManager(configPath)
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+	rules := manager.GetRules()
+	if len(rules) != 2 || rules[0].Line != 6 || rules[1].Line != 8 {
+		t.Fatalf("unexpected rule lines: %+v, %+v", rules[0], rules[1])
+	}
+	if parsed, _ := ParseConfig(testConfig); parsed.Rules[1].Line != 8 {
+		t.Errorf("ParseConfig line = %d, want 8", parsed.Rules[1].Line)
+	}
+
+	// Saving points the rules at their lines in the written file
+	manager.InsertRule(0, &RuleConfig{Type: "DOMAIN", Value: "c.com", Policy: "DIRECT", Enabled: true})
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	saved := manager.GetRules()
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	for i, r := range manager.GetRules() {
+		if saved[i].Line != r.Line || r.Line == 0 {
+			t.Errorf("rule %d: line %d after save, %d after load", i, saved[i].Line, r.Line)
+		}
+	}
+}
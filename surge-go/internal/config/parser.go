@@ -31,6 +31,19 @@ func ParseSections(content string) map[string][]string {
 	return sections
 }
 
+// sectionLine returns the line number of the header of section name, the
+// last one if it appears several times as ParseSections keeps the last
+func sectionLine(content, name string) int {
+	header := "[" + name + "]"
+	found := 0
+	for i, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == header {
+			found = i + 1
+		}
+	}
+	return found
+}
+
 // ParseProxies parses [Proxy] section
 func ParseProxies(lines []string) []*ProxyConfig {
 	var proxies []*ProxyConfig
@@ -100,6 +113,12 @@ func ParseSingleProxy(name, cfgStr string) *ProxyConfig {
 				proxy.TFO = val == "true"
 			case "udp":
 				proxy.UDP = val == "true"
+			case "bandwidth-limit":
+				proxy.BandwidthLimit = val
+			case "quota-daily":
+				proxy.QuotaDaily = val
+			case "quota-monthly":
+				proxy.QuotaMonthly = val
 			}
 		}
 	}
@@ -158,6 +177,22 @@ func ParseProxyGroups(lines []string) []*ProxyGroupConfig {
 					group.Selected = val
 				case "evaluate-before-use":
 					group.EvaluateBeforeUse = val == "true" || val == "1"
+				case "lazy":
+					group.Lazy = val == "true" || val == "1"
+				case "bandwidth-limit":
+					group.BandwidthLimit = val
+				case "quota-daily":
+					group.QuotaDaily = val
+				case "quota-monthly":
+					group.QuotaMonthly = val
+				case "strategy":
+					group.Strategy = val
+				case "default":
+					group.Default = val
+				default:
+					if isNetworkCondition(key) {
+						group.Conditions = append(group.Conditions, key+"="+val)
+					}
 				}
 			} else {
 				group.Proxies = append(group.Proxies, part)
@@ -168,10 +203,22 @@ func ParseProxyGroups(lines []string) []*ProxyGroupConfig {
 	return groups
 }
 
+// isNetworkCondition reports whether a group option key is a subnet group condition
+func isNetworkCondition(key string) bool {
+	upper := strings.ToUpper(key)
+	return strings.HasPrefix(upper, "SUBNET:") || strings.HasPrefix(upper, "ROUTER:") || strings.HasPrefix(upper, "INTERFACE:")
+}
+
 // ParseRules parses[Rule] section
 func ParseRules(lines []string) []*RuleConfig {
+	return parseRules(lines, 0)
+}
+
+// parseRules parses the [Rule] section starting at line first of the file and
+// records the line of each rule. A zero first leaves the lines unset.
+func parseRules(lines []string, first int) []*RuleConfig {
 	var rules []*RuleConfig
-	for _, line := range lines {
+	for i, line := range lines {
 		comment := ""
 		if idx := strings.Index(line, "//"); idx != -1 {
 			if idx > 0 && line[idx-1] == ':' {
@@ -201,6 +248,9 @@ func ParseRules(lines []string) []*RuleConfig {
 			Params:  make([]string, 0),
 			Enabled: true,
 		}
+		if first > 0 {
+			rule.Line = first + i
+		}
 
 		if rule.Type == "FINAL" {
 			// FINAL,Proxy,dns-failed
@@ -217,6 +267,8 @@ func ParseRules(lines []string) []*RuleConfig {
 			for i := 3; i < len(parts); i++ {
 				if parts[i] == "no-resolve" {
 					rule.NoResolve = true
+				} else if val, ok := strings.CutPrefix(parts[i], "update-interval="); ok {
+					rule.UpdateInterval = mustInt(val)
 				} else {
 					rule.Params = append(rule.Params, parts[i])
 				}
@@ -227,6 +279,27 @@ func ParseRules(lines []string) []*RuleConfig {
 	return rules
 }
 
+// ParseBandwidth parses [Bandwidth] section, e.g. "192.168.1.20 = 2MB/s"
+func ParseBandwidth(lines []string) []*BandwidthConfig {
+	var limits []*BandwidthConfig
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		limits = append(limits, &BandwidthConfig{
+			Device: strings.TrimSpace(parts[0]),
+			Limit:  strings.TrimSpace(parts[1]),
+		})
+	}
+	return limits
+}
+
 // ParseHosts parses [Host] section
 func ParseHosts(lines []string) []*HostConfig {
 	var hosts []*HostConfig
@@ -361,7 +434,7 @@ func ParseConfig(content string) (*SurgeConfig, error) {
 	}
 
 	if lines, ok := sections["Rule"]; ok {
-		cfg.Rules = ParseRules(lines)
+		cfg.Rules = parseRules(lines, sectionLine(content, "Rule")+1)
 	}
 
 	if lines, ok := sections["Host"]; ok {
@@ -382,6 +455,10 @@ func ParseConfig(content string) (*SurgeConfig, error) {
 		cfg.BodyRewrites = ParseBodyRewrites(lines)
 	}
 
+	if lines, ok := sections["Bandwidth"]; ok {
+		cfg.Bandwidth = ParseBandwidth(lines)
+	}
+
 	return cfg, nil
 }
 
@@ -10,6 +10,7 @@ type SurgeConfig struct {
 	URLRewrites  []*URLRewriteConfig
 	BodyRewrites []*BodyRewriteConfig
 	MITM         *MITMConfig
+	Bandwidth    []*BandwidthConfig
 }
 
 // ProxyConfig represents a single proxy in [Proxy] section
@@ -26,6 +27,9 @@ type ProxyConfig struct {
 	SkipCertVerify bool              `json:"skip_cert_verify"`
 	TFO            bool              `json:"tfo"`
 	UDP            bool              `json:"udp"`
+	BandwidthLimit string            `json:"bandwidth_limit"` // e.g. 5MB/s
+	QuotaDaily     string            `json:"quota_daily"`     // e.g. 10GB
+	QuotaMonthly   string            `json:"quota_monthly"`   // e.g. 100GB
 	Parameters     map[string]string `json:"parameters"`
 }
 
@@ -46,6 +50,13 @@ type ProxyGroupConfig struct {
 	NoAlert           bool     `json:"no_alert"`
 	Selected          string   `json:"selected"` // Persist selected proxy
 	EvaluateBeforeUse bool     `json:"evaluate_before_use"`
+	Lazy              bool     `json:"lazy"` // Skip health checks while the group is unused
+	BandwidthLimit    string   `json:"bandwidth_limit"`
+	QuotaDaily        string   `json:"quota_daily"`
+	QuotaMonthly      string   `json:"quota_monthly"`
+	Strategy          string   `json:"strategy"`   // load-balance: round-robin, random, consistent-hashing, sticky-sessions
+	Default           string   `json:"default"`    // subnet: policy used when no condition matches
+	Conditions        []string `json:"conditions"` // subnet: TYPE:VALUE=POLICY, e.g. SUBNET:192.168.1.0/24=DIRECT
 }
 
 // RuleConfig represents a single rule in [Rule] section
@@ -58,6 +69,13 @@ type RuleConfig struct {
 	UpdateInterval int      `json:"update_interval"`
 	Comment        string   `json:"comment"`
 	Enabled        bool     `json:"enabled"`
+	Line           int      `json:"line,omitempty"` // Line in the config file, 0 for rules not read from it
+}
+
+// BandwidthConfig represents a single item in [Bandwidth] section
+type BandwidthConfig struct {
+	Device string `json:"device"` // Source device IP
+	Limit  string `json:"limit"`  // e.g. 2MB/s
 }
 
 // HostConfig represents a single item in [Host] section
@@ -101,6 +119,7 @@ func NewSurgeConfig() *SurgeConfig {
 	return &SurgeConfig{
 		General: &GeneralConfig{
 			TestTimeout:            5,
+			DialRetry:              true,
 			LogLevel:               "notify",
 			ExcludeSimpleHostnames: true,
 			HttpApiWebDashboard:    true,
@@ -112,5 +131,6 @@ func NewSurgeConfig() *SurgeConfig {
 		URLRewrites:  make([]*URLRewriteConfig, 0),
 		BodyRewrites: make([]*BodyRewriteConfig, 0),
 		MITM:         &MITMConfig{},
+		Bandwidth:    make([]*BandwidthConfig, 0),
 	}
 }
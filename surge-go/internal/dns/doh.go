@@ -76,6 +76,50 @@ func (r *DoHResolver) query(ctx context.Context, url, host string, qtype uint16)
 	m := new(dns.Msg)
 	m.SetQuestion(host, qtype)
 
+	in, err := r.post(ctx, url, m)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	if in.Rcode == dns.RcodeSuccess {
+		for _, ans := range in.Answer {
+			if qtype == dns.TypeA {
+				if a, ok := ans.(*dns.A); ok {
+					ips = append(ips, a.A)
+				}
+			} else if qtype == dns.TypeAAAA {
+				if aaaa, ok := ans.(*dns.AAAA); ok {
+					ips = append(ips, aaaa.AAAA)
+				}
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no records found")
+	}
+	return ips, nil
+}
+
+// Exchange sends a query to the DoH servers in order and returns the first answer
+func (r *DoHResolver) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for _, url := range r.urls {
+		resp, err := r.post(ctx, url, query)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("no DoH servers available")
+	}
+	return nil, lastErr
+}
+
+// post sends a DNS message to a DoH server and returns its answer
+func (r *DoHResolver) post(ctx context.Context, url string, m *dns.Msg) (*dns.Msg, error) {
 	packed, err := m.Pack()
 	if err != nil {
 		return nil, err
@@ -105,30 +149,11 @@ func (r *DoHResolver) query(ctx context.Context, url, host string, qtype uint16)
 		return nil, err
 	}
 
-	var in dns.Msg
+	in := new(dns.Msg)
 	if err := in.Unpack(body); err != nil {
 		return nil, err
 	}
-
-	var ips []net.IP
-	if in.Rcode == dns.RcodeSuccess {
-		for _, ans := range in.Answer {
-			if qtype == dns.TypeA {
-				if a, ok := ans.(*dns.A); ok {
-					ips = append(ips, a.A)
-				}
-			} else if qtype == dns.TypeAAAA {
-				if aaaa, ok := ans.(*dns.AAAA); ok {
-					ips = append(ips, aaaa.AAAA)
-				}
-			}
-		}
-	}
-
-	if len(ips) == 0 {
-		return nil, fmt.Errorf("no records found")
-	}
-	return ips, nil
+	return in, nil
 }
 
 func (r *DoHResolver) Close() error {
@@ -2,9 +2,12 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+
+	"github.com/miekg/dns"
 )
 
 // Manager coordinates DNS resolution
@@ -100,6 +103,31 @@ func (m *Manager) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
 	return ips, err
 }
 
+// ErrNoUpstream is returned by Exchange without a dns-server or DoH upstream:
+// the system resolver only looks up addresses
+var ErrNoUpstream = errors.New("no upstream DNS server to forward to")
+
+// Exchanger forwards DNS queries as is
+type Exchanger interface {
+	Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+}
+
+// CanExchange reports whether queries can be forwarded with Exchange
+func (m *Manager) CanExchange() bool {
+	_, ok := m.upstream.(Exchanger)
+	return ok
+}
+
+// Exchange forwards a query to the upstream servers, for the record types
+// LookupIP does not cover. Hosts and the cache are not used.
+func (m *Manager) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	ex, ok := m.upstream.(Exchanger)
+	if !ok {
+		return nil, ErrNoUpstream
+	}
+	return ex.Exchange(ctx, query)
+}
+
 // TestUpstreams tests all configured upstream resolvers
 func (m *Manager) TestUpstreams(ctx context.Context) map[string]int {
 	results := make(map[string]int)
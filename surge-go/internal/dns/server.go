@@ -0,0 +1,300 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// answerTTL is the TTL of the A and AAAA records answered from the manager
+	answerTTL = 60
+	// queryTimeout bounds the resolution of one query
+	queryTimeout = 5 * time.Second
+	// clientLogSize is the number of recent queries kept per client
+	clientLogSize = 50
+	// maxLoggedClients bounds the clients with a query log; the one seen least
+	// recently is dropped first
+	maxLoggedClients = 1024
+)
+
+// Server answers DNS queries of LAN clients over UDP and TCP. A and AAAA
+// queries are resolved by the manager, through hosts, cache and the configured
+// upstreams; other queries are forwarded to the upstreams as is, which needs a
+// dns-server or DoH upstream. Queries are not logged, they are kept per client.
+type Server struct {
+	addr    string
+	manager func() *Manager // The current manager, it is replaced on reload
+
+	mu      sync.Mutex
+	udp     *dns.Server
+	tcp     *dns.Server
+	clients map[string]*clientLog
+}
+
+// QueryRecord is one query answered by the server
+type QueryRecord struct {
+	Time      time.Time `json:"time"`
+	Client    string    `json:"client"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Rcode     string    `json:"rcode"`
+	Answers   []string  `json:"answers,omitempty"`
+	Forwarded bool      `json:"forwarded"` // Sent to the upstreams instead of resolved by the manager
+	Duration  int64     `json:"duration"`  // ms
+}
+
+// ClientSummary counts the queries of one client
+type ClientSummary struct {
+	Client    string    `json:"client"`
+	Queries   int64     `json:"queries"`
+	Failures  int64     `json:"failures"` // Answered with SERVFAIL
+	LastQuery time.Time `json:"last_query"`
+}
+
+type clientLog struct {
+	summary ClientSummary
+	recent  []QueryRecord // Ring buffer, next is the oldest once full
+	next    int
+}
+
+// NewServer creates a DNS server listening on addr, e.g. 0.0.0.0:53. manager
+// returns the manager resolving queries, nil while none is available.
+func NewServer(addr string, manager func() *Manager) *Server {
+	return &Server{
+		addr:    addr,
+		manager: manager,
+		clients: make(map[string]*clientLog),
+	}
+}
+
+// Start listens on UDP and TCP and serves until Shutdown
+func (s *Server) Start() error {
+	pc, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	return s.Serve(pc, l)
+}
+
+// Serve answers queries arriving on pc and l until Shutdown
+func (s *Server) Serve(pc net.PacketConn, l net.Listener) error {
+	handler := dns.HandlerFunc(s.handle)
+	s.mu.Lock()
+	s.udp = &dns.Server{PacketConn: pc, Handler: handler}
+	s.tcp = &dns.Server{Listener: l, Handler: handler}
+	udp, tcp := s.udp, s.tcp
+	s.mu.Unlock()
+
+	log.Printf("DNS server listening on %s (UDP and TCP)", pc.LocalAddr())
+	if mgr := s.manager(); mgr != nil && !mgr.CanExchange() {
+		log.Printf("DNS server: no dns-server or DoH upstream is configured, queries other than A and AAAA are answered with SERVFAIL")
+	}
+	errCh := make(chan error, 2)
+	go func() { errCh <- udp.ActivateAndServe() }()
+	go func() { errCh <- tcp.ActivateAndServe() }()
+	return <-errCh
+}
+
+// Shutdown stops both listeners
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	udp, tcp := s.udp, s.tcp
+	s.mu.Unlock()
+
+	var errs []error
+	for _, srv := range []*dns.Server{udp, tcp} {
+		if srv != nil {
+			errs = append(errs, srv.ShutdownContext(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) handle(w dns.ResponseWriter, req *dns.Msg) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	resp, forwarded := s.resolve(ctx, req)
+	resp.Id = req.Id
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		// Answers too large for the client are truncated, it retries over TCP
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		resp.Truncate(size)
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		log.Printf("DNS: failed to answer %s: %v", w.RemoteAddr(), err)
+	}
+
+	if len(req.Question) > 0 {
+		s.record(w.RemoteAddr(), req.Question[0], resp, forwarded, time.Since(start))
+	}
+}
+
+// resolve answers a query and reports whether it was forwarded upstream
+func (s *Server) resolve(ctx context.Context, req *dns.Msg) (*dns.Msg, bool) {
+	mgr := s.manager()
+	if mgr == nil || len(req.Question) != 1 {
+		return failure(req, dns.RcodeServerFailure), false
+	}
+	q := req.Question[0]
+
+	if q.Qclass == dns.ClassINET && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeAAAA) {
+		ips, err := mgr.LookupIP(ctx, q.Name)
+		if err == nil {
+			return answerIPs(req, ips), false
+		}
+		// The upstreams tell a missing domain from a failure, the manager does not
+		if resp, ferr := mgr.Exchange(ctx, req); ferr == nil {
+			return resp, true
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return failure(req, dns.RcodeNameError), false
+		}
+		return failure(req, dns.RcodeServerFailure), false
+	}
+
+	resp, err := mgr.Exchange(ctx, req)
+	if err != nil {
+		// Without an upstream every such query fails, as reported on start
+		if !errors.Is(err, ErrNoUpstream) {
+			log.Printf("DNS: failed to forward %s %s: %v", dns.TypeToString[q.Qtype], q.Name, err)
+		}
+		return failure(req, dns.RcodeServerFailure), true
+	}
+	return resp, true
+}
+
+// answerIPs answers an A or AAAA query with the addresses of its family
+func answerIPs(req *dns.Msg, ips []net.IP) *dns.Msg {
+	q := req.Question[0]
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.RecursionAvailable = true
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: answerTTL}
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		switch {
+		case q.Qtype == dns.TypeA && ip4 != nil:
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: ip4})
+		case q.Qtype == dns.TypeAAAA && ip4 == nil && ip.To16() != nil:
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	return resp
+}
+
+func failure(req *dns.Msg, rcode int) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetRcode(req, rcode)
+	resp.RecursionAvailable = true
+	return resp
+}
+
+// record adds a query to the log of its client
+func (s *Server) record(addr net.Addr, q dns.Question, resp *dns.Msg, forwarded bool, d time.Duration) {
+	client := addr.String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	rec := QueryRecord{
+		Time:      time.Now(),
+		Client:    client,
+		Name:      strings.TrimSuffix(q.Name, "."),
+		Type:      dns.TypeToString[q.Qtype],
+		Rcode:     dns.RcodeToString[resp.Rcode],
+		Forwarded: forwarded,
+		Duration:  d.Milliseconds(),
+	}
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			rec.Answers = append(rec.Answers, rr.A.String())
+		case *dns.AAAA:
+			rec.Answers = append(rec.Answers, rr.AAAA.String())
+		case *dns.CNAME:
+			rec.Answers = append(rec.Answers, strings.TrimSuffix(rr.Target, "."))
+		default:
+			rec.Answers = append(rec.Answers, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cl, ok := s.clients[client]
+	if !ok {
+		if len(s.clients) >= maxLoggedClients {
+			s.dropOldestClient()
+		}
+		cl = &clientLog{summary: ClientSummary{Client: client}}
+		s.clients[client] = cl
+	}
+	cl.summary.Queries++
+	if resp.Rcode == dns.RcodeServerFailure {
+		cl.summary.Failures++
+	}
+	cl.summary.LastQuery = rec.Time
+	if len(cl.recent) < clientLogSize {
+		cl.recent = append(cl.recent, rec)
+	} else {
+		cl.recent[cl.next] = rec
+		cl.next = (cl.next + 1) % clientLogSize
+	}
+}
+
+// dropOldestClient removes the client seen least recently. s.mu must be held.
+func (s *Server) dropOldestClient() {
+	var oldest string
+	var at time.Time
+	for client, cl := range s.clients {
+		if oldest == "" || cl.summary.LastQuery.Before(at) {
+			oldest, at = client, cl.summary.LastQuery
+		}
+	}
+	delete(s.clients, oldest)
+}
+
+// Clients returns the clients that sent queries, most recent first
+func (s *Server) Clients() []ClientSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]ClientSummary, 0, len(s.clients))
+	for _, cl := range s.clients {
+		list = append(list, cl.summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastQuery.After(list[j].LastQuery) })
+	return list
+}
+
+// ClientQueries returns the recent queries of a client, newest first, or nil
+// if it sent none
+func (s *Server) ClientQueries(client string) []QueryRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cl, ok := s.clients[client]
+	if !ok {
+		return nil
+	}
+	list := make([]QueryRecord, 0, len(cl.recent))
+	for i := len(cl.recent) - 1; i >= 0; i-- {
+		list = append(list, cl.recent[(cl.next+i)%len(cl.recent)])
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestServer serves DNS for manager on a local UDP and TCP port
+func startTestServer(t *testing.T, manager *Manager) (*Server, string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Fatal(err)
+	}
+	s := NewServer(pc.LocalAddr().String(), func() *Manager { return manager })
+	go s.Serve(pc, l)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s, pc.LocalAddr().String()
+}
+
+func TestServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &dns.Server{PacketConn: pc}
+	upstream.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch q := r.Question[0]; {
+		case q.Name == "example.com." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("example.com. 300 A 1.2.3.4")
+			m.Answer = append(m.Answer, rr)
+		case q.Name == "example.com." && q.Qtype == dns.TypeTXT:
+			rr, _ := dns.NewRR(`example.com. 300 TXT "v=test"`)
+			m.Answer = append(m.Answer, rr)
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+	go upstream.ActivateAndServe()
+	defer upstream.Shutdown()
+
+	mgr := NewManager(map[string]string{"router.lan": "192.168.1.1"}, []string{pc.LocalAddr().String()}, nil, nil)
+	defer mgr.Close()
+	s, addr := startTestServer(t, mgr)
+
+	query := func(network, name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		c := &dns.Client{Net: network, Timeout: 2 * time.Second}
+		resp, _, err := c.Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("%s %s over %s: %v", dns.TypeToString[qtype], name, network, err)
+		}
+		return resp
+	}
+
+	// Hosts entries are answered by the manager
+	resp := query("udp", "router.lan.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "192.168.1.1" || resp.Answer[0].Header().Ttl != answerTTL {
+		t.Errorf("A router.lan: %v", resp.Answer)
+	}
+	if resp := query("udp", "router.lan.", dns.TypeAAAA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("AAAA router.lan: want an empty answer, got %v", resp)
+	}
+	if resp := query("tcp", "example.com.", dns.TypeA); len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "1.2.3.4" {
+		t.Errorf("A example.com over TCP: %v", resp.Answer)
+	}
+
+	// Other types are forwarded as is
+	resp = query("udp", "example.com.", dns.TypeTXT)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.TXT).Txt[0] != "v=test" {
+		t.Errorf("TXT example.com: %v", resp.Answer)
+	}
+	// A missing domain is reported as such
+	if resp := query("udp", "missing.example.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("A missing.example: rcode %s, want NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+
+	clients := s.Clients()
+	if len(clients) != 1 || clients[0].Client != "127.0.0.1" || clients[0].Queries != 5 {
+		t.Fatalf("unexpected clients: %+v", clients)
+	}
+	log := s.ClientQueries("127.0.0.1")
+	if len(log) != 5 || log[0].Name != "missing.example" || log[0].Rcode != "NXDOMAIN" || !log[1].Forwarded || log[4].Forwarded {
+		t.Errorf("unexpected query log: %+v", log)
+	}
+	if s.ClientQueries("10.0.0.1") != nil {
+		t.Error("a client without queries has a log")
+	}
+}
+
+func TestServer_ClientLogSize(t *testing.T) {
+	s := NewServer("", func() *Manager { return nil })
+	addr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 5353}
+	resp := new(dns.Msg)
+	for i := 0; i < clientLogSize+10; i++ {
+		s.record(addr, dns.Question{Name: "example.com.", Qtype: dns.TypeA}, resp, false, time.Millisecond)
+	}
+	s.record(addr, dns.Question{Name: "last.example.", Qtype: dns.TypeA}, resp, false, time.Millisecond)
+
+	log := s.ClientQueries("192.168.1.20")
+	if len(log) != clientLogSize || log[0].Name != "last.example" {
+		t.Errorf("got %d queries, newest %q", len(log), log[0].Name)
+	}
+	if c := s.Clients(); len(c) != 1 || c[0].Queries != clientLogSize+11 {
+		t.Errorf("unexpected clients: %+v", c)
+	}
+}
+
+func TestServer_NoUpstream(t *testing.T) {
+	mgr := NewManager(map[string]string{"router.lan": "192.168.1.1"}, nil, nil, nil)
+	defer mgr.Close()
+	if mgr.CanExchange() {
+		t.Fatal("the system resolver cannot forward queries")
+	}
+	_, addr := startTestServer(t, mgr)
+
+	// Hosts are still answered, other types fail without an upstream to forward to
+	c := &dns.Client{Net: "udp", Timeout: 2 * time.Second}
+	for qtype, want := range map[uint16]int{dns.TypeA: dns.RcodeSuccess, dns.TypeMX: dns.RcodeServerFailure} {
+		m := new(dns.Msg)
+		m.SetQuestion("router.lan.", qtype)
+		resp, _, err := c.Exchange(m, addr)
+		if err != nil {
+			t.Fatalf("%s router.lan: %v", dns.TypeToString[qtype], err)
+		}
+		if resp.Rcode != want {
+			t.Errorf("%s router.lan: rcode %s, want %s", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode], dns.RcodeToString[want])
+		}
+	}
+}
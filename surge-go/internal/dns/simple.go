@@ -108,6 +108,33 @@ func (r *SimpleResolver) query(ctx context.Context, server, host string) ([]net.
 	return ips, nil
 }
 
+// Exchange sends a query to the servers in order and returns the first answer
+func (r *SimpleResolver) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for _, server := range r.config.Servers {
+		resp, err := exchange(ctx, query, server, r.config.Timeout)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		return nil, errors.New("no DNS servers configured")
+	}
+	return nil, lastErr
+}
+
+// exchange sends query over UDP and retries over TCP if the answer was truncated
+func exchange(ctx context.Context, query *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+	c := &dns.Client{Timeout: timeout}
+	resp, _, err := c.ExchangeContext(ctx, query, server)
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.ExchangeContext(ctx, query, server)
+	}
+	return resp, err
+}
+
 func (r *SimpleResolver) Close() error {
 	return nil
 }
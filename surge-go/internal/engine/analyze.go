@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/rule"
+)
+
+// builtinPolicies are available to every rule, see getAdapter
+var builtinPolicies = []string{"DIRECT", "REJECT", "REJECT-NO-DROP", "REJECT-DROP", "REJECT-TINYGIF"}
+
+// AnalyzeRules looks for broken and unreachable rules in cfg. The policies of
+// the rules are checked against the proxies and groups of cfg, and rule sets
+// are analyzed with the content of sets.
+func AnalyzeRules(cfg *config.SurgeConfig, sets []*rule.RuleSetRule) []rule.Issue {
+	policies := append([]string{}, builtinPolicies...)
+	for _, p := range cfg.Proxies {
+		policies = append(policies, p.Name)
+	}
+	for _, g := range cfg.ProxyGroups {
+		policies = append(policies, g.Name)
+	}
+	return rule.Analyze(cfg.Rules, policies, sets)
+}
+
+// AnalyzeConfig analyzes the rules of cfg with the rule sets the engine has loaded
+func (e *Engine) AnalyzeConfig(cfg *config.SurgeConfig) []rule.Issue {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	var sets []*rule.RuleSetRule
+	if re != nil {
+		sets = re.RuleSetRules()
+	}
+	return AnalyzeRules(cfg, sets)
+}
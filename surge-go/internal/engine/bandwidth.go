@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"log"
+	"net"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/quota"
+	"github.com/surge-proxy/surge-go/internal/shaper"
+)
+
+// configureBandwidth applies bandwidth-limit options of proxies and groups
+// and the [Bandwidth] device limits. Invalid limits are logged and ignored.
+func (e *Engine) configureBandwidth(cfg *config.SurgeConfig) {
+	policies := make(map[string]int64)
+	devices := make(map[string]int64)
+
+	add := func(m map[string]int64, name, limit string) {
+		if limit == "" {
+			return
+		}
+		rate, err := shaper.ParseRate(limit)
+		if err != nil {
+			log.Printf("Engine: ignoring bandwidth limit of %s: %v", name, err)
+			return
+		}
+		m[name] = rate
+	}
+
+	for _, p := range cfg.Proxies {
+		add(policies, p.Name, p.BandwidthLimit)
+	}
+	for _, g := range cfg.ProxyGroups {
+		add(policies, g.Name, g.BandwidthLimit)
+	}
+	for _, b := range cfg.Bandwidth {
+		add(devices, b.Device, b.Limit)
+	}
+
+	e.Shaper.Configure(policies, devices)
+}
+
+// policyChain returns the policy and the members selected below it, down to the proxy
+func (e *Engine) policyChain(name string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+	for {
+		g, ok := e.Groups[name]
+		if !ok {
+			return chain
+		}
+		name = g.Now()
+		if name == "" || seen[name] {
+			return chain
+		}
+		seen[name] = true
+		chain = append(chain, name)
+	}
+}
+
+// wrapConn returns a function applying the bandwidth limits and traffic quotas
+// of the policies a connection from source went through. The traffic is also
+// counted in the statistics, for process pid if it is known.
+func (e *Engine) wrapConn(source string, pid int) func(policy string, conn net.Conn) net.Conn {
+	device := source
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		device = host
+	}
+	return func(policy string, conn net.Conn) net.Conn {
+		chain := e.policyChain(policy)
+		conn = shaper.NewConn(conn, e.Shaper.Limiters(chain, device))
+		if e.Quota.Tracks(chain) {
+			conn = quota.NewConn(conn, e.Quota, chain)
+		}
+		if e.Stats != nil {
+			conn = &statsConn{Conn: conn, stats: e.Stats, pid: pid}
+		}
+		return conn
+	}
+}
+
+// GetBandwidthStatus returns the state of all configured bandwidth limiters
+func (e *Engine) GetBandwidthStatus() []shaper.Status {
+	return e.Shaper.Status()
+}
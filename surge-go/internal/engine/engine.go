@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,9 +18,13 @@ import (
 	"github.com/surge-proxy/surge-go/internal/dns"
 	"github.com/surge-proxy/surge-go/internal/mitm"
 	"github.com/surge-proxy/surge-go/internal/policy"
+	"github.com/surge-proxy/surge-go/internal/process"
 	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/quota"
 	"github.com/surge-proxy/surge-go/internal/rewrite"
 	"github.com/surge-proxy/surge-go/internal/rule"
+	"github.com/surge-proxy/surge-go/internal/shaper"
+	"github.com/surge-proxy/surge-go/internal/state"
 	"github.com/surge-proxy/surge-go/internal/stats"
 	"github.com/surge-proxy/surge-go/internal/tracker"
 	// "github.com/surge-proxy/surge-go/internal/tun"
@@ -46,6 +51,21 @@ type Engine struct {
 	Mode         string
 	Tracker      *tracker.Tracker
 	CaptureStore *capture.Store
+	History      *stats.LatencyHistory
+	State        *state.Store
+	Shaper       *shaper.Manager
+	Quota        *quota.Manager
+
+	// quotaStop stops the periodic saving of quota usage
+	quotaStop chan struct{}
+
+	// fallbacks maps rule keys to their fallback-policy option
+	fallbacks map[string]string
+
+	// ruleSetCacheDir keeps downloaded rule sets across restarts, if set
+	ruleSetCacheDir string
+	// processes caches the process lookups of process rules
+	processes processCache
 	// TUNDevice    *tun.Device
 
 	// Test state
@@ -63,6 +83,9 @@ func NewEngine(cfg *config.SurgeConfig) *Engine {
 		Groups:       make(map[string]policy.Group),
 		Mode:         "rule",
 		CaptureStore: capture.NewStore(1000),
+		History:      stats.NewLatencyHistory(stats.DefaultHistorySize),
+		Shaper:       shaper.NewManager(),
+		Quota:        quota.NewManager(),
 	}
 	e.Tracker = tracker.NewTracker(e.CaptureStore)
 	return e
@@ -77,6 +100,12 @@ func (e *Engine) Start() error {
 		return nil
 	}
 
+	// Shared health check limits apply to every group created below
+	policy.DefaultHealthChecker.Configure(
+		e.Config.General.HealthCheckConcurrency,
+		time.Duration(e.Config.General.TestTimeout)*time.Second,
+	)
+
 	// 1. Load Proxies
 	if err := e.loadProxies(e.Config); err != nil {
 		return fmt.Errorf("failed to load proxies: %v", err)
@@ -87,6 +116,9 @@ func (e *Engine) Start() error {
 		return fmt.Errorf("failed to load groups: %v", err)
 	}
 
+	e.configureBandwidth(e.Config)
+	e.configureQuotas(e.Config)
+
 	// 3. Initialize DNS Manager
 	hostsMap := make(map[string]string)
 	for _, h := range e.Config.Hosts {
@@ -112,11 +144,31 @@ func (e *Engine) Start() error {
 		return fmt.Errorf("failed to init mitm manager: %v", err)
 	}
 
+	// Databases used by IP-ASN and GEOSITE rules must be loaded before the rules
+	e.loadGeoData(e.Config)
+
 	// 5. Initialize Rule Engine
+	prev := e.RuleEngine
 	e.RuleEngine = rule.NewEngine()
+	e.RuleEngine.SetResolver(e.resolveForRules)
+	e.RuleEngine.SetRuleSetCacheDir(e.ruleSetCacheDir)
+	// Runtime rules are not part of the config and survive reloads
+	if prev != nil {
+		e.RuleEngine.TakeRuntimeRules(prev)
+	}
 	if err := e.loadRules(); err != nil {
 		return fmt.Errorf("failed to load rules: %v", err)
 	}
+	// Rules whose line did not change keep their hits and traffic
+	if prev != nil {
+		e.RuleEngine.TakeStats(prev)
+	}
+
+	// Restore selections, mode and rule toggles from the previous run
+	e.restoreState()
+
+	e.quotaStop = make(chan struct{})
+	e.startQuotaPersistence(e.quotaStop)
 
 	// 6. Start Servers
 	// Listeners are managed by main.go or caller
@@ -126,6 +178,7 @@ func (e *Engine) Start() error {
 }
 
 func (e *Engine) loadRules() error {
+	e.fallbacks = ruleFallbacks(e.Config.Rules)
 	return e.RuleEngine.LoadRulesFromConfigs(e.Config.Rules)
 }
 
@@ -149,6 +202,12 @@ func (e *Engine) Stop() error {
 		}
 	}
 
+	// Rule sets of the next Start are updated by its own rule engine
+	e.RuleEngine.Close()
+
+	close(e.quotaStop)
+	e.saveQuotaUsage()
+
 	e.running = false
 	return nil
 }
@@ -167,8 +226,15 @@ func (e *Engine) Shutdown(ctx context.Context) error {
 // SetMode sets the proxy mode
 func (e *Engine) SetMode(mode string) {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 	e.Mode = mode
+	store := e.State
+	e.mu.Unlock()
+
+	if store != nil {
+		if err := store.SetMode(mode); err != nil {
+			log.Printf("Engine: failed to save mode: %v", err)
+		}
+	}
 }
 
 // GetMode returns the current proxy mode
@@ -230,11 +296,29 @@ func (e *Engine) HandleRequest(ctx context.Context, network, address, source str
 	}
 	e.mu.RLock()
 	mode := e.Mode
+	override := e.Config != nil && e.Config.General != nil && e.Config.General.SniffOverrideDestination
 	e.mu.RUnlock()
 
+	// The local process behind the connection, looked up only when a process
+	// rule is evaluated, for the rule and tracking
+	var proc *process.Info
+
+	// A domain sniffed from a connection to an IP names its destination
+	sniffed, _ := protocol.SniffedFromContext(ctx)
+	sniffedDomain := ""
+	if host, port, err := net.SplitHostPort(address); err == nil && net.ParseIP(host) != nil &&
+		sniffed.Domain != "" && net.ParseIP(sniffed.Domain) == nil {
+		sniffedDomain = sniffed.Domain
+		if override {
+			address = net.JoinHostPort(sniffedDomain, port)
+		}
+	}
+
 	var selectedDialer protocol.Dialer
 	var policyName string
 	var ruleDesc string
+	var matched rule.Rule
+	var resolvedIP string // Set when rule matching resolved the domain
 
 	// Mode handling
 	switch mode {
@@ -263,25 +347,61 @@ func (e *Engine) HandleRequest(ctx context.Context, network, address, source str
 		port, _ := strconv.Atoi(portStr)
 
 		meta := &rule.RequestMetadata{
-			Type: network,
-			Host: host,
-			Port: port,
+			Type:    network,
+			Host:    host,
+			Port:    port,
+			Context: ctx,
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			meta.IP = ip
+			// Domain rules see the sniffed domain, IP rules the IP connected to
+			if sniffedDomain != "" {
+				meta.Host = sniffedDomain
+			}
 		}
+		meta.Protocol = sniffed.Protocol
 		if source != "" {
 			if ip := net.ParseIP(source); ip != nil {
 				meta.SourceIP = ip
 			} else {
 				// Handle host:port source format if needed
-				h, _, err := net.SplitHostPort(source)
+				h, p, err := net.SplitHostPort(source)
 				if err == nil {
 					meta.SourceIP = net.ParseIP(h)
+					meta.SourcePort, _ = strconv.Atoi(p)
 				}
 			}
 		}
+		if in, ok := protocol.InboundFromContext(ctx); ok {
+			meta.InboundType = in.Type
+			meta.InboundPort = in.Port
+			meta.InboundUser = in.User
+		}
+		if req, ok := protocol.HTTPRequestFromContext(ctx); ok {
+			meta.URL = req.URL
+			meta.Method = req.Method
+			meta.Headers = req.Header
+			if meta.Protocol == "" {
+				meta.Protocol = "HTTP"
+				if strings.HasPrefix(req.URL, "https://") {
+					meta.Protocol = "HTTPS"
+				}
+			}
+		}
+		meta.LookupProcess = func() string {
+			if proc = e.findProcess(network, source); proc == nil {
+				return ""
+			}
+			return processPath(proc)
+		}
 
 		// Match
 		if e.RuleEngine != nil {
 			adapter, matchedRule := e.RuleEngine.Match(meta)
+			matched = matchedRule
+			if meta.DnsIP != nil {
+				resolvedIP = meta.DnsIP.String()
+			}
 			if adapter != "" {
 				selectedDialer = e.getAdapter(adapter)
 				policyName = adapter
@@ -302,20 +422,41 @@ func (e *Engine) HandleRequest(ctx context.Context, network, address, source str
 	}
 
 	// Prepare tracking metadata
-	// Try to resolve PID/Process if possible (requires advanced platform specific code, skipping for now)
-
 	connMeta := &tracker.Connection{
 		SourceIP:      source,
 		TargetAddress: address,
+		DestinationIP: resolvedIP,
+		Protocol:      sniffed.Protocol,
+		SniffedHost:   sniffed.Domain,
 		Rule:          ruleDesc,
 		Policy:        policyName,
 	}
+	if matched != nil {
+		connMeta.Counter = matched.Stats()
+	}
+	pid := 0
+	if proc != nil {
+		pid = proc.PID
+		connMeta.PID = proc.PID
+		connMeta.ProcessName = proc.Name
+	}
+	if in, ok := protocol.InboundFromContext(ctx); ok {
+		connMeta.InboundType = in.Type
+		connMeta.InboundPort = in.Port
+		connMeta.InboundUser = in.User
+	}
 
-	return &tracker.TrackingDialer{
-		Dialer:  selectedDialer,
-		Tracker: e.Tracker,
-		Meta:    connMeta,
+	d := &tracker.TrackingDialer{
+		Dialer:    selectedDialer,
+		Tracker:   e.Tracker,
+		Meta:      connMeta,
+		Fallbacks: e.buildFallbacks(policyName, matched),
+		Wrap:      e.wrapConn(source, pid),
+	}
+	if override && sniffedDomain != "" {
+		d.Address = address
 	}
+	return d
 }
 
 func (e *Engine) getAdapter(name string) protocol.Dialer {
@@ -373,7 +514,28 @@ func (e *Engine) GetProxyList() interface{} {
 			item["now"] = sg.Now()
 		} else if ug, ok := group.(*policy.URLTestGroup); ok {
 			item["now"] = ug.Now()
+		} else if lg, ok := group.(*policy.LoadBalanceGroup); ok {
+			item["now"] = lg.Now()
+		} else if ng, ok := group.(*policy.SubnetGroup); ok {
+			item["now"] = ng.Now()
+		}
+
+		// Latest probe result of each member
+		members := make([]map[string]interface{}, 0, len(group.Proxies()))
+		for _, member := range group.Proxies() {
+			m := map[string]interface{}{
+				"name":  member,
+				"delay": 0,
+				"alive": false,
+			}
+			if res, ok := e.History.Latest(member); ok {
+				m["delay"] = res.Latency
+				m["alive"] = res.Alive()
+				m["last_test"] = res.Timestamp
+			}
+			members = append(members, m)
 		}
+		item["members"] = members
 
 		list = append(list, item)
 	}
@@ -402,15 +564,66 @@ func (e *Engine) ResolveDNS(host string) ([]string, error) {
 	return result, nil
 }
 
+// GetDNSManager returns the current DNS manager, which is replaced on reload
+func (e *Engine) GetDNSManager() *dns.Manager {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.DNSManager
+}
+
+// ruleResolveTimeout bounds the DNS lookup done while matching IP-based rules
+const ruleResolveTimeout = 5 * time.Second
+
+// resolveForRules resolves a domain for IP-based rules, preferring IPv4. A
+// failure is not logged: the IP rules simply do not match, as in Surge.
+func (e *Engine) resolveForRules(ctx context.Context, host string) net.IP {
+	e.mu.RLock()
+	mgr := e.DNSManager
+	e.mu.RUnlock()
+	if mgr == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ruleResolveTimeout)
+	defer cancel()
+
+	ips, err := mgr.LookupIP(ctx, host)
+	if err != nil || len(ips) == 0 {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return ips[0]
+}
+
 // MatchRule matches a rule for a given request
 func (e *Engine) MatchRule(reqURL, sourceIP, process string) (string, string, error) {
 	if e.RuleEngine == nil {
 		return "", "", fmt.Errorf("Rule engine not initialized")
 	}
 
+	meta, err := matchMetadata(reqURL, sourceIP, process)
+	if err != nil {
+		return "", "", err
+	}
+
+	adapter, matchedRule := e.RuleEngine.Match(meta)
+	ruleDesc := "FINAL"
+	if matchedRule != nil {
+		ruleDesc = fmt.Sprintf("%s, %s", matchedRule.Type(), matchedRule.Payload())
+	}
+
+	return adapter, ruleDesc, nil
+}
+
+// matchMetadata builds the request metadata used to test rules against a URL
+func matchMetadata(reqURL, sourceIP, process string) (*rule.RequestMetadata, error) {
 	u, err := url.Parse(reqURL)
 	if err != nil {
-		return "", "", fmt.Errorf("invalid URL: %v", err)
+		return nil, fmt.Errorf("invalid URL: %v", err)
 	}
 
 	port := 80
@@ -430,6 +643,7 @@ func (e *Engine) MatchRule(reqURL, sourceIP, process string) (string, string, er
 		Host:        host,
 		Port:        port,
 		ProcessPath: process,
+		URL:         reqURL,
 	}
 
 	// Parse Host as IP if possible
@@ -442,23 +656,18 @@ func (e *Engine) MatchRule(reqURL, sourceIP, process string) (string, string, er
 			meta.SourceIP = ip
 		}
 	}
-
-	adapter, matchedRule := e.RuleEngine.Match(meta)
-	ruleDesc := "FINAL"
-	if matchedRule != nil {
-		ruleDesc = fmt.Sprintf("%s, %s", matchedRule.Type(), matchedRule.Payload())
-	}
-
-	return adapter, ruleDesc, nil
+	return meta, nil
 }
 
 // Reload applies a new configuration
 func (e *Engine) Reload(cfg *config.SurgeConfig) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
+	// Stop and Start take the engine lock themselves
 	e.Stop()
+
+	e.mu.Lock()
 	e.Config = cfg
+	e.mu.Unlock()
+
 	return e.Start()
 }
 
@@ -512,7 +721,9 @@ func (e *Engine) TestProxy(name, testURL string) (int, error) {
 		return 0, fmt.Errorf("proxy or group not found: %s", name)
 	}
 
-	return dialer.Test(testURL, 10*time.Second)
+	latency, err := dialer.Test(testURL, 10*time.Second)
+	e.recordProbe(name, stats.ProbeResult{Latency: int64(latency)}, err, "api")
+	return latency, err
 }
 
 // TestProxyDetailed tests the latency of a proxy and returns detailed metrics
@@ -538,19 +749,26 @@ func (e *Engine) TestProxyDetailed(name, testURL string) (map[string]int64, erro
 
 	// Check if dialer supports detailed testing
 	if tester, ok := dialer.(protocol.LatencyTester); ok {
-		stats, err := tester.TestLatency(testURL, 10*time.Second)
+		ls, err := tester.TestLatency(testURL, 10*time.Second)
 		if err != nil {
+			e.recordProbe(name, stats.ProbeResult{}, err, "api")
 			return nil, err
 		}
+		e.recordProbe(name, stats.ProbeResult{
+			Latency:   ls.Total,
+			TCP:       ls.TCPHandshake,
+			Handshake: ls.Handshake,
+		}, nil, "api")
 		return map[string]int64{
-			"tcp":       stats.TCPHandshake,
-			"handshake": stats.Handshake,
-			"total":     stats.Total,
+			"tcp":       ls.TCPHandshake,
+			"handshake": ls.Handshake,
+			"total":     ls.Total,
 		}, nil
 	}
 
 	// Fallback to standard test
 	latency, err := dialer.Test(testURL, 10*time.Second)
+	e.recordProbe(name, stats.ProbeResult{Latency: int64(latency)}, err, "api")
 	if err != nil {
 		return nil, err
 	}
@@ -560,6 +778,29 @@ func (e *Engine) TestProxyDetailed(name, testURL string) (map[string]int64, erro
 	}, nil
 }
 
+// recordProbe stores a latency test result in the proxy's history
+func (e *Engine) recordProbe(name string, res stats.ProbeResult, err error, source string) {
+	if err != nil {
+		res.Latency = 0
+		res.Error = err.Error()
+	}
+	res.Source = source
+	e.History.Record(name, res)
+}
+
+// GetProxyHistory returns the recent latency test results of a proxy or group, oldest first
+func (e *Engine) GetProxyHistory(name string) ([]stats.ProbeResult, error) {
+	e.mu.RLock()
+	_, isProxy := e.Proxies[name]
+	_, isGroup := e.Groups[name]
+	e.mu.RUnlock()
+
+	if !isProxy && !isGroup && name != "DIRECT" {
+		return nil, fmt.Errorf("proxy or group not found: %s", name)
+	}
+	return e.History.Get(name), nil
+}
+
 // SetGlobalProxy 临时设置全局代理（用于测试）- Deprecated
 // func (e *Engine) SetGlobalProxy(proxyName string) error { ... }
 
@@ -575,8 +816,13 @@ func (e *Engine) TestProxyDetailed(name, testURL string) (map[string]int64, erro
 // HandleTUNConnection implements tun.Handler
 func (e *Engine) HandleTUNConnection(conn net.Conn, target string) {
 	// Basic implementation: pass to HandleRequest
-	// Need context
-	ctx := context.Background()
+	ctx := protocol.WithInbound(context.Background(), protocol.Inbound{Type: protocol.InboundTUN})
+	e.mu.RLock()
+	sniffing := e.Config != nil && e.Config.General != nil && e.Config.General.Sniffing
+	e.mu.RUnlock()
+	if sniffing {
+		ctx, conn = sniffConn(ctx, conn)
+	}
 	dialer := e.HandleRequest(ctx, "tcp", target, conn.RemoteAddr().String())
 
 	// Dial target
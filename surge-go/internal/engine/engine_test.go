@@ -0,0 +1,381 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/process"
+	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/tracker"
+)
+
+func TestHandleRequest_SourceAndInboundRules(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Proxy Group]
+Users = select, DIRECT
+Ports = select, DIRECT
+Socks = select, DIRECT
+Clients = select, DIRECT
+
+[Rule]
+IN-USER,alice,Users
+SRC-PORT,40000-40100,Ports
+AND,((IN-TYPE,SOCKS5),(IN-PORT,1080)),Socks
+SRC-IP,192.168.1.0/24,Clients
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	tests := []struct {
+		name    string
+		inbound *protocol.Inbound
+		source  string
+		want    string
+	}{
+		{"authenticated user", &protocol.Inbound{Type: protocol.InboundHTTP, Port: 8888, User: "alice"}, "10.0.0.1:5000", "Users"},
+		{"other user", &protocol.Inbound{Type: protocol.InboundHTTP, Port: 8888, User: "bob"}, "10.0.0.1:5000", "DIRECT"},
+		{"source port", nil, "10.0.0.1:40050", "Ports"},
+		{"socks listener", &protocol.Inbound{Type: protocol.InboundSOCKS5, Port: 1080}, "10.0.0.1:5000", "Socks"},
+		{"socks on another port", &protocol.Inbound{Type: protocol.InboundSOCKS5, Port: 1081}, "10.0.0.1:5000", "DIRECT"},
+		{"source network", &protocol.Inbound{Type: protocol.InboundTUN}, "192.168.1.7:5000", "Clients"},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.inbound != nil {
+			ctx = protocol.WithInbound(ctx, *tt.inbound)
+		}
+		d, ok := e.HandleRequest(ctx, "tcp", "example.com:443", tt.source).(*tracker.TrackingDialer)
+		if !ok {
+			t.Fatalf("%s: expected a tracking dialer", tt.name)
+		}
+		if d.Meta.Policy != tt.want {
+			t.Errorf("%s: policy = %s, want %s", tt.name, d.Meta.Policy, tt.want)
+		}
+		if tt.inbound != nil && (d.Meta.InboundType != tt.inbound.Type || d.Meta.InboundUser != tt.inbound.User) {
+			t.Errorf("%s: connection inbound = %s/%s, want %s/%s", tt.name, d.Meta.InboundType, d.Meta.InboundUser, tt.inbound.Type, tt.inbound.User)
+		}
+	}
+}
+
+func TestHandleRequest_Sniffed(t *testing.T) {
+	const rules = `
+[Proxy Group]
+Sites = select, DIRECT
+Video = select, DIRECT
+Secure = select, DIRECT
+
+[Rule]
+DOMAIN-SUFFIX,example.com,Sites
+PROTOCOL,QUIC,Video
+PROTOCOL,TLS,Secure
+FINAL,DIRECT
+`
+	tests := []struct {
+		name     string
+		address  string
+		sniffed  protocol.Sniffed
+		override bool
+		policy   string
+		dial     string
+	}{
+		{"sniffed domain", "93.184.216.34:443", protocol.Sniffed{Protocol: "HTTPS", Domain: "www.example.com"}, false, "Sites", ""},
+		{"override", "93.184.216.34:443", protocol.Sniffed{Protocol: "HTTPS", Domain: "www.example.com"}, true, "Sites", "www.example.com:443"},
+		{"requested domain kept", "other.org:443", protocol.Sniffed{Protocol: "HTTPS", Domain: "www.example.com"}, true, "Secure", ""},
+		{"protocol only", "10.0.0.1:443", protocol.Sniffed{Protocol: "QUIC"}, false, "Video", ""},
+		{"TLS covers HTTPS", "10.0.0.1:443", protocol.Sniffed{Protocol: "HTTPS", Domain: "other.org"}, false, "Secure", ""},
+	}
+	for _, tt := range tests {
+		general := "[General]\n"
+		if tt.override {
+			general += "sniff-override-destination = true\n"
+		}
+		cfg, err := config.ParseConfig(general + rules)
+		if err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		e := NewEngine(cfg)
+		if err := e.Start(); err != nil {
+			t.Fatalf("failed to start engine: %v", err)
+		}
+
+		ctx := protocol.WithSniffed(context.Background(), tt.sniffed)
+		d := e.HandleRequest(ctx, "tcp", tt.address, "10.0.0.2:5000").(*tracker.TrackingDialer)
+		if d.Meta.Policy != tt.policy {
+			t.Errorf("%s: policy = %s, want %s", tt.name, d.Meta.Policy, tt.policy)
+		}
+		if d.Address != tt.dial {
+			t.Errorf("%s: dial address = %q, want %q", tt.name, d.Address, tt.dial)
+		}
+		if d.Meta.Protocol != tt.sniffed.Protocol || d.Meta.SniffedHost != tt.sniffed.Domain {
+			t.Errorf("%s: connection protocol %q, host %q", tt.name, d.Meta.Protocol, d.Meta.SniffedHost)
+		}
+		e.Stop()
+	}
+}
+
+func TestHandleRequest_ProcessRules(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process lookup is only supported on Linux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.ParseConfig(`
+[Proxy Group]
+ByName = select, DIRECT
+ByPath = select, DIRECT
+
+[Rule]
+PROCESS-NAME,` + filepath.Base(exe) + `,ByName
+PROCESS-PATH-REGEX,^` + regexp.QuoteMeta(exe) + `$,ByPath
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	// A connection of this process, as a local client of the proxy
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	d, ok := e.HandleRequest(context.Background(), "tcp", "example.com:443", client.LocalAddr().String()).(*tracker.TrackingDialer)
+	if !ok {
+		t.Fatal("expected a tracking dialer")
+	}
+	if d.Meta.Policy != "ByName" || d.Meta.PID != os.Getpid() || d.Meta.ProcessName != filepath.Base(exe) {
+		t.Errorf("unexpected connection: policy %s, pid %d, process %q", d.Meta.Policy, d.Meta.PID, d.Meta.ProcessName)
+	}
+
+	found := false
+	for _, p := range e.Stats.GetProcesses() {
+		found = found || p.PID == os.Getpid()
+	}
+	if !found {
+		t.Error("the process should be registered in the statistics")
+	}
+	if info, ok := e.processes.get("tcp|"+client.LocalAddr().String(), time.Now()); !ok || info == nil || info.PID != os.Getpid() {
+		t.Error("the lookup should be cached by client address")
+	}
+
+	// An entry left by another process that used the same client port is
+	// not trusted, the socket no longer matches
+	stale := &process.Info{PID: 1, Name: "stale", Inode: 1}
+	e.processes.put("tcp|"+client.LocalAddr().String(), stale, time.Now())
+	if info := e.findProcess("tcp", client.LocalAddr().String()); info == nil || info.PID != os.Getpid() {
+		t.Errorf("stale cache entry used: %+v", info)
+	}
+
+	// Clients on other hosts have no process
+	d = e.HandleRequest(context.Background(), "tcp", "example.com:443", "192.0.2.1:5000").(*tracker.TrackingDialer)
+	if d.Meta.Policy != "DIRECT" || d.Meta.PID != 0 {
+		t.Errorf("remote client: policy %s, pid %d", d.Meta.Policy, d.Meta.PID)
+	}
+}
+
+func TestHandleRequest_NoProcessRules(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Rule]
+DOMAIN-SUFFIX,example.com,DIRECT
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Without process rules the process of a local client is not looked up
+	d := e.HandleRequest(context.Background(), "tcp", "example.com:443", client.LocalAddr().String()).(*tracker.TrackingDialer)
+	if d.Meta.PID != 0 {
+		t.Errorf("pid = %d, want no lookup", d.Meta.PID)
+	}
+	if _, ok := e.processes.get("tcp|"+client.LocalAddr().String(), time.Now()); ok {
+		t.Error("no lookup should be cached")
+	}
+}
+
+func TestExplainMatch_PolicyPath(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Proxy]
+HK = trojan, 127.0.0.1, 443, password=pw
+
+[Proxy Group]
+Proxy = select, Streaming, DIRECT
+Streaming = select, HK
+
+[Rule]
+DOMAIN-SUFFIX,netflix.com,Proxy
+IP-CIDR,10.0.0.0/8,Missing
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	ex, err := e.ExplainMatch("https://www.netflix.com/title", "", "")
+	if err != nil {
+		t.Fatalf("ExplainMatch failed: %v", err)
+	}
+	if ex.Adapter != "Proxy" || ex.Rule != "DOMAIN-SUFFIX, netflix.com" || ex.Mode != "rule" {
+		t.Errorf("unexpected match: %+v", ex)
+	}
+	if len(ex.Trace.Steps) != 1 || !ex.Trace.Steps[0].Matched {
+		t.Errorf("unexpected steps: %+v", ex.Trace.Steps)
+	}
+	var names []string
+	for _, hop := range ex.PolicyPath {
+		names = append(names, hop.Name)
+	}
+	if len(ex.PolicyPath) != 3 || names[0] != "Proxy" || names[1] != "Streaming" || names[2] != "HK" {
+		t.Fatalf("policy path = %v, want [Proxy Streaming HK]", names)
+	}
+	if !ex.PolicyPath[0].Group || ex.PolicyPath[0].Selected != "Streaming" || ex.PolicyPath[2].Group {
+		t.Errorf("unexpected hops: %+v", ex.PolicyPath)
+	}
+
+	ex, _ = e.ExplainMatch("http://10.1.2.3", "", "")
+	if ex.Adapter != "Missing" || len(ex.PolicyPath) != 1 || ex.PolicyPath[0].Note == "" {
+		t.Errorf("an unknown policy should be reported, got %+v", ex.PolicyPath)
+	}
+
+	e.SetMode("direct")
+	ex, _ = e.ExplainMatch("https://www.netflix.com", "", "")
+	if ex.Adapter != "DIRECT" || ex.Trace != nil {
+		t.Errorf("direct mode should skip rules, got %+v", ex)
+	}
+}
+
+func TestRuntimeRules_Reload(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Proxy]
+HK = trojan, 127.0.0.1, 443, password=pw
+
+[Rule]
+FINAL,HK
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	if _, err := e.AddRuntimeRule("DOMAIN-SUFFIX,example.com,Missing", 0, ""); err == nil {
+		t.Error("a rule with an unknown policy was accepted")
+	}
+	if _, err := e.AddRuntimeRule("DOMAIN-SUFFIX,example.com,DIRECT", time.Hour, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if rules := e.GetRuntimeRules(); len(rules) != 1 {
+		t.Fatalf("got %d runtime rules after reload, want 1", len(rules))
+	}
+	ex, err := e.ExplainMatch("https://www.example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Adapter != "DIRECT" || !ex.Trace.Steps[0].Runtime {
+		t.Errorf("unexpected match: %+v", ex)
+	}
+}
+
+func TestRuleStats_Reload(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Rule]
+DOMAIN-SUFFIX,example.com,DIRECT
+DOMAIN-SUFFIX,example.org,DIRECT
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	d := e.HandleRequest(context.Background(), "tcp", "www.example.com:443", "10.0.0.2:5000").(*tracker.TrackingDialer)
+	if d.Meta.Counter == nil {
+		t.Fatal("connection is not counted for its rule")
+	}
+	d.Meta.Counter.AddTraffic(100, 2000)
+	e.HandleRequest(context.Background(), "tcp", "www.example.org:443", "10.0.0.2:5001")
+
+	changed, err := config.ParseConfig(`
+[Rule]
+DOMAIN-SUFFIX,example.com,DIRECT
+DOMAIN-SUFFIX,example.org,REJECT
+FINAL,DIRECT
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if err := e.Reload(changed); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	rules := e.RuleEngine.GetRules()
+	if s := rules[0].Stats().Snapshot(); s.HitCount != 1 || s.Upload != 100 || s.Download != 2000 || s.LastHit == nil {
+		t.Errorf("unchanged rule lost its stats: %+v", s)
+	}
+	if s := rules[1].Stats().Snapshot(); s.HitCount != 0 {
+		t.Errorf("changed rule kept its stats: %+v", s)
+	}
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"log"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/geoip"
+	"github.com/surge-proxy/surge-go/internal/geosite"
+)
+
+// loadGeoData loads the ASN and geosite databases named in the config.
+// A database already loaded from the same path is kept across reloads.
+// Failures are logged: the rules needing them then match nothing.
+func (e *Engine) loadGeoData(cfg *config.SurgeConfig) {
+	if path := cfg.General.ASNDatabase; path != "" && path != geoip.ASNPath() {
+		if err := geoip.InitASN(path); err != nil {
+			log.Printf("Warning: failed to load ASN database %s: %v", path, err)
+		} else {
+			log.Printf("Loaded ASN database from %s", path)
+		}
+	}
+
+	if path := cfg.General.GeositeDatabase; path != "" && path != geosite.Path() {
+		if err := geosite.Init(path); err != nil {
+			log.Printf("Warning: failed to load geosite database %s: %v", path, err)
+		} else {
+			log.Printf("Loaded geosite database from %s", path)
+		}
+	}
+}
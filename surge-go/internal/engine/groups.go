@@ -6,6 +6,7 @@ import (
 	"github.com/surge-proxy/surge-go/internal/config"
 	"github.com/surge-proxy/surge-go/internal/policy"
 	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/stats"
 )
 
 // loadGroups loads policy groups from configuration
@@ -66,6 +67,16 @@ func (e *Engine) loadGroups(cfg *config.SurgeConfig) error {
 		if err != nil {
 			return fmt.Errorf("failed to create group %s: %v", gConfig.Name, err)
 		}
+		if po, ok := group.(policy.ProbeObservable); ok {
+			po.SetProbeObserver(func(groupName, member string, latency int, err error) {
+				e.recordProbe(member, stats.ProbeResult{Latency: int64(latency)}, err, groupName)
+			})
+		}
+		e.watchSelection(group)
+		// Members out of traffic quota are skipped until the period resets
+		if aa, ok := group.(policy.AvailabilityAware); ok {
+			aa.SetAvailability(e.memberAvailable)
+		}
 		e.Groups[gConfig.Name] = group
 	}
 
@@ -76,3 +87,19 @@ func (e *Engine) loadGroups(cfg *config.SurgeConfig) error {
 
 	return nil
 }
+
+// GetGroupHealth returns passive and probe health statistics for a group's members
+func (e *Engine) GetGroupHealth(name string) ([]policy.MemberHealth, error) {
+	e.mu.RLock()
+	g, ok := e.Groups[name]
+	e.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("group not found: %s", name)
+	}
+	hr, ok := g.(policy.HealthReporter)
+	if !ok {
+		return nil, fmt.Errorf("group %s does not track member health", name)
+	}
+	return hr.HealthStats(), nil
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/process"
+	"github.com/surge-proxy/surge-go/internal/stats"
+)
+
+// Lookups are cached by client address: keep-alive requests and retries of
+// one connection share it, and finding the owner of a socket scans /proc.
+// A cached process is used only while it still owns the socket, as the
+// client port may be reused by another process within the TTL.
+const (
+	processCacheTTL  = 10 * time.Second
+	processCacheSize = 4096
+)
+
+// processCache remembers the process behind recent client addresses, nil for
+// clients without one
+type processCache struct {
+	mu      sync.Mutex
+	entries map[string]processEntry
+}
+
+type processEntry struct {
+	info    *process.Info
+	expires time.Time
+}
+
+func (c *processCache) get(key string, now time.Time) (*process.Info, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ent, ok := c.entries[key]
+	if !ok || now.After(ent.expires) {
+		return nil, false
+	}
+	return ent.info, true
+}
+
+func (c *processCache) put(key string, info *process.Info, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]processEntry)
+	}
+	if len(c.entries) >= processCacheSize {
+		for k, ent := range c.entries {
+			if now.After(ent.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= processCacheSize {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = processEntry{info: info, expires: now.Add(processCacheTTL)}
+}
+
+// findProcess returns the local process behind a client address, "ip:port",
+// and registers it with the statistics. It returns nil for clients on other
+// hosts and where process lookup is not supported.
+func (e *Engine) findProcess(network, source string) *process.Info {
+	host, portStr, err := net.SplitHostPort(source)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	port, _ := strconv.Atoi(portStr)
+
+	key := network + "|" + source
+	now := time.Now()
+	if info, ok := e.processes.get(key, now); ok {
+		if info == nil {
+			return nil
+		}
+		if inode, err := process.SocketInode(network, ip, port); err == nil && inode == info.Inode {
+			return info
+		}
+	}
+
+	info, err := process.FindProcess(network, ip, port)
+	if err != nil {
+		info = nil
+	} else if e.Stats != nil {
+		e.Stats.RegisterProcess(info.PID, info.Name)
+	}
+	e.processes.put(key, info, now)
+	return info
+}
+
+// processPath is what process rules match: the executable path, or only the
+// name when the path cannot be read
+func processPath(info *process.Info) string {
+	if info.Path != "" {
+		return info.Path
+	}
+	return info.Name
+}
+
+// statsConn records the traffic of a connection in the statistics, under the
+// process that opened it when known
+type statsConn struct {
+	net.Conn
+	stats *stats.Collector
+	pid   int
+}
+
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.stats.RecordDownload(uint64(n), c.pid, "")
+	}
+	return n, err
+}
+
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.stats.RecordUpload(uint64(n), c.pid, "")
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"log"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/quota"
+)
+
+// quotaSaveInterval is how often quota usage is written to the state file
+const quotaSaveInterval = time.Minute
+
+// configureQuotas applies the quota-daily and quota-monthly options of proxies and
+// groups and restores the usage saved by the previous run. Caller must hold e.mu.
+func (e *Engine) configureQuotas(cfg *config.SurgeConfig) {
+	limits := make(map[string]quota.Limit)
+
+	parse := func(name, option, value string) int64 {
+		if value == "" {
+			return 0
+		}
+		n, err := quota.ParseSize(value)
+		if err != nil {
+			log.Printf("Engine: ignoring %s of %s: %v", option, name, err)
+			return 0
+		}
+		return n
+	}
+	add := func(name, daily, monthly string) {
+		l := quota.Limit{
+			Daily:   parse(name, "quota-daily", daily),
+			Monthly: parse(name, "quota-monthly", monthly),
+		}
+		if l.Daily > 0 || l.Monthly > 0 {
+			limits[name] = l
+		}
+	}
+
+	for _, p := range cfg.Proxies {
+		add(p.Name, p.QuotaDaily, p.QuotaMonthly)
+	}
+	for _, g := range cfg.ProxyGroups {
+		add(g.Name, g.QuotaDaily, g.QuotaMonthly)
+	}
+
+	e.Quota.Configure(limits)
+	if e.State != nil {
+		e.Quota.Restore(e.State.Snapshot().Quotas)
+	}
+}
+
+// memberAvailable reports whether a group member still has traffic quota left
+func (e *Engine) memberAvailable(name string) bool {
+	return !e.Quota.Exceeded(name)
+}
+
+// startQuotaPersistence periodically saves quota usage until stop is closed
+func (e *Engine) startQuotaPersistence(stop <-chan struct{}) {
+	if e.State == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(quotaSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.saveQuotaUsage()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// saveQuotaUsage writes the current quota usage to the state file
+func (e *Engine) saveQuotaUsage() {
+	if e.State == nil {
+		return
+	}
+	if err := e.State.SetQuotaUsage(e.Quota.Snapshot()); err != nil {
+		log.Printf("Engine: failed to save quota usage: %v", err)
+	}
+}
+
+// GetQuotaStatus returns the usage and limits of every proxy with a quota
+func (e *Engine) GetQuotaStatus() []quota.Status {
+	return e.Quota.Status()
+}
+
+// GetQuotaEvents returns the most recent quota exceeded events
+func (e *Engine) GetQuotaEvents() []quota.Event {
+	return e.Quota.Events()
+}
+
+// SubscribeQuotaEvents returns a channel receiving quota exceeded events
+// and a function to unsubscribe
+func (e *Engine) SubscribeQuotaEvents() (<-chan quota.Event, func()) {
+	return e.Quota.Subscribe()
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/policy"
+	"github.com/surge-proxy/surge-go/internal/rule"
+	"github.com/surge-proxy/surge-go/internal/tracker"
+)
+
+// fallbackPolicyParam is the rule option naming the policy used when the rule's own policy fails
+const fallbackPolicyParam = "fallback-policy="
+
+// ruleFallbacks maps rule keys to their configured fallback-policy
+func ruleFallbacks(configs []*config.RuleConfig) map[string]string {
+	m := make(map[string]string)
+	for _, cfg := range configs {
+		for _, p := range cfg.Params {
+			if !strings.HasPrefix(p, fallbackPolicyParam) {
+				continue
+			}
+			// Build the rule the same way the rule engine does so the keys agree
+			r, err := rule.CreateRuleFromConfig(cfg.Type, cfg.Value, cfg.Policy, cfg.NoResolve, cfg.Enabled, cfg.Comment)
+			if err != nil || r == nil {
+				continue
+			}
+			m[ruleKey(r)] = strings.TrimSpace(strings.TrimPrefix(p, fallbackPolicyParam))
+		}
+	}
+	return m
+}
+
+// isRejectPolicy reports whether failing dials through the policy are intended
+func isRejectPolicy(name string) bool {
+	return strings.HasPrefix(name, "REJECT")
+}
+
+// buildFallbacks returns the dials to try after the matched policy fails:
+// the same policy once more, the next member of the group, then the rule's fallback-policy.
+// Select groups do not move to another member, the user chose the one to use.
+func (e *Engine) buildFallbacks(policyName string, matched rule.Rule) []tracker.Fallback {
+	e.mu.RLock()
+	retry := e.Config != nil && e.Config.General != nil && e.Config.General.DialRetry
+	group := e.Groups[policyName]
+	fallback := ""
+	if matched != nil {
+		fallback = e.fallbacks[ruleKey(matched)]
+	}
+	e.mu.RUnlock()
+
+	if isRejectPolicy(policyName) {
+		return nil
+	}
+
+	var list []tracker.Fallback
+	if retry {
+		if d := e.getAdapter(policyName); d != nil {
+			list = append(list, tracker.Fallback{Policy: policyName, Dialer: d})
+		}
+		if group != nil && group.Type() != "select" {
+			if next := nextMember(group); next != "" {
+				if d := e.getAdapter(next); d != nil {
+					list = append(list, tracker.Fallback{Policy: next, Dialer: d})
+				}
+			}
+		}
+	}
+	// Skip the fallback-policy if the group fallback already tried it
+	for _, f := range list {
+		if f.Policy == fallback {
+			fallback = ""
+		}
+	}
+	if fallback != "" {
+		if d := e.getAdapter(fallback); d != nil {
+			list = append(list, tracker.Fallback{Policy: fallback, Dialer: d})
+		}
+	}
+	return list
+}
+
+// nextMember returns the member after the group's current selection, skipping rejects
+func nextMember(g policy.Group) string {
+	members := g.Proxies()
+	current := g.Now()
+	idx := -1
+	for i, m := range members {
+		if m == current {
+			idx = i
+			break
+		}
+	}
+	for i := 1; i < len(members); i++ {
+		m := members[(idx+i+len(members))%len(members)]
+		if m != current && !isRejectPolicy(m) {
+			return m
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/rule"
+	"github.com/surge-proxy/surge-go/internal/tracker"
+)
+
+// autoGroup is a group picking its member itself, like url-test
+type autoGroup struct {
+	protocol.Dialer
+	members []string
+	now     string
+}
+
+func (g *autoGroup) Proxies() []string { return g.members }
+func (g *autoGroup) Now() string       { return g.now }
+
+func TestBuildFallbacks(t *testing.T) {
+	cfg, err := config.ParseConfig(`
+[Proxy Group]
+Proxy = select, Backup, REJECT, DIRECT
+Backup = select, DIRECT
+
+[Rule]
+DOMAIN-SUFFIX,Example.com,Proxy,fallback-policy=Backup
+FINAL,Proxy
+`)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	e := NewEngine(cfg)
+	if err := e.Start(); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	defer e.Stop()
+
+	e.Groups["Proxy"].(interface{ SetCurrent(string) error }).SetCurrent("Backup")
+
+	_, matched := e.RuleEngine.Match(&rule.RequestMetadata{Host: "www.example.com", Port: 443})
+	if matched == nil || matched.Type() != "DOMAIN-SUFFIX" {
+		t.Fatalf("unexpected match: %v", matched)
+	}
+
+	policies := func(fallbacks []tracker.Fallback) []string {
+		var got []string
+		for _, f := range fallbacks {
+			got = append(got, f.Policy)
+		}
+		return got
+	}
+
+	// A select group stays on the member the user chose: retry Proxy, then the rule's fallback-policy
+	if got, want := policies(e.buildFallbacks("Proxy", matched)), []string{"Proxy", "Backup"}; !slices.Equal(got, want) {
+		t.Errorf("select group fallbacks = %v, want %v", got, want)
+	}
+
+	// Other groups move to the member after the current one, skipping REJECT
+	e.Groups["Auto"] = &autoGroup{Dialer: protocol.NewDirectDialer("Auto"), members: []string{"Backup", "REJECT", "DIRECT"}, now: "Backup"}
+	if got, want := policies(e.buildFallbacks("Auto", matched)), []string{"Auto", "DIRECT", "Backup"}; !slices.Equal(got, want) {
+		t.Errorf("automatic group fallbacks = %v, want %v", got, want)
+	}
+
+	if f := e.buildFallbacks("REJECT", matched); len(f) != 0 {
+		t.Errorf("rejected requests must not fall back: %v", f)
+	}
+}
@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/surge-proxy/surge-go/internal/rule"
+)
+
+// RuleSetCacheDirForConfig returns the rule-set cache directory next to a config
+// file, e.g. /etc/surge/surge.conf -> /etc/surge/surge.rulesets
+func RuleSetCacheDirForConfig(configPath string) string {
+	dir := filepath.Dir(configPath)
+	base := strings.TrimSuffix(filepath.Base(configPath), filepath.Ext(configPath))
+	return filepath.Join(dir, base+".rulesets")
+}
+
+// EnableRuleSetCache keeps downloaded rule sets in dir, so that they are used
+// right away on the next start instead of waiting for the download.
+// It must be called before Start.
+func (e *Engine) EnableRuleSetCache(dir string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ruleSetCacheDir = dir
+}
+
+// GetRuleSets returns the status of the loaded rule sets
+func (e *Engine) GetRuleSets() []rule.RuleSetStatus {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return []rule.RuleSetStatus{}
+	}
+	return re.RuleSets()
+}
+
+// RefreshRuleSet downloads the rule sets with the given URL now
+func (e *Engine) RefreshRuleSet(url string) ([]rule.RuleSetStatus, error) {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return nil, rule.ErrRuleSetNotFound
+	}
+	return re.RefreshRuleSet(url)
+}
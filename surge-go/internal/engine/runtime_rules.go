@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/rule"
+)
+
+// AddRuntimeRule adds a rule evaluated before the config rules, which expires
+// after ttl if positive. It is kept across reloads but not written to the config.
+func (e *Engine) AddRuntimeRule(line string, ttl time.Duration, comment string) (rule.RuntimeRuleStatus, error) {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return rule.RuntimeRuleStatus{}, fmt.Errorf("Rule engine not initialized")
+	}
+	r, err := rule.ParseRule(line)
+	if err != nil {
+		return rule.RuntimeRuleStatus{}, err
+	}
+	if r != nil && !slices.Contains(builtinPolicies, r.Adapter()) && !e.hasPolicy(r.Adapter()) {
+		return rule.RuntimeRuleStatus{}, fmt.Errorf("unknown policy: %s", r.Adapter())
+	}
+	return re.AddRuntimeRule(line, ttl, comment)
+}
+
+// GetRuntimeRules returns the runtime rules in evaluation order
+func (e *Engine) GetRuntimeRules() []rule.RuntimeRuleStatus {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return []rule.RuntimeRuleStatus{}
+	}
+	return re.RuntimeRules()
+}
+
+// RemoveRuntimeRule removes a runtime rule by id
+func (e *Engine) RemoveRuntimeRule(id int) error {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return rule.ErrRuntimeRuleNotFound
+	}
+	return re.RemoveRuntimeRule(id)
+}
+
+// PromoteRuntimeRule marks a runtime rule as written to the config and returns
+// its status from before the promotion. The caller saves the line to the
+// config, calling UnpromoteRuntimeRule if that fails.
+func (e *Engine) PromoteRuntimeRule(id int) (rule.RuntimeRuleStatus, error) {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return rule.RuntimeRuleStatus{}, rule.ErrRuntimeRuleNotFound
+	}
+	return re.PromoteRuntimeRule(id)
+}
+
+// UnpromoteRuntimeRule undoes PromoteRuntimeRule, restoring the expiry the
+// rule had
+func (e *Engine) UnpromoteRuntimeRule(id int, expires time.Time) error {
+	e.mu.RLock()
+	re := e.RuleEngine
+	e.mu.RUnlock()
+
+	if re == nil {
+		return rule.ErrRuntimeRuleNotFound
+	}
+	return re.UnpromoteRuntimeRule(id, expires)
+}
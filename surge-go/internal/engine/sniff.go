@@ -0,0 +1,19 @@
+package engine
+
+import (
+	"context"
+	"net"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/sniff"
+)
+
+// sniffConn reads the first client bytes of conn and returns a context
+// carrying what they revealed, and the connection to relay
+func sniffConn(ctx context.Context, conn net.Conn) (context.Context, net.Conn) {
+	conn, res := sniff.Conn(conn, sniff.DefaultTimeout)
+	if res == nil {
+		return ctx, conn
+	}
+	return protocol.WithSniffed(ctx, protocol.Sniffed{Protocol: res.Protocol, Domain: res.Domain}), conn
+}
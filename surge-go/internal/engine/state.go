@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/surge-proxy/surge-go/internal/policy"
+	"github.com/surge-proxy/surge-go/internal/rule"
+	"github.com/surge-proxy/surge-go/internal/state"
+)
+
+// EnableStatePersistence loads runtime state (mode, group selections, url-test winners
+// and rule toggles) from path and records later changes there.
+// It must be called before Start.
+func (e *Engine) EnableStatePersistence(path string) error {
+	store, err := state.NewStore(path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.State = store
+	return nil
+}
+
+// ruleKey identifies a rule across reloads, independent of its position
+func ruleKey(r rule.Rule) string {
+	return fmt.Sprintf("%s,%s,%s", r.Type(), r.Payload(), r.Adapter())
+}
+
+// watchSelection persists selection changes of a group
+func (e *Engine) watchSelection(group policy.Group) {
+	so, ok := group.(policy.SelectionObservable)
+	if !ok || e.State == nil {
+		return
+	}
+
+	store := e.State
+	isSelect := group.Type() == "select"
+	so.SetSelectionObserver(func(name, selected string) {
+		var err error
+		if isSelect {
+			err = store.SetSelection(name, selected)
+		} else {
+			err = store.SetWinner(name, selected)
+		}
+		if err != nil {
+			log.Printf("Engine: failed to save selection of %s: %v", name, err)
+		}
+	})
+}
+
+// restoreState applies the persisted runtime state. Caller must hold e.mu.
+func (e *Engine) restoreState() {
+	if e.State == nil {
+		return
+	}
+	st := e.State.Snapshot()
+
+	if st.Mode != "" {
+		e.Mode = st.Mode
+	}
+
+	for name, group := range e.Groups {
+		rs, ok := group.(policy.SelectionRestorer)
+		if !ok {
+			continue
+		}
+		selected, ok := st.Selections[name]
+		if !ok {
+			selected, ok = st.Winners[name]
+		}
+		if ok && !rs.RestoreSelection(selected) {
+			log.Printf("Engine: saved selection %s is no longer a member of %s", selected, name)
+		}
+	}
+
+	if e.RuleEngine != nil && len(st.Rules) > 0 {
+		for _, r := range e.RuleEngine.GetRules() {
+			if enabled, ok := st.Rules[ruleKey(r)]; ok {
+				r.SetEnabled(enabled)
+			}
+		}
+	}
+}
+
+// ToggleRule enables or disables the rule at index and persists the change
+func (e *Engine) ToggleRule(index int, enabled bool) error {
+	e.mu.RLock()
+	re, store := e.RuleEngine, e.State
+	e.mu.RUnlock()
+
+	if re == nil {
+		return fmt.Errorf("rule engine not initialized")
+	}
+	if err := re.ToggleRule(index, enabled); err != nil {
+		return err
+	}
+
+	if store != nil {
+		rules := re.GetRules()
+		if err := store.SetRuleEnabled(ruleKey(rules[index]), enabled); err != nil {
+			log.Printf("Engine: failed to save rule state: %v", err)
+		}
+	}
+	return nil
+}
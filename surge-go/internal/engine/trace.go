@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/surge-proxy/surge-go/internal/rule"
+)
+
+// MatchExplanation tells which rule a request matches, why, and which proxy
+// the policy finally leads to
+type MatchExplanation struct {
+	Mode       string      `json:"mode"`
+	Adapter    string      `json:"adapter"`
+	Rule       string      `json:"rule"`
+	Trace      *rule.Trace `json:"trace,omitempty"` // Only in rule mode
+	PolicyPath []PolicyHop `json:"policy_path"`
+}
+
+// PolicyHop is one step from a policy to the proxy carrying the connection.
+// A group hop names the member it currently uses.
+type PolicyHop struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Group    bool   `json:"group,omitempty"`
+	Selected string `json:"selected,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// ExplainMatch matches a request like MatchRule and records every rule
+// evaluated, DNS resolution and the policy resolution through nested groups.
+// Hit counts are not changed.
+func (e *Engine) ExplainMatch(reqURL, sourceIP, process string) (*MatchExplanation, error) {
+	e.mu.RLock()
+	re, mode := e.RuleEngine, e.Mode
+	e.mu.RUnlock()
+
+	if re == nil {
+		return nil, fmt.Errorf("Rule engine not initialized")
+	}
+	meta, err := matchMetadata(reqURL, sourceIP, process)
+	if err != nil {
+		return nil, err
+	}
+
+	ex := &MatchExplanation{Mode: mode}
+	switch mode {
+	case "direct":
+		ex.Adapter, ex.Rule = "DIRECT", "Mode: Direct"
+	case "global":
+		// The same choice as HandleRequest
+		ex.Adapter, ex.Rule = "DIRECT", "Mode: Global"
+		for _, name := range []string{"Proxy", "Global"} {
+			if e.hasPolicy(name) {
+				ex.Adapter = name
+				break
+			}
+		}
+	default:
+		adapter, matched, trace := re.MatchTrace(meta)
+		ex.Adapter, ex.Rule, ex.Trace = adapter, "FINAL", trace
+		if matched != nil {
+			ex.Rule = fmt.Sprintf("%s, %s", matched.Type(), matched.Payload())
+		}
+		if ex.Adapter == "" {
+			ex.Adapter = "DIRECT"
+		}
+	}
+
+	ex.PolicyPath = e.policyPath(ex.Adapter)
+	return ex, nil
+}
+
+func (e *Engine) hasPolicy(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, isProxy := e.Proxies[name]
+	_, isGroup := e.Groups[name]
+	return isProxy || isGroup
+}
+
+// policyPath follows a policy through the current selection of each group
+// down to a proxy or a built-in policy
+func (e *Engine) policyPath(name string) []PolicyHop {
+	var path []PolicyHop
+	seen := make(map[string]bool)
+	for {
+		if seen[name] {
+			path = append(path, PolicyHop{Name: name, Note: "loop between groups"})
+			return path
+		}
+		seen[name] = true
+
+		e.mu.RLock()
+		group, isGroup := e.Groups[name]
+		proxy, isProxy := e.Proxies[name]
+		e.mu.RUnlock()
+
+		switch {
+		case isProxy:
+			return append(path, PolicyHop{Name: name, Type: proxy.Type()})
+		case isGroup:
+			selected := group.Now()
+			path = append(path, PolicyHop{Name: name, Type: group.Type(), Group: true, Selected: selected})
+			if selected == "" {
+				path[len(path)-1].Note = "no member selected"
+				return path
+			}
+			name = selected
+		default:
+			// Built-in policies, and unknown names which fall back to DIRECT
+			d := e.getAdapter(name)
+			hop := PolicyHop{Name: name, Type: d.Type()}
+			if d.Name() != name {
+				hop.Note = "unknown policy, " + d.Name() + " is used"
+			}
+			return append(path, hop)
+		}
+	}
+}
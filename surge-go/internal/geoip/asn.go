@@ -0,0 +1,82 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Global ASN DB instance, separate from the country database
+var (
+	asnInstance *MaxMindDB
+	asnMu       sync.RWMutex
+)
+
+// ASNResult is the record struct for decoding a GeoLite2-ASN MMDB
+type ASNResult struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// InitASN initializes the global ASN database from a GeoLite2-ASN file
+func InitASN(path string) error {
+	asnMu.Lock()
+	defer asnMu.Unlock()
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if asnInstance != nil {
+		asnInstance.Close()
+	}
+	asnInstance = &MaxMindDB{
+		reader: reader,
+		path:   path,
+	}
+	return nil
+}
+
+// LookupASN returns the autonomous system the given IP belongs to.
+// Addresses not in the database have number 0.
+func LookupASN(ip net.IP) (ASNResult, error) {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+
+	var result ASNResult
+	if asnInstance == nil || asnInstance.reader == nil {
+		return result, errors.New("ASN database not initialized")
+	}
+	err := asnInstance.reader.Lookup(ip, &result)
+	return result, err
+}
+
+// ASNPath returns the file the ASN database was loaded from, or "" if none
+func ASNPath() string {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	if asnInstance == nil {
+		return ""
+	}
+	return asnInstance.path
+}
+
+// CloseASN closes the global ASN database
+func CloseASN() {
+	asnMu.Lock()
+	defer asnMu.Unlock()
+	if asnInstance != nil {
+		asnInstance.Close()
+		asnInstance = nil
+	}
+}
+
+// IsASNInitialized checks if the ASN DB is ready
+func IsASNInitialized() bool {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	return asnInstance != nil
+}
@@ -0,0 +1,104 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeASNTestDB writes an IPv4 MaxMind DB mapping 1.0.0.0/8 to AS13335
+func writeASNTestDB(t *testing.T) string {
+	t.Helper()
+
+	// Search tree: one node per bit of the first octet (00000001). Every node
+	// sends the off-path bit to "no data" (node count) and the on-path bit to
+	// the next node; the last one points into the data section.
+	const nodeCount = 8
+	const dataPointer = nodeCount + 16
+	var tree []byte
+	record := func(v int) { tree = append(tree, byte(v>>16), byte(v>>8), byte(v)) }
+	for i := 0; i < nodeCount-1; i++ {
+		record(i + 1) // bit 0
+		record(nodeCount)
+	}
+	record(nodeCount)
+	record(dataPointer) // last bit 1
+
+	str := func(s string) []byte {
+		if len(s) < 29 {
+			return append([]byte{0x40 | byte(len(s))}, s...)
+		}
+		return append([]byte{0x40 | 29, byte(len(s) - 29)}, s...)
+	}
+	u16 := func(v int) []byte { return []byte{0xA2, byte(v >> 8), byte(v)} }
+	u32 := func(v int) []byte { return []byte{0xC4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+	cat := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+
+	data := cat([]byte{0xE2},
+		str("autonomous_system_number"), u32(13335),
+		str("autonomous_system_organization"), str("CLOUDFLARENET"))
+
+	metadata := cat([]byte("\xab\xcd\xefMaxMind.com"), []byte{0xE8},
+		str("node_count"), u32(nodeCount),
+		str("record_size"), u16(24),
+		str("ip_version"), u16(4),
+		str("database_type"), str("GeoLite2-ASN"),
+		str("languages"), []byte{0x00, 0x04}, // empty array
+		str("binary_format_major_version"), u16(2),
+		str("binary_format_minor_version"), u16(0),
+		str("build_epoch"), []byte{0x01, 0x02, 0x01}, // uint64 1
+	)
+
+	db := cat(tree, make([]byte, 16), data, metadata)
+	path := filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	if err := os.WriteFile(path, db, 0644); err != nil {
+		t.Fatalf("failed to write test DB: %v", err)
+	}
+	return path
+}
+
+func TestLookupASN(t *testing.T) {
+	CloseASN()
+	if _, err := LookupASN(net.ParseIP("1.1.1.1")); err == nil {
+		t.Error("expected error when ASN DB not initialized")
+	}
+
+	path := writeASNTestDB(t)
+	if err := InitASN(path); err != nil {
+		t.Fatalf("InitASN: %v", err)
+	}
+	defer CloseASN()
+
+	if ASNPath() != path {
+		t.Errorf("ASNPath() = %q, want %q", ASNPath(), path)
+	}
+
+	res, err := LookupASN(net.ParseIP("1.1.1.1"))
+	if err != nil {
+		t.Fatalf("LookupASN: %v", err)
+	}
+	if res.Number != 13335 || res.Organization != "CLOUDFLARENET" {
+		t.Errorf("LookupASN(1.1.1.1) = %+v, want AS13335 CLOUDFLARENET", res)
+	}
+
+	res, err = LookupASN(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("LookupASN: %v", err)
+	}
+	if res.Number != 0 {
+		t.Errorf("LookupASN(8.8.8.8) = %+v, want no ASN", res)
+	}
+}
+
+func TestInitASN_FileNotFound(t *testing.T) {
+	if err := InitASN("non_existent_asn.mmdb"); err == nil {
+		t.Error("expected error for non-existent file, got nil")
+	}
+}
@@ -0,0 +1,264 @@
+// Package geosite loads v2ray geosite.dat domain lists
+package geosite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DomainType is how a geosite entry matches a domain
+type DomainType int
+
+// Domain types, numbered as in v2ray's routercommon.Domain.Type
+const (
+	Plain  DomainType = 0 // Keyword anywhere in the domain
+	Regex  DomainType = 1 // Regular expression
+	Suffix DomainType = 2 // The domain and its subdomains
+	Full   DomainType = 3 // Exactly the domain
+)
+
+// Domain is a single geosite entry
+type Domain struct {
+	Type       DomainType
+	Value      string
+	Attributes []string // Attribute keys, such as "cn" or "ads"
+}
+
+// HasAttribute reports whether the entry carries the attribute
+func (d Domain) HasAttribute(attr string) bool {
+	for _, a := range d.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Database holds the domain lists of a geosite.dat file by category
+type Database struct {
+	categories map[string][]Domain // Keyed by lowercased category
+}
+
+// Load reads a geosite.dat file
+func Load(path string) (*Database, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a GeoSiteList protobuf message
+func Parse(data []byte) (*Database, error) {
+	db := &Database{categories: make(map[string][]Domain)}
+	err := eachField(data, func(num int, raw []byte) error {
+		if num != 1 { // GeoSiteList.entry
+			return nil
+		}
+		code, domains, err := parseGeoSite(raw)
+		if err != nil {
+			return err
+		}
+		key := strings.ToLower(code)
+		db.categories[key] = append(db.categories[key], domains...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid geosite data: %v", err)
+	}
+	return db, nil
+}
+
+// Domains returns the entries of a category. "category@attr" keeps only the
+// entries carrying the attribute, as in v2ray.
+func (db *Database) Domains(category string) ([]Domain, bool) {
+	name, attr, filtered := strings.Cut(strings.ToLower(strings.TrimSpace(category)), "@")
+	domains, ok := db.categories[name]
+	if !ok || !filtered {
+		return domains, ok
+	}
+
+	var out []Domain
+	for _, d := range domains {
+		if d.HasAttribute(attr) {
+			out = append(out, d)
+		}
+	}
+	return out, true
+}
+
+// Categories returns the category names, sorted
+func (db *Database) Categories() []string {
+	names := make([]string, 0, len(db.categories))
+	for name := range db.categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseGeoSite decodes a GeoSite message: country_code = 1, domain = 2
+func parseGeoSite(data []byte) (string, []Domain, error) {
+	var code string
+	var domains []Domain
+	err := eachField(data, func(num int, raw []byte) error {
+		switch num {
+		case 1:
+			code = string(raw)
+		case 2:
+			d, err := parseDomain(raw)
+			if err != nil {
+				return err
+			}
+			domains = append(domains, d)
+		}
+		return nil
+	})
+	return code, domains, err
+}
+
+// parseDomain decodes a Domain message: type = 1, value = 2, attribute = 3
+func parseDomain(data []byte) (Domain, error) {
+	var d Domain
+	err := eachField(data, func(num int, raw []byte) error {
+		switch num {
+		case 1:
+			v, _, err := readVarint(raw)
+			d.Type = DomainType(v)
+			return err
+		case 2:
+			d.Value = string(raw)
+		case 3:
+			// Attribute: key = 1, followed by a bool or int value we do not need
+			return eachField(raw, func(num int, raw []byte) error {
+				if num == 1 {
+					d.Attributes = append(d.Attributes, string(raw))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return d, err
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated message")
+
+// eachField calls fn with the number and raw value of every field of a protobuf
+// message. Varint values are passed still encoded; fixed-size ones as their bytes.
+func eachField(data []byte, fn func(num int, raw []byte) error) error {
+	for len(data) > 0 {
+		tag, n, err := readVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		num := int(tag >> 3)
+
+		var size int
+		switch tag & 7 {
+		case wireVarint:
+			_, size, err = readVarint(data)
+			if err != nil {
+				return err
+			}
+		case wireFixed64:
+			size = 8
+		case wireFixed32:
+			size = 4
+		case wireBytes:
+			l, n, err := readVarint(data)
+			if err != nil {
+				return err
+			}
+			data = data[n:]
+			if l > uint64(len(data)) {
+				return errTruncated
+			}
+			size = int(l)
+		default:
+			return fmt.Errorf("unsupported wire type %d", tag&7)
+		}
+		if size > len(data) {
+			return errTruncated
+		}
+		if err := fn(num, data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// readVarint decodes a varint and returns its length
+func readVarint(data []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		b := data[i]
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+// Global DB instance
+var (
+	instance     *Database
+	instancePath string
+	mu           sync.RWMutex
+)
+
+// Init loads the global geosite database
+func Init(path string) error {
+	db, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	instance, instancePath = db, path
+	return nil
+}
+
+// Default returns the global database, or nil if none is loaded
+func Default() *Database {
+	mu.RLock()
+	defer mu.RUnlock()
+	return instance
+}
+
+// Path returns the file the global database was loaded from, or "" if none
+func Path() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return instancePath
+}
+
+// Close unloads the global database
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	instance, instancePath = nil, ""
+}
+
+// IsInitialized checks if the global database is loaded
+func IsInitialized() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return instance != nil
+}
@@ -0,0 +1,132 @@
+package geosite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Minimal protobuf encoding for test data
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = appendVarint(b, uint64(num)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func encodeDomain(t DomainType, value string, attrs ...string) []byte {
+	b := appendVarint(nil, 1<<3|wireVarint)
+	b = appendVarint(b, uint64(t))
+	b = appendBytes(b, 2, []byte(value))
+	for _, a := range attrs {
+		attr := appendBytes(nil, 1, []byte(a))
+		attr = appendVarint(attr, 2<<3|wireVarint) // bool_value = true
+		attr = appendVarint(attr, 1)
+		b = appendBytes(b, 3, attr)
+	}
+	return b
+}
+
+func encodeSite(code string, domains ...[]byte) []byte {
+	b := appendBytes(nil, 1, []byte(code))
+	for _, d := range domains {
+		b = appendBytes(b, 2, d)
+	}
+	return b
+}
+
+func testData() []byte {
+	var list []byte
+	list = appendBytes(list, 1, encodeSite("NETFLIX",
+		encodeDomain(Suffix, "netflix.com"),
+		encodeDomain(Full, "fast.com"),
+		encodeDomain(Plain, "nflxvideo"),
+		encodeDomain(Regex, `^netflix\d+\.net$`),
+	))
+	list = appendBytes(list, 1, encodeSite("GOOGLE",
+		encodeDomain(Suffix, "google.com"),
+		encodeDomain(Suffix, "google.cn", "cn"),
+	))
+	return list
+}
+
+func TestParse(t *testing.T) {
+	db, err := Parse(testData())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if got := db.Categories(); len(got) != 2 || got[0] != "google" || got[1] != "netflix" {
+		t.Errorf("Categories() = %v", got)
+	}
+
+	domains, ok := db.Domains("Netflix")
+	if !ok || len(domains) != 4 {
+		t.Fatalf("Domains(Netflix) = %v, %v", domains, ok)
+	}
+	want := []Domain{
+		{Type: Suffix, Value: "netflix.com"},
+		{Type: Full, Value: "fast.com"},
+		{Type: Plain, Value: "nflxvideo"},
+		{Type: Regex, Value: `^netflix\d+\.net$`},
+	}
+	for i, d := range domains {
+		if d.Type != want[i].Type || d.Value != want[i].Value {
+			t.Errorf("domain %d = %+v, want %+v", i, d, want[i])
+		}
+	}
+
+	cn, ok := db.Domains("google@cn")
+	if !ok || len(cn) != 1 || cn[0].Value != "google.cn" {
+		t.Errorf("Domains(google@cn) = %v, %v", cn, ok)
+	}
+
+	if _, ok := db.Domains("unknown"); ok {
+		t.Error("unknown category should not be found")
+	}
+}
+
+func TestParse_Truncated(t *testing.T) {
+	data := testData()
+	if _, err := Parse(data[:len(data)-3]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
+
+func TestInit(t *testing.T) {
+	Close()
+	if IsInitialized() {
+		t.Fatal("database should not be loaded")
+	}
+
+	path := filepath.Join(t.TempDir(), "geosite.dat")
+	if err := os.WriteFile(path, testData(), 0644); err != nil {
+		t.Fatalf("failed to write test data: %v", err)
+	}
+	if err := Init(path); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer Close()
+
+	if !IsInitialized() || Path() != path {
+		t.Errorf("database not loaded from %s", path)
+	}
+	if _, ok := Default().Domains("netflix"); !ok {
+		t.Error("netflix category missing")
+	}
+
+	if err := Init(filepath.Join(t.TempDir(), "missing.dat")); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if Path() != path {
+		t.Error("failed Init must keep the loaded database")
+	}
+}
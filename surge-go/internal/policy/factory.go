@@ -67,11 +67,27 @@ func NewGroupFromConfig(cfg *config.ProxyGroupConfig, resolver ProxyResolver, al
 		g = NewRelayGroup(cfg.Name, proxies, resolver)
 	case "smart":
 		g = NewSmartGroup(cfg.Name, proxies, resolver, cfg.URL, cfg.Interval, cfg.EvaluateBeforeUse)
+	case "load-balance":
+		g, err = NewLoadBalanceGroup(cfg.Name, proxies, resolver, cfg.URL, cfg.Interval, cfg.Strategy)
+		if err != nil {
+			return nil, err
+		}
+	case "subnet":
+		g, err = NewSubnetGroup(cfg.Name, cfg.Default, cfg.Conditions, resolver, cfg.Interval, true)
+		if err != nil {
+			return nil, err
+		}
 	// case "fallback": ...
 	default:
 		return nil, fmt.Errorf("unsupported group type: %s", cfg.Type)
 	}
 
+	if cfg.Lazy {
+		if lg, ok := g.(interface{ SetLazy(bool) }); ok {
+			lg.SetLazy(true)
+		}
+	}
+
 	// Set the filter on the group instance so future updates are also filtered
 	if cfg.PolicyRegex != "" {
 		if fg, ok := g.(FilterableGroup); ok {
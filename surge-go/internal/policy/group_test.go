@@ -134,3 +134,81 @@ func TestURLTestGroup(t *testing.T) {
 		t.Errorf("should switch to NewBest. Got %s", gWithTol.Now())
 	}
 }
+
+func TestSelectGroup_SelectionObserver(t *testing.T) {
+	g := NewSelectGroup("Proxy", []string{"A", "B"}, nil, "")
+
+	var got string
+	g.SetSelectionObserver(func(group, selected string) {
+		got = group + "=" + selected
+	})
+
+	if err := g.SetCurrent("B"); err != nil {
+		t.Fatalf("SetCurrent failed: %v", err)
+	}
+	if got != "Proxy=B" {
+		t.Errorf("observer got %q, want Proxy=B", got)
+	}
+
+	// Restoring persisted state must not be reported back as a change
+	got = ""
+	if !g.RestoreSelection("A") || g.Now() != "A" {
+		t.Errorf("RestoreSelection should apply member A, now %s", g.Now())
+	}
+	if g.RestoreSelection("C") {
+		t.Error("RestoreSelection should reject non-members")
+	}
+	if got != "" {
+		t.Errorf("restore should not notify, got %q", got)
+	}
+}
+
+func TestGroups_SkipUnavailableMembers(t *testing.T) {
+	proxies := map[string]protocol.Dialer{
+		"Fast": &MockDialer{NameVal: "Fast", LatencyMs: 20},
+		"Slow": &MockDialer{NameVal: "Slow", LatencyMs: 200},
+	}
+	resolver := func(name string) protocol.Dialer {
+		return proxies[name]
+	}
+	exhausted := map[string]bool{}
+	available := func(name string) bool { return !exhausted[name] }
+
+	g := NewURLTestGroup("AutoQuota", []string{"Fast", "Slow"}, resolver, "http://test.com", 0, 0)
+	g.SetAvailability(available)
+	g.Retest()
+	if g.Now() != "Fast" {
+		t.Fatalf("expected Fast, got %s", g.Now())
+	}
+
+	// Fast runs out of quota: the next dial switches away without waiting for a probe round
+	exhausted["Fast"] = true
+	if _, err := g.DialContext(context.Background(), "tcp", "example.com:443"); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	if g.Now() != "Slow" {
+		t.Errorf("expected switch to Slow, got %s", g.Now())
+	}
+	g.Retest()
+	if g.Now() != "Slow" {
+		t.Errorf("retest should not pick the exhausted member, got %s", g.Now())
+	}
+
+	// Manually selected members are refused so the dial falls back elsewhere
+	sg := NewSelectGroup("Manual", []string{"Fast", "Slow"}, resolver, "Fast")
+	sg.SetAvailability(available)
+	if _, err := sg.DialContext(context.Background(), "tcp", "example.com:443"); err == nil {
+		t.Error("dialing an unavailable member should fail")
+	}
+
+	lb, _ := NewLoadBalanceGroup("LBQuota", []string{"Fast", "Slow"}, resolver, "http://test.com", 0, StrategyConsistentHashing)
+	lb.SetAvailability(available)
+	for _, host := range []string{"a.com:443", "b.com:443", "c.com:443", "d.com:443"} {
+		if _, err := lb.DialContext(context.Background(), "tcp", host); err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		if lb.Now() == "Fast" {
+			t.Fatal("load balancing should skip the exhausted member")
+		}
+	}
+}
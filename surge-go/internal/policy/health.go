@@ -0,0 +1,316 @@
+package policy
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ewmaAlpha weights the newest sample in latency and success rate averages
+	ewmaAlpha = 0.3
+	// failThreshold is the number of consecutive real-traffic failures that demotes a member
+	failThreshold = 3
+	// failurePenaltyMs is the score penalty of a failure that just happened
+	failurePenaltyMs = 2000.0
+	// failureDecay is how long it takes a failure penalty to decay to ~37%
+	failureDecay = 60 * time.Second
+	// demoteWindow is how long a demoted member stays out of rotation without new failures
+	demoteWindow = 5 * time.Minute
+	// unknownLatencyMs is assumed for members without any latency sample
+	unknownLatencyMs = 9999.0
+)
+
+// MemberHealth is a snapshot of a group member's health, from probes and real traffic
+type MemberHealth struct {
+	Name                string    `json:"name"`
+	ProbeLatency        float64   `json:"probe_latency"` // EWMA of probe latency (ms)
+	DialLatency         float64   `json:"dial_latency"`  // EWMA of real dial latency (ms)
+	ProbeAlive          bool      `json:"probe_alive"`
+	Successes           uint64    `json:"successes"`
+	Failures            uint64    `json:"failures"`
+	SuccessRate         float64   `json:"success_rate"` // EWMA of real traffic outcomes, 0..1
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastProbe           time.Time `json:"last_probe"`
+	Demoted             bool      `json:"demoted"`
+	Score               float64   `json:"score"` // Lower is better
+}
+
+// HealthReporter is implemented by groups that track member health
+type HealthReporter interface {
+	HealthStats() []MemberHealth
+}
+
+type memberHealth struct {
+	probeLatency float64
+	dialLatency  float64
+	probed       bool
+	probeAlive   bool
+	successes    uint64
+	failures     uint64
+	successRate  float64
+	consecutive  int
+	lastFailure  time.Time
+	lastSuccess  time.Time
+	lastProbe    time.Time
+}
+
+// HealthTracker keeps passive and active health statistics for group members
+type HealthTracker struct {
+	mu      sync.RWMutex
+	members map[string]*memberHealth
+	now     func() time.Time
+}
+
+// NewHealthTracker creates an empty HealthTracker
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{
+		members: make(map[string]*memberHealth),
+		now:     time.Now,
+	}
+}
+
+func (t *HealthTracker) get(name string) *memberHealth {
+	m, ok := t.members[name]
+	if !ok {
+		m = &memberHealth{successRate: 1}
+		t.members[name] = m
+	}
+	return m
+}
+
+func ewma(prev, sample float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return ewmaAlpha*sample + (1-ewmaAlpha)*prev
+}
+
+// RecordProbe records the result of a synthetic latency test
+func (t *HealthTracker) RecordProbe(name string, latency int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := t.get(name)
+	m.lastProbe = t.now()
+	m.probeAlive = err == nil
+	if err == nil {
+		m.probeLatency = ewma(m.probeLatency, float64(latency), !m.probed)
+		m.probed = true
+	}
+}
+
+// RecordDial records the outcome of a real dial through the member
+func (t *HealthTracker) RecordDial(name string, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := t.get(name)
+	if err != nil {
+		t.recordFailureLocked(m)
+		return
+	}
+	m.dialLatency = ewma(m.dialLatency, float64(latency.Milliseconds()), m.successes == 0)
+	m.successes++
+	m.successRate = ewma(m.successRate, 1, false)
+	m.consecutive = 0
+	m.lastSuccess = t.now()
+}
+
+// RecordConnError records a failure observed on an established connection
+func (t *HealthTracker) RecordConnError(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordFailureLocked(t.get(name))
+}
+
+func (t *HealthTracker) recordFailureLocked(m *memberHealth) {
+	m.failures++
+	m.successRate = ewma(m.successRate, 0, false)
+	m.consecutive++
+	m.lastFailure = t.now()
+}
+
+// Forget drops statistics of members no longer in the group
+func (t *HealthTracker) Forget(keep []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	set := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		set[k] = true
+	}
+	for name := range t.members {
+		if !set[name] {
+			delete(t.members, name)
+		}
+	}
+}
+
+// IsDemoted reports whether real traffic through the member keeps failing
+func (t *HealthTracker) IsDemoted(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	m, ok := t.members[name]
+	if !ok {
+		return false
+	}
+	return t.demotedLocked(m)
+}
+
+func (t *HealthTracker) demotedLocked(m *memberHealth) bool {
+	return m.consecutive >= failThreshold && t.now().Sub(m.lastFailure) < demoteWindow
+}
+
+// Latency returns the best known latency estimate for the member in ms
+func (t *HealthTracker) Latency(name string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	m, ok := t.members[name]
+	if !ok {
+		return unknownLatencyMs
+	}
+	return latencyLocked(m)
+}
+
+func latencyLocked(m *memberHealth) float64 {
+	if m.probed && m.probeAlive {
+		return m.probeLatency
+	}
+	if m.probed && !m.probeAlive {
+		return unknownLatencyMs
+	}
+	if m.successes > 0 {
+		return m.dialLatency
+	}
+	return unknownLatencyMs
+}
+
+// Score combines latency, success rate and recent failures. Lower is better.
+func (t *HealthTracker) Score(name string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	m, ok := t.members[name]
+	if !ok {
+		return unknownLatencyMs
+	}
+	return t.scoreLocked(m)
+}
+
+func (t *HealthTracker) scoreLocked(m *memberHealth) float64 {
+	score := latencyLocked(m)
+	// Failure rate penalty: a member failing half of its connections costs +1000ms
+	score += (1 - m.successRate) * 2 * 1000
+	// Recent failure penalty, decaying exponentially with the age of the last failure
+	if m.consecutive > 0 {
+		age := t.now().Sub(m.lastFailure)
+		score += failurePenaltyMs * float64(m.consecutive) * math.Exp(-float64(age)/float64(failureDecay))
+	}
+	return score
+}
+
+// Best returns the member with the lowest score, preferring members that are not demoted.
+// It returns "" if candidates is empty.
+func (t *HealthTracker) Best(candidates []string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	best, bestScore := "", math.MaxFloat64
+	bestDemoted := true
+	for _, name := range candidates {
+		m, ok := t.members[name]
+		score, demoted := unknownLatencyMs, false
+		if ok {
+			score, demoted = t.scoreLocked(m), t.demotedLocked(m)
+		}
+		if best == "" || (bestDemoted && !demoted) || (demoted == bestDemoted && score < bestScore) {
+			best, bestScore, bestDemoted = name, score, demoted
+		}
+	}
+	return best
+}
+
+// Snapshot returns the statistics of the given members, in order
+func (t *HealthTracker) Snapshot(names []string) []MemberHealth {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]MemberHealth, 0, len(names))
+	for _, name := range names {
+		h := MemberHealth{Name: name, SuccessRate: 1, Score: unknownLatencyMs}
+		if m, ok := t.members[name]; ok {
+			h.ProbeLatency = m.probeLatency
+			h.DialLatency = m.dialLatency
+			h.ProbeAlive = m.probeAlive
+			h.Successes = m.successes
+			h.Failures = m.failures
+			h.SuccessRate = m.successRate
+			h.ConsecutiveFailures = m.consecutive
+			h.LastFailure = m.lastFailure
+			h.LastSuccess = m.lastSuccess
+			h.LastProbe = m.lastProbe
+			h.Demoted = t.demotedLocked(m)
+			h.Score = t.scoreLocked(m)
+		}
+		list = append(list, h)
+	}
+	return list
+}
+
+// healthConn reports connection-level failures of a member back to its tracker.
+// A read or write error before any data arrived means the member could not
+// actually reach the target, even though the dial succeeded.
+type healthConn struct {
+	net.Conn
+	name     string
+	tracker  *HealthTracker
+	onFail   func()
+	received atomic.Bool
+	reported atomic.Bool
+}
+
+func newHealthConn(conn net.Conn, name string, tracker *HealthTracker, onFail func()) net.Conn {
+	return &healthConn{Conn: conn, name: name, tracker: tracker, onFail: onFail}
+}
+
+func (c *healthConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.Store(true)
+	}
+	if err != nil {
+		c.check(err)
+	}
+	return n, err
+}
+
+func (c *healthConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		c.check(err)
+	}
+	return n, err
+}
+
+func (c *healthConn) check(err error) {
+	if c.received.Load() || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return
+	}
+	// Deadlines are set by the relay code itself, not a member failure
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return
+	}
+	if c.reported.CompareAndSwap(false, true) {
+		c.tracker.RecordConnError(c.name)
+		if c.onFail != nil {
+			c.onFail()
+		}
+	}
+}
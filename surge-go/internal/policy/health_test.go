@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+// probeOnlyDialer passes latency tests but fails real dials, like a node whose
+// generate_204 endpoint works while real destinations are blocked
+type probeOnlyDialer struct {
+	MockDialer
+}
+
+func (d *probeOnlyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("connection reset")
+}
+
+// resetConn fails the first read, as a proxy dropping the tunnel would
+type resetConn struct {
+	net.Conn
+}
+
+func (c *resetConn) Read(b []byte) (int, error) {
+	return 0, errors.New("read: connection reset by peer")
+}
+
+func TestURLTestGroup_DemotesOnRealFailures(t *testing.T) {
+	proxies := map[string]protocol.Dialer{
+		"Fast":   &probeOnlyDialer{MockDialer{NameVal: "Fast", LatencyMs: 20}},
+		"Backup": &MockDialer{NameVal: "Backup", LatencyMs: 150},
+	}
+	resolver := func(name string) protocol.Dialer {
+		return proxies[name]
+	}
+
+	g := NewURLTestGroup("Auto", []string{"Backup", "Fast"}, resolver, "http://test.com", 0, 0)
+	g.Retest()
+	if g.Now() != "Fast" {
+		t.Fatalf("probe should pick Fast, got %s", g.Now())
+	}
+
+	for i := 0; i < failThreshold; i++ {
+		if _, err := g.DialContext(context.Background(), "tcp", "example.com:443"); err == nil {
+			t.Fatal("expected dial through Fast to fail")
+		}
+	}
+	if g.Now() != "Backup" {
+		t.Errorf("should demote Fast after %d failures, got %s", failThreshold, g.Now())
+	}
+
+	// The next probe round must not bring the demoted member back
+	g.Retest()
+	if g.Now() != "Backup" {
+		t.Errorf("demoted member came back after probe: %s", g.Now())
+	}
+
+	var fast MemberHealth
+	for _, m := range g.HealthStats() {
+		if m.Name == "Fast" {
+			fast = m
+		}
+	}
+	if !fast.Demoted || fast.Failures != failThreshold || !fast.ProbeAlive {
+		t.Errorf("unexpected stats for Fast: %+v", fast)
+	}
+}
+
+func TestHealthTracker_DemotionExpires(t *testing.T) {
+	tr := NewHealthTracker()
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+
+	for i := 0; i < failThreshold; i++ {
+		tr.RecordDial("A", 0, errors.New("fail"))
+	}
+	if !tr.IsDemoted("A") {
+		t.Fatal("A should be demoted")
+	}
+
+	now = now.Add(demoteWindow + time.Second)
+	if tr.IsDemoted("A") {
+		t.Error("demotion should expire after the window")
+	}
+
+	tr.RecordDial("A", 30*time.Millisecond, nil)
+	if got := tr.Snapshot([]string{"A"})[0]; got.ConsecutiveFailures != 0 || got.DialLatency != 30 {
+		t.Errorf("success should reset failures and record latency: %+v", got)
+	}
+}
+
+func TestHealthConn_ReportsConnectionErrors(t *testing.T) {
+	tr := NewHealthTracker()
+	failed := 0
+	conn := newHealthConn(&resetConn{}, "A", tr, func() { failed++ })
+
+	buf := make([]byte, 16)
+	conn.Read(buf)
+	conn.Read(buf)
+
+	if failed != 1 {
+		t.Errorf("failure callback should fire once, got %d", failed)
+	}
+	if got := tr.Snapshot([]string{"A"})[0]; got.Failures != 1 {
+		t.Errorf("expected 1 recorded failure, got %d", got.Failures)
+	}
+}
@@ -0,0 +1,265 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+// Load balancing strategies
+const (
+	StrategyRoundRobin        = "round-robin"
+	StrategyRandom            = "random"
+	StrategyConsistentHashing = "consistent-hashing" // keyed on destination host
+	StrategyStickySessions    = "sticky-sessions"    // keyed on source IP
+)
+
+// virtualNodes is the number of points each member occupies on the hash ring
+const virtualNodes = 100
+
+// LoadBalanceGroup spreads connections across its members
+type LoadBalanceGroup struct {
+	BaseGroup
+	URL      string
+	Interval time.Duration
+	Strategy string
+
+	current  string          // Last chosen member
+	alive    map[string]bool // Health check results; members missing from the map are assumed alive
+	ring     []ringNode      // Hash ring over the alive members, rebuilt when health changes
+	counter  uint32
+	mu       sync.RWMutex
+	stopChan chan struct{}
+}
+
+type ringNode struct {
+	hash uint32
+	name string
+}
+
+// NewLoadBalanceGroup creates a new LoadBalanceGroup
+func NewLoadBalanceGroup(name string, proxies []string, resolver ProxyResolver, url string, interval int, strategy string) (*LoadBalanceGroup, error) {
+	switch strategy {
+	case "":
+		strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyRandom, StrategyConsistentHashing, StrategyStickySessions:
+	default:
+		return nil, fmt.Errorf("unsupported load-balance strategy: %s", strategy)
+	}
+
+	g := &LoadBalanceGroup{
+		BaseGroup: BaseGroup{
+			NameStr:     name,
+			TypeStr:     "load-balance",
+			ProxiesList: proxies,
+			Resolver:    resolver,
+		},
+		URL:      url,
+		Interval: time.Duration(interval) * time.Second,
+		Strategy: strategy,
+		alive:    make(map[string]bool),
+		stopChan: make(chan struct{}),
+	}
+	g.rebuildRing()
+
+	if interval > 0 {
+		go g.startLoop()
+	}
+
+	return g, nil
+}
+
+func (g *LoadBalanceGroup) UpdateProxies(proxies []string, localProxies map[string]protocol.Dialer) {
+	g.mu.Lock()
+
+	// Apply filter
+	proxies = g.FilterProxies(proxies)
+
+	g.ProxiesList = proxies
+	g.LocalProxies = localProxies
+
+	// Drop health state of removed members
+	keep := make(map[string]bool, len(proxies))
+	for _, p := range proxies {
+		keep[p] = true
+	}
+	for name := range g.alive {
+		if !keep[name] {
+			delete(g.alive, name)
+		}
+	}
+	if !keep[g.current] {
+		g.current = ""
+	}
+	g.rebuildRing()
+	g.mu.Unlock()
+
+	go g.Retest()
+}
+
+// DialContext implements protocol.Dialer
+func (g *LoadBalanceGroup) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	target := g.pick(ctx, address)
+	if target == "" {
+		return nil, fmt.Errorf("no proxy available in group %s", g.Name())
+	}
+	if g.use.touch(g.Interval) {
+		go g.Retest()
+	}
+
+	g.mu.Lock()
+	g.current = target
+	g.mu.Unlock()
+
+	return g.SafeDial(ctx, network, address, target)
+}
+
+// pick chooses a member for the connection according to the strategy
+func (g *LoadBalanceGroup) pick(ctx context.Context, address string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	candidates := g.availableLocked()
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	switch g.Strategy {
+	case StrategyRandom:
+		return candidates[rand.Intn(len(candidates))]
+	case StrategyConsistentHashing:
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		return g.lookupRingLocked(host)
+	case StrategyStickySessions:
+		src := protocol.SourceIPFromContext(ctx)
+		if src == "" {
+			// Without a source address every connection would land on the same node
+			return candidates[rand.Intn(len(candidates))]
+		}
+		return g.lookupRingLocked(src)
+	default:
+		n := atomic.AddUint32(&g.counter, 1)
+		return candidates[int(n-1)%len(candidates)]
+	}
+}
+
+// availableLocked returns the available members that passed their last health check.
+// If every available member failed, all of them are returned so traffic is not blackholed.
+func (g *LoadBalanceGroup) availableLocked() []string {
+	members := g.availableMembers(g.ProxiesList)
+	var alive []string
+	for _, p := range members {
+		if ok, tested := g.alive[p]; !tested || ok {
+			alive = append(alive, p)
+		}
+	}
+	if len(alive) == 0 {
+		return members
+	}
+	return alive
+}
+
+// rebuildRing recomputes the hash ring. Caller must hold g.mu.
+func (g *LoadBalanceGroup) rebuildRing() {
+	members := g.availableLocked()
+	ring := make([]ringNode, 0, len(members)*virtualNodes)
+	for _, name := range members {
+		for i := 0; i < virtualNodes; i++ {
+			ring = append(ring, ringNode{hash: hashKey(name + "#" + strconv.Itoa(i)), name: name})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	g.ring = ring
+}
+
+func (g *LoadBalanceGroup) lookupRingLocked(key string) string {
+	if len(g.ring) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	idx := sort.Search(len(g.ring), func(i int) bool { return g.ring[i].hash >= h })
+	// Members that became unavailable since the ring was built hand over to the next node
+	for i := 0; i < len(g.ring); i++ {
+		node := g.ring[(idx+i)%len(g.ring)]
+		if g.available(node.name) {
+			return node.name
+		}
+	}
+	return ""
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// Now returns the last chosen member
+func (g *LoadBalanceGroup) Now() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.current
+}
+
+func (g *LoadBalanceGroup) startLoop() {
+	// Initial check so dead members are skipped from the start
+	if g.use.shouldCheck(g.Interval) {
+		g.Retest()
+	}
+
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if g.use.shouldCheck(g.Interval) {
+				g.Retest()
+			}
+		case <-g.stopChan:
+			return
+		}
+	}
+}
+
+// Retest health checks all members and updates the alive set
+func (g *LoadBalanceGroup) Retest() {
+	if g.Resolver == nil {
+		return
+	}
+	g.use.tested()
+
+	g.mu.RLock()
+	proxies := make([]string, len(g.ProxiesList))
+	copy(proxies, g.ProxiesList)
+	g.mu.RUnlock()
+
+	results := DefaultHealthChecker.ProbeAll(g.NameStr, proxies, g.Resolver, g.URL)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, res := range results {
+		g.alive[res.Name] = res.Err == nil
+		if res.Fresh {
+			g.notifyProbe(res.Name, res.Latency, res.Err)
+		}
+	}
+	g.rebuildRing()
+}
+
+func (g *LoadBalanceGroup) Close() error {
+	close(g.stopChan)
+	return nil
+}
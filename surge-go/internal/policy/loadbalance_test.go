@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+func newLBProxies() (map[string]protocol.Dialer, ProxyResolver) {
+	proxies := map[string]protocol.Dialer{
+		"A": &MockDialer{NameVal: "A", LatencyMs: 10},
+		"B": &MockDialer{NameVal: "B", LatencyMs: 10},
+		"C": &MockDialer{NameVal: "C", LatencyMs: 10},
+	}
+	resolver := func(name string) protocol.Dialer {
+		return proxies[name]
+	}
+	return proxies, resolver
+}
+
+func TestLoadBalanceGroup_RoundRobin(t *testing.T) {
+	_, resolver := newLBProxies()
+	g, err := NewLoadBalanceGroup("LB", []string{"A", "B", "C"}, resolver, "http://test.com", 0, "")
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		if _, err := g.DialContext(context.Background(), "tcp", "example.com:443"); err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		got = append(got, g.Now())
+	}
+
+	want := []string{"A", "B", "C", "A", "B", "C"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("round-robin order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLoadBalanceGroup_SkipsDeadMembers(t *testing.T) {
+	proxies, resolver := newLBProxies()
+	proxies["B"].(*MockDialer).Fail = true
+
+	g, _ := NewLoadBalanceGroup("LB", []string{"A", "B", "C"}, resolver, "http://test.com", 0, StrategyRoundRobin)
+	g.Retest()
+
+	for i := 0; i < 6; i++ {
+		g.DialContext(context.Background(), "tcp", "example.com:443")
+		if g.Now() == "B" {
+			t.Fatal("dead member B should be skipped")
+		}
+	}
+}
+
+func TestLoadBalanceGroup_ConsistentHashing(t *testing.T) {
+	proxies, resolver := newLBProxies()
+	g, _ := NewLoadBalanceGroup("LB", []string{"A", "B", "C"}, resolver, "http://test.com", 0, StrategyConsistentHashing)
+
+	g.DialContext(context.Background(), "tcp", "example.com:443")
+	first := g.Now()
+	for i := 0; i < 5; i++ {
+		g.DialContext(context.Background(), "tcp", "example.com:80")
+		if g.Now() != first {
+			t.Fatalf("same host should map to %s, got %s", first, g.Now())
+		}
+	}
+
+	// Removing another member must not move the host
+	for name := range proxies {
+		if name != first {
+			proxies[name].(*MockDialer).Fail = true
+			break
+		}
+	}
+	g.Retest()
+	g.DialContext(context.Background(), "tcp", "example.com:443")
+	if g.Now() != first {
+		t.Errorf("host moved from %s to %s after unrelated member died", first, g.Now())
+	}
+}
+
+func TestLoadBalanceGroup_StickySessions(t *testing.T) {
+	_, resolver := newLBProxies()
+	g, _ := NewLoadBalanceGroup("LB", []string{"A", "B", "C"}, resolver, "http://test.com", 0, StrategyStickySessions)
+
+	ctx := protocol.WithSourceAddr(context.Background(), "192.168.1.20:51234")
+	g.DialContext(ctx, "tcp", "a.com:443")
+	first := g.Now()
+
+	ctx = protocol.WithSourceAddr(context.Background(), "192.168.1.20:51999")
+	for _, target := range []string{"b.com:443", "c.com:80", "d.com:443"} {
+		g.DialContext(ctx, "tcp", target)
+		if g.Now() != first {
+			t.Fatalf("source should stick to %s, got %s", first, g.Now())
+		}
+	}
+}
+
+func TestLoadBalanceGroup_InvalidStrategy(t *testing.T) {
+	if _, err := NewLoadBalanceGroup("LB", []string{"A"}, nil, "", 0, "fastest"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
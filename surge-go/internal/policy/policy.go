@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"sync/atomic"
 	"time"
 
 	"github.com/surge-proxy/surge-go/internal/protocol"
@@ -30,6 +31,38 @@ type UpdatableGroup interface {
 	UpdateProxies(proxies []string, localProxies map[string]protocol.Dialer)
 }
 
+// ProbeObserver receives the result of every member latency test run by a group
+type ProbeObserver func(group, member string, latency int, err error)
+
+// ProbeObservable is implemented by groups that report their member probes
+type ProbeObservable interface {
+	SetProbeObserver(fn ProbeObserver)
+}
+
+// SelectionObserver is notified when a group switches to another member
+type SelectionObserver func(group, selected string)
+
+// SelectionObservable is implemented by groups that report selection changes
+type SelectionObservable interface {
+	SetSelectionObserver(fn SelectionObserver)
+}
+
+// SelectionRestorer is implemented by groups whose selection can be restored
+// from persisted state. It reports whether the selection was applied.
+type SelectionRestorer interface {
+	RestoreSelection(name string) bool
+}
+
+// AvailabilityFunc reports whether a member may be used, e.g. because it has
+// traffic quota left. Unavailable members are skipped by automatic groups and
+// refused by SafeDial.
+type AvailabilityFunc func(member string) bool
+
+// AvailabilityAware is implemented by groups that honour member availability
+type AvailabilityAware interface {
+	SetAvailability(fn AvailabilityFunc)
+}
+
 // BaseGroup provides common fields for policy groups
 type BaseGroup struct {
 	NameStr      string
@@ -38,6 +71,11 @@ type BaseGroup struct {
 	LocalProxies map[string]protocol.Dialer
 	Resolver     ProxyResolver
 	FilterRegex  *regexp.Regexp
+
+	observer    atomic.Pointer[ProbeObserver]
+	selObserver atomic.Pointer[SelectionObserver]
+	availableFn atomic.Pointer[AvailabilityFunc]
+	use         usage
 }
 
 func (g *BaseGroup) Name() string {
@@ -81,6 +119,78 @@ func (g *BaseGroup) FilterProxies(proxies []string) []string {
 	return filtered
 }
 
+// SetLazy enables lazy health checking: periodic probes are skipped while the group is unused
+func (g *BaseGroup) SetLazy(lazy bool) {
+	g.use.mu.Lock()
+	defer g.use.mu.Unlock()
+	g.use.lazy = lazy
+}
+
+// SetProbeObserver registers fn to receive the group's member probe results
+func (g *BaseGroup) SetProbeObserver(fn ProbeObserver) {
+	if fn == nil {
+		g.observer.Store(nil)
+		return
+	}
+	g.observer.Store(&fn)
+}
+
+// notifyProbe forwards a member probe result to the registered observer
+func (g *BaseGroup) notifyProbe(member string, latency int, err error) {
+	if fn := g.observer.Load(); fn != nil {
+		(*fn)(g.NameStr, member, latency, err)
+	}
+}
+
+// SetSelectionObserver registers fn to be notified of selection changes
+func (g *BaseGroup) SetSelectionObserver(fn SelectionObserver) {
+	if fn == nil {
+		g.selObserver.Store(nil)
+		return
+	}
+	g.selObserver.Store(&fn)
+}
+
+// notifySelection forwards a selection change to the registered observer.
+// Callers must not hold the group lock.
+func (g *BaseGroup) notifySelection(selected string) {
+	if fn := g.selObserver.Load(); fn != nil {
+		(*fn)(g.NameStr, selected)
+	}
+}
+
+// SetAvailability registers fn to decide which members may be used
+func (g *BaseGroup) SetAvailability(fn AvailabilityFunc) {
+	if fn == nil {
+		g.availableFn.Store(nil)
+		return
+	}
+	g.availableFn.Store(&fn)
+}
+
+// available reports whether the member may be used. Members are available
+// unless the registered AvailabilityFunc says otherwise.
+func (g *BaseGroup) available(member string) bool {
+	if fn := g.availableFn.Load(); fn != nil {
+		return (*fn)(member)
+	}
+	return true
+}
+
+// availableMembers returns the members of list that may be used
+func (g *BaseGroup) availableMembers(list []string) []string {
+	if g.availableFn.Load() == nil {
+		return list
+	}
+	var out []string
+	for _, p := range list {
+		if g.available(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func (g *BaseGroup) Close() error {
 	return nil
 }
@@ -93,11 +203,14 @@ func (g *BaseGroup) SafeDial(ctx context.Context, network, address, childName st
 		// But ideally we resolve "DIRECT" from the resolver if it's there.
 		// If resolver returns nil, we fallback.
 		d := &net.Dialer{Timeout: 30 * time.Second}
-		return d.DialContext(ctx, network, address)
+		return d.DialContext(ctx, network, protocol.ResolvedAddress(ctx, address))
 	}
 	if childName == "REJECT" {
 		return nil, fmt.Errorf("connection rejected")
 	}
+	if !g.available(childName) {
+		return nil, fmt.Errorf("proxy '%s' is unavailable", childName)
+	}
 
 	// Check local proxies first
 	if g.LocalProxies != nil {
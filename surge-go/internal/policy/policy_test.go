@@ -0,0 +1,38 @@
+package policy
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+func TestURLTestGroup_ReportsProbes(t *testing.T) {
+	proxies := map[string]protocol.Dialer{
+		"A": &MockDialer{NameVal: "A", LatencyMs: 40},
+		"B": &MockDialer{NameVal: "B", LatencyMs: 80},
+	}
+	resolver := func(name string) protocol.Dialer {
+		return proxies[name]
+	}
+
+	g := NewURLTestGroup("Auto", []string{"A", "B"}, resolver, "http://test.com", 0, 0)
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	g.SetProbeObserver(func(group, member string, latency int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if group != "Auto" || err != nil {
+			t.Errorf("unexpected probe report: %s/%s %v", group, member, err)
+		}
+		seen[member] = latency
+	})
+	g.Retest()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 || seen["A"] != 40 || seen["B"] != 80 {
+		t.Errorf("unexpected probe reports: %v", seen)
+	}
+}
@@ -0,0 +1,243 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+const (
+	// DefaultProbeConcurrency caps the number of latency tests running at once
+	DefaultProbeConcurrency = 16
+	// DefaultProbeTimeout is used when test-timeout is not configured
+	DefaultProbeTimeout = 5 * time.Second
+	// probeReuseWindow is how long a probe result is shared with other groups
+	probeReuseWindow = 10 * time.Second
+	// lazyIdleIntervals is how many check intervals a lazy group may stay unused
+	// before its periodic checks are skipped
+	lazyIdleIntervals = 3
+)
+
+// HealthChecker runs latency probes for all groups. Concurrent probes of the same
+// proxy and URL are merged, recent results are reused across groups, and the
+// number of probes in flight is capped.
+type HealthChecker struct {
+	mu       sync.Mutex
+	sem      chan struct{}
+	timeout  time.Duration
+	inflight map[probeKey]*probeCall
+	recent   map[probeKey]probeOutcome
+	now      func() time.Time
+}
+
+type probeKey struct {
+	name string
+	url  string
+	ptr  unsafe.Pointer // Dialer identity, nil for dialers that are not pointers
+}
+
+func newProbeKey(name string, d protocol.Dialer, url string) probeKey {
+	k := probeKey{name: name, url: url}
+	// Tell apart dialers sharing a name, e.g. before and after a reload
+	if v := reflect.ValueOf(d); v.Kind() == reflect.Pointer {
+		k.ptr = v.UnsafePointer()
+	}
+	return k
+}
+
+type probeOutcome struct {
+	latency int
+	err     error
+	at      time.Time
+	group   string // Group that ran the probe
+}
+
+type probeCall struct {
+	done chan struct{}
+	res  probeOutcome
+}
+
+// DefaultHealthChecker is shared by all groups
+var DefaultHealthChecker = NewHealthChecker(DefaultProbeConcurrency, DefaultProbeTimeout)
+
+// NewHealthChecker creates a checker running at most concurrency probes at once
+func NewHealthChecker(concurrency int, timeout time.Duration) *HealthChecker {
+	h := &HealthChecker{
+		inflight: make(map[probeKey]*probeCall),
+		recent:   make(map[probeKey]probeOutcome),
+		now:      time.Now,
+	}
+	h.Configure(concurrency, timeout)
+	return h
+}
+
+// Configure changes the concurrency cap and probe timeout.
+// Probes already waiting keep the previous cap.
+func (h *HealthChecker) Configure(concurrency int, timeout time.Duration) {
+	if concurrency <= 0 {
+		concurrency = DefaultProbeConcurrency
+	}
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sem == nil || cap(h.sem) != concurrency {
+		h.sem = make(chan struct{}, concurrency)
+	}
+	h.timeout = timeout
+}
+
+// Timeout returns the probe timeout
+func (h *HealthChecker) Timeout() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.timeout
+}
+
+// Probe tests d against url on behalf of group. A recent result produced for another
+// group is reused; a group retesting always gets a new measurement. fresh is false
+// when the result was shared, so callers only report results they produced.
+func (h *HealthChecker) Probe(group, name string, d protocol.Dialer, url string) (latency int, fresh bool, err error) {
+	key := newProbeKey(name, d, url)
+
+	h.mu.Lock()
+	if res, ok := h.recent[key]; ok && res.group != group && h.now().Sub(res.at) < probeReuseWindow {
+		h.mu.Unlock()
+		return res.latency, false, res.err
+	}
+	if call, ok := h.inflight[key]; ok {
+		h.mu.Unlock()
+		<-call.done
+		return call.res.latency, false, call.res.err
+	}
+	call := &probeCall{done: make(chan struct{})}
+	h.inflight[key] = call
+	sem, timeout := h.sem, h.timeout
+	h.mu.Unlock()
+
+	sem <- struct{}{}
+	latency, err = d.Test(url, timeout)
+	<-sem
+
+	call.res = probeOutcome{latency: latency, err: err, at: h.now(), group: group}
+
+	h.mu.Lock()
+	delete(h.inflight, key)
+	h.recent[key] = call.res
+	h.pruneLocked()
+	h.mu.Unlock()
+
+	close(call.done)
+	return latency, true, err
+}
+
+// errProxyNotFound is the probe error of members the resolver does not know
+var errProxyNotFound = errors.New("not found")
+
+// ProbeResult is the outcome of probing one member
+type ProbeResult struct {
+	Name    string
+	Latency int
+	Fresh   bool // Measured for this group, not shared from another one
+	Err     error
+}
+
+// ProbeAll probes the members of group against url, returning one result per
+// member in no particular order. No more goroutines than the concurrency cap
+// are started, whatever the number of members.
+func (h *HealthChecker) ProbeAll(group string, members []string, resolve ProxyResolver, url string) []ProbeResult {
+	h.mu.Lock()
+	workers := min(cap(h.sem), len(members))
+	h.mu.Unlock()
+
+	names := make(chan string)
+	results := make(chan ProbeResult, len(members))
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				p := resolve(name)
+				if p == nil {
+					results <- ProbeResult{Name: name, Err: errProxyNotFound}
+					continue
+				}
+				lat, fresh, err := h.Probe(group, name, p, url)
+				results <- ProbeResult{Name: name, Latency: lat, Fresh: fresh, Err: err}
+			}
+		}()
+	}
+	for _, name := range members {
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+	close(results)
+
+	list := make([]ProbeResult, 0, len(members))
+	for res := range results {
+		list = append(list, res)
+	}
+	return list
+}
+
+// pruneLocked drops results too old to be reused
+func (h *HealthChecker) pruneLocked() {
+	now := h.now()
+	for key, res := range h.recent {
+		if now.Sub(res.at) >= probeReuseWindow {
+			delete(h.recent, key)
+		}
+	}
+}
+
+// usage records when a group was last used, for lazy health checking.
+// Lazy groups are not probed until first used.
+type usage struct {
+	mu       sync.Mutex
+	lazy     bool
+	lastUsed time.Time
+	lastTest time.Time
+}
+
+// touch marks the group as used and reports whether a lazy group's results are
+// older than interval and should be refreshed now
+func (u *usage) touch(interval time.Duration) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	u.lastUsed = now
+	if !u.lazy || interval <= 0 || now.Sub(u.lastTest) <= interval {
+		return false
+	}
+	// Claim the refresh so concurrent dials don't start more
+	u.lastTest = now
+	return true
+}
+
+// shouldCheck reports whether a periodic check should run. Lazy groups
+// that have not been used for a few intervals are skipped.
+func (u *usage) shouldCheck(interval time.Duration) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.lazy || interval <= 0 {
+		return true
+	}
+	return time.Since(u.lastUsed) < lazyIdleIntervals*interval
+}
+
+// tested records that a check round ran
+func (u *usage) tested() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lastTest = time.Now()
+}
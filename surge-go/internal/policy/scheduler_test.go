@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+// countingDialer counts probes and tracks how many run at once
+type countingDialer struct {
+	MockDialer
+	calls   atomic.Int32
+	running atomic.Int32
+	peak    atomic.Int32
+	delay   time.Duration
+}
+
+func (d *countingDialer) Test(url string, timeout time.Duration) (int, error) {
+	d.calls.Add(1)
+	n := d.running.Add(1)
+	for {
+		p := d.peak.Load()
+		if n <= p || d.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(d.delay)
+	d.running.Add(-1)
+	return d.LatencyMs, nil
+}
+
+func TestHealthChecker_SharesProbesAcrossGroups(t *testing.T) {
+	h := NewHealthChecker(4, time.Second)
+	d := &countingDialer{MockDialer: MockDialer{NameVal: "A", LatencyMs: 30}, delay: 20 * time.Millisecond}
+
+	// Two groups probing the same proxy at the same time run a single test
+	var wg sync.WaitGroup
+	fresh := make([]bool, 2)
+	for i, group := range []string{"Auto", "Smart"} {
+		wg.Add(1)
+		go func(i int, group string) {
+			defer wg.Done()
+			_, fresh[i], _ = h.Probe(group, "A", d, "http://test.com")
+		}(i, group)
+	}
+	wg.Wait()
+
+	if d.calls.Load() != 1 {
+		t.Errorf("expected 1 probe, got %d", d.calls.Load())
+	}
+	if fresh[0] == fresh[1] {
+		t.Errorf("exactly one caller should own the result: %v", fresh)
+	}
+
+	// Another group reuses the recent result, the group that ran it retests
+	if _, ok, _ := h.Probe("LB", "A", d, "http://test.com"); ok || d.calls.Load() != 1 {
+		t.Errorf("recent result should be reused, calls=%d", d.calls.Load())
+	}
+}
+
+func TestHealthChecker_ConcurrencyCap(t *testing.T) {
+	h := NewHealthChecker(2, time.Second)
+	d := &countingDialer{MockDialer: MockDialer{NameVal: "A"}, delay: 10 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Distinct URLs so probes are not merged
+			h.Probe("G", "A", d, "http://test.com/"+string(rune('a'+i)))
+		}(i)
+	}
+	wg.Wait()
+
+	if d.calls.Load() != 10 {
+		t.Errorf("expected 10 probes, got %d", d.calls.Load())
+	}
+	if d.peak.Load() > 2 {
+		t.Errorf("at most 2 probes should run at once, peak %d", d.peak.Load())
+	}
+}
+
+func TestHealthChecker_ProbeAllGoroutines(t *testing.T) {
+	h := NewHealthChecker(2, time.Second)
+	d := &countingDialer{MockDialer: MockDialer{NameVal: "A"}, delay: 20 * time.Millisecond}
+	members := make([]string, 50)
+	for i := range members {
+		members[i] = fmt.Sprintf("m%d", i)
+	}
+	resolve := func(name string) protocol.Dialer {
+		if name == "m0" {
+			return nil
+		}
+		return d
+	}
+
+	base := runtime.NumGoroutine()
+	done := make(chan []ProbeResult)
+	go func() { done <- h.ProbeAll("G", members, resolve, "http://test.com") }()
+	time.Sleep(10 * time.Millisecond)
+	// The caller's goroutine and one worker per concurrency slot
+	if n := runtime.NumGoroutine() - base; n > 3 {
+		t.Errorf("%d goroutines running for 50 members, want at most 3", n)
+	}
+
+	results := <-done
+	if len(results) != len(members) || d.calls.Load() != 49 {
+		t.Fatalf("got %d results and %d probes, want 50 and 49", len(results), d.calls.Load())
+	}
+	for _, res := range results {
+		if (res.Name == "m0") != errors.Is(res.Err, errProxyNotFound) {
+			t.Errorf("unexpected result %+v", res)
+		}
+	}
+}
+
+// valueDialer is a comparable struct type whose field may hold an uncomparable value
+type valueDialer struct {
+	*MockDialer
+	tags any
+}
+
+func TestHealthChecker_ValueDialer(t *testing.T) {
+	h := NewHealthChecker(2, time.Second)
+	d := valueDialer{MockDialer: &MockDialer{NameVal: "A", LatencyMs: 10}, tags: []string{"x"}}
+	// Used as a map key, the dialer value would panic
+	if lat, _, err := h.Probe("G", "A", d, "http://test.com"); err != nil || lat != 10 {
+		t.Errorf("Probe = %d, %v", lat, err)
+	}
+}
+
+func TestUsage_Lazy(t *testing.T) {
+	u := &usage{lazy: true}
+	interval := time.Minute
+
+	if u.shouldCheck(interval) {
+		t.Error("unused lazy group should not be checked")
+	}
+	if !u.touch(interval) {
+		t.Error("first use of a lazy group should trigger a check")
+	}
+	if u.touch(interval) {
+		t.Error("a check was just claimed, no second one expected")
+	}
+	if !u.shouldCheck(interval) {
+		t.Error("recently used lazy group should be checked")
+	}
+
+	eager := &usage{}
+	if !eager.shouldCheck(interval) || eager.touch(interval) {
+		t.Error("non-lazy groups always follow the interval")
+	}
+}
@@ -93,6 +93,19 @@ func (g *SelectGroup) Now() string {
 
 // SetCurrent changes the current selection
 func (g *SelectGroup) SetCurrent(name string) error {
+	if err := g.setCurrent(name); err != nil {
+		return err
+	}
+	g.notifySelection(name)
+	return nil
+}
+
+// RestoreSelection implements SelectionRestorer
+func (g *SelectGroup) RestoreSelection(name string) bool {
+	return g.setCurrent(name) == nil
+}
+
+func (g *SelectGroup) setCurrent(name string) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
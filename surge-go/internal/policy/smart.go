@@ -2,8 +2,8 @@ package policy
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
 	"net"
 	"sync"
 	"time"
@@ -18,7 +18,7 @@ type SmartGroup struct {
 	Interval time.Duration
 
 	current  string
-	stats    map[string]*proxyStats
+	health   *HealthTracker
 	mu       sync.RWMutex
 	stopChan chan struct{}
 }
@@ -27,14 +27,7 @@ func (g *SmartGroup) UpdateProxies(proxies []string, localProxies map[string]pro
 	g.mu.Lock()
 	g.ProxiesList = proxies
 	g.LocalProxies = localProxies
-
-	// Init stats for new proxies
-	for _, p := range proxies {
-		if _, ok := g.stats[p]; !ok {
-			g.stats[p] = &proxyStats{LatencyMs: 9999}
-		}
-	}
-	// Cleanup old stats? Optional.
+	g.health.Forget(proxies)
 
 	// Reset current
 	found := false
@@ -54,12 +47,6 @@ func (g *SmartGroup) UpdateProxies(proxies []string, localProxies map[string]pro
 	go g.Retest()
 }
 
-type proxyStats struct {
-	LatencyMs    int
-	FailureCount int
-	LastUpdate   time.Time
-}
-
 // NewSmartGroup creates a new SmartGroup
 func NewSmartGroup(name string, proxies []string, resolver ProxyResolver, url string, interval int, evaluateBeforeUse bool) *SmartGroup {
 	g := &SmartGroup{
@@ -71,15 +58,10 @@ func NewSmartGroup(name string, proxies []string, resolver ProxyResolver, url st
 		},
 		URL:      url,
 		Interval: time.Duration(interval) * time.Second,
-		stats:    make(map[string]*proxyStats),
+		health:   NewHealthTracker(),
 		stopChan: make(chan struct{}),
 	}
 
-	// Initialize stats
-	for _, p := range proxies {
-		g.stats[p] = &proxyStats{LatencyMs: 9999}
-	}
-
 	if len(proxies) > 0 {
 		if !evaluateBeforeUse {
 			g.current = proxies[0]
@@ -111,37 +93,33 @@ func (g *SmartGroup) DialContext(ctx context.Context, network, address string) (
 	if target == "" {
 		return nil, fmt.Errorf("no proxy available in group %s", g.Name())
 	}
+	if g.use.touch(g.Interval) {
+		go g.Retest()
+	}
+	if !g.available(target) {
+		g.evaluate()
+		target = g.Now()
+	}
 
+	start := time.Now()
 	conn, err := g.SafeDial(ctx, network, address, target)
 
-	// Smart logic: verify connection success/fail
-	g.updateStats(target, err)
-
-	return conn, err
-}
-
-func (g *SmartGroup) updateStats(name string, err error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	stat, ok := g.stats[name]
-	if !ok {
-		return
-	}
-
+	// Smart logic: learn from real connection success/fail
+	g.health.RecordDial(target, time.Since(start), err)
 	if err != nil {
-		stat.FailureCount++
-	} else {
-		// Decay failure count on success
-		if stat.FailureCount > 0 {
-			stat.FailureCount--
-		}
-	}
-
-	// Trigger re-evaluation if current failed?
-	if err != nil && name == g.current {
 		go g.evaluate() // Run in background to avoid blocking Dial
+		return nil, err
 	}
+
+	return newHealthConn(conn, target, g.health, func() { go g.evaluate() }), nil
+}
+
+// HealthStats returns passive and probe statistics for every member
+func (g *SmartGroup) HealthStats() []MemberHealth {
+	g.mu.RLock()
+	proxies := g.ProxiesList
+	g.mu.RUnlock()
+	return g.health.Snapshot(proxies)
 }
 
 func (g *SmartGroup) Now() string {
@@ -157,7 +135,9 @@ func (g *SmartGroup) startLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			g.Retest()
+			if g.use.shouldCheck(g.Interval) {
+				g.Retest()
+			}
 		case <-g.stopChan:
 			return
 		}
@@ -168,69 +148,28 @@ func (g *SmartGroup) Retest() {
 	if g.Resolver == nil {
 		return
 	}
+	g.use.tested()
 
-	type result struct {
-		name    string
-		latency int
-		err     error
-	}
-
-	results := make(chan result, len(g.ProxiesList))
-	var wg sync.WaitGroup
-
-	for _, name := range g.ProxiesList {
-		wg.Add(1)
-		go func(n string) {
-			defer wg.Done()
-			p := g.Resolver(n)
-			if p == nil {
-				return
-			}
-			lat, err := p.Test(g.URL, 5*time.Second)
-			results <- result{name: n, latency: lat, err: err}
-		}(name)
-	}
-
-	wg.Wait()
-	close(results)
-
-	g.mu.Lock()
-	for res := range results {
-		if stat, ok := g.stats[res.name]; ok {
-			if res.err == nil {
-				stat.LatencyMs = res.latency
-			} else {
-				// Test failed, treat as failure
-				stat.FailureCount++
-				stat.LatencyMs = 9999
-			}
-			stat.LastUpdate = time.Now()
+	for _, res := range DefaultHealthChecker.ProbeAll(g.NameStr, g.ProxiesList, g.Resolver, g.URL) {
+		if errors.Is(res.Err, errProxyNotFound) {
+			continue
+		}
+		g.health.RecordProbe(res.Name, res.Latency, res.Err)
+		if res.Fresh {
+			g.notifyProbe(res.Name, res.Latency, res.Err)
 		}
 	}
-	g.mu.Unlock()
 
 	g.evaluate()
 }
 
 // evaluate picks the best proxy based on score
+// (probe latency, real traffic success rate and recent failures)
 func (g *SmartGroup) evaluate() {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	bestName := ""
-	bestScore := math.MaxInt64
-
-	for name, stat := range g.stats {
-		// Score = Latency + (FailureCount * 2000)
-		score := stat.LatencyMs + (stat.FailureCount * 2000)
-
-		if score < bestScore {
-			bestScore = score
-			bestName = name
-		}
-	}
-
-	if bestName != "" {
+	if bestName := g.health.Best(g.availableMembers(g.ProxiesList)); bestName != "" {
 		g.current = bestName
 	}
 }
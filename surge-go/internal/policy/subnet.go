@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/system"
+)
+
+// SubnetCondition selects a policy when the current network matches
+type SubnetCondition struct {
+	Type   string // SUBNET, ROUTER or INTERFACE
+	Value  string
+	Policy string
+
+	ipNet *net.IPNet
+	ip    net.IP
+}
+
+// ParseSubnetCondition parses "TYPE:VALUE=POLICY", e.g. "SUBNET:192.168.1.0/24=DIRECT"
+func ParseSubnetCondition(s string) (*SubnetCondition, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return nil, fmt.Errorf("invalid subnet condition '%s'", s)
+	}
+	cond := strings.SplitN(strings.TrimSpace(kv[0]), ":", 2)
+	if len(cond) != 2 {
+		return nil, fmt.Errorf("invalid subnet condition '%s'", s)
+	}
+
+	c := &SubnetCondition{
+		Type:   strings.ToUpper(strings.TrimSpace(cond[0])),
+		Value:  strings.TrimSpace(cond[1]),
+		Policy: strings.TrimSpace(kv[1]),
+	}
+	if c.Policy == "" {
+		return nil, fmt.Errorf("missing policy in subnet condition '%s'", s)
+	}
+
+	switch c.Type {
+	case "SUBNET":
+		_, ipNet, err := net.ParseCIDR(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet '%s': %v", c.Value, err)
+		}
+		c.ipNet = ipNet
+	case "ROUTER":
+		c.ip = net.ParseIP(c.Value)
+		if c.ip == nil {
+			return nil, fmt.Errorf("invalid router address '%s'", c.Value)
+		}
+	case "INTERFACE":
+		if c.Value == "" {
+			return nil, fmt.Errorf("missing interface name in '%s'", s)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported subnet condition type: %s", c.Type)
+	}
+
+	return c, nil
+}
+
+// Match checks the condition against a network state
+func (c *SubnetCondition) Match(state *system.NetworkState) bool {
+	if state == nil {
+		return false
+	}
+	switch c.Type {
+	case "SUBNET":
+		for _, addr := range state.Addresses {
+			if c.ipNet.Contains(addr.IP) {
+				return true
+			}
+		}
+	case "ROUTER":
+		if gw := net.ParseIP(state.Gateway); gw != nil {
+			return gw.Equal(c.ip)
+		}
+	case "INTERFACE":
+		return state.Interface == c.Value
+	}
+	return false
+}
+
+// SubnetGroup selects a policy based on the network the host is attached to,
+// the Linux counterpart of Surge's ssid group
+type SubnetGroup struct {
+	BaseGroup
+	Default    string
+	Conditions []*SubnetCondition
+	Interval   time.Duration // Poll interval for network changes
+
+	current  string
+	mu       sync.RWMutex
+	stopChan chan struct{}
+}
+
+// NewSubnetGroup creates a new SubnetGroup. The network is evaluated immediately
+// and re-evaluated on every change when watch is true.
+func NewSubnetGroup(name string, defaultPolicy string, conditions []string, resolver ProxyResolver, interval int, watch bool) (*SubnetGroup, error) {
+	if defaultPolicy == "" {
+		return nil, fmt.Errorf("subnet group %s requires a default policy", name)
+	}
+
+	var conds []*SubnetCondition
+	proxies := []string{defaultPolicy}
+	for _, s := range conditions {
+		c, err := ParseSubnetCondition(s)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+		proxies = appendUnique(proxies, c.Policy)
+	}
+
+	g := &SubnetGroup{
+		BaseGroup: BaseGroup{
+			NameStr:     name,
+			TypeStr:     "subnet",
+			ProxiesList: proxies,
+			Resolver:    resolver,
+		},
+		Default:    defaultPolicy,
+		Conditions: conds,
+		Interval:   time.Duration(interval) * time.Second,
+		current:    defaultPolicy,
+		stopChan:   make(chan struct{}),
+	}
+
+	if watch {
+		if state, err := system.GetNetworkState(); err == nil {
+			g.Evaluate(state)
+		}
+		go system.WatchNetwork(g.Interval, g.stopChan, g.Evaluate)
+	}
+
+	return g, nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// Evaluate picks the policy of the first matching condition, or the default
+func (g *SubnetGroup) Evaluate(state *system.NetworkState) {
+	selected := g.Default
+	for _, c := range g.Conditions {
+		if c.Match(state) {
+			selected = c.Policy
+			break
+		}
+	}
+
+	g.mu.Lock()
+	changed := g.current != selected
+	g.current = selected
+	g.mu.Unlock()
+
+	if changed {
+		log.Printf("Subnet group %s: network changed, switched to %s", g.Name(), selected)
+	}
+}
+
+// DialContext implements protocol.Dialer
+func (g *SubnetGroup) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return g.SafeDial(ctx, network, address, g.Now())
+}
+
+// Now returns the policy selected for the current network
+func (g *SubnetGroup) Now() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.current
+}
+
+// Test tests the currently selected policy
+func (g *SubnetGroup) Test(url string, timeout time.Duration) (int, error) {
+	target := g.Now()
+	if g.Resolver != nil {
+		if child := g.Resolver(target); child != nil {
+			return child.Test(url, timeout)
+		}
+	}
+	return 0, fmt.Errorf("cannot test proxy '%s'", target)
+}
+
+func (g *SubnetGroup) Close() error {
+	close(g.stopChan)
+	return nil
+}
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+	"github.com/surge-proxy/surge-go/internal/system"
+)
+
+func mustIPNet(t *testing.T, cidr string) *net.IPNet {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("bad cidr %s: %v", cidr, err)
+	}
+	ipNet.IP = ip
+	return ipNet
+}
+
+func TestSubnetGroup_Evaluate(t *testing.T) {
+	g, err := NewSubnetGroup("Net", "Proxy", []string{
+		"SUBNET:192.168.1.0/24=DIRECT",
+		"ROUTER:10.0.0.1=Office",
+		"INTERFACE:wg0=VPN",
+	}, nil, 0, false)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	if g.Now() != "Proxy" {
+		t.Errorf("initial selection should be default, got %s", g.Now())
+	}
+
+	tests := []struct {
+		name  string
+		state *system.NetworkState
+		want  string
+	}{
+		{"home subnet", &system.NetworkState{Gateway: "192.168.1.1", Interface: "eth0", Addresses: []*net.IPNet{mustIPNet(t, "192.168.1.23/24")}}, "DIRECT"},
+		{"office router", &system.NetworkState{Gateway: "10.0.0.1", Interface: "eth0", Addresses: []*net.IPNet{mustIPNet(t, "10.0.0.50/16")}}, "Office"},
+		{"vpn interface", &system.NetworkState{Gateway: "172.16.0.1", Interface: "wg0"}, "VPN"},
+		{"unknown network", &system.NetworkState{Gateway: "172.20.0.1", Interface: "eth1", Addresses: []*net.IPNet{mustIPNet(t, "172.20.0.9/24")}}, "Proxy"},
+	}
+
+	for _, tt := range tests {
+		g.Evaluate(tt.state)
+		if g.Now() != tt.want {
+			t.Errorf("%s: selected %s, want %s", tt.name, g.Now(), tt.want)
+		}
+	}
+
+	// Proxies lists every referenced policy for cycle validation
+	if len(g.Proxies()) != 4 {
+		t.Errorf("expected 4 referenced policies, got %v", g.Proxies())
+	}
+}
+
+func TestParseSubnetCondition_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"SUBNET:192.168.1.0=DIRECT",
+		"ROUTER:not-an-ip=DIRECT",
+		"SSID:home=DIRECT",
+		"SUBNET:10.0.0.0/8",
+	} {
+		if _, err := ParseSubnetCondition(s); err == nil {
+			t.Errorf("ParseSubnetCondition(%q) should fail", s)
+		}
+	}
+}
+
+func TestParseProxyGroups_Subnet(t *testing.T) {
+	groups := config.ParseProxyGroups([]string{
+		"Net = subnet, default=Proxy, SUBNET:192.168.1.0/24=DIRECT, ROUTER:10.0.0.1=DIRECT",
+	})
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	g := groups[0]
+	if g.Default != "Proxy" {
+		t.Errorf("default = %s, want Proxy", g.Default)
+	}
+	if len(g.Conditions) != 2 || g.Conditions[0] != "SUBNET:192.168.1.0/24=DIRECT" {
+		t.Errorf("unexpected conditions: %v", g.Conditions)
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"context"
 	"fmt"
+	"log"
 	"math"
 	"net"
 	"sync"
@@ -19,6 +20,7 @@ type URLTestGroup struct {
 	Tolerance int // Tolerance in Ms
 
 	current  string // The winner
+	health   *HealthTracker
 	mu       sync.RWMutex
 	stopChan chan struct{}
 }
@@ -31,6 +33,7 @@ func (g *URLTestGroup) UpdateProxies(proxies []string, localProxies map[string]p
 
 	g.ProxiesList = proxies
 	g.LocalProxies = localProxies
+	g.health.Forget(proxies)
 
 	// Reset current logic similar to SelectGroup
 	found := false
@@ -63,6 +66,7 @@ func NewURLTestGroup(name string, proxies []string, resolver ProxyResolver, url
 		URL:       url,
 		Interval:  time.Duration(interval) * time.Second,
 		Tolerance: tolerance,
+		health:    NewHealthTracker(),
 		stopChan:  make(chan struct{}),
 	}
 
@@ -86,8 +90,70 @@ func (g *URLTestGroup) DialContext(ctx context.Context, network, address string)
 	if target == "" {
 		return nil, fmt.Errorf("no proxy available in group %s", g.Name())
 	}
+	if g.use.touch(g.Interval) {
+		go g.Retest()
+	}
+	if !g.available(target) {
+		if next := g.switchAway(target, "is unavailable"); next != "" {
+			target = next
+		}
+	}
+
+	start := time.Now()
+	conn, err := g.SafeDial(ctx, network, address, target)
+	g.health.RecordDial(target, time.Since(start), err)
+	if err != nil {
+		g.demoteIfFailing(target)
+		return nil, err
+	}
+
+	return newHealthConn(conn, target, g.health, func() { g.demoteIfFailing(target) }), nil
+}
 
-	return g.SafeDial(ctx, network, address, target)
+// demoteIfFailing switches away from the current member when real traffic through it
+// keeps failing, without waiting for the next probe round
+func (g *URLTestGroup) demoteIfFailing(name string) {
+	if g.health.IsDemoted(name) {
+		g.switchAway(name, "keeps failing")
+	}
+}
+
+// switchAway replaces name, if it is still the current member, with the best
+// healthy and available other member. It returns the new current member, or
+// "" if nothing changed.
+func (g *URLTestGroup) switchAway(name, reason string) string {
+	g.mu.Lock()
+	if g.current != name {
+		current := g.current
+		g.mu.Unlock()
+		return current
+	}
+
+	var others []string
+	for _, p := range g.availableMembers(g.ProxiesList) {
+		if p != name {
+			others = append(others, p)
+		}
+	}
+	next := g.health.Best(others)
+	if next == "" || g.health.IsDemoted(next) {
+		g.mu.Unlock()
+		return ""
+	}
+	log.Printf("URLTest group %s: %s %s, switching to %s", g.Name(), name, reason, next)
+	g.current = next
+	g.mu.Unlock()
+
+	g.notifySelection(next)
+	return next
+}
+
+// HealthStats returns passive and probe statistics for every member
+func (g *URLTestGroup) HealthStats() []MemberHealth {
+	g.mu.RLock()
+	proxies := g.ProxiesList
+	g.mu.RUnlock()
+	return g.health.Snapshot(proxies)
 }
 
 func (g *URLTestGroup) Now() string {
@@ -103,7 +169,9 @@ func (g *URLTestGroup) startLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			g.Retest()
+			if g.use.shouldCheck(g.Interval) {
+				g.Retest()
+			}
 		case <-g.stopChan:
 			return
 		}
@@ -115,34 +183,9 @@ func (g *URLTestGroup) Retest() {
 	if g.Resolver == nil {
 		return
 	}
+	g.use.tested()
 
-	type result struct {
-		name    string
-		latency int
-		err     error
-	}
-
-	results := make(chan result, len(g.ProxiesList))
-	var wg sync.WaitGroup
-
-	for _, name := range g.ProxiesList {
-		wg.Add(1)
-		go func(n string) {
-			defer wg.Done()
-			p := g.Resolver(n)
-			if p == nil {
-				results <- result{name: n, err: fmt.Errorf("not found")}
-				return
-			}
-
-			// Use a shorter timeout for testing
-			lat, err := p.Test(g.URL, 5*time.Second)
-			results <- result{name: n, latency: lat, err: err}
-		}(name)
-	}
-
-	wg.Wait()
-	close(results)
+	results := DefaultHealthChecker.ProbeAll(g.NameStr, g.ProxiesList, g.Resolver, g.URL)
 
 	bestName := ""
 	bestLat := math.MaxInt32
@@ -152,35 +195,69 @@ func (g *URLTestGroup) Retest() {
 
 	proxyMap := make(map[string]int)
 
-	for res := range results {
-		if res.err == nil {
-			proxyMap[res.name] = res.latency
-			if res.latency < bestLat {
-				bestLat = res.latency
-				bestName = res.name
+	for _, res := range results {
+		g.health.RecordProbe(res.Name, res.Latency, res.Err)
+		if res.Fresh {
+			g.notifyProbe(res.Name, res.Latency, res.Err)
+		}
+		if res.Err == nil {
+			proxyMap[res.Name] = res.Latency
+			// Members failing real traffic or out of quota are skipped even if their probe passes
+			if g.health.IsDemoted(res.Name) || !g.available(res.Name) {
+				continue
+			}
+			if res.Latency < bestLat {
+				bestLat = res.Latency
+				bestName = res.Name
 			}
 		}
 	}
 
-	if bestName != "" {
-		g.mu.Lock()
-		defer g.mu.Unlock()
-
-		// Tolerance check
-		if g.current != "" && g.current != bestName {
-			if curLat, ok := proxyMap[g.current]; ok {
-				// If current is valid, check if new best is significantly better
-				if bestLat > curLat-g.Tolerance {
-					// New best is not significantly better (latency diff < tolerance), keep current
-					// e.g. best=100, cur=120, tol=50. 100 > 120-50 (70). True. Keep current.
-					// e.g. best=50, cur=120, tol=50. 50 > 120-50 (70). False. Switch.
-					return
-				}
+	if bestName != "" && g.switchTo(bestName, bestLat, proxyMap) {
+		g.notifySelection(bestName)
+	}
+}
+
+// switchTo makes bestName the winner unless the current member is still healthy
+// and within tolerance of it. It reports whether the winner changed.
+func (g *URLTestGroup) switchTo(bestName string, bestLat int, latencies map[string]int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.current == bestName {
+		return false
+	}
+
+	// Tolerance check
+	if g.current != "" {
+		if curLat, ok := latencies[g.current]; ok && !g.health.IsDemoted(g.current) && g.available(g.current) {
+			// If current is valid, check if new best is significantly better
+			if bestLat > curLat-g.Tolerance {
+				// New best is not significantly better (latency diff < tolerance), keep current
+				// e.g. best=100, cur=120, tol=50. 100 > 120-50 (70). True. Keep current.
+				// e.g. best=50, cur=120, tol=50. 50 > 120-50 (70). False. Switch.
+				return false
 			}
 		}
+	}
 
-		g.current = bestName
+	g.current = bestName
+	return true
+}
+
+// RestoreSelection implements SelectionRestorer. The restored winner is used until
+// the next probe round finds a member that is better by more than the tolerance.
+func (g *URLTestGroup) RestoreSelection(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, p := range g.ProxiesList {
+		if p == name {
+			g.current = name
+			return true
+		}
 	}
+	return false
 }
 
 func (g *URLTestGroup) Close() error {
@@ -0,0 +1,99 @@
+// Package process finds the local process that owns a connection
+package process
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no local socket matches the address
+	ErrNotFound = errors.New("process not found")
+	// ErrNotSupported is returned on platforms without process lookup
+	ErrNotSupported = errors.New("process lookup not supported on this platform")
+)
+
+// Info describes the process owning a socket
+type Info struct {
+	PID   int
+	Name  string // Executable name
+	Path  string // Executable path, empty if it cannot be read
+	Inode uint32 // Inode of the socket the process was found by
+}
+
+// FindProcess returns the process owning the local socket bound to ip:port.
+// network is "tcp" or "udp", optionally with a version suffix. Addresses of
+// other hosts are never found.
+func FindProcess(network string, ip net.IP, port int) (*Info, error) {
+	network, err := localSocket(network, ip, port)
+	if err != nil {
+		return nil, err
+	}
+	return findProcess(network, ip, port)
+}
+
+// SocketInode returns the inode of the local socket bound to ip:port. It is
+// much cheaper than FindProcess, which also scans the processes for the
+// socket, so it tells whether a process found earlier still owns the address.
+func SocketInode(network string, ip net.IP, port int) (uint32, error) {
+	network, err := localSocket(network, ip, port)
+	if err != nil {
+		return 0, err
+	}
+	inode, _, err := socketInode(network, ip, port)
+	return inode, err
+}
+
+// localSocket checks that ip:port can be a socket of this host and returns
+// the network to look it up in
+func localSocket(network string, ip net.IP, port int) (string, error) {
+	if ip == nil || port <= 0 || port > 65535 {
+		return "", ErrNotFound
+	}
+	if !isLocal(ip) {
+		return "", ErrNotFound
+	}
+	if strings.HasPrefix(network, "udp") {
+		return "udp", nil
+	}
+	return "tcp", nil
+}
+
+// localAddrsTTL is how long the addresses of the interfaces are cached
+const localAddrsTTL = 30 * time.Second
+
+var local struct {
+	sync.Mutex
+	addrs   []net.IP
+	updated time.Time
+}
+
+// isLocal reports whether ip is an address of this host
+func isLocal(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+
+	local.Lock()
+	defer local.Unlock()
+	if time.Since(local.updated) > localAddrsTTL {
+		local.addrs = local.addrs[:0]
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, a := range addrs {
+				if n, ok := a.(*net.IPNet); ok {
+					local.addrs = append(local.addrs, n.IP)
+				}
+			}
+		}
+		local.updated = time.Now()
+	}
+	for _, a := range local.addrs {
+		if a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// sock_diag message layout (linux/sock_diag.h, linux/inet_diag.h), not exported by package syscall
+const (
+	sockDiagByFamily = 20
+	inetDiagReqLen   = 56 // struct inet_diag_req_v2
+	inetDiagMsgLen   = 72 // struct inet_diag_msg
+)
+
+func findProcess(network string, ip net.IP, port int) (*Info, error) {
+	inode, uid, err := socketInode(network, ip, port)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := inodeOwner(inode, uid)
+	if err != nil {
+		return nil, err
+	}
+	info, err := processInfo(pid)
+	if err != nil {
+		return nil, err
+	}
+	info.Inode = inode
+	return info, nil
+}
+
+// socketInode returns the inode and owner of the socket bound to ip:port. The
+// kernel is asked through sock_diag, /proc/net is read if netlink fails.
+func socketInode(network string, ip net.IP, port int) (uint32, uint32, error) {
+	inode, uid, err := sockDiag(network, ip, port)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return inode, uid, err
+	}
+	return procNetInode(network, ip, port)
+}
+
+func sockDiag(network string, ip net.IP, port int) (uint32, uint32, error) {
+	proto := uint8(syscall.IPPROTO_TCP)
+	if network == "udp" {
+		proto = syscall.IPPROTO_UDP
+	}
+
+	// IPv4 clients may also use dual-stack IPv6 sockets
+	if v4 := ip.To4(); v4 != nil {
+		inode, uid, err := sockDiagQuery(syscall.AF_INET, proto, v4, port)
+		if !errors.Is(err, ErrNotFound) {
+			return inode, uid, err
+		}
+	}
+	return sockDiagQuery(syscall.AF_INET6, proto, ip.To16(), port)
+}
+
+// sockDiagQuery dumps the sockets of a family with the source port and returns
+// the one bound to ip
+func sockDiagQuery(family, proto uint8, ip net.IP, port int) (uint32, uint32, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_INET_DIAG)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.Close(fd)
+	tv := syscall.Timeval{Sec: 1}
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	req := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	binary.NativeEndian.PutUint32(req[0:4], uint32(len(req)))
+	binary.NativeEndian.PutUint16(req[4:6], sockDiagByFamily)
+	binary.NativeEndian.PutUint16(req[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	body := req[syscall.NLMSG_HDRLEN:]
+	body[0], body[1] = family, proto
+	binary.NativeEndian.PutUint32(body[4:8], 0xffffffff) // All states
+	// The kernel only dumps sockets with this source port
+	binary.BigEndian.PutUint16(body[8:10], uint16(port))
+
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return 0, 0, err
+	}
+
+	buf := make([]byte, 32*1024)
+	var inode, uid uint32
+	found := false
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return 0, 0, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				if !found {
+					return 0, 0, ErrNotFound
+				}
+				return inode, uid, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := int32(binary.NativeEndian.Uint32(m.Data[:4])); errno != 0 {
+						return 0, 0, syscall.Errno(-errno)
+					}
+				}
+				return 0, 0, fmt.Errorf("sock_diag: error message")
+			}
+			if found || len(m.Data) < inetDiagMsgLen {
+				continue
+			}
+
+			d := m.Data
+			if int(binary.BigEndian.Uint16(d[4:6])) != port {
+				continue
+			}
+			src := net.IP(d[8:24])
+			if family == syscall.AF_INET {
+				src = net.IP(d[8:12])
+			}
+			// Unconnected UDP sockets are bound to any address
+			if !src.Equal(ip) && !(proto == syscall.IPPROTO_UDP && src.IsUnspecified()) {
+				continue
+			}
+			// Sockets in TIME_WAIT belong to no process
+			if ino := binary.NativeEndian.Uint32(d[68:72]); ino != 0 {
+				inode, uid, found = ino, binary.NativeEndian.Uint32(d[64:68]), true
+			}
+		}
+	}
+}
+
+// procNetInode looks the socket up in /proc/net/{tcp,udp}{,6}
+func procNetInode(network string, ip net.IP, port int) (uint32, uint32, error) {
+	for _, name := range []string{network, network + "6"} {
+		f, err := os.Open("/proc/net/" + name)
+		if err != nil {
+			continue
+		}
+		inode, uid, ok := parseProcNet(f, ip, port, network == "udp")
+		f.Close()
+		if ok {
+			return inode, uid, nil
+		}
+	}
+	return 0, 0, ErrNotFound
+}
+
+// parseProcNet finds the socket bound to ip:port in /proc/net/tcp-style
+// content. With anyAddr, sockets bound to the unspecified address match too.
+// Addresses are hex in host byte order per 32-bit word, e.g. 0100007F:1F90
+// is 127.0.0.1:8080.
+func parseProcNet(r io.Reader, ip net.IP, port int, anyAddr bool) (uint32, uint32, bool) {
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		if first {
+			// Skip header: sl local_address rem_address st ...
+			first = false
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		addr, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseUint(portHex, 16, 16); err != nil || int(p) != port {
+			continue
+		}
+		local := parseProcNetIP(addr)
+		if local == nil || !(local.Equal(ip) || (anyAddr && local.IsUnspecified())) {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 32)
+		if err != nil || inode == 0 {
+			continue
+		}
+		uid, _ := strconv.ParseUint(fields[7], 10, 32)
+		return uint32(inode), uint32(uid), true
+	}
+	return 0, 0, false
+}
+
+func parseProcNetIP(s string) net.IP {
+	raw, err := hex.DecodeString(s)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	return ip
+}
+
+// maxRecentPIDs bounds the processes checked before scanning all of them
+const maxRecentPIDs = 16
+
+// recent holds the last owners found, most recent first. Programs usually
+// open many connections, so their sockets are looked for there first.
+var recent struct {
+	sync.Mutex
+	pids []int
+}
+
+// inodeOwner returns the process with a descriptor for the socket inode.
+// Processes of the socket's owner are checked first.
+func inodeOwner(inode, uid uint32) (int, error) {
+	target := fmt.Sprintf("socket:[%d]", inode)
+
+	recent.Lock()
+	candidates := append([]int{}, recent.pids...)
+	recent.Unlock()
+	for _, pid := range candidates {
+		if ownsSocket(pid, target) {
+			rememberPID(pid)
+			return pid, nil
+		}
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	var others []int
+	candidates = candidates[:0]
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Uid != uid {
+				others = append(others, pid)
+				continue
+			}
+		}
+		candidates = append(candidates, pid)
+	}
+	for _, pid := range append(candidates, others...) {
+		if ownsSocket(pid, target) {
+			rememberPID(pid)
+			return pid, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func ownsSocket(pid int, target string) bool {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	fds, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, fd := range fds {
+		if link, err := os.Readlink(dir + "/" + fd.Name()); err == nil && link == target {
+			return true
+		}
+	}
+	return false
+}
+
+func rememberPID(pid int) {
+	recent.Lock()
+	defer recent.Unlock()
+	pids := []int{pid}
+	for _, p := range recent.pids {
+		if p != pid && len(pids) < maxRecentPIDs {
+			pids = append(pids, p)
+		}
+	}
+	recent.pids = pids
+}
+
+// processInfo reads the executable of pid, falling back to its command name
+// when the executable link cannot be read
+func processInfo(pid int) (*Info, error) {
+	if path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		path = strings.TrimSuffix(path, " (deleted)")
+		return &Info{PID: pid, Name: filepath.Base(path), Path: path}, nil
+	}
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return nil, err
+	}
+	return &Info{PID: pid, Name: strings.TrimSpace(string(comm))}, nil
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseProcNet(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 11111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:D431 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 22222 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 33333 2 0000000000000000 0
+`
+	inode, uid, ok := parseProcNet(strings.NewReader(table), net.ParseIP("127.0.0.1"), 0xD431, false)
+	if !ok || inode != 22222 || uid != 1000 {
+		t.Errorf("parseProcNet = %d, %d, %v, want 22222, 1000, true", inode, uid, ok)
+	}
+	if _, _, ok := parseProcNet(strings.NewReader(table), net.ParseIP("10.0.0.1"), 0xD431, false); ok {
+		t.Error("another address should not match")
+	}
+
+	// Sockets bound to any address only match for UDP
+	if _, _, ok := parseProcNet(strings.NewReader(table), net.ParseIP("127.0.0.1"), 53, false); ok {
+		t.Error("unspecified address should not match without anyAddr")
+	}
+	if inode, _, ok := parseProcNet(strings.NewReader(table), net.ParseIP("127.0.0.1"), 53, true); !ok || inode != 33333 {
+		t.Errorf("parseProcNet with anyAddr = %d, %v, want 33333, true", inode, ok)
+	}
+}
+
+func TestParseProcNetIP(t *testing.T) {
+	if ip := parseProcNetIP("0100007F"); !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("IPv4 = %v", ip)
+	}
+	// ::ffff:127.0.0.1 as written in /proc/net/tcp6
+	if ip := parseProcNetIP("0000000000000000FFFF00000100007F"); !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("IPv4-mapped = %v", ip)
+	}
+	if ip := parseProcNetIP("xyz"); ip != nil {
+		t.Errorf("invalid address = %v, want nil", ip)
+	}
+}
+
+func TestFindProcess_Self(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.TCPAddr)
+
+	info, err := FindProcess("tcp", local.IP, local.Port)
+	if err != nil {
+		t.Fatalf("FindProcess failed: %v", err)
+	}
+	if info.PID != os.Getpid() || info.Name == "" {
+		t.Errorf("FindProcess = %+v, want pid %d", info, os.Getpid())
+	}
+	if inode, err := SocketInode("tcp", local.IP, local.Port); err != nil || inode == 0 || inode != info.Inode {
+		t.Errorf("SocketInode = %d, %v, want %d", inode, err, info.Inode)
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	addr := udp.LocalAddr().(*net.UDPAddr)
+	if info, err := FindProcess("udp", addr.IP, addr.Port); err != nil || info.PID != os.Getpid() {
+		t.Errorf("FindProcess(udp) = %+v, %v", info, err)
+	}
+
+	if _, err := FindProcess("tcp", net.ParseIP("192.0.2.1"), local.Port); err != ErrNotFound {
+		t.Errorf("a remote address should not be found, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package process
+
+import "net"
+
+// findProcess stub for unsupported platforms
+func findProcess(network string, ip net.IP, port int) (*Info, error) {
+	return nil, ErrNotSupported
+}
+
+// socketInode stub for unsupported platforms
+func socketInode(network string, ip net.IP, port int) (uint32, uint32, error) {
+	return 0, 0, ErrNotSupported
+}
@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type sourceAddrKey struct{}
+
+// WithSourceAddr returns a context carrying the client address of the connection being dialed.
+// Policy groups use it for source-based decisions such as sticky sessions.
+func WithSourceAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, sourceAddrKey{}, addr)
+}
+
+// SourceAddrFromContext returns the client address stored by WithSourceAddr, or "" if absent
+func SourceAddrFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(sourceAddrKey{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// SourceIPFromContext returns the host part of the client address stored in ctx
+func SourceIPFromContext(ctx context.Context) string {
+	addr := SourceAddrFromContext(ctx)
+	if addr == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+type resolvedIPKey struct{}
+
+type resolvedIP struct {
+	host string
+	ip   net.IP
+}
+
+// WithResolvedIP returns a context carrying the IP host was already resolved to,
+// so direct dials can reuse it instead of resolving again
+func WithResolvedIP(ctx context.Context, host string, ip net.IP) context.Context {
+	return context.WithValue(ctx, resolvedIPKey{}, resolvedIP{host: host, ip: ip})
+}
+
+// ResolvedAddress replaces the host of address with the IP stored by WithResolvedIP
+// for that host. Other addresses are returned unchanged.
+func ResolvedAddress(ctx context.Context, address string) string {
+	r, ok := ctx.Value(resolvedIPKey{}).(resolvedIP)
+	if !ok {
+		return address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || !strings.EqualFold(host, r.host) {
+		return address
+	}
+	return net.JoinHostPort(r.ip.String(), port)
+}
+
+// Inbound types, naming the kind of listener a connection arrived on
+const (
+	InboundHTTP   = "HTTP"
+	InboundSOCKS5 = "SOCKS5"
+	InboundTUN    = "TUN"
+	InboundREDIR  = "REDIR"
+)
+
+// Inbound describes the listener a connection arrived on
+type Inbound struct {
+	Type string // One of the Inbound* constants
+	Port int    // Local port of the listener, 0 if it has none
+	User string // Authenticated user, "" without authentication
+}
+
+type inboundKey struct{}
+
+// WithInbound returns a context carrying the listener the request arrived on
+func WithInbound(ctx context.Context, in Inbound) context.Context {
+	return context.WithValue(ctx, inboundKey{}, in)
+}
+
+// InboundFromContext returns the listener stored by WithInbound
+func InboundFromContext(ctx context.Context) (Inbound, bool) {
+	in, ok := ctx.Value(inboundKey{}).(Inbound)
+	return in, ok
+}
+
+// HTTPRequest describes the HTTP request a connection is dialed for
+type HTTPRequest struct {
+	URL    string
+	Method string
+	Header http.Header
+}
+
+type httpRequestKey struct{}
+
+// WithHTTPRequest returns a context carrying the HTTP request being routed
+func WithHTTPRequest(ctx context.Context, req HTTPRequest) context.Context {
+	return context.WithValue(ctx, httpRequestKey{}, req)
+}
+
+// HTTPRequestFromContext returns the request stored by WithHTTPRequest
+func HTTPRequestFromContext(ctx context.Context) (HTTPRequest, bool) {
+	req, ok := ctx.Value(httpRequestKey{}).(HTTPRequest)
+	return req, ok
+}
+
+// Sniffed is what the first client bytes of a connection revealed
+type Sniffed struct {
+	Protocol string // HTTP, HTTPS or TLS
+	Domain   string // TLS SNI or HTTP Host, "" if absent
+}
+
+type sniffedKey struct{}
+
+// WithSniffed returns a context carrying the result of sniffing the connection
+func WithSniffed(ctx context.Context, s Sniffed) context.Context {
+	return context.WithValue(ctx, sniffedKey{}, s)
+}
+
+// SniffedFromContext returns the result stored by WithSniffed
+func SniffedFromContext(ctx context.Context) (Sniffed, bool) {
+	s, ok := ctx.Value(sniffedKey{}).(Sniffed)
+	return s, ok
+}
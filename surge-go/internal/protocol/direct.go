@@ -31,7 +31,7 @@ func (d *DirectDialer) DialContext(ctx context.Context, network, address string)
 		KeepAlive: 30 * time.Second,
 	}
 	network = utils.ResolveNetwork(network)
-	return dialer.DialContext(ctx, network, address)
+	return dialer.DialContext(ctx, network, ResolvedAddress(ctx, address))
 }
 
 // Name returns the name of this dialer
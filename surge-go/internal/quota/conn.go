@@ -0,0 +1,33 @@
+package quota
+
+import "net"
+
+// Conn counts the traffic of a connection against the quotas of the policies it went through
+type Conn struct {
+	net.Conn
+	manager *Manager
+	names   []string
+}
+
+// NewConn wraps conn so its traffic counts against the quotas of names
+func NewConn(conn net.Conn, manager *Manager, names []string) net.Conn {
+	return &Conn{Conn: conn, manager: manager, names: names}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.count(n)
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.count(n)
+	return n, err
+}
+
+func (c *Conn) count(n int) {
+	for _, name := range c.names {
+		c.manager.Add(name, n)
+	}
+}
@@ -0,0 +1,302 @@
+package quota
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota periods
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// maxEvents is the number of recent quota events kept for the API
+const maxEvents = 50
+
+// Limit is the traffic allowance of a proxy in bytes. Zero means unlimited.
+type Limit struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// Usage is the traffic a proxy used in the current periods
+type Usage struct {
+	Day        string `json:"day"` // 2006-01-02
+	DayBytes   uint64 `json:"day_bytes"`
+	Month      string `json:"month"` // 2006-01
+	MonthBytes uint64 `json:"month_bytes"`
+}
+
+// Status is the quota state of a proxy
+type Status struct {
+	Name         string    `json:"name"`
+	DailyLimit   int64     `json:"daily_limit"`
+	DailyUsed    uint64    `json:"daily_used"`
+	MonthlyLimit int64     `json:"monthly_limit"`
+	MonthlyUsed  uint64    `json:"monthly_used"`
+	Exceeded     bool      `json:"exceeded"`
+	ResetsAt     time.Time `json:"resets_at,omitempty"` // When an exceeded proxy becomes available again
+}
+
+// Event is emitted when a proxy uses up a quota
+type Event struct {
+	Name   string    `json:"name"`
+	Period string    `json:"period"`
+	Limit  int64     `json:"limit"`
+	Used   uint64    `json:"used"`
+	Time   time.Time `json:"time"`
+}
+
+// Manager counts traffic per proxy against daily and monthly quotas
+type Manager struct {
+	mu     sync.Mutex
+	limits map[string]Limit
+	usage  map[string]*Usage
+	events []Event
+	subs   map[chan Event]struct{}
+	now    func() time.Time
+}
+
+// NewManager creates a manager without quotas
+func NewManager() *Manager {
+	return &Manager{
+		limits: make(map[string]Limit),
+		usage:  make(map[string]*Usage),
+		subs:   make(map[chan Event]struct{}),
+		now:    time.Now,
+	}
+}
+
+// Configure replaces the quotas. Usage of proxies keeping a quota is preserved.
+func (m *Manager) Configure(limits map[string]Limit) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limits = limits
+	for name := range m.usage {
+		if _, ok := limits[name]; !ok {
+			delete(m.usage, name)
+		}
+	}
+}
+
+// Restore loads usage saved by a previous run. Usage from past periods is dropped.
+func (m *Manager) Restore(saved map[string]Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, u := range saved {
+		if _, ok := m.limits[name]; !ok {
+			continue
+		}
+		u := u
+		m.rollLocked(&u)
+		m.usage[name] = &u
+	}
+}
+
+// Snapshot returns the usage of every proxy with a quota, for persistence
+func (m *Manager) Snapshot() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]Usage, len(m.usage))
+	for name, u := range m.usage {
+		out[name] = *u
+	}
+	return out
+}
+
+// rollLocked resets the counters of periods that ended
+func (m *Manager) rollLocked(u *Usage) {
+	now := m.now()
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day, u.DayBytes = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthBytes = month, 0
+	}
+}
+
+func (m *Manager) getLocked(name string) *Usage {
+	u, ok := m.usage[name]
+	if !ok {
+		u = &Usage{}
+		m.usage[name] = u
+	}
+	m.rollLocked(u)
+	return u
+}
+
+// Tracks reports whether any of names has a quota
+func (m *Manager) Tracks(names []string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := m.limits[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Add counts n bytes against the proxy's quotas. Proxies without a quota are not tracked.
+func (m *Manager) Add(name string, n int) {
+	if n <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	limit, ok := m.limits[name]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+
+	u := m.getLocked(name)
+	before := *u
+	u.DayBytes += uint64(n)
+	u.MonthBytes += uint64(n)
+
+	var hits []Event
+	if crossed(limit.Daily, before.DayBytes, u.DayBytes) {
+		hits = append(hits, Event{Name: name, Period: PeriodDaily, Limit: limit.Daily, Used: u.DayBytes, Time: m.now()})
+	}
+	if crossed(limit.Monthly, before.MonthBytes, u.MonthBytes) {
+		hits = append(hits, Event{Name: name, Period: PeriodMonthly, Limit: limit.Monthly, Used: u.MonthBytes, Time: m.now()})
+	}
+	for _, ev := range hits {
+		m.emitLocked(ev)
+	}
+	m.mu.Unlock()
+}
+
+func crossed(limit int64, before, after uint64) bool {
+	return limit > 0 && before < uint64(limit) && after >= uint64(limit)
+}
+
+func (m *Manager) emitLocked(ev Event) {
+	log.Printf("Quota: %s used up its %s quota (%d bytes)", ev.Name, ev.Period, ev.Limit)
+
+	m.events = append(m.events, ev)
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+	for ch := range m.subs {
+		// Slow subscribers miss events rather than blocking traffic
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Exceeded reports whether the proxy used up a quota in the current period
+func (m *Manager) Exceeded(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit, ok := m.limits[name]
+	if !ok {
+		return false
+	}
+	u, ok := m.usage[name]
+	if !ok {
+		return false
+	}
+	m.rollLocked(u)
+	return exceeded(limit, u)
+}
+
+func exceeded(limit Limit, u *Usage) bool {
+	return (limit.Daily > 0 && u.DayBytes >= uint64(limit.Daily)) ||
+		(limit.Monthly > 0 && u.MonthBytes >= uint64(limit.Monthly))
+}
+
+// Status returns the quota state of every proxy with a quota, sorted by name
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Status, 0, len(m.limits))
+	for name, limit := range m.limits {
+		u := m.getLocked(name)
+		st := Status{
+			Name:         name,
+			DailyLimit:   limit.Daily,
+			DailyUsed:    u.DayBytes,
+			MonthlyLimit: limit.Monthly,
+			MonthlyUsed:  u.MonthBytes,
+			Exceeded:     exceeded(limit, u),
+		}
+		if st.Exceeded {
+			st.ResetsAt = m.resetTime(limit, u)
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// resetTime returns when an exceeded proxy becomes available again
+func (m *Manager) resetTime(limit Limit, u *Usage) time.Time {
+	now := m.now()
+	y, mo, d := now.Date()
+	if limit.Monthly > 0 && u.MonthBytes >= uint64(limit.Monthly) {
+		return time.Date(y, mo+1, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, mo, d+1, 0, 0, 0, 0, now.Location())
+}
+
+// Events returns the most recent quota events, oldest first
+func (m *Manager) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Event, len(m.events))
+	copy(out, m.events)
+	return out
+}
+
+// Subscribe returns a channel receiving quota events and a function to unsubscribe
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subs, ch)
+		m.mu.Unlock()
+	}
+}
+
+// ParseSize parses a traffic amount such as "10GB" or "500MB" into bytes (binary multiples)
+func ParseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, u.suffix) {
+			v, mult = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.mult
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid traffic amount: %s", s)
+	}
+	return int64(f * float64(mult)), nil
+}
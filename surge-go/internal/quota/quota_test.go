@@ -0,0 +1,148 @@
+package quota
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestManager(now *time.Time) *Manager {
+	m := NewManager()
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func TestManager_ExceededAndReset(t *testing.T) {
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	m := newTestManager(&now)
+	m.Configure(map[string]Limit{"HK": {Daily: 100, Monthly: 250}})
+
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	m.Add("HK", 60)
+	if m.Exceeded("HK") {
+		t.Fatal("HK should have quota left")
+	}
+	m.Add("HK", 60)
+	if !m.Exceeded("HK") {
+		t.Fatal("HK should exceed its daily quota")
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Name != "HK" || ev.Period != PeriodDaily {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	default:
+		t.Fatal("expected a quota event")
+	}
+
+	// Exceeding again in the same period emits no new event
+	m.Add("HK", 10)
+	if got := len(m.Events()); got != 1 {
+		t.Errorf("events = %d, want 1", got)
+	}
+
+	// Midnight starts a new day and, here, a new month: both counters reset
+	now = now.Add(2 * time.Hour)
+	if m.Exceeded("HK") {
+		t.Fatal("quota should reset at midnight")
+	}
+	st := m.Status()
+	if len(st) != 1 || st[0].DailyUsed != 0 || st[0].MonthlyUsed != 0 {
+		t.Errorf("unexpected status after reset: %+v", st)
+	}
+}
+
+func TestManager_MonthlyQuota(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	m := newTestManager(&now)
+	m.Configure(map[string]Limit{"JP": {Monthly: 100}})
+
+	m.Add("JP", 100)
+	now = now.AddDate(0, 0, 1)
+	if !m.Exceeded("JP") {
+		t.Fatal("monthly quota should still be exceeded the next day")
+	}
+
+	st := m.Status()[0]
+	want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	if !st.ResetsAt.Equal(want) {
+		t.Errorf("ResetsAt = %v, want %v", st.ResetsAt, want)
+	}
+}
+
+func TestManager_UntrackedAndRestore(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	m := newTestManager(&now)
+	m.Configure(map[string]Limit{"HK": {Daily: 100}})
+
+	m.Add("US", 1000)
+	if m.Exceeded("US") || m.Tracks([]string{"US"}) {
+		t.Error("proxies without a quota should not be tracked")
+	}
+
+	m.Restore(map[string]Usage{
+		"HK":  {Day: "2026-03-10", DayBytes: 100, Month: "2026-03", MonthBytes: 100},
+		"Old": {Day: "2026-03-10", DayBytes: 100},
+	})
+	if !m.Exceeded("HK") {
+		t.Error("restored usage should count")
+	}
+	if _, ok := m.Snapshot()["Old"]; ok {
+		t.Error("usage of proxies without a quota should be dropped")
+	}
+
+	// Usage saved in a previous day is discarded
+	m.Restore(map[string]Usage{"HK": {Day: "2026-03-09", DayBytes: 100, Month: "2026-03", MonthBytes: 100}})
+	if m.Exceeded("HK") {
+		t.Error("usage from a past day should not count against the daily quota")
+	}
+}
+
+func TestConn_CountsTraffic(t *testing.T) {
+	m := NewManager()
+	m.Configure(map[string]Limit{"HK": {Daily: 1 << 20}})
+
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewConn(client, m, []string{"Proxy", "HK"})
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 5)
+		server.Read(buf)
+		server.Write([]byte("pong!!"))
+	}()
+
+	conn.Write([]byte("ping!"))
+	buf := make([]byte, 6)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if got := m.Status()[0].DailyUsed; got != 11 {
+		t.Errorf("DailyUsed = %d, want 11", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"10GB":   10 << 30,
+		"500MB":  500 << 20,
+		"1.5 tb": 3 << 39,
+		"2048":   2048,
+	}
+	for in, want := range tests {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "GB", "-1GB", "ten"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+}
@@ -33,7 +33,24 @@ func (r *ProtocolRule) Match(metadata *RequestMetadata) bool {
 	if r.Protocol == "udp" {
 		return strings.HasPrefix(metadata.Type, "udp")
 	}
-	return strings.EqualFold(metadata.Type, r.Protocol)
+	// HTTPS is TLS carrying HTTP
+	if r.Protocol == "tls" && strings.EqualFold(metadata.Protocol, "HTTPS") {
+		return true
+	}
+	return strings.EqualFold(metadata.Protocol, r.Protocol) || strings.EqualFold(metadata.Type, r.Protocol)
+}
+
+// unsupportedReason explains why r, or one of its sub-rules, can never match,
+// or returns "". QUIC runs over UDP, which no listener accepts yet, and it is
+// not sniffed.
+func unsupportedReason(r Rule) string {
+	var reason string
+	walkRules(r, func(sub Rule) {
+		if p, ok := sub.(*ProtocolRule); ok && p.Protocol == "quic" {
+			reason = "PROTOCOL,QUIC never matches: no listener accepts UDP and QUIC is not sniffed"
+		}
+	})
+	return reason
 }
 
 // DestPortRule matches destination port
@@ -72,7 +89,7 @@ func NewAndRule(rules []Rule, adapter string, noResolve bool) *AndRule {
 	return &AndRule{
 		BaseRule: BaseRule{
 			RuleType:    "AND",
-			RulePayload: "...", // Complex payload representation
+			RulePayload: formatSubRules(rules),
 			AdapterName: adapter,
 			NoResolve:   noResolve,
 		},
@@ -88,3 +105,52 @@ func (r *AndRule) Match(metadata *RequestMetadata) bool {
 	}
 	return true
 }
+
+// OrRule matches if any sub-rule matches
+type OrRule struct {
+	BaseRule
+	Rules []Rule
+}
+
+func NewOrRule(rules []Rule, adapter string, noResolve bool) *OrRule {
+	return &OrRule{
+		BaseRule: BaseRule{
+			RuleType:    "OR",
+			RulePayload: formatSubRules(rules),
+			AdapterName: adapter,
+			NoResolve:   noResolve,
+		},
+		Rules: rules,
+	}
+}
+
+func (r *OrRule) Match(metadata *RequestMetadata) bool {
+	for _, rule := range r.Rules {
+		if rule.Match(metadata) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotRule matches if its sub-rule does not match
+type NotRule struct {
+	BaseRule
+	Rule Rule
+}
+
+func NewNotRule(rule Rule, adapter string, noResolve bool) *NotRule {
+	return &NotRule{
+		BaseRule: BaseRule{
+			RuleType:    "NOT",
+			RulePayload: formatSubRules([]Rule{rule}),
+			AdapterName: adapter,
+			NoResolve:   noResolve,
+		},
+		Rule: rule,
+	}
+}
+
+func (r *NotRule) Match(metadata *RequestMetadata) bool {
+	return !r.Rule.Match(metadata)
+}
@@ -18,6 +18,28 @@ func TestProtocolRule(t *testing.T) {
 	}
 }
 
+func TestProtocolRule_Sniffed(t *testing.T) {
+	tests := []struct {
+		payload  string
+		protocol string
+		want     bool
+	}{
+		{"HTTPS", "HTTPS", true},
+		{"HTTPS", "TLS", false},
+		{"TLS", "HTTPS", true},
+		{"TLS", "TLS", true},
+		{"QUIC", "QUIC", true},
+		{"HTTP", "HTTPS", false},
+		{"HTTP", "", false},
+	}
+	for _, tt := range tests {
+		r := NewProtocolRule(tt.payload, "Proxy", false)
+		if got := r.Match(&RequestMetadata{Type: "tcp", Protocol: tt.protocol}); got != tt.want {
+			t.Errorf("PROTOCOL,%s on %q = %v, want %v", tt.payload, tt.protocol, got, tt.want)
+		}
+	}
+}
+
 func TestDestPortRule(t *testing.T) {
 	r, err := NewDestPortRule("80", "Proxy", false)
 	if err != nil {
@@ -0,0 +1,348 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+)
+
+// Severities of analysis issues
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Kinds of analysis issues
+const (
+	IssueInvalid          = "invalid"          // The rule cannot be created
+	IssueUndefinedPolicy  = "undefined-policy" // The policy names no proxy, group or built-in policy
+	IssueAfterFinal       = "after-final"      // The rule comes after FINAL
+	IssueShadowed         = "shadowed"         // An earlier rule sends all its traffic to another policy
+	IssueRedundant        = "redundant"        // An earlier rule sends all its traffic to the same policy
+	IssueRuleSetNotLoaded = "rule-set-not-loaded"
+	IssueUnsupported      = "unsupported" // The rule needs traffic no listener accepts
+)
+
+// Issue is a problem found by Analyze
+type Issue struct {
+	Severity    string `json:"severity"`
+	Kind        string `json:"kind"`
+	Index       int    `json:"index"`          // Position in the rule list
+	Line        int    `json:"line,omitempty"` // Line in the config file, if known
+	Rule        string `json:"rule"`
+	Policy      string `json:"policy"`
+	Message     string `json:"message"`
+	RelatedLine int    `json:"related_line,omitempty"` // Line of the rule taking the traffic
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", ruleLocation(i.Index, i.Line), i.Severity, i.Rule, i.Message)
+}
+
+func ruleLocation(index, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("rule #%d", index)
+}
+
+// Analyze looks for rules that are broken or can never match: invalid rules,
+// rules with undefined policies, rules after FINAL and rules whose traffic is
+// always taken by an earlier rule. policies are the names a rule may use.
+// Rule sets are analyzed with the content of the matching set in sets, if any.
+func Analyze(configs []*config.RuleConfig, policies []string, sets []*RuleSetRule) []Issue {
+	a := &analyzer{
+		configs:  configs,
+		rules:    make([]Rule, len(configs)),
+		policies: make(map[string]bool, len(policies)),
+		sets:     make(map[string]*RuleSetRule, len(sets)),
+		domains:  newDomainTrie(),
+		seen:     make(map[string]int),
+		final:    -1,
+	}
+	for _, p := range policies {
+		a.policies[p] = true
+	}
+	for _, rs := range sets {
+		a.sets[rs.Type()+","+rs.URL] = rs
+	}
+
+	for i := range configs {
+		a.analyze(i)
+	}
+	return a.issues
+}
+
+type analyzer struct {
+	configs  []*config.RuleConfig
+	rules    []Rule // Created from configs, nil where that failed
+	policies map[string]bool
+	sets     map[string]*RuleSetRule
+	issues   []Issue
+
+	// Earlier enabled rules that may take the traffic of later ones
+	domains *domainTrie    // DOMAIN and DOMAIN-SUFFIX rules
+	linear  []int          // Other rules taking traffic by host or IP
+	seen    map[string]int // Every rule, by type and payload
+	final   int            // First FINAL rule, or -1
+}
+
+func (a *analyzer) analyze(i int) {
+	cfg := a.configs[i]
+	r, err := ruleFromConfig(cfg)
+	if err != nil || r == nil {
+		msg := "unknown rule"
+		if err != nil {
+			msg = err.Error()
+		}
+		a.report(i, SeverityError, IssueInvalid, msg, -1)
+		return
+	}
+	if rs, ok := r.(*RuleSetRule); ok {
+		if loaded, ok := a.sets[rs.Type()+","+rs.URL]; ok {
+			r = loaded
+		}
+	}
+	a.rules[i] = r
+
+	if !a.policies[cfg.Policy] {
+		if cfg.Policy == "" {
+			a.report(i, SeverityError, IssueUndefinedPolicy, "no policy, DIRECT is used", -1)
+		} else {
+			a.report(i, SeverityError, IssueUndefinedPolicy, fmt.Sprintf("policy %s is not defined, DIRECT is used", cfg.Policy), -1)
+		}
+	}
+	if !cfg.Enabled {
+		return
+	}
+
+	if reason := unsupportedReason(r); reason != "" {
+		a.report(i, SeverityWarning, IssueUnsupported, reason, -1)
+	}
+	if a.final >= 0 {
+		a.report(i, SeverityWarning, IssueAfterFinal, "never evaluated: "+a.describe(a.final)+" matches everything first", a.final)
+		return
+	}
+	if j := a.takenBy(r); j >= 0 {
+		if a.configs[j].Policy == cfg.Policy {
+			a.report(i, SeverityWarning, IssueRedundant, a.describe(j)+" already sends all its traffic to "+cfg.Policy, j)
+		} else {
+			a.report(i, SeverityWarning, IssueShadowed, "never matches: "+a.describe(j)+" sends all its traffic to "+a.configs[j].Policy+" first", j)
+		}
+	}
+	if rs, ok := r.(*RuleSetRule); ok && rs.Size() == 0 && rs.Status().LastUpdate == nil {
+		a.report(i, SeverityInfo, IssueRuleSetNotLoaded, "not loaded, its entries were not analyzed", -1)
+	}
+	a.add(i, r)
+}
+
+// takenBy returns the first earlier rule matching all traffic r matches, or -1
+func (a *analyzer) takenBy(r Rule) int {
+	best := -1
+	take := func(j int) {
+		if best < 0 || j < best {
+			best = j
+		}
+	}
+
+	if j, ok := a.seen[ruleKey(r)]; ok {
+		take(j)
+	}
+	switch r := r.(type) {
+	case *DomainRule:
+		a.domains.covering(r.RulePayload, false, take)
+	case *DomainSuffixRule:
+		a.domains.covering(r.RulePayload, true, take)
+	}
+	for _, j := range a.linear {
+		if (best < 0 || j < best) && covers(a.rules[j], r) {
+			take(j)
+		}
+	}
+	return best
+}
+
+// add records an enabled rule as a candidate to take the traffic of later ones.
+// Rules with a schedule leave it to later rules outside of it.
+func (a *analyzer) add(i int, r Rule) {
+	if r.Schedule() != nil {
+		return
+	}
+	if _, ok := a.seen[ruleKey(r)]; !ok {
+		a.seen[ruleKey(r)] = i
+	}
+	switch r := r.(type) {
+	case *FinalRule:
+		a.final = i
+	case *DomainRule:
+		if !a.domains.insert(r.RulePayload, i, domainExact) {
+			a.linear = append(a.linear, i)
+		}
+	case *DomainSuffixRule:
+		if !a.domains.insert(r.RulePayload, i, domainSuffix) {
+			a.linear = append(a.linear, i)
+		}
+	case *DomainKeywordRule, *IPCIDRRule, *RuleSetRule:
+		a.linear = append(a.linear, i)
+	}
+}
+
+func (a *analyzer) report(i int, severity, kind, msg string, related int) {
+	issue := Issue{
+		Severity: severity,
+		Kind:     kind,
+		Index:    i,
+		Line:     a.configs[i].Line,
+		Rule:     describeConfig(a.configs[i]),
+		Policy:   a.configs[i].Policy,
+		Message:  msg,
+	}
+	if related >= 0 {
+		issue.RelatedLine = a.configs[related].Line
+	}
+	a.issues = append(a.issues, issue)
+}
+
+// describe names rule i in a message
+func (a *analyzer) describe(i int) string {
+	return fmt.Sprintf("%s (%s)", ruleLocation(i, a.configs[i].Line), describeConfig(a.configs[i]))
+}
+
+func describeConfig(cfg *config.RuleConfig) string {
+	if cfg.Value == "" {
+		return cfg.Type
+	}
+	return cfg.Type + "," + cfg.Value
+}
+
+// ruleKey identifies rules matching the same traffic by their definition
+func ruleKey(r Rule) string {
+	key := r.Type() + "," + r.Payload()
+	if nr, ok := r.(interface{ noResolve() bool }); ok && nr.noResolve() {
+		key += ",no-resolve"
+	}
+	return key
+}
+
+// covers reports whether rule e matches all traffic rule r matches. It knows
+// the rules matching by host or IP and answers false when unsure.
+func covers(e, r Rule) bool {
+	switch e := e.(type) {
+	case *DomainRule:
+		d, ok := r.(*DomainRule)
+		return ok && d.RulePayload == e.RulePayload
+	case *DomainSuffixRule:
+		// A suffix matching the suffix of r also matches its subdomains
+		switch r.(type) {
+		case *DomainRule, *DomainSuffixRule:
+			return e.Match(&RequestMetadata{Host: r.Payload()})
+		}
+	case *DomainKeywordRule:
+		switch r.(type) {
+		case *DomainRule, *DomainSuffixRule, *DomainKeywordRule:
+			return strings.Contains(r.Payload(), e.RulePayload)
+		}
+	case *IPCIDRRule:
+		c, ok := r.(*IPCIDRRule)
+		// Without no-resolve, r resolves domains that never reach e
+		return ok && (!e.NoResolve || c.NoResolve) && networkCovers(e.ipNet, c.ipNet)
+	case *RuleSetRule:
+		return e.covers(r)
+	}
+	return false
+}
+
+// covers reports whether an entry or rule of the set matches all traffic r matches
+func (s *RuleSetRule) covers(r Rule) bool {
+	if c, ok := r.(*IPCIDRRule); ok && s.NoResolve && !c.NoResolve {
+		return false
+	}
+
+	s.UpdateMu.RLock()
+	list, rules := s.list, s.Rules
+	s.UpdateMu.RUnlock()
+	if list != nil && list.covers(r) {
+		return true
+	}
+	for _, sub := range rules {
+		if covers(sub, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *listMatcher) covers(r Rule) bool {
+	found := false
+	hit := func(int) { found = true }
+
+	switch r := r.(type) {
+	case *DomainRule:
+		if m.domains.covering(r.RulePayload, false, hit); found {
+			return true
+		}
+		for _, re := range m.regexes {
+			if re.MatchString(r.RulePayload) {
+				return true
+			}
+		}
+	case *DomainSuffixRule:
+		if m.domains.covering(r.RulePayload, true, hit); found {
+			return true
+		}
+	case *DomainKeywordRule:
+	case *IPCIDRRule:
+		network := m.ips.first(r.ipNet.IP)
+		if network == nil {
+			return false
+		}
+		ones, _ := network.Mask.Size()
+		rOnes, _ := r.ipNet.Mask.Size()
+		return ones <= rOnes
+	default:
+		return false
+	}
+
+	for _, k := range m.keywordList {
+		if strings.Contains(r.Payload(), k) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkCovers reports whether network a contains network b
+func networkCovers(a, b *net.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+}
+
+// CachedRuleSets creates the rule sets of configs with the content cached in
+// cacheDir, for analysis without downloading them. Sets without a usable cache
+// are left out.
+func CachedRuleSets(configs []*config.RuleConfig, cacheDir string) []*RuleSetRule {
+	var sets []*RuleSetRule
+	for _, cfg := range configs {
+		r, err := CreateRuleFromConfig(cfg.Type, cfg.Value, cfg.Policy, cfg.NoResolve, cfg.Enabled, "")
+		if err != nil {
+			continue
+		}
+		for _, rs := range ruleSets([]Rule{r}) {
+			if err := rs.LoadCache(cacheDir); err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					log.Printf("Rule set %s: ignoring cache: %v", rs.URL, err)
+				}
+				continue
+			}
+			sets = append(sets, rs)
+		}
+	}
+	return sets
+}
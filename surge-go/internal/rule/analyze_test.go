@@ -0,0 +1,133 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+)
+
+func TestAnalyze(t *testing.T) {
+	set, _ := NewRuleSetRule("https://example.com/set.list", "REJECT", nil)
+	if err := set.Load([]byte("DOMAIN-SUFFIX,tracker.com\nDOMAIN-KEYWORD,adserver\nIP-CIDR,192.168.0.0/16\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{
+		"DOMAIN-SUFFIX,google.com,Proxy",
+		"DOMAIN,www.google.com,DIRECT",
+		"DOMAIN,mail.google.com,Proxy",
+		"DOMAIN-KEYWORD,ads,REJECT",
+		"DOMAIN-SUFFIX,ads.example.com,REJECT",
+		"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve",
+		"IP-CIDR,10.1.0.0/16,Proxy",
+		"IP-CIDR,10.2.0.0/16,Proxy,no-resolve",
+		"RULE-SET,https://example.com/set.list,REJECT",
+		"DOMAIN,cdn.tracker.com,DIRECT",
+		"IP-CIDR,192.168.1.0/24,DIRECT",
+		"RULE-SET,https://example.com/missing.list,REJECT",
+		"DOMAIN,x.com,Nowhere",
+		"FOO,bar,DIRECT",
+		"DOMAIN,off.google.com,DIRECT",
+		"FINAL,Proxy",
+		"DOMAIN,late.com,DIRECT",
+	}
+	configs := config.ParseRules(lines)
+	for i, cfg := range configs {
+		cfg.Line = i + 1
+	}
+	configs[14].Enabled = false
+
+	issues := Analyze(configs, []string{"DIRECT", "REJECT", "Proxy"}, []*RuleSetRule{set})
+
+	want := []struct {
+		line, related int
+		kind          string
+	}{
+		{2, 1, IssueShadowed},
+		{3, 1, IssueRedundant},
+		{5, 4, IssueRedundant},
+		{8, 6, IssueShadowed},
+		{10, 9, IssueShadowed},
+		{11, 9, IssueShadowed},
+		{12, 0, IssueRuleSetNotLoaded},
+		{13, 0, IssueUndefinedPolicy},
+		{14, 0, IssueInvalid},
+		{17, 16, IssueAfterFinal},
+	}
+	if len(issues) != len(want) {
+		for _, issue := range issues {
+			t.Log(issue)
+		}
+		t.Fatalf("got %d issues, want %d", len(issues), len(want))
+	}
+	for i, w := range want {
+		got := issues[i]
+		if got.Line != w.line || got.RelatedLine != w.related || got.Kind != w.kind {
+			t.Errorf("issue %d = %v (kind %s, related line %d), want line %d, kind %s, related line %d",
+				i, got, got.Kind, got.RelatedLine, w.line, w.kind, w.related)
+		}
+	}
+	if issues[7].Severity != SeverityError || issues[0].Severity != SeverityWarning {
+		t.Errorf("unexpected severities: %s, %s", issues[7].Severity, issues[0].Severity)
+	}
+}
+
+func TestDomainTrieCovering(t *testing.T) {
+	trie := newDomainTrie()
+	trie.insert("example.com", 0, domainSuffix)
+	trie.insert("exact.org", 1, domainExact)
+	trie.insert("sub.net", 2, domainSubdomains)
+
+	tests := []struct {
+		domain     string
+		subdomains bool
+		want       bool
+	}{
+		{"example.com", true, true},
+		{"a.example.com", false, true},
+		{"exact.org", false, true},
+		{"exact.org", true, false},
+		{"a.exact.org", false, false},
+		{"sub.net", false, false},
+		{"a.sub.net", true, true},
+		{"other.com", false, false},
+	}
+	for _, tt := range tests {
+		found := false
+		trie.covering(tt.domain, tt.subdomains, func(int) { found = true })
+		if found != tt.want {
+			t.Errorf("covering(%q, %v) = %v, want %v", tt.domain, tt.subdomains, found, tt.want)
+		}
+	}
+}
+
+func TestAnalyze_Schedule(t *testing.T) {
+	configs := config.ParseRules([]string{
+		"DOMAIN-SUFFIX,corp.com,Corp,schedule=Mon-Fri 09:00-18:00",
+		"DOMAIN,git.corp.com,DIRECT",
+		"DOMAIN,a.com,Corp,schedule=Someday",
+		"FINAL,DIRECT,schedule=Sat Sun",
+		"DOMAIN,b.com,Corp",
+	})
+	issues := Analyze(configs, []string{"DIRECT", "Corp"}, nil)
+	if len(issues) != 1 || issues[0].Index != 2 || issues[0].Kind != IssueInvalid {
+		t.Errorf("got %v, want only the invalid schedule of rule 3", issues)
+	}
+}
+
+func TestAnalyze_QUIC(t *testing.T) {
+	configs := config.ParseRules([]string{
+		"PROTOCOL,QUIC,REJECT",
+		"AND,((DEST-PORT,443),(NOT,((PROTOCOL,QUIC)))),DIRECT",
+		"PROTOCOL,TLS,DIRECT",
+	})
+	issues := Analyze(configs, []string{"DIRECT", "REJECT"}, nil)
+	if len(issues) != 2 {
+		t.Fatalf("got %v, want the two rules using PROTOCOL,QUIC", issues)
+	}
+	for i, issue := range issues {
+		if issue.Index != i || issue.Kind != IssueUnsupported || issue.Severity != SeverityWarning {
+			t.Errorf("issue %d = %v (kind %s)", i, issue, issue.Kind)
+		}
+	}
+}
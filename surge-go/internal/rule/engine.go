@@ -1,18 +1,41 @@
 package rule
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/surge-proxy/surge-go/internal/config"
 )
 
 // Engine manages lifecycle and matching of rules
 type Engine struct {
-	rules []Rule
-	mu    sync.RWMutex
+	rules    []Rule
+	index    *ruleIndex // Compiled on first match after the rules change
+	resolver IPResolver
+	mu       sync.RWMutex
+
+	cacheDir string             // Where downloaded rule sets are cached, if set
+	setsCtx  context.Context    // Canceled when the rule sets are replaced
+	stopSets context.CancelFunc // Stops the updates of the current rule sets
+
+	runtime       []*runtimeRule // Evaluated before rules, newest first
+	nextRuntimeID int
+	nextExpiry    time.Time // When the next runtime rule expires, zero if none does
 }
 
+// ErrRuleSetNotFound is returned for a rule-set URL that no loaded rule uses
+var ErrRuleSetNotFound = errors.New("rule set not found")
+
+// IPResolver returns the IP of a domain, or nil if it cannot be resolved
+// before ctx ends
+type IPResolver func(ctx context.Context, host string) net.IP
+
 // NewEngine creates a new rule engine
 func NewEngine() *Engine {
 	return &Engine{
@@ -25,6 +48,7 @@ func (e *Engine) Add(r Rule) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.rules = append(e.rules, r)
+	e.index = nil
 }
 
 // LoadFromConfig loads rules from configuration lines
@@ -41,22 +65,13 @@ func (e *Engine) LoadFromConfig(ruleLines []string) error {
 			return fmt.Errorf("failed to parse rule line '%s': %v", line, err)
 		}
 		if rule != nil {
+			warnUnsupported(rule)
 			rules = append(rules, rule)
-
-			// If it's a RULE-SET, start its auto-update?
-			// Ideally we should manage this better, but for now simple start is ok.
-			if rs, ok := rule.(*RuleSetRule); ok {
-				// Start auto update every 24h by default, or configurable
-				// Need update-interval logic which is usually in the config line options.
-				// For now hardcode or skip.
-				// We can just trigger a download now in background.
-				go func() {
-					_ = rs.UpdateFromURL()
-				}()
-			}
 		}
 	}
 	e.rules = rules
+	e.index = nil
+	e.startRuleSets()
 	return nil
 }
 
@@ -67,24 +82,131 @@ func (e *Engine) LoadRulesFromConfigs(configs []*config.RuleConfig) error {
 
 	var rules []Rule
 	for _, cfg := range configs {
-		rule, err := CreateRuleFromConfig(cfg.Type, cfg.Value, cfg.Policy, cfg.NoResolve, cfg.Enabled, cfg.Comment)
+		rule, err := ruleFromConfig(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to create rule from config: %v", err)
 		}
 		if rule != nil {
+			warnUnsupported(rule)
 			rules = append(rules, rule)
-
-			if rs, ok := rule.(*RuleSetRule); ok {
-				go func() {
-					_ = rs.UpdateFromURL()
-				}()
-			}
 		}
 	}
 	e.rules = rules
+	e.index = nil
+	e.startRuleSets()
 	return nil
 }
 
+// warnUnsupported logs an enabled rule that can never match
+func warnUnsupported(r Rule) {
+	if reason := unsupportedReason(r); reason != "" && r.IsEnabled() {
+		log.Printf("Rule %s: %s", describeRule(r), reason)
+	}
+}
+
+// SetRuleSetCacheDir sets the directory where downloaded rule sets are kept,
+// so they are available right away on the next start. It applies to rule sets
+// loaded afterwards.
+func (e *Engine) SetRuleSetCacheDir(dir string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cacheDir = dir
+}
+
+// startRuleSets stops the updates of the previous rule sets, loads the current
+// ones from the cache and starts their updates. e.mu must be held.
+func (e *Engine) startRuleSets() {
+	if e.stopSets != nil {
+		e.stopSets()
+	}
+	e.setsCtx, e.stopSets = context.WithCancel(context.Background())
+
+	for _, rs := range ruleSets(e.rules) {
+		if e.cacheDir != "" {
+			if err := rs.LoadCache(e.cacheDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Rule set %s: ignoring cache: %v", rs.URL, err)
+			}
+		}
+		go rs.run(e.setsCtx, e.cacheDir)
+	}
+}
+
+// ruleSets returns the rule sets among rules, including those nested in
+// logical rules, in rule order
+func ruleSets(rules []Rule) []*RuleSetRule {
+	var sets []*RuleSetRule
+	for _, r := range rules {
+		walkRules(r, func(sub Rule) {
+			if rs, ok := sub.(*RuleSetRule); ok {
+				sets = append(sets, rs)
+			}
+		})
+	}
+	return sets
+}
+
+// Close stops the updates of the rule sets
+func (e *Engine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopSets != nil {
+		e.stopSets()
+		e.stopSets = nil
+	}
+}
+
+// RuleSets returns the status of every loaded rule set, in rule order. Sets
+// nested in logical rules are included.
+func (e *Engine) RuleSets() []RuleSetStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]RuleSetStatus, 0)
+	for _, rs := range ruleSets(e.rules) {
+		statuses = append(statuses, rs.Status())
+	}
+	return statuses
+}
+
+// RuleSetRules returns the rule sets in use, with their current content
+func (e *Engine) RuleSetRules() []*RuleSetRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return ruleSets(e.rules)
+}
+
+// RefreshRuleSet downloads the rule sets with the given URL now and returns
+// their status
+func (e *Engine) RefreshRuleSet(url string) ([]RuleSetStatus, error) {
+	e.mu.RLock()
+	var sets []*RuleSetRule
+	for _, rs := range ruleSets(e.rules) {
+		if rs.URL == url {
+			sets = append(sets, rs)
+		}
+	}
+	ctx, cacheDir := e.setsCtx, e.cacheDir
+	e.mu.RUnlock()
+
+	if len(sets) == 0 {
+		return nil, ErrRuleSetNotFound
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var firstErr error
+	statuses := make([]RuleSetStatus, 0, len(sets))
+	for _, rs := range sets {
+		if err := rs.Update(ctx, cacheDir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		statuses = append(statuses, rs.Status())
+	}
+	return statuses, firstErr
+}
+
 // GetRules returns all loaded rules
 func (e *Engine) GetRules() []Rule {
 	e.mu.RLock()
@@ -98,11 +220,11 @@ func (e *Engine) GetRules() []Rule {
 	return copied
 }
 
-// ResetCounters resets hit counts for all rules
+// ResetCounters resets hit counts and traffic statistics for all rules
 func (e *Engine) ResetCounters() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	for _, r := range e.rules {
+	for _, r := range e.evaluated() {
 		r.ResetHitCount()
 	}
 }
@@ -120,26 +242,72 @@ func (e *Engine) ToggleRule(index int, enabled bool) error {
 	return nil
 }
 
-// Match finds the first matching rule for the request
+// SetResolver sets the resolver used when a domain request reaches an
+// IP-based rule without no-resolve
+func (e *Engine) SetResolver(fn IPResolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resolver = fn
+}
+
+// Match finds the first matching rule for the request, runtime rules first. A
+// domain is resolved only when matching reaches the first IP-based rule without
+// no-resolve; the IP is stored in metadata.DnsIP.
 func (e *Engine) Match(metadata *RequestMetadata) (string, Rule) {
+	t := now()
+	e.expireRuntimeRules(t)
+	idx := e.compiled()
 	e.mu.RLock()
-	defer e.mu.RUnlock()
+	resolver := e.resolver
+	e.mu.RUnlock()
 
-	for _, r := range e.rules {
-		if !r.IsEnabled() {
-			continue
-		}
-		if r.Match(metadata) {
-			r.IncrementHitCount()
-			return r.Adapter(), r
+	usable := usableAt(t)
+	i := idx.match(metadata, usable, 0)
+	if resolver != nil && needsIP(metadata) {
+		// Rules before the first resolving rule were evaluated without an IP, as
+		// they would be in order; evaluation continues from there with the IP.
+		if p := idx.firstResolve(usable); p >= 0 && (i < 0 || p < i) {
+			if ip := resolver(metadata.context(), metadata.Host); ip != nil {
+				metadata.DnsIP = ip
+				i = idx.match(metadata, usable, p)
+			}
 		}
 	}
 
+	if i >= 0 {
+		r := idx.rules[i]
+		r.IncrementHitCount()
+		return r.Adapter(), r
+	}
+
 	// No match found - technically should hit FINAL if present.
 	// If no match and no FINAL, usually Direct or error.
 	return "", nil
 }
 
+// needsIP reports whether the request is for a domain that was not resolved yet
+func needsIP(metadata *RequestMetadata) bool {
+	return metadata.IP == nil && metadata.DnsIP == nil && metadata.Host != "" && net.ParseIP(metadata.Host) == nil
+}
+
+// compiled returns the index of the runtime and config rules, building it if
+// the rules changed
+func (e *Engine) compiled() *ruleIndex {
+	e.mu.RLock()
+	idx := e.index
+	e.mu.RUnlock()
+	if idx != nil {
+		return idx
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.index == nil {
+		e.index = newRuleIndex(e.evaluated())
+	}
+	return e.index
+}
+
 // Count returns number of loaded rules
 func (e *Engine) Count() int {
 	e.mu.RLock()
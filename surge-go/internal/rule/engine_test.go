@@ -1,6 +1,8 @@
 package rule
 
 import (
+	"context"
+	"net"
 	"testing"
 )
 
@@ -38,3 +40,70 @@ func TestEngine(t *testing.T) {
 		}
 	}
 }
+
+func TestEngine_ResolvesLazily(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.LoadFromConfig([]string{
+		"DOMAIN-SUFFIX,example.com,Proxy",
+		"IP-CIDR,192.168.0.0/16,LAN-NoResolve,no-resolve",
+		"IP-CIDR,10.0.0.0/8,Private",
+		"IP-CIDR,192.168.0.0/16,LAN",
+		"FINAL,Final",
+	}); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	lookups := 0
+	engine.SetResolver(func(ctx context.Context, host string) net.IP {
+		lookups++
+		if ctx.Err() != nil {
+			return nil
+		}
+		switch host {
+		case "nas.home":
+			return net.IPv4(192, 168, 1, 2)
+		case "intranet.corp":
+			return net.IPv4(10, 1, 2, 3)
+		}
+		return nil
+	})
+
+	// Matched before any IP rule: no lookup
+	meta := &RequestMetadata{Host: "www.example.com"}
+	if adapter, _ := engine.Match(meta); adapter != "Proxy" || lookups != 0 || meta.DnsIP != nil {
+		t.Fatalf("adapter = %s, lookups = %d, want Proxy without lookup", adapter, lookups)
+	}
+
+	// Resolved at the first IP rule without no-resolve; the earlier no-resolve rule is skipped
+	meta = &RequestMetadata{Host: "nas.home"}
+	if adapter, _ := engine.Match(meta); adapter != "LAN" {
+		t.Errorf("adapter = %s, want LAN", adapter)
+	}
+	if lookups != 1 || !meta.DnsIP.Equal(net.IPv4(192, 168, 1, 2)) {
+		t.Errorf("lookups = %d, DnsIP = %v", lookups, meta.DnsIP)
+	}
+
+	meta = &RequestMetadata{Host: "intranet.corp"}
+	if adapter, _ := engine.Match(meta); adapter != "Private" {
+		t.Errorf("adapter = %s, want Private", adapter)
+	}
+
+	// Unresolvable domains fall through to FINAL
+	if adapter, _ := engine.Match(&RequestMetadata{Host: "unknown.test"}); adapter != "Final" {
+		t.Errorf("adapter = %s, want Final", adapter)
+	}
+
+	// The lookup ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if adapter, _ := engine.Match(&RequestMetadata{Host: "nas.home", Context: ctx}); adapter != "Final" {
+		t.Errorf("canceled request: adapter = %s, want Final", adapter)
+	}
+
+	// IP requests are never resolved
+	before := lookups
+	engine.Match(&RequestMetadata{Host: "10.0.0.1", IP: net.ParseIP("10.0.0.1")})
+	if lookups != before {
+		t.Error("IP requests should not be resolved")
+	}
+}
@@ -1,6 +1,10 @@
 package rule
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/surge-proxy/surge-go/internal/geoip"
 )
 
@@ -47,3 +51,50 @@ func (r *GeoIPRule) Match(metadata *RequestMetadata) bool {
 
 	return isoCode == r.CountryCode
 }
+
+// IPASNRule matches the autonomous system of the IP, from the ASN database
+type IPASNRule struct {
+	BaseRule
+	ASN uint
+}
+
+// NewIPASNRule accepts the AS number with or without the "AS" prefix
+func NewIPASNRule(asn, adapter string, noResolve bool) (*IPASNRule, error) {
+	trimmed := strings.TrimSpace(asn)
+	if len(trimmed) > 2 && strings.EqualFold(trimmed[:2], "AS") {
+		trimmed = trimmed[2:]
+	}
+	n, err := strconv.ParseUint(trimmed, 10, 32)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid IP-ASN: %s", asn)
+	}
+	return &IPASNRule{
+		BaseRule: BaseRule{
+			RuleType:    "IP-ASN",
+			RulePayload: asn,
+			AdapterName: adapter,
+			NoResolve:   noResolve,
+		},
+		ASN: uint(n),
+	}, nil
+}
+
+func (r *IPASNRule) Match(metadata *RequestMetadata) bool {
+	ip := metadata.IP
+	if ip == nil {
+		if r.NoResolve {
+			return false
+		}
+		ip = metadata.DnsIP
+	}
+
+	if ip == nil || !geoip.IsASNInitialized() {
+		return false
+	}
+
+	res, err := geoip.LookupASN(ip)
+	if err != nil {
+		return false
+	}
+	return res.Number == r.ASN
+}
@@ -0,0 +1,107 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/surge-proxy/surge-go/internal/geosite"
+)
+
+// GeoSiteRule matches the domains of a v2ray geosite category, such as
+// "netflix" or "google@cn". The category is compiled into the same index as
+// DOMAIN, DOMAIN-SUFFIX and DOMAIN-KEYWORD rules.
+type GeoSiteRule struct {
+	BaseRule
+	Category string
+
+	mu    sync.RWMutex
+	db    *geosite.Database // Database the index was compiled from
+	index *ruleIndex
+}
+
+// NewGeoSiteRule creates a GEOSITE rule. The category is checked against the
+// geosite database if one is loaded; otherwise the rule matches nothing until it is.
+func NewGeoSiteRule(category, adapter string) (*GeoSiteRule, error) {
+	if db := geosite.Default(); db != nil {
+		if _, ok := db.Domains(category); !ok {
+			return nil, fmt.Errorf("unknown GEOSITE category: %s", category)
+		}
+	}
+	return &GeoSiteRule{
+		BaseRule: BaseRule{
+			RuleType:    "GEOSITE",
+			RulePayload: category,
+			AdapterName: adapter,
+		},
+		Category: category,
+	}, nil
+}
+
+func (r *GeoSiteRule) Match(metadata *RequestMetadata) bool {
+	if metadata.Host == "" {
+		return false
+	}
+	idx := r.compiled()
+	return idx != nil && idx.match(metadata, nil, 0) >= 0
+}
+
+// compiled returns the index over the category's domains, rebuilding it when
+// the geosite database was reloaded. It returns nil without a database.
+func (r *GeoSiteRule) compiled() *ruleIndex {
+	db := geosite.Default()
+	if db == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	idx, built := r.index, r.db
+	r.mu.RUnlock()
+	if built == db {
+		return idx
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db != db {
+		domains, _ := db.Domains(r.Category)
+		r.index = newRuleIndex(geoSiteRules(domains))
+		r.db = db
+	}
+	return r.index
+}
+
+// geoSiteRules converts geosite entries into domain rules
+func geoSiteRules(domains []geosite.Domain) []Rule {
+	rules := make([]Rule, 0, len(domains))
+	for _, d := range domains {
+		value := strings.ToLower(d.Value)
+		switch d.Type {
+		case geosite.Full:
+			rules = append(rules, NewDomainRule(value, ""))
+		case geosite.Suffix:
+			rules = append(rules, NewDomainSuffixRule(value, ""))
+		case geosite.Plain:
+			rules = append(rules, NewDomainKeywordRule(value, ""))
+		case geosite.Regex:
+			if re, err := regexp.Compile(d.Value); err == nil {
+				rules = append(rules, &domainRegexRule{
+					BaseRule: BaseRule{RuleType: "DOMAIN-REGEX", RulePayload: d.Value},
+					re:       re,
+				})
+			}
+		}
+	}
+	return rules
+}
+
+// domainRegexRule matches the domain against a regular expression
+type domainRegexRule struct {
+	BaseRule
+	re *regexp.Regexp
+}
+
+func (r *domainRegexRule) Match(metadata *RequestMetadata) bool {
+	return metadata.Host != "" && r.re.MatchString(strings.ToLower(metadata.Host))
+}
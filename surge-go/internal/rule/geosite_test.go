@@ -0,0 +1,113 @@
+package rule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/geosite"
+)
+
+// writeGeoSite writes a geosite.dat with one category. Each domain is a
+// (type, value) pair encoded as a protobuf routercommon.Domain.
+func writeGeoSite(t *testing.T, category string, domains map[string]geosite.DomainType) string {
+	t.Helper()
+	field := func(b []byte, num int, data []byte) []byte {
+		b = append(b, byte(num<<3|2), byte(len(data)))
+		return append(b, data...)
+	}
+
+	site := field(nil, 1, []byte(category))
+	for value, typ := range domains {
+		d := []byte{1 << 3, byte(typ)}
+		d = field(d, 2, []byte(value))
+		site = field(site, 2, d)
+	}
+	list := field(nil, 1, site)
+
+	path := filepath.Join(t.TempDir(), "geosite.dat")
+	if err := os.WriteFile(path, list, 0644); err != nil {
+		t.Fatalf("failed to write geosite data: %v", err)
+	}
+	return path
+}
+
+func TestGeoSiteRule(t *testing.T) {
+	geosite.Close()
+	defer geosite.Close()
+
+	r, err := NewGeoSiteRule("netflix", "Streaming")
+	if err != nil {
+		t.Fatalf("rules can be created before the database is loaded: %v", err)
+	}
+	if r.Match(&RequestMetadata{Host: "www.netflix.com"}) {
+		t.Error("should not match without a database")
+	}
+
+	path := writeGeoSite(t, "NETFLIX", map[string]geosite.DomainType{
+		"netflix.com":        geosite.Suffix,
+		"fast.com":           geosite.Full,
+		"nflxvideo":          geosite.Plain,
+		`^nflx\d+\.example$`: geosite.Regex,
+	})
+	if err := geosite.Init(path); err != nil {
+		t.Fatalf("geosite.Init: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"netflix.com", true},
+		{"WWW.Netflix.com", true},
+		{"fast.com", true},
+		{"www.fast.com", false},
+		{"ipv4-c001.nflxvideo.net", true},
+		{"nflx42.example", true},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := r.Match(&RequestMetadata{Host: tt.host}); got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRule("GEOSITE,unknown,Proxy"); err == nil {
+		t.Error("expected error for unknown category once the database is loaded")
+	}
+
+	// Reloading the database recompiles the category
+	path = writeGeoSite(t, "NETFLIX", map[string]geosite.DomainType{"netflix.net": geosite.Suffix})
+	if err := geosite.Init(path); err != nil {
+		t.Fatalf("geosite.Init: %v", err)
+	}
+	if r.Match(&RequestMetadata{Host: "netflix.com"}) || !r.Match(&RequestMetadata{Host: "www.netflix.net"}) {
+		t.Error("rule should follow the reloaded database")
+	}
+}
+
+func TestIPASNRule(t *testing.T) {
+	for _, payload := range []string{"13335", "AS13335", "as13335"} {
+		r, err := NewIPASNRule(payload, "DIRECT", false)
+		if err != nil {
+			t.Fatalf("NewIPASNRule(%q): %v", payload, err)
+		}
+		if r.ASN != 13335 {
+			t.Errorf("NewIPASNRule(%q).ASN = %d", payload, r.ASN)
+		}
+	}
+	for _, payload := range []string{"", "AS", "cloudflare", "0"} {
+		if _, err := NewIPASNRule(payload, "DIRECT", false); err == nil {
+			t.Errorf("expected error for %q", payload)
+		}
+	}
+
+	r, _ := ParseRule("IP-ASN,13335,DIRECT")
+	if !mayResolve(r) {
+		t.Error("IP-ASN needs the IP of domain requests")
+	}
+	r, _ = ParseRule("IP-ASN,13335,DIRECT,no-resolve")
+	if mayResolve(r) {
+		t.Error("no-resolve IP-ASN must not resolve")
+	}
+}
@@ -0,0 +1,117 @@
+package rule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HTTP rules match the request itself, which is only known for plain HTTP and
+// MITM'd HTTPS. Other traffic has no URL or headers and never matches them.
+
+// URLRegexRule matches the full request URL against a regular expression
+type URLRegexRule struct {
+	BaseRule
+	re *regexp.Regexp
+}
+
+func NewURLRegexRule(pattern, adapter string) (*URLRegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL-REGEX %q: %v", pattern, err)
+	}
+	return &URLRegexRule{
+		BaseRule: BaseRule{
+			RuleType:    "URL-REGEX",
+			RulePayload: pattern,
+			AdapterName: adapter,
+		},
+		re: re,
+	}, nil
+}
+
+func (r *URLRegexRule) Match(metadata *RequestMetadata) bool {
+	return metadata.URL != "" && r.re.MatchString(metadata.URL)
+}
+
+// UserAgentRule matches the User-Agent header against a wildcard pattern,
+// where * matches any run of characters and ? a single one
+type UserAgentRule struct {
+	BaseRule
+	re *regexp.Regexp
+}
+
+func NewUserAgentRule(pattern, adapter string) *UserAgentRule {
+	return &UserAgentRule{
+		BaseRule: BaseRule{
+			RuleType:    "USER-AGENT",
+			RulePayload: pattern,
+			AdapterName: adapter,
+		},
+		re: compileWildcard(pattern),
+	}
+}
+
+func (r *UserAgentRule) Match(metadata *RequestMetadata) bool {
+	ua := metadata.Headers.Get("User-Agent")
+	return ua != "" && r.re.MatchString(ua)
+}
+
+// HeaderRule matches a request header. The payload is "Name" to require the
+// header, or "Name:pattern" to match its value against a wildcard pattern.
+type HeaderRule struct {
+	BaseRule
+	name string
+	re   *regexp.Regexp // nil when only the presence of the header is checked
+}
+
+func NewHeaderRule(payload, adapter string) (*HeaderRule, error) {
+	name, pattern, hasValue := strings.Cut(payload, ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("invalid HEADER %q, expected Name or Name:pattern", payload)
+	}
+	r := &HeaderRule{
+		BaseRule: BaseRule{
+			RuleType:    "HEADER",
+			RulePayload: payload,
+			AdapterName: adapter,
+		},
+		name: name,
+	}
+	if hasValue {
+		r.re = compileWildcard(strings.TrimSpace(pattern))
+	}
+	return r, nil
+}
+
+func (r *HeaderRule) Match(metadata *RequestMetadata) bool {
+	values := metadata.Headers.Values(r.name)
+	if r.re == nil {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if r.re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileWildcard turns a pattern using * and ? into an anchored regular expression
+func compileWildcard(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,92 @@
+package rule
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestURLRegexRule(t *testing.T) {
+	r, err := NewURLRegexRule(`^https?://ads\.example\.com/banner/`, "REJECT")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	if !r.Match(&RequestMetadata{URL: "https://ads.example.com/banner/1.png"}) {
+		t.Error("should match the banner URL")
+	}
+	if r.Match(&RequestMetadata{URL: "https://ads.example.com/page"}) {
+		t.Error("should not match other paths")
+	}
+	if r.Match(&RequestMetadata{Host: "ads.example.com"}) {
+		t.Error("should not match requests without a URL")
+	}
+	if _, err := NewURLRegexRule("([", "REJECT"); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestUserAgentRule(t *testing.T) {
+	r := NewUserAgentRule("Instagram*", "Proxy")
+	headers := http.Header{}
+	headers.Set("User-Agent", "Instagram 250.0 (iPhone)")
+	if !r.Match(&RequestMetadata{Headers: headers}) {
+		t.Error("should match the Instagram client")
+	}
+	headers.Set("User-Agent", "Mozilla/5.0 Instagram")
+	if r.Match(&RequestMetadata{Headers: headers}) {
+		t.Error("pattern is anchored at the start")
+	}
+	if r.Match(&RequestMetadata{}) {
+		t.Error("should not match without headers")
+	}
+
+	single := NewUserAgentRule("curl/?.*", "DIRECT")
+	headers.Set("User-Agent", "curl/8.4.0")
+	if !single.Match(&RequestMetadata{Headers: headers}) {
+		t.Error("? should match a single character")
+	}
+}
+
+func TestHeaderRule(t *testing.T) {
+	presence, err := NewHeaderRule("X-Debug", "DIRECT")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	value, err := NewHeaderRule("accept-language: zh*", "Proxy")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Add("Accept-Language", "en-US")
+	headers.Add("Accept-Language", "zh-CN")
+	meta := &RequestMetadata{Headers: headers}
+	if presence.Match(meta) {
+		t.Error("X-Debug is not set")
+	}
+	if !value.Match(meta) {
+		t.Error("should match any value of the header, case-insensitively by name")
+	}
+
+	headers.Set("X-Debug", "")
+	if !presence.Match(meta) {
+		t.Error("should match an empty header that is present")
+	}
+
+	if _, err := NewHeaderRule(":value", "DIRECT"); err == nil {
+		t.Error("expected error for missing header name")
+	}
+}
+
+func TestParseHTTPRules(t *testing.T) {
+	lines := []string{
+		`URL-REGEX,^http://example\.com/(a|b)/,REJECT`,
+		"USER-AGENT,Instagram*,Proxy",
+		"HEADER,X-Debug,DIRECT",
+		"AND,((USER-AGENT,curl*),(HEADER,Accept:*json*)),DIRECT",
+	}
+	for _, line := range lines {
+		if _, err := ParseRule(line); err != nil {
+			t.Errorf("ParseRule(%q): %v", line, err)
+		}
+	}
+}
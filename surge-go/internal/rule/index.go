@@ -0,0 +1,486 @@
+package rule
+
+import (
+	"net"
+	"strings"
+)
+
+// ruleIndex is a compiled form of an ordered rule list. DOMAIN and DOMAIN-SUFFIX
+// rules live in a domain trie, DOMAIN-KEYWORD rules in an Aho-Corasick automaton
+// and IP-CIDR rules in a radix tree. All other rules are checked one by one.
+// Lookups return the same rule a linear scan would: the first one that matches.
+type ruleIndex struct {
+	rules    []Rule
+	domains  *domainTrie
+	keywords *keywordMatcher
+	ips      *ipTree
+	linear   []int // Positions of rules that are not indexed, ascending
+	resolves []int // Positions of rules that may need the IP of a domain, ascending
+}
+
+// newRuleIndex compiles rules. The index refers to the slice, which must not be modified afterwards.
+func newRuleIndex(rules []Rule) *ruleIndex {
+	x := &ruleIndex{
+		rules:    rules,
+		domains:  newDomainTrie(),
+		keywords: newKeywordMatcher(),
+		ips:      newIPTree(),
+	}
+
+	for i, r := range rules {
+		indexed := false
+		switch r := r.(type) {
+		case *DomainRule:
+			indexed = x.domains.insert(r.RulePayload, i, domainExact)
+		case *DomainSuffixRule:
+			indexed = x.domains.insert(r.RulePayload, i, domainSuffix)
+		case *DomainKeywordRule:
+			indexed = x.keywords.insert(r.RulePayload, i)
+		case *IPCIDRRule:
+			indexed = x.ips.insert(r.ipNet, i)
+		}
+		if !indexed {
+			x.linear = append(x.linear, i)
+		}
+		if mayResolve(r) {
+			x.resolves = append(x.resolves, i)
+		}
+	}
+	x.keywords.build()
+	return x
+}
+
+// match returns the position of the first rule from position from on that
+// matches metadata and for which usable reports true, or -1.
+// A nil usable accepts every rule.
+func (x *ruleIndex) match(metadata *RequestMetadata, usable func(Rule) bool, from int) int {
+	best := -1
+	take := func(i int) {
+		if i >= from && (best < 0 || i < best) && (usable == nil || usable(x.rules[i])) {
+			best = i
+		}
+	}
+
+	if metadata.Host != "" {
+		host := strings.ToLower(metadata.Host)
+		x.domains.lookup(host, take)
+		x.keywords.lookup(host, take)
+	}
+	ip := metadata.IP
+	if ip == nil {
+		ip = metadata.DnsIP
+	}
+	if ip != nil {
+		x.ips.lookup(ip, take)
+	}
+
+	// Rules without an index only matter if they come before the best indexed match
+	for _, i := range x.linear {
+		if i < from {
+			continue
+		}
+		if best >= 0 && i > best {
+			break
+		}
+		r := x.rules[i]
+		if (usable == nil || usable(r)) && r.Match(metadata) {
+			return i
+		}
+	}
+	return best
+}
+
+// firstResolve returns the position of the first usable rule that needs the
+// IP of a domain request, or -1
+func (x *ruleIndex) firstResolve(usable func(Rule) bool) int {
+	for _, i := range x.resolves {
+		r := x.rules[i]
+		if (usable == nil || usable(r)) && needsResolve(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mayResolve reports whether the rule can need the IP of a domain request.
+// It is decided when rules are compiled; needsResolve gives the current answer.
+func mayResolve(r Rule) bool {
+	switch r := r.(type) {
+	case *IPCIDRRule:
+		return !r.NoResolve
+	case *GeoIPRule:
+		return !r.NoResolve
+	case *IPASNRule:
+		return !r.NoResolve
+	case *RuleSetRule:
+		return !r.NoResolve
+	case *AndRule:
+		return anyMayResolve(r.Rules)
+	case *OrRule:
+		return anyMayResolve(r.Rules)
+	case *NotRule:
+		return mayResolve(r.Rule)
+	}
+	return false
+}
+
+func anyMayResolve(rules []Rule) bool {
+	for _, r := range rules {
+		if mayResolve(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsResolve reports whether the rule needs the IP of a domain request.
+// Rule sets only do once they contain IP-based entries or rules.
+func needsResolve(r Rule) bool {
+	if rs, ok := r.(*RuleSetRule); ok {
+		return !rs.NoResolve && rs.hasIPs()
+	}
+	return mayResolve(r)
+}
+
+// domainTrie stores domains by their labels, last label first
+type domainTrie struct {
+	root *domainNode
+}
+
+type domainNode struct {
+	children   map[string]*domainNode
+	exact      []int // DOMAIN rules for the domain ending at this node
+	suffix     []int // DOMAIN-SUFFIX rules for the domain ending at this node
+	subdomains []int // Entries matching only the subdomains of this node's domain
+}
+
+// domainKind is how a trie entry matches hosts
+type domainKind int
+
+const (
+	domainExact      domainKind = iota // The domain itself
+	domainSuffix                       // The domain and its subdomains
+	domainSubdomains                   // Only the subdomains
+)
+
+func newDomainTrie() *domainTrie {
+	return &domainTrie{root: &domainNode{}}
+}
+
+// insert adds the rule at position idx. Domains with empty labels, such as
+// ".example.com", are rejected and left to the rule's own Match.
+func (t *domainTrie) insert(domain string, idx int, kind domainKind) bool {
+	if domain == "" {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	for _, l := range labels {
+		if l == "" {
+			return false
+		}
+	}
+
+	n := t.root
+	for i := len(labels) - 1; i >= 0; i-- {
+		if n.children == nil {
+			n.children = make(map[string]*domainNode)
+		}
+		child, ok := n.children[labels[i]]
+		if !ok {
+			child = &domainNode{}
+			n.children[labels[i]] = child
+		}
+		n = child
+	}
+	switch kind {
+	case domainSuffix:
+		n.suffix = append(n.suffix, idx)
+	case domainSubdomains:
+		n.subdomains = append(n.subdomains, idx)
+	default:
+		n.exact = append(n.exact, idx)
+	}
+	return true
+}
+
+// lookup calls fn for every rule matching the lowercased host
+func (t *domainTrie) lookup(host string, fn func(int)) {
+	n := t.root
+	end := len(host)
+	for end >= 0 {
+		start := strings.LastIndexByte(host[:end], '.') + 1
+		child, ok := n.children[host[start:end]]
+		if !ok {
+			return
+		}
+		n = child
+
+		if start == 0 {
+			// The whole host is consumed
+			for _, i := range n.exact {
+				fn(i)
+			}
+			for _, i := range n.suffix {
+				fn(i)
+			}
+			return
+		}
+		// The remaining labels form a subdomain of this node's domain
+		for _, i := range n.suffix {
+			fn(i)
+		}
+		for _, i := range n.subdomains {
+			fn(i)
+		}
+		end = start - 1
+	}
+}
+
+// first returns the domain and kind of an entry matching the lowercased host
+func (t *domainTrie) first(host string) (string, domainKind, bool) {
+	n := t.root
+	end := len(host)
+	for end >= 0 {
+		start := strings.LastIndexByte(host[:end], '.') + 1
+		child, ok := n.children[host[start:end]]
+		if !ok {
+			break
+		}
+		n = child
+
+		if start == 0 {
+			switch {
+			case len(n.exact) > 0:
+				return host, domainExact, true
+			case len(n.suffix) > 0:
+				return host, domainSuffix, true
+			}
+			break
+		}
+		switch {
+		case len(n.suffix) > 0:
+			return host[start:], domainSuffix, true
+		case len(n.subdomains) > 0:
+			return host[start:], domainSubdomains, true
+		}
+		end = start - 1
+	}
+	return "", domainExact, false
+}
+
+// covering calls fn for every entry matching the lowercased domain and, with
+// subdomains set, all of its subdomains as well
+func (t *domainTrie) covering(domain string, subdomains bool, fn func(int)) {
+	n := t.root
+	end := len(domain)
+	for end >= 0 {
+		start := strings.LastIndexByte(domain[:end], '.') + 1
+		child, ok := n.children[domain[start:end]]
+		if !ok {
+			return
+		}
+		n = child
+
+		if start == 0 {
+			for _, i := range n.suffix {
+				fn(i)
+			}
+			if !subdomains {
+				for _, i := range n.exact {
+					fn(i)
+				}
+			}
+			return
+		}
+		for _, i := range n.suffix {
+			fn(i)
+		}
+		for _, i := range n.subdomains {
+			fn(i)
+		}
+		end = start - 1
+	}
+}
+
+// keywordMatcher finds all keywords contained in a string in one pass (Aho-Corasick)
+type keywordMatcher struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	out  []int // Rules whose keyword ends here, including through fail links
+}
+
+func newKeywordMatcher() *keywordMatcher {
+	return &keywordMatcher{nodes: []acNode{{}}}
+}
+
+// insert adds the keyword of the rule at position idx. Empty keywords are rejected.
+func (m *keywordMatcher) insert(keyword string, idx int) bool {
+	if keyword == "" {
+		return false
+	}
+	cur := int32(0)
+	for i := 0; i < len(keyword); i++ {
+		c := keyword[i]
+		next, ok := m.nodes[cur].next[c]
+		if !ok {
+			m.nodes = append(m.nodes, acNode{})
+			next = int32(len(m.nodes) - 1)
+			if m.nodes[cur].next == nil {
+				m.nodes[cur].next = make(map[byte]int32)
+			}
+			m.nodes[cur].next[c] = next
+		}
+		cur = next
+	}
+	m.nodes[cur].out = append(m.nodes[cur].out, idx)
+	return true
+}
+
+// build computes the fail links. It must be called after the last insert.
+func (m *keywordMatcher) build() {
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		m.nodes[child].fail = 0
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for c, child := range m.nodes[cur].next {
+			f := m.nodes[cur].fail
+			for {
+				if next, ok := m.nodes[f].next[c]; ok {
+					m.nodes[child].fail = next
+					break
+				}
+				if f == 0 {
+					m.nodes[child].fail = 0
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			fail := m.nodes[child].fail
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// lookup calls fn for every rule whose keyword occurs in s
+func (m *keywordMatcher) lookup(s string, fn func(int)) {
+	if len(m.nodes) == 1 {
+		return
+	}
+	cur := int32(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for {
+			if next, ok := m.nodes[cur].next[c]; ok {
+				cur = next
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		for _, idx := range m.nodes[cur].out {
+			fn(idx)
+		}
+	}
+}
+
+// ipTree is a radix tree over the address bits, one for IPv4 and one for IPv6.
+// Like net.IPNet.Contains, IPv4 networks also match IPv4-mapped IPv6 addresses.
+type ipTree struct {
+	v4 *ipNode
+	v6 *ipNode
+}
+
+type ipNode struct {
+	child [2]*ipNode
+	rules []int // Rules for the network ending at this depth
+}
+
+func newIPTree() *ipTree {
+	return &ipTree{v4: &ipNode{}, v6: &ipNode{}}
+}
+
+// insert adds the network of the rule at position idx
+func (t *ipTree) insert(network *net.IPNet, idx int) bool {
+	if network == nil {
+		return false
+	}
+	ones, bits := network.Mask.Size()
+	root := t.v4
+	switch {
+	case len(network.IP) == net.IPv4len && bits == 32:
+	case len(network.IP) == net.IPv6len && bits == 128:
+		root = t.v6
+	default:
+		return false
+	}
+
+	n := root
+	for i := 0; i < ones; i++ {
+		b := bit(network.IP, i)
+		if n.child[b] == nil {
+			n.child[b] = &ipNode{}
+		}
+		n = n.child[b]
+	}
+	n.rules = append(n.rules, idx)
+	return true
+}
+
+// lookup calls fn for every rule whose network contains ip
+func (t *ipTree) lookup(ip net.IP, fn func(int)) {
+	n := t.v6
+	if v4 := ip.To4(); v4 != nil {
+		ip, n = v4, t.v4
+	} else if len(ip) != net.IPv6len {
+		return
+	}
+
+	for i := 0; n != nil; i++ {
+		for _, idx := range n.rules {
+			fn(idx)
+		}
+		if i == len(ip)*8 {
+			return
+		}
+		n = n.child[bit(ip, i)]
+	}
+}
+
+// first returns the widest network containing ip, or nil
+func (t *ipTree) first(ip net.IP) *net.IPNet {
+	n := t.v6
+	if v4 := ip.To4(); v4 != nil {
+		ip, n = v4, t.v4
+	} else if len(ip) != net.IPv6len {
+		return nil
+	}
+
+	bits := len(ip) * 8
+	for i := 0; n != nil; i++ {
+		if len(n.rules) > 0 {
+			mask := net.CIDRMask(i, bits)
+			return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		}
+		if i == bits {
+			break
+		}
+		n = n.child[bit(ip, i)]
+	}
+	return nil
+}
+
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,137 @@
+package rule
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+// linearMatch is the reference behaviour the index must reproduce
+func linearMatch(rules []Rule, metadata *RequestMetadata) int {
+	for i, r := range rules {
+		if r.IsEnabled() && r.Match(metadata) {
+			return i
+		}
+	}
+	return -1
+}
+
+func mustCIDR(t *testing.T, cidr, adapter string) Rule {
+	t.Helper()
+	r, err := NewIPCIDRRule(cidr, adapter, false)
+	if err != nil {
+		t.Fatalf("invalid cidr %s: %v", cidr, err)
+	}
+	return r
+}
+
+func TestRuleIndex_FirstMatchWins(t *testing.T) {
+	port, _ := NewDestPortRule("8443", "Port", false)
+	rules := []Rule{
+		NewDomainKeywordRule("ads", "Reject"),
+		NewDomainSuffixRule("google.com", "Proxy"),
+		NewDomainRule("mail.google.com", "Mail"), // Shadowed by the suffix rule
+		port,
+		mustCIDR(t, "10.0.0.0/8", "LAN"),
+		mustCIDR(t, "10.1.0.0/16", "Office"), // Shadowed by 10.0.0.0/8
+		mustCIDR(t, "2001:db8::/32", "V6"),
+		NewDomainSuffixRule(".dotted.com", "Dotted"), // Not indexable, falls back to Match
+		NewDomainKeywordRule("oogle", "Keyword"),
+		NewFinalRule("Final"),
+	}
+	idx := newRuleIndex(rules)
+
+	tests := []*RequestMetadata{
+		{Host: "mail.google.com"},
+		{Host: "MAIL.Google.COM"},
+		{Host: "google.com"},
+		{Host: "agoogle.com"},
+		{Host: "ads.google.com"},
+		{Host: "x.dotted.com"},
+		{Host: "www.example.com", Port: 8443},
+		{Host: "www.example.com"},
+		{IP: net.ParseIP("10.1.2.3")},
+		{IP: net.ParseIP("::ffff:10.1.2.3")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("2001:db9::1")},
+		{Host: "nas.local", DnsIP: net.ParseIP("10.0.0.5")},
+		{},
+	}
+	for _, m := range tests {
+		want := linearMatch(rules, m)
+		if got := idx.match(m, Rule.IsEnabled, 0); got != want {
+			t.Errorf("match(%+v) = %d, want %d", m, got, want)
+		}
+	}
+}
+
+func TestRuleIndex_SkipsDisabledRules(t *testing.T) {
+	rules := []Rule{
+		NewDomainSuffixRule("example.com", "First"),
+		NewDomainKeywordRule("example", "Second"),
+		NewFinalRule("Final"),
+	}
+	for _, r := range rules {
+		r.SetEnabled(true)
+	}
+	idx := newRuleIndex(rules)
+	m := &RequestMetadata{Host: "www.example.com"}
+
+	if got := idx.match(m, Rule.IsEnabled, 0); got != 0 {
+		t.Fatalf("match = %d, want 0", got)
+	}
+	rules[0].SetEnabled(false)
+	if got := idx.match(m, Rule.IsEnabled, 0); got != 1 {
+		t.Errorf("match = %d, want 1 after disabling the first rule", got)
+	}
+	rules[1].SetEnabled(false)
+	if got := idx.match(m, Rule.IsEnabled, 0); got != 2 {
+		t.Errorf("match = %d, want FINAL", got)
+	}
+}
+
+func TestKeywordMatcher_OverlappingKeywords(t *testing.T) {
+	m := newKeywordMatcher()
+	for i, kw := range []string{"he", "she", "his", "hers", "xyz"} {
+		m.insert(kw, i)
+	}
+	m.build()
+
+	found := map[int]bool{}
+	m.lookup("ushers", func(i int) { found[i] = true })
+	for i, want := range []bool{true, true, false, true, false} {
+		if found[i] != want {
+			t.Errorf("keyword %d found = %v, want %v", i, found[i], want)
+		}
+	}
+}
+
+func TestRuleIndex_LargeRuleSetAgreesWithLinearScan(t *testing.T) {
+	var rules []Rule
+	for i := 0; i < 2000; i++ {
+		switch i % 4 {
+		case 0:
+			rules = append(rules, NewDomainSuffixRule(fmt.Sprintf("site%d.com", i), "Proxy"))
+		case 1:
+			rules = append(rules, NewDomainRule(fmt.Sprintf("www.site%d.com", i-1), "Exact"))
+		case 2:
+			rules = append(rules, NewDomainKeywordRule(fmt.Sprintf("kw%d", i), "Keyword"))
+		case 3:
+			rules = append(rules, mustCIDR(t, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256), "LAN"))
+		}
+	}
+	idx := newRuleIndex(rules)
+
+	for i := 0; i < 2000; i += 7 {
+		for _, m := range []*RequestMetadata{
+			{Host: fmt.Sprintf("www.site%d.com", i)},
+			{Host: fmt.Sprintf("a.kw%d.net", i)},
+			{IP: net.IPv4(10, byte(i/256), byte(i%256), 9)},
+		} {
+			want := linearMatch(rules, m)
+			if got := idx.match(m, Rule.IsEnabled, 0); got != want {
+				t.Errorf("match(%+v) = %d, want %d", m, got, want)
+			}
+		}
+	}
+}
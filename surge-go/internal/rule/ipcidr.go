@@ -12,20 +12,9 @@ type IPCIDRRule struct {
 }
 
 func NewIPCIDRRule(cidr, adapter string, noResolve bool) (*IPCIDRRule, error) {
-	_, ipNet, err := net.ParseCIDR(cidr)
+	ipNet, err := parseIPNet(cidr)
 	if err != nil {
-		// Try parsing as single IP
-		ip := net.ParseIP(cidr)
-		if ip != nil {
-			// Convert single IP to CIDR /32 or /128
-			bits := 32
-			if ip.To4() == nil {
-				bits = 128
-			}
-			_, ipNet, _ = net.ParseCIDR(fmt.Sprintf("%s/%d", ip.String(), bits))
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	return &IPCIDRRule{
@@ -60,3 +49,22 @@ func (r *IPCIDRRule) Match(metadata *RequestMetadata) bool {
 	// For now, assume metadata contains all necessary info.
 	return false
 }
+
+// parseIPNet parses a CIDR, or a single IP as a /32 or /128 network
+func parseIPNet(cidr string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		// Try parsing as single IP
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, err
+		}
+		// Convert single IP to CIDR /32 or /128
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		_, ipNet, _ = net.ParseCIDR(fmt.Sprintf("%s/%d", ip.String(), bits))
+	}
+	return ipNet, nil
+}
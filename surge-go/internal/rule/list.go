@@ -0,0 +1,134 @@
+package rule
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// listMatcher matches the plain entries of a rule set: domains, keywords,
+// domain regexes and IP networks. Entries share the index structures used for
+// rules instead of becoming a Rule each, which keeps large lists compact.
+type listMatcher struct {
+	domains     *domainTrie
+	keywords    *keywordMatcher
+	keywordList []string // The keywords again, to explain matches
+	regexes     []*regexp.Regexp
+	ips         *ipTree
+	hasIPs      bool
+	size        int
+}
+
+func newListMatcher() *listMatcher {
+	return &listMatcher{
+		domains:  newDomainTrie(),
+		keywords: newKeywordMatcher(),
+		ips:      newIPTree(),
+	}
+}
+
+// addDomain adds a domain entry, reporting false for malformed domains
+func (m *listMatcher) addDomain(domain string, kind domainKind) bool {
+	if !m.domains.insert(strings.ToLower(strings.TrimSuffix(domain, ".")), 0, kind) {
+		return false
+	}
+	m.size++
+	return true
+}
+
+func (m *listMatcher) addKeyword(keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	if !m.keywords.insert(keyword, 0) {
+		return false
+	}
+	m.keywordList = append(m.keywordList, keyword)
+	m.size++
+	return true
+}
+
+func (m *listMatcher) addRegex(re *regexp.Regexp) {
+	m.regexes = append(m.regexes, re)
+	m.size++
+}
+
+func (m *listMatcher) addNetwork(network *net.IPNet) bool {
+	if !m.ips.insert(network, 0) {
+		return false
+	}
+	m.hasIPs = true
+	m.size++
+	return true
+}
+
+// build finishes the matcher. It must be called after the last entry is added.
+func (m *listMatcher) build() {
+	m.keywords.build()
+}
+
+func (m *listMatcher) match(metadata *RequestMetadata) bool {
+	found := false
+	hit := func(int) { found = true }
+
+	if metadata.Host != "" {
+		host := strings.ToLower(metadata.Host)
+		if m.domains.lookup(host, hit); found {
+			return true
+		}
+		if m.keywords.lookup(host, hit); found {
+			return true
+		}
+		for _, re := range m.regexes {
+			if re.MatchString(host) {
+				return true
+			}
+		}
+	}
+
+	if m.hasIPs {
+		ip := metadata.IP
+		if ip == nil {
+			ip = metadata.DnsIP
+		}
+		if ip != nil {
+			m.ips.lookup(ip, hit)
+		}
+	}
+	return found
+}
+
+// explain returns the entry matching metadata, written as a rule, or ""
+func (m *listMatcher) explain(metadata *RequestMetadata) string {
+	if metadata.Host != "" {
+		host := strings.ToLower(metadata.Host)
+		if domain, kind, ok := m.domains.first(host); ok {
+			switch kind {
+			case domainSuffix:
+				return "DOMAIN-SUFFIX," + domain
+			case domainSubdomains:
+				return "DOMAIN-SUFFIX," + domain + " (subdomains only)"
+			}
+			return "DOMAIN," + domain
+		}
+		for _, k := range m.keywordList {
+			if strings.Contains(host, k) {
+				return "DOMAIN-KEYWORD," + k
+			}
+		}
+		for _, re := range m.regexes {
+			if re.MatchString(host) {
+				return "DOMAIN-REGEX," + re.String()
+			}
+		}
+	}
+
+	if m.hasIPs {
+		ip := metadata.IP
+		if ip == nil {
+			ip = metadata.DnsIP
+		}
+		if network := m.ips.first(ip); network != nil {
+			return "IP-CIDR," + network.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logical rules combine sub-rules written as a parenthesized list:
+//
+//	AND,((DOMAIN-SUFFIX,a.com),(DEST-PORT,443)),Proxy
+//	OR,((DOMAIN-SUFFIX,a.com),(AND,((DEST-PORT,443),(PROTOCOL,UDP)))),Proxy
+//	NOT,((IP-CIDR,10.0.0.0/8,no-resolve)),DIRECT
+//
+// Sub-rules have no policy of their own and may nest to any depth.
+
+// newLogicalRule builds an AND, OR or NOT rule from its sub-rule list
+func newLogicalRule(ruleType, payload, adapter string, noResolve bool) (Rule, error) {
+	subRules, err := parseSubRules(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rule: %v", ruleType, err)
+	}
+
+	switch ruleType {
+	case "AND":
+		return NewAndRule(subRules, adapter, noResolve), nil
+	case "OR":
+		return NewOrRule(subRules, adapter, noResolve), nil
+	case "NOT":
+		if len(subRules) != 1 {
+			return nil, fmt.Errorf("invalid NOT rule: expected exactly 1 sub-rule, got %d", len(subRules))
+		}
+		return NewNotRule(subRules[0], adapter, noResolve), nil
+	default:
+		return nil, fmt.Errorf("unknown logical rule type: %s", ruleType)
+	}
+}
+
+// parseSubRules parses "((TYPE,VALUE),(TYPE,VALUE),...)" into rules
+func parseSubRules(payload string) ([]Rule, error) {
+	s := strings.TrimSpace(payload)
+	if s == "" {
+		return nil, fmt.Errorf("missing sub-rules")
+	}
+	if s[0] != '(' {
+		return nil, fmt.Errorf("sub-rules must be enclosed in parentheses, got %q", s)
+	}
+	end, err := closingParen(s, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end != len(s)-1 {
+		return nil, fmt.Errorf("unexpected %q after sub-rule list", s[end+1:])
+	}
+
+	var rules []Rule
+	inner := s[1:end]
+	pos := 0
+	for {
+		pos = skipSpaces(inner, pos)
+		if pos == len(inner) {
+			break
+		}
+		if inner[pos] != '(' {
+			return nil, fmt.Errorf("expected '(' at position %d, got %q", pos+1, inner[pos])
+		}
+		close, err := closingParen(inner, pos)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := parseSubRule(inner[pos+1 : close])
+		if err != nil {
+			return nil, fmt.Errorf("sub-rule %d: %v", len(rules)+1, err)
+		}
+		rules = append(rules, r)
+
+		pos = skipSpaces(inner, close+1)
+		if pos == len(inner) {
+			break
+		}
+		if inner[pos] != ',' {
+			return nil, fmt.Errorf("expected ',' after sub-rule %d, got %q", len(rules), inner[pos])
+		}
+		pos++
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("missing sub-rules")
+	}
+	return rules, nil
+}
+
+// parseSubRule parses "TYPE,VALUE[,no-resolve]" from inside a sub-rule's parentheses
+func parseSubRule(s string) (Rule, error) {
+	parts := splitRuleLine(s)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, fmt.Errorf("expected TYPE,VALUE, got %q", s)
+	}
+
+	ruleType := strings.ToUpper(parts[0])
+	noResolve := false
+	for _, opt := range parts[2:] {
+		if !strings.EqualFold(opt, "no-resolve") {
+			return nil, fmt.Errorf("unexpected option %q in %s sub-rule (sub-rules have no policy)", opt, ruleType)
+		}
+		noResolve = true
+	}
+	if ruleType == "FINAL" {
+		return nil, fmt.Errorf("FINAL cannot be used as a sub-rule")
+	}
+
+	return newRule(ruleType, parts[1], "", noResolve)
+}
+
+// closingParen returns the index of the parenthesis closing the one at open
+func closingParen(s string, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unbalanced parentheses: '(' at position %d is never closed", open+1)
+}
+
+func skipSpaces(s string, pos int) int {
+	for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+// formatSubRules renders sub-rules in the syntax parseSubRules accepts
+func formatSubRules(rules []Rule) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, r := range rules {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('(')
+		b.WriteString(r.Type())
+		b.WriteByte(',')
+		b.WriteString(r.Payload())
+		if nr, ok := r.(interface{ noResolve() bool }); ok && nr.noResolve() {
+			b.WriteString(",no-resolve")
+		}
+		b.WriteByte(')')
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// walkRules calls fn for r and, if it is a logical rule, for its sub-rules at
+// any depth
+func walkRules(r Rule, fn func(Rule)) {
+	fn(r)
+	switch r := r.(type) {
+	case *AndRule:
+		for _, sub := range r.Rules {
+			walkRules(sub, fn)
+		}
+	case *OrRule:
+		for _, sub := range r.Rules {
+			walkRules(sub, fn)
+		}
+	case *NotRule:
+		walkRules(r.Rule, fn)
+	}
+}
@@ -0,0 +1,111 @@
+package rule
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule_NestedLogical(t *testing.T) {
+	r, err := ParseRule("OR,((DOMAIN-SUFFIX,a.com),(AND,((DEST-PORT,443),(PROTOCOL,UDP)))),Proxy")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	if r.Type() != "OR" || r.Adapter() != "Proxy" {
+		t.Fatalf("unexpected rule %s -> %s", r.Type(), r.Adapter())
+	}
+
+	tests := []struct {
+		meta *RequestMetadata
+		want bool
+	}{
+		{&RequestMetadata{Host: "www.a.com", Type: "tcp", Port: 80}, true},
+		{&RequestMetadata{Host: "b.com", Type: "udp", Port: 443}, true},
+		{&RequestMetadata{Host: "b.com", Type: "tcp", Port: 443}, false},
+		{&RequestMetadata{Host: "b.com", Type: "udp", Port: 53}, false},
+	}
+	for _, tt := range tests {
+		if got := r.Match(tt.meta); got != tt.want {
+			t.Errorf("Match(%+v) = %v, want %v", tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestParseRule_Not(t *testing.T) {
+	r, err := ParseRule("NOT,((IP-CIDR,10.0.0.0/8,no-resolve)),DIRECT")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	if r.Match(&RequestMetadata{IP: []byte{10, 1, 2, 3}}) {
+		t.Error("NOT should not match an address inside the network")
+	}
+	if !r.Match(&RequestMetadata{IP: []byte{192, 168, 1, 1}}) {
+		t.Error("NOT should match an address outside the network")
+	}
+}
+
+func TestLogicalRule_PayloadRoundTrip(t *testing.T) {
+	payloads := []string{
+		"((DOMAIN-SUFFIX,a.com),(AND,((DEST-PORT,443),(PROTOCOL,udp))))",
+		"((IP-CIDR,10.0.0.0/8,no-resolve))",
+		"((NOT,((DOMAIN,x.com))),(DOMAIN-KEYWORD,ads))",
+	}
+	for _, p := range payloads {
+		for _, typ := range []string{"AND", "OR"} {
+			r, err := ParseRule(typ + "," + p + ",Proxy")
+			if err != nil {
+				t.Fatalf("ParseRule(%s,%s) failed: %v", typ, p, err)
+			}
+			if r.Payload() != p {
+				t.Errorf("Payload() = %s, want %s", r.Payload(), p)
+			}
+
+			// The config path builds the same rule
+			c, err := CreateRuleFromConfig(typ, r.Payload(), "Proxy", false, true, "")
+			if err != nil {
+				t.Fatalf("CreateRuleFromConfig failed: %v", err)
+			}
+			if c.Payload() != p {
+				t.Errorf("config Payload() = %s, want %s", c.Payload(), p)
+			}
+		}
+	}
+
+	// Spacing is normalized
+	r, err := ParseRule("AND,( (PROTOCOL,UDP) , (DEST-PORT,443) ),REJECT")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	if want := "((PROTOCOL,udp),(DEST-PORT,443))"; r.Payload() != want {
+		t.Errorf("Payload() = %s, want %s", r.Payload(), want)
+	}
+}
+
+func TestParseRule_LogicalErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"AND,,Proxy", "missing sub-rules"},
+		{"AND,(),Proxy", "missing sub-rules"},
+		{"AND,DOMAIN,a.com,Proxy", "enclosed in parentheses"},
+		{"OR,((DOMAIN,a.com),(DEST-PORT,abc)),Proxy", "sub-rule 2: invalid port: abc"},
+		{"OR,((DOMAIN,a.com),(AND,((DEST-PORT,443),(BOGUS,x)))),Proxy", "sub-rule 2: invalid AND rule: sub-rule 2: unknown rule type: BOGUS"},
+		{"AND,((DOMAIN,a.com)(DEST-PORT,443)),Proxy", "expected ',' after sub-rule 1"},
+		{"AND,((DOMAIN,a.com),DEST-PORT),Proxy", "expected '(' at position"},
+		{"AND,((DOMAIN,a.com),(DEST-PORT,443),Proxy", "never closed"},
+		{"NOT,((DOMAIN,a.com),(DOMAIN,b.com)),Proxy", "expected exactly 1 sub-rule, got 2"},
+		{"AND,((DOMAIN,a.com,Proxy)),Proxy", "unexpected option \"Proxy\""},
+		{"AND,((FINAL,x)),Proxy", "FINAL cannot be used"},
+		{"AND,((DOMAIN)),Proxy", "expected TYPE,VALUE"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRule(tt.line)
+		if err == nil {
+			t.Errorf("ParseRule(%q) should fail", tt.line)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseRule(%q) error = %q, want it to contain %q", tt.line, err, tt.want)
+		}
+	}
+}
@@ -3,8 +3,15 @@ package rule
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/config"
 )
 
+// scheduleParam is the rule option limiting the rule to a schedule, e.g.
+// schedule=Mon-Fri 09:00-18:00
+const scheduleParam = "schedule="
+
 // ParseRule parses a rule line into a Rule object
 // Format: TYPE,PAYLOAD,ADAPTER,OPTIONS
 // Example: DOMAIN-SUFFIX,google.com,Proxy,no-resolve
@@ -29,7 +36,9 @@ func ParseRule(line string) (Rule, error) {
 	// Handle special case for FINAL
 	if ruleType == "FINAL" {
 		adapter := strings.TrimSpace(parts[1])
-		return NewFinalRule(adapter), nil
+		r := NewFinalRule(adapter)
+		r.SetEnabled(true)
+		return r, nil
 	}
 
 	payload := strings.TrimSpace(parts[1])
@@ -40,14 +49,35 @@ func ParseRule(line string) (Rule, error) {
 
 	// Options
 	noResolve := false
+	var schedule *Schedule
 	if len(parts) > 3 {
 		for _, opt := range parts[3:] {
-			if strings.EqualFold(strings.TrimSpace(opt), "no-resolve") {
+			opt = strings.TrimSpace(opt)
+			if strings.EqualFold(opt, "no-resolve") {
 				noResolve = true
+			} else if spec, ok := strings.CutPrefix(opt, scheduleParam); ok {
+				s, err := ParseSchedule(spec)
+				if err != nil {
+					return nil, err
+				}
+				schedule = s
 			}
 		}
 	}
 
+	r, err := newRule(ruleType, payload, adapter, noResolve)
+	if err != nil {
+		return nil, err
+	}
+	r.SetSchedule(schedule)
+	// A rule line is in use unless switched off later
+	r.SetEnabled(true)
+	return r, nil
+}
+
+// newRule creates a rule of the given type. It is shared by ParseRule,
+// CreateRuleFromConfig and the sub-rules of logical rules.
+func newRule(ruleType, payload, adapter string, noResolve bool) (Rule, error) {
 	switch ruleType {
 	case "DOMAIN":
 		return NewDomainRule(payload, adapter), nil
@@ -60,100 +90,42 @@ func ParseRule(line string) (Rule, error) {
 		return NewIPCIDRRule(payload, adapter, noResolve)
 	case "GEOIP":
 		return NewGeoIPRule(payload, adapter, noResolve), nil
+	case "IP-ASN":
+		return NewIPASNRule(payload, adapter, noResolve)
+	case "GEOSITE":
+		return NewGeoSiteRule(payload, adapter)
 	case "PROCESS-NAME":
 		return NewProcessNameRule(payload, adapter, noResolve), nil
+	case "PROCESS-PATH-REGEX":
+		return NewProcessPathRegexRule(payload, adapter)
 	case "PROTOCOL":
 		return NewProtocolRule(payload, adapter, noResolve), nil
 	case "DEST-PORT":
 		return NewDestPortRule(payload, adapter, noResolve)
+	case "SRC-IP":
+		return NewSrcIPRule(payload, adapter)
+	case "SRC-PORT":
+		return NewSrcPortRule(payload, adapter)
+	case "IN-PORT":
+		return NewInPortRule(payload, adapter)
+	case "IN-TYPE":
+		return NewInTypeRule(payload, adapter)
+	case "IN-USER":
+		return NewInUserRule(payload, adapter), nil
+	case "URL-REGEX":
+		return NewURLRegexRule(payload, adapter)
+	case "USER-AGENT":
+		return NewUserAgentRule(payload, adapter), nil
+	case "HEADER":
+		return NewHeaderRule(payload, adapter)
 	case "AND", "OR", "NOT":
-		// AND, ((Protocol,HTTP), (Domain,example.com)), Proxy
-		// First, extract the list of sub-rules enclosed in ((...))
-		// The payload format is roughly: ((Type,Value),(Type,Value))
-		// We need to strip outer parens if present and split by tuple
-
-		subRulesStr := payload
-		if strings.HasPrefix(subRulesStr, "((") && strings.HasSuffix(subRulesStr, "))") {
-			subRulesStr = subRulesStr[1 : len(subRulesStr)-1] // Remove outer ( ) from ((...)) -> (...)
-		}
-
-		// Now we have (Type,Value),(Type,Value)
-		// We need to split by comma, but respect parentheses
-		var subRules []Rule
-		var currentRuleStr strings.Builder
-		parenCount := 0
-
-		for _, char := range subRulesStr {
-			if char == '(' {
-				parenCount++
-			} else if char == ')' {
-				parenCount--
-			}
-
-			if char == ',' && parenCount == 0 {
-				// End of a rule tuple
-				rStr := currentRuleStr.String()
-				rStr = strings.TrimSpace(rStr)
-				if len(rStr) > 0 {
-					// recursive parse: rule tuple (Type,Value) -> Type,Value,Adapter
-					// We need to strip ( ) around the tuple: (Type,Value) -> Type,Value
-					if strings.HasPrefix(rStr, "(") && strings.HasSuffix(rStr, ")") {
-						rStr = rStr[1 : len(rStr)-1]
-					}
-					// Sub-rules in AND don't usually have their own adapter/policy, they inherit or are just conditions needed.
-					// ParseRule expects TYPE,PAYLOAD,ADAPTER.
-					// But inside AND, it's usually just TYPE,PAYLOAD.
-					// We can append a dummy adapter to satisfy ParseRule, or update ParseRule to handle optional adapter.
-					// Let's try appending dummy adapter if missing.
-					if !strings.Contains(rStr, ",") {
-						// Invalid sub-rule
-						continue
-					}
-					// Check if it has enough parts. If only Type,Value, we add ",Dummy" to parse it.
-					// But we should ignore the adapter from sub-rule result anyway.
-					parts := strings.Split(rStr, ",")
-					if len(parts) == 2 {
-						rStr += ",DUMMY"
-					}
-
-					subRule, err := ParseRule(rStr)
-					if err == nil && subRule != nil {
-						subRules = append(subRules, subRule)
-					}
-				}
-				currentRuleStr.Reset()
-			} else {
-				currentRuleStr.WriteRune(char)
-			}
-		}
-
-		// Process the last rule
-		rStr := currentRuleStr.String()
-		rStr = strings.TrimSpace(rStr)
-		if len(rStr) > 0 {
-			if strings.HasPrefix(rStr, "(") && strings.HasSuffix(rStr, ")") {
-				rStr = rStr[1 : len(rStr)-1]
-			}
-			parts := strings.Split(rStr, ",")
-			if len(parts) == 2 {
-				rStr += ",DUMMY"
-			}
-			subRule, err := ParseRule(rStr)
-			if err == nil && subRule != nil {
-				subRules = append(subRules, subRule)
-			}
-		}
-
-		if ruleType == "AND" {
-			return NewAndRule(subRules, adapter, noResolve), nil
-		}
-		return nil, fmt.Errorf("OR/NOT rules matching not implemented fully yet")
+		return newLogicalRule(ruleType, payload, adapter, noResolve)
 	case "RULE-SET":
-		// RULE-SET,url,Proxy
-		// This needs special handling: it should return a RuleSetRule (which we haven't defined yet)
-		// Or maybe we treat it as a factory that returns a placeholder?
-		// We need to define NewRuleSetRule first.
 		return NewRuleSetRule(payload, adapter, nil)
+	case "DOMAIN-SET":
+		return NewDomainSetRule(payload, adapter)
+	case "TIME":
+		return NewTimeRule(payload, adapter)
 	default:
 		return nil, fmt.Errorf("unknown rule type: %s", ruleType)
 	}
@@ -166,38 +138,10 @@ func CreateRuleFromConfig(ruleType, payload, adapter string, noResolve, enabled
 
 	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
 
-	switch ruleType {
-	case "FINAL":
+	if ruleType == "FINAL" {
 		r = NewFinalRule(adapter)
-	case "DOMAIN":
-		r = NewDomainRule(payload, adapter)
-	case "DOMAIN-SUFFIX":
-		r = NewDomainSuffixRule(payload, adapter)
-	case "DOMAIN-KEYWORD":
-		r = NewDomainKeywordRule(payload, adapter)
-	case "IP-CIDR", "IP-CIDR6":
-		r, err = NewIPCIDRRule(payload, adapter, noResolve)
-	case "GEOIP":
-		r = NewGeoIPRule(payload, adapter, noResolve)
-	case "PROCESS-NAME":
-		r = NewProcessNameRule(payload, adapter, noResolve)
-	case "PROTOCOL":
-		r = NewProtocolRule(payload, adapter, noResolve)
-	case "DEST-PORT":
-		r, err = NewDestPortRule(payload, adapter, noResolve)
-	case "AND", "OR", "NOT":
-		// For complex logic rules, payload parsing is complex.
-		// For now we assume payload is the full string like ((...))
-		// We can reuse ParseRule for now or reimplement logic.
-		// Reusing ParseRule is safer for complex logic but we need to inject enabled/comment after.
-		// Reconstruct the line for ParseRule...
-		// RuleConfig.Value for AND is ((...))
-		fullLine := fmt.Sprintf("%s,%s,%s", ruleType, payload, adapter)
-		r, err = ParseRule(fullLine)
-	case "RULE-SET":
-		r, err = NewRuleSetRule(payload, adapter, nil)
-	default:
-		return nil, fmt.Errorf("unknown rule type: %s", ruleType)
+	} else {
+		r, err = newRule(ruleType, payload, adapter, noResolve)
 	}
 
 	if err != nil {
@@ -211,6 +155,32 @@ func CreateRuleFromConfig(ruleType, payload, adapter string, noResolve, enabled
 	return r, nil
 }
 
+// ruleFromConfig creates the rule of a config line with its options: the
+// update interval of rule sets, nested ones included, and the schedule
+func ruleFromConfig(cfg *config.RuleConfig) (Rule, error) {
+	r, err := CreateRuleFromConfig(cfg.Type, cfg.Value, cfg.Policy, cfg.NoResolve, cfg.Enabled, cfg.Comment)
+	if err != nil || r == nil {
+		return r, err
+	}
+	if cfg.UpdateInterval > 0 {
+		walkRules(r, func(sub Rule) {
+			if rs, ok := sub.(*RuleSetRule); ok {
+				rs.UpdateInterval = time.Duration(cfg.UpdateInterval) * time.Second
+			}
+		})
+	}
+	for _, p := range cfg.Params {
+		if spec, ok := strings.CutPrefix(p, scheduleParam); ok {
+			s, err := ParseSchedule(spec)
+			if err != nil {
+				return nil, err
+			}
+			r.SetSchedule(s)
+		}
+	}
+	return r, nil
+}
+
 func splitRuleLine(line string) []string {
 	var parts []string
 	var current strings.Builder
@@ -1,7 +1,9 @@
 package rule
 
 import (
+	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -26,16 +28,52 @@ func NewProcessNameRule(payload string, adapter string, noResolve bool) *Process
 
 // Match checks if the request's process path matches the rule
 func (r *ProcessNameRule) Match(metadata *RequestMetadata) bool {
-	if metadata.ProcessPath == "" {
+	path := metadata.processPath()
+	if path == "" {
 		return false
 	}
 
 	// If the rule expects a path (contains separator), match full path
 	if strings.Contains(r.ExpectedName, "/") || strings.Contains(r.ExpectedName, "\\") {
-		return strings.EqualFold(metadata.ProcessPath, r.ExpectedName)
+		return strings.EqualFold(path, r.ExpectedName)
 	}
 
 	// Otherwise match base name
-	processName := filepath.Base(metadata.ProcessPath)
+	processName := filepath.Base(path)
 	return strings.EqualFold(processName, r.ExpectedName)
 }
+
+// ProcessPathRegexRule matches the full path of the process executable
+type ProcessPathRegexRule struct {
+	BaseRule
+	re *regexp.Regexp
+}
+
+func NewProcessPathRegexRule(pattern, adapter string) (*ProcessPathRegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROCESS-PATH-REGEX %q: %v", pattern, err)
+	}
+	return &ProcessPathRegexRule{
+		BaseRule: BaseRule{
+			RuleType:    "PROCESS-PATH-REGEX",
+			RulePayload: pattern,
+			AdapterName: adapter,
+		},
+		re: re,
+	}, nil
+}
+
+func (r *ProcessPathRegexRule) Match(metadata *RequestMetadata) bool {
+	path := metadata.processPath()
+	return path != "" && r.re.MatchString(path)
+}
+
+// processPath returns the process path of the request, looking it up on first use
+func (m *RequestMetadata) processPath() string {
+	if m.ProcessPath == "" && m.LookupProcess != nil {
+		m.ProcessPath = m.LookupProcess()
+		m.LookupProcess = nil
+	}
+	return m.ProcessPath
+}
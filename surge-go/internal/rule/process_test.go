@@ -61,3 +61,61 @@ func TestProcessNameRule_Match(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessPathRegexRule_Match(t *testing.T) {
+	r, err := ParseRule(`PROCESS-PATH-REGEX,^/usr/(local/)?bin/(curl|wget)$,Proxy`)
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/usr/bin/curl", true},
+		{"/usr/local/bin/wget", true},
+		{"/opt/bin/curl", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := r.Match(&RequestMetadata{ProcessPath: tt.path}); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRule("PROCESS-PATH-REGEX,(,Proxy"); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestProcessRule_LazyLookup(t *testing.T) {
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{
+		"DOMAIN,a.com,DIRECT",
+		"PROCESS-NAME,wget,Proxy",
+		"AND,((DEST-PORT,443),(PROCESS-PATH-REGEX,/curl$)),Proxy",
+		"FINAL,REJECT",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	match := func(host string) string {
+		adapter, _ := e.Match(&RequestMetadata{
+			Host: host,
+			Port: 443,
+			LookupProcess: func() string {
+				lookups++
+				return "/usr/bin/curl"
+			},
+		})
+		return adapter
+	}
+
+	if got := match("a.com"); got != "DIRECT" || lookups != 0 {
+		t.Errorf("a.com: got %s with %d lookups, want DIRECT without lookup", got, lookups)
+	}
+	// Both process rules are evaluated, the process is looked up once
+	if got := match("b.com"); got != "Proxy" || lookups != 1 {
+		t.Errorf("b.com: got %s with %d lookups, want Proxy with 1 lookup", got, lookups)
+	}
+}
@@ -1,19 +1,45 @@
 package rule
 
 import (
+	"context"
 	"net"
+	"net/http"
+	"sync/atomic"
 )
 
 // RequestMetadata contains information about the request being matched
 type RequestMetadata struct {
 	Type        string // tcp, udp, etc.
+	Protocol    string // Application protocol: HTTP, HTTPS or TLS (optional)
 	Host        string // Domain or IP string
 	IP          net.IP // Parsed IP address (nil if domain)
 	Port        int
-	ProcessPath string // Process name/path (optional)
-	SourceIP    net.IP // Source IP (optional)
-	SourcePort  int    // Source Port (optional)
-	DnsIP       net.IP // Resolved IP if Host was a domain (optional)
+	ProcessPath string      // Process name/path (optional)
+	SourceIP    net.IP      // Source IP (optional)
+	SourcePort  int         // Source Port (optional)
+	DnsIP       net.IP      // Resolved IP if Host was a domain (optional)
+	InboundType string      // Listener the request arrived on: HTTP, SOCKS5, TUN or REDIR (optional)
+	InboundPort int         // Local port of that listener (optional)
+	InboundUser string      // Authenticated inbound user (optional)
+	URL         string      // Full request URL, for plain HTTP and MITM'd HTTPS (optional)
+	Method      string      // HTTP method (optional)
+	Headers     http.Header // HTTP request headers (optional)
+
+	// LookupProcess, if set, finds ProcessPath the first time a process rule
+	// needs it, so that other requests skip the lookup (optional)
+	LookupProcess func() string
+
+	// Context of the request, which ends the DNS lookup for IP rules when it
+	// is canceled (optional)
+	Context context.Context
+}
+
+// context returns the request context, or a background one if unset
+func (m *RequestMetadata) context() context.Context {
+	if m.Context != nil {
+		return m.Context
+	}
+	return context.Background()
 }
 
 // Rule defines the interface for all routing rules
@@ -36,9 +62,15 @@ type Rule interface {
 	// IncrementHitCount increments the usage counter
 	IncrementHitCount()
 
-	// ResetHitCount resets the usage counter
+	// ResetHitCount resets the usage counter and the traffic statistics
 	ResetHitCount()
 
+	// Stats returns the hit and traffic statistics of the rule
+	Stats() *Stats
+
+	// SetStats replaces the statistics, e.g. with those of the rule it replaces
+	SetStats(s *Stats)
+
 	// IsEnabled returns true if the rule is enabled
 	IsEnabled() bool
 
@@ -50,6 +82,12 @@ type Rule interface {
 
 	// SetComment sets the comment
 	SetComment(comment string)
+
+	// Schedule returns the schedule= option limiting when the rule applies, or nil
+	Schedule() *Schedule
+
+	// SetSchedule sets the schedule; nil applies the rule at all times
+	SetSchedule(s *Schedule)
 }
 
 // BaseRule provides common fields for rules
@@ -58,15 +96,21 @@ type BaseRule struct {
 	AdapterName string
 	RulePayload string
 	NoResolve   bool
-	hitCount    int64
-	enabled     bool
+	stats       atomic.Pointer[Stats] // Created on first use
+	enabled     atomic.Bool           // Toggled while rules are matched
 	comment     string
+	schedule    *Schedule
 }
 
 func (r *BaseRule) Match(metadata *RequestMetadata) bool {
 	return false
 }
 
+// noResolve reports whether the rule was given the no-resolve option
+func (r *BaseRule) noResolve() bool {
+	return r.NoResolve
+}
+
 func (r *BaseRule) Adapter() string {
 	return r.AdapterName
 }
@@ -80,23 +124,35 @@ func (r *BaseRule) Payload() string {
 }
 
 func (r *BaseRule) HitCount() int64 {
-	return r.hitCount
+	return r.Stats().hits.Load()
 }
 
 func (r *BaseRule) IncrementHitCount() {
-	r.hitCount++
+	r.Stats().Hit(now())
 }
 
 func (r *BaseRule) ResetHitCount() {
-	r.hitCount = 0
+	r.Stats().Reset()
+}
+
+func (r *BaseRule) Stats() *Stats {
+	if s := r.stats.Load(); s != nil {
+		return s
+	}
+	r.stats.CompareAndSwap(nil, &Stats{})
+	return r.stats.Load()
+}
+
+func (r *BaseRule) SetStats(s *Stats) {
+	r.stats.Store(s)
 }
 
 func (r *BaseRule) IsEnabled() bool {
-	return r.enabled
+	return r.enabled.Load()
 }
 
 func (r *BaseRule) SetEnabled(enabled bool) {
-	r.enabled = enabled
+	r.enabled.Store(enabled)
 }
 
 func (r *BaseRule) Comment() string {
@@ -106,3 +162,11 @@ func (r *BaseRule) Comment() string {
 func (r *BaseRule) SetComment(comment string) {
 	r.comment = comment
 }
+
+func (r *BaseRule) Schedule() *Schedule {
+	return r.schedule
+}
+
+func (r *BaseRule) SetSchedule(s *Schedule) {
+	r.schedule = s
+}
@@ -67,3 +67,52 @@ func TestFinalRule(t *testing.T) {
 		t.Error("FINAL should match everything")
 	}
 }
+
+func TestRule_Enabled(t *testing.T) {
+	// Parsed rule lines are enabled, rules built otherwise start disabled
+	for _, line := range []string{
+		"DOMAIN,google.com,Proxy",
+		"AND,((DOMAIN-SUFFIX,a.com),(DEST-PORT,443)),Proxy",
+		"FINAL,DIRECT",
+	} {
+		r, err := ParseRule(line)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) failed: %v", line, err)
+		}
+		if !r.IsEnabled() {
+			t.Errorf("ParseRule(%q) is disabled", line)
+		}
+	}
+	if NewDomainRule("a.com", "Proxy").IsEnabled() {
+		t.Error("a constructed rule should start disabled")
+	}
+	for _, enabled := range []bool{true, false} {
+		r, err := CreateRuleFromConfig("DOMAIN", "a.com", "Proxy", false, enabled, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.IsEnabled() != enabled {
+			t.Errorf("CreateRuleFromConfig(enabled=%v) is enabled: %v", enabled, r.IsEnabled())
+		}
+	}
+}
+
+func TestEngine_ToggleWhileMatching(t *testing.T) {
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{"DOMAIN,a.com,Proxy", "FINAL,DIRECT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run with -race: toggling writes the flag that matching reads
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			e.ToggleRule(0, i%2 == 0)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		e.Match(&RequestMetadata{Host: "a.com"})
+	}
+	<-done
+}
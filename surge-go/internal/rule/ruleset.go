@@ -1,22 +1,28 @@
 package rule
 
 import (
-	"bufio"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"strings"
 	"sync"
 	"time"
 )
 
-// RuleSetRule matches against a set of rules loaded from external source
+// RuleSetRule matches against a set of rules loaded from external source.
+// Plain domain and IP entries are compiled into a list matcher; the other
+// rules of the set are kept as Rules.
 type RuleSetRule struct {
 	BaseRule
 	URL      string
-	Rules    []Rule
+	Format   string // One of the Format constants; empty detects it from the content
+	Rules    []Rule // Use SetRules to replace the rules once matching has started
 	UpdateMu sync.RWMutex
+
+	// UpdateInterval is how often the set is downloaded again
+	UpdateInterval time.Duration
+
+	index *ruleIndex   // Compiled from Rules on first match
+	list  *listMatcher // Plain entries of the set, if any
+
+	fetchMu sync.Mutex // Serializes updates
+	status  ruleSetState
 }
 
 // NewRuleSetRule creates a new rule set.
@@ -29,92 +35,92 @@ func NewRuleSetRule(url, adapter string, initialRules []Rule) (*RuleSetRule, err
 			RulePayload: url,
 			AdapterName: adapter,
 		},
-		URL:   url,
-		Rules: initialRules,
+		URL:            url,
+		Rules:          initialRules,
+		UpdateInterval: DefaultRuleSetInterval,
+	}, nil
+}
+
+// NewDomainSetRule creates a DOMAIN-SET rule: a rule set with one domain per line,
+// where a leading dot also matches the subdomains
+func NewDomainSetRule(url, adapter string) (*RuleSetRule, error) {
+	return &RuleSetRule{
+		BaseRule: BaseRule{
+			RuleType:    "DOMAIN-SET",
+			RulePayload: url,
+			AdapterName: adapter,
+		},
+		URL:            url,
+		Format:         FormatDomainSet,
+		UpdateInterval: DefaultRuleSetInterval,
 	}, nil
 }
 
 func (r *RuleSetRule) Match(metadata *RequestMetadata) bool {
 	r.UpdateMu.RLock()
-	defer r.UpdateMu.RUnlock()
-
-	for _, rule := range r.Rules {
-		if rule.Match(metadata) {
-			return true
-		}
+	list := r.list
+	r.UpdateMu.RUnlock()
+	if list != nil && list.match(metadata) {
+		return true
 	}
-	return false
+	return r.compiled().match(metadata, nil, 0) >= 0
 }
 
-// UpdateFromURL downloads and parsing the ruleset
-func (r *RuleSetRule) UpdateFromURL() error {
-	// 1. Download
-	// For local files
-	var reader io.Reader
-	if strings.HasPrefix(r.URL, "file://") {
-		f, err := os.Open(strings.TrimPrefix(r.URL, "file://"))
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		reader = f
-	} else {
-		// Assume HTTP/HTTPS
-		resp, err := http.Get(r.URL)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("failed to download ruleset: status %d", resp.StatusCode)
-		}
-		reader = resp.Body
+// compiled returns the index over the set's rules, building it if needed
+func (r *RuleSetRule) compiled() *ruleIndex {
+	r.UpdateMu.RLock()
+	idx := r.index
+	r.UpdateMu.RUnlock()
+	if idx != nil {
+		return idx
 	}
 
-	// 2. Parse
-	var rules []Rule
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
-			continue
-		}
+	r.UpdateMu.Lock()
+	defer r.UpdateMu.Unlock()
+	if r.index == nil {
+		r.index = newRuleIndex(r.Rules)
+	}
+	return r.index
+}
 
-		// Parse rule line
-		// RuleSets often don't have adapter in the line, or they might.
-		// Typically: DOMAIN-SUFFIX,google.com
-		// The adapter is determined by the RULE-SET line in the main config.
-		// So we pass empty adapter to ParseRule?
-		// But ParseRule expects standard format which might include adapter.
-		// If the line is "DOMAIN-SUFFIX,google.com", split len is 2.
-		// ParseRule handles it (adapter will be empty).
+// hasIPs reports whether the set contains IP-based entries or rules
+func (r *RuleSetRule) hasIPs() bool {
+	r.UpdateMu.RLock()
+	list := r.list
+	r.UpdateMu.RUnlock()
+	return (list != nil && list.hasIPs) || len(r.compiled().resolves) > 0
+}
 
-		rule, err := ParseRule(line)
-		if err != nil {
-			// Log error but continue?
-			continue
-		}
-		if rule != nil {
-			rules = append(rules, rule)
-		}
+// Size returns the number of entries and rules in the set
+func (r *RuleSetRule) Size() int {
+	r.UpdateMu.RLock()
+	defer r.UpdateMu.RUnlock()
+	n := len(r.Rules)
+	if r.list != nil {
+		n += r.list.size
 	}
+	return n
+}
 
+// SetRules replaces the rules of the set
+func (r *RuleSetRule) SetRules(rules []Rule) {
+	r.setContent(rules, nil)
+}
+
+func (r *RuleSetRule) setContent(rules []Rule, list *listMatcher) {
 	r.UpdateMu.Lock()
+	defer r.UpdateMu.Unlock()
 	r.Rules = rules
-	r.UpdateMu.Unlock()
-
-	return nil
+	r.list = list
+	r.index = nil
 }
 
-// StartAutoUpdate starts a background routine to update rules
-func (r *RuleSetRule) StartAutoUpdate(interval time.Duration) {
-	go func() {
-		// Initial update
-		_ = r.UpdateFromURL()
-
-		ticker := time.NewTicker(interval)
-		for range ticker.C {
-			_ = r.UpdateFromURL()
-		}
-	}()
+// Load replaces the content of the set with a rule-set file in the set's format
+func (r *RuleSetRule) Load(data []byte) error {
+	rules, list, err := parseRuleSet(data, r.Format)
+	if err != nil {
+		return err
+	}
+	r.setContent(rules, list)
+	return nil
 }
@@ -0,0 +1,302 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule-set formats
+const (
+	FormatSurge     = "surge"      // Classical rule lines, such as DOMAIN-SUFFIX,google.com
+	FormatDomainSet = "domain-set" // One domain per line, a leading dot includes subdomains
+	FormatClash     = "clash"      // Clash rule provider YAML (domain, ipcidr or classical)
+	FormatSRS       = "srs"        // sing-box binary rule set
+)
+
+// parseRuleSet compiles a rule-set file. Entries that only name a domain or a
+// network go into a listMatcher; other rules are returned as Rules.
+// An empty format is detected from the content.
+func parseRuleSet(data []byte, format string) ([]Rule, *listMatcher, error) {
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	list := newListMatcher()
+	var rules []Rule
+	var err error
+	switch format {
+	case FormatSurge:
+		rules = parseClassicalLines(lines(data), list)
+	case FormatDomainSet:
+		for _, line := range lines(data) {
+			addDomainSetEntry(list, line)
+		}
+	case FormatClash:
+		rules, err = parseClashProvider(data, list)
+	case FormatSRS:
+		err = parseSRS(data, list)
+	default:
+		err = fmt.Errorf("unknown rule-set format: %s", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list.build()
+	return rules, list, nil
+}
+
+// detectFormat tells the formats RULE-SET accepts apart by their content
+func detectFormat(data []byte) string {
+	if bytes.HasPrefix(data, srsMagic) {
+		return FormatSRS
+	}
+	for _, line := range lines(data) {
+		if strings.HasPrefix(line, "payload:") {
+			return FormatClash
+		}
+	}
+	return FormatSurge
+}
+
+// lines returns the trimmed lines of data, without blank lines and comments
+func lines(data []byte) []string {
+	var out []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// parseClassicalLines parses rule lines. The policy of a line, if any, is
+// ignored: the RULE-SET line decides it. Invalid lines are skipped.
+func parseClassicalLines(ruleLines []string, list *listMatcher) []Rule {
+	var rules []Rule
+	for _, line := range ruleLines {
+		if addListEntry(list, line) {
+			continue
+		}
+		r, err := ParseRule(line)
+		if err != nil || r == nil {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// addListEntry adds a DOMAIN, DOMAIN-SUFFIX, DOMAIN-KEYWORD or IP-CIDR line
+// without options to the list. It reports false for any other line.
+func addListEntry(list *listMatcher, line string) bool {
+	parts := splitRuleLine(line)
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && strings.EqualFold(parts[2], "no-resolve")) {
+		return false
+	}
+	payload := parts[1]
+	switch strings.ToUpper(parts[0]) {
+	case "DOMAIN":
+		return list.addDomain(payload, domainExact)
+	case "DOMAIN-SUFFIX":
+		return list.addDomain(payload, domainSuffix)
+	case "DOMAIN-KEYWORD":
+		return list.addKeyword(payload)
+	case "IP-CIDR", "IP-CIDR6":
+		network, err := parseIPNet(payload)
+		return err == nil && list.addNetwork(network)
+	}
+	return false
+}
+
+// addDomainSetEntry adds a DOMAIN-SET line: "example.com" matches the domain
+// only, ".example.com" the domain and all its subdomains
+func addDomainSetEntry(list *listMatcher, line string) bool {
+	if strings.HasPrefix(line, ".") {
+		return list.addDomain(line[1:], domainSuffix)
+	}
+	return list.addDomain(line, domainExact)
+}
+
+// parseClashProvider parses a Clash rule provider. Each payload entry is
+// classified on its own, so the provider's behavior need not be known:
+// rule lines are classical, networks are ipcidr and the rest are domains.
+func parseClashProvider(data []byte, list *listMatcher) ([]Rule, error) {
+	entries, err := clashPayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var classical []string
+	for _, entry := range entries {
+		switch {
+		case strings.Contains(entry, ","):
+			classical = append(classical, entry)
+		case strings.Contains(entry, "/") || net.ParseIP(entry) != nil:
+			if network, err := parseIPNet(entry); err == nil {
+				list.addNetwork(network)
+			}
+		default:
+			addClashDomain(list, entry)
+		}
+	}
+	return parseClassicalLines(classical, list), nil
+}
+
+// addClashDomain adds an entry of a domain behavior provider:
+// "+.example.com" matches the domain and its subdomains, ".example.com" only
+// its subdomains and "*" a single label
+func addClashDomain(list *listMatcher, entry string) bool {
+	switch {
+	case strings.HasPrefix(entry, "+."):
+		return list.addDomain(entry[2:], domainSuffix)
+	case strings.HasPrefix(entry, ".") && !strings.Contains(entry, "*"):
+		return list.addDomain(entry[1:], domainSubdomains)
+	case strings.Contains(entry, "*"):
+		var b strings.Builder
+		b.WriteByte('^')
+		for i, label := range strings.Split(strings.ToLower(entry), ".") {
+			if i > 0 {
+				b.WriteString(`\.`)
+			}
+			if label == "*" {
+				b.WriteString(`[^.]+`)
+			} else {
+				b.WriteString(regexp.QuoteMeta(label))
+			}
+		}
+		b.WriteByte('$')
+		re, err := regexp.Compile(b.String())
+		if err != nil {
+			return false
+		}
+		list.addRegex(re)
+		return true
+	}
+	return list.addDomain(entry, domainExact)
+}
+
+// clashPayload returns the entries of the top-level payload list of a Clash
+// rule provider, written as a block sequence or a single-line flow sequence
+func clashPayload(data []byte) ([]string, error) {
+	var entries []string
+	inPayload, found := false, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		topLevel := raw[0] != ' ' && raw[0] != '\t' && raw[0] != '-'
+		if topLevel {
+			inPayload = false
+			key, rest, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(key) != "payload" {
+				continue
+			}
+			inPayload, found = true, true
+
+			rest = strings.TrimSpace(rest)
+			if strings.HasPrefix(rest, "[") {
+				if !strings.HasSuffix(rest, "]") {
+					return nil, fmt.Errorf("unsupported multi-line flow sequence in payload")
+				}
+				for _, item := range splitFlowSequence(rest[1 : len(rest)-1]) {
+					if v := yamlScalar(item); v != "" {
+						entries = append(entries, v)
+					}
+				}
+				inPayload = false
+			}
+			continue
+		}
+
+		if inPayload && strings.HasPrefix(line, "-") {
+			if v := yamlScalar(line[1:]); v != "" {
+				entries = append(entries, v)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no payload in rule provider")
+	}
+	return entries, nil
+}
+
+// splitFlowSequence splits the items of a flow sequence at commas outside quotes
+func splitFlowSequence(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// yamlScalar returns the value of a quoted or plain YAML scalar
+func yamlScalar(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				if v, err := strconv.Unquote(s[:i+1]); err == nil {
+					return v
+				}
+				return s[1:i]
+			}
+		}
+		return strings.Trim(s, `"`)
+	case strings.HasPrefix(s, "'"):
+		// A quote inside the value is written twice
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return strings.ReplaceAll(s[1:i], "''", "'")
+		}
+		return strings.Trim(s, "'")
+	}
+	// Plain scalars end at a comment
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
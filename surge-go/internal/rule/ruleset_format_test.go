@@ -0,0 +1,391 @@
+package rule
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+type listCase struct {
+	host  string
+	ip    string
+	match bool
+}
+
+func checkList(t *testing.T, rs *RuleSetRule, cases []listCase) {
+	t.Helper()
+	for _, c := range cases {
+		md := &RequestMetadata{Host: c.host}
+		if c.ip != "" {
+			md.IP = net.ParseIP(c.ip)
+		}
+		if got := rs.Match(md); got != c.match {
+			t.Errorf("Match(host=%q, ip=%q) = %v, want %v", c.host, c.ip, got, c.match)
+		}
+	}
+}
+
+func TestDomainSet(t *testing.T) {
+	rs, err := ParseRule("DOMAIN-SET,https://example.com/reject.txt,REJECT")
+	if err != nil {
+		t.Fatalf("ParseRule failed: %v", err)
+	}
+	set := rs.(*RuleSetRule)
+	if set.Type() != "DOMAIN-SET" || set.Adapter() != "REJECT" {
+		t.Fatalf("got %s -> %s", set.Type(), set.Adapter())
+	}
+
+	data := "# ads\nads.example.com\n.tracker.net\n\nExample.ORG.\n"
+	if err := set.Load([]byte(data)); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if set.Size() != 3 {
+		t.Errorf("Size() = %d, want 3", set.Size())
+	}
+	checkList(t, set, []listCase{
+		{host: "ads.example.com", match: true},
+		{host: "x.ads.example.com", match: false},
+		{host: "tracker.net", match: true},
+		{host: "a.b.tracker.net", match: true},
+		{host: "example.org", match: true},
+		{host: "EXAMPLE.org", match: true},
+		{host: "example.com", match: false},
+	})
+
+	// A domain set never contains rule lines
+	if err := set.Load([]byte("DOMAIN-SUFFIX,google.com\n")); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkList(t, set, []listCase{{host: "google.com", match: false}})
+}
+
+func TestRuleSet_SurgeList(t *testing.T) {
+	rs, _ := NewRuleSetRule("http://example.com/rules", "Proxy", nil)
+	data := "DOMAIN,exact.com\nDOMAIN-SUFFIX,suffix.com\nDOMAIN-KEYWORD,kw\nIP-CIDR,10.0.0.0/8,no-resolve\nIP-CIDR6,2001:db8::/32\nDEST-PORT,8443\nINVALID,x\n"
+	if err := rs.Load([]byte(data)); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// Plain entries are compiled into the list, the rest stay rules
+	if len(rs.Rules) != 2 {
+		t.Errorf("got %d rules, want 2 (IP-CIDR with no-resolve and DEST-PORT)", len(rs.Rules))
+	}
+	if rs.list.size != 4 {
+		t.Errorf("list has %d entries, want 4", rs.list.size)
+	}
+	checkList(t, rs, []listCase{
+		{host: "exact.com", match: true},
+		{host: "a.exact.com", match: false},
+		{host: "a.suffix.com", match: true},
+		{host: "mykwsite.net", match: true},
+		{host: "x.com", ip: "10.1.2.3", match: true},
+		{host: "x.com", ip: "2001:db8::1", match: true},
+		{host: "other.com", ip: "1.1.1.1", match: false},
+	})
+	if !needsResolve(rs) {
+		t.Error("a set with IP entries should need the IP of domain requests")
+	}
+}
+
+func TestRuleSet_Clash(t *testing.T) {
+	block := `# Clash rule provider
+payload:
+  - '+.google.com'
+  - ".cdn.example.com"
+  - "exact.example.org" # comment
+  - '*.wild.net'
+  - 192.168.0.0/16
+  - "DOMAIN-KEYWORD,youtube"
+  - DST-PORT,22
+other: value
+  - ignored.com
+`
+	rs, _ := NewRuleSetRule("http://example.com/p.yaml", "Proxy", nil)
+	if err := rs.Load([]byte(block)); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkList(t, rs, []listCase{
+		{host: "google.com", match: true},
+		{host: "www.google.com", match: true},
+		{host: "cdn.example.com", match: false},
+		{host: "a.cdn.example.com", match: true},
+		{host: "exact.example.org", match: true},
+		{host: "a.wild.net", match: true},
+		{host: "a.b.wild.net", match: false},
+		{host: "wild.net", match: false},
+		{host: "x.com", ip: "192.168.3.4", match: true},
+		{host: "m.youtube.com", match: true},
+		{host: "ignored.com", match: false},
+	})
+
+	flow := `payload: ["+.flow.com", '10.0.0.0/8', "DOMAIN-SUFFIX,flowrule.com,no-resolve"]`
+	if err := rs.Load([]byte(flow)); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkList(t, rs, []listCase{
+		{host: "a.flow.com", match: true},
+		{host: "a.flowrule.com", match: true},
+		{host: "x.com", ip: "10.0.0.1", match: true},
+		{host: "google.com", match: false},
+	})
+
+	if _, _, err := parseRuleSet([]byte("rules:\n  - a.com\n"), FormatClash); err == nil {
+		t.Error("expected an error for a provider without payload")
+	}
+}
+
+// srsWriter writes the parts of the sing-box rule-set format the tests need
+type srsWriter struct {
+	bytes.Buffer
+}
+
+func (w *srsWriter) uvarint(v uint64) {
+	w.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *srsWriter) strings(values ...string) {
+	w.uvarint(uint64(len(values)))
+	for _, v := range values {
+		w.uvarint(uint64(len(v)))
+		w.WriteString(v)
+	}
+}
+
+func (w *srsWriter) uint64s(values []uint64) {
+	w.uvarint(uint64(len(values)))
+	for _, v := range values {
+		binary.Write(w, binary.BigEndian, v)
+	}
+}
+
+// domains writes a domain matcher holding the given keys, as a succinct trie
+// over the reversed keys
+func (w *srsWriter) domains(keys ...string) {
+	reversed := make([]string, len(keys))
+	for i, k := range keys {
+		reversed[i] = reverseString(k)
+	}
+	sort.Strings(reversed)
+
+	var leaves, labelBitmap []uint64
+	var labels []byte
+	setBit := func(bm *[]uint64, i int) {
+		for i>>6 >= len(*bm) {
+			*bm = append(*bm, 0)
+		}
+		(*bm)[i>>6] |= 1 << (uint(i) & 63)
+	}
+
+	type span struct{ start, end, col int }
+	queue := []span{{0, len(reversed), 0}}
+	pos := 0
+	for i := 0; i < len(queue); i++ {
+		s := queue[i]
+		if s.col == len(reversed[s.start]) {
+			s.start++
+			setBit(&leaves, i)
+		}
+		for j := s.start; j < s.end; {
+			from := j
+			for j < s.end && reversed[j][s.col] == reversed[from][s.col] {
+				j++
+			}
+			queue = append(queue, span{from, j, s.col + 1})
+			labels = append(labels, reversed[from][s.col])
+			pos++ // 0 bit
+		}
+		setBit(&labelBitmap, pos)
+		pos++
+	}
+
+	w.WriteByte(srsItemDomain)
+	w.WriteByte(1)
+	w.uint64s(leaves)
+	w.uint64s(labelBitmap)
+	w.uvarint(uint64(len(labels)))
+	w.Write(labels)
+}
+
+// adguard writes an AdGuard matcher, which shares the domain matcher's trie
+func (w *srsWriter) adguard(rules ...string) {
+	var trie srsWriter
+	trie.domains(rules...)
+	w.WriteByte(srsItemAdGuardDomain)
+	w.Write(trie.Bytes()[1:])
+}
+
+func (w *srsWriter) ipRanges(ranges ...[2]string) {
+	w.WriteByte(srsItemIPCIDR)
+	w.WriteByte(1)
+	binary.Write(w, binary.BigEndian, uint64(len(ranges)))
+	for _, r := range ranges {
+		for _, s := range r {
+			ip := net.ParseIP(s)
+			if v4 := ip.To4(); v4 != nil {
+				ip = v4
+			}
+			w.uvarint(uint64(len(ip)))
+			w.Write(ip)
+		}
+	}
+}
+
+func (w *srsWriter) file() []byte {
+	var out bytes.Buffer
+	out.Write(srsMagic)
+	out.WriteByte(2)
+	zw := zlib.NewWriter(&out)
+	zw.Write(w.Bytes())
+	zw.Close()
+	return out.Bytes()
+}
+
+func TestRuleSet_SRS(t *testing.T) {
+	var w srsWriter
+	w.uvarint(3)
+
+	// Domains, keywords and IPs
+	w.WriteByte(0)
+	w.domains("exact.com", "\nsuffix.com", "\r.sub.org")
+	w.WriteByte(srsItemDomainKeyword)
+	w.strings("kw")
+	w.WriteByte(srsItemDomainRegex)
+	w.strings(`^re\d+\.net$`)
+	w.ipRanges([2]string{"10.0.0.0", "10.0.0.255"}, [2]string{"192.168.1.1", "192.168.1.2"}, [2]string{"2001:db8::", "2001:db8::ffff"})
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+
+	// A domain restricted to a port cannot be a list entry
+	w.WriteByte(0)
+	w.domains("ported.com")
+	w.WriteByte(srsItemPort)
+	w.uvarint(1)
+	binary.Write(&w, binary.BigEndian, uint16(443))
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+
+	// Logical rules are skipped as well
+	w.WriteByte(1)
+	w.WriteByte(0) // and
+	w.uvarint(1)
+	w.WriteByte(0)
+	w.domains("logical.com")
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+	w.WriteByte(0) // invert
+
+	data := w.file()
+	if got := detectFormat(data); got != FormatSRS {
+		t.Fatalf("detectFormat = %q, want %q", got, FormatSRS)
+	}
+
+	path := filepath.Join(t.TempDir(), "set.srs")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs, _ := NewRuleSetRule("file://"+path, "Proxy", nil)
+	if err := rs.UpdateFromURL(); err != nil {
+		t.Fatalf("UpdateFromURL failed: %v", err)
+	}
+	checkList(t, rs, []listCase{
+		{host: "exact.com", match: true},
+		{host: "a.exact.com", match: false},
+		{host: "suffix.com", match: true},
+		{host: "a.suffix.com", match: true},
+		{host: "sub.org", match: false},
+		{host: "a.sub.org", match: true},
+		{host: "xkwx.com", match: true},
+		{host: "re42.net", match: true},
+		{host: "x.com", ip: "10.0.0.7", match: true},
+		{host: "x.com", ip: "10.0.1.0", match: false},
+		{host: "x.com", ip: "192.168.1.2", match: true},
+		{host: "x.com", ip: "192.168.1.3", match: false},
+		{host: "x.com", ip: "2001:db8::abcd", match: true},
+		{host: "ported.com", match: false},
+		{host: "logical.com", match: false},
+	})
+
+	if err := rs.Load([]byte("SRS\x09")); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+}
+
+func TestRuleSet_SRSNetworkItems(t *testing.T) {
+	var w srsWriter
+	w.uvarint(3)
+
+	// AdGuard filters are not domain lists
+	w.WriteByte(0)
+	w.adguard("||ads.example^")
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+
+	// Nor are rules tied to the network the device is on
+	w.WriteByte(0)
+	w.domains("metered.com")
+	w.WriteByte(srsItemNetworkType)
+	w.uvarint(2)
+	w.Write([]byte{1, 2})
+	w.WriteByte(srsItemNetworkIsExpensive)
+	w.WriteByte(srsItemNetworkIsConstrained)
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+
+	w.WriteByte(0)
+	w.domains("plain.com")
+	w.WriteByte(srsItemFinal)
+	w.WriteByte(0)
+
+	rs, _ := NewRuleSetRule("https://example.com/set.srs", "Proxy", nil)
+	if err := rs.Load(w.file()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkList(t, rs, []listCase{
+		{host: "plain.com", match: true},
+		{host: "metered.com", match: false},
+		{host: "ads.example", match: false},
+	})
+}
+
+func TestRuleSet_SRSHugeCount(t *testing.T) {
+	huge := uint64(1) << 62
+	items := map[string]func(w *srsWriter){
+		"keywords": func(w *srsWriter) { w.WriteByte(srsItemDomainKeyword); w.uvarint(huge) },
+		"ports":    func(w *srsWriter) { w.WriteByte(srsItemPort); w.uvarint(huge) },
+		"domains":  func(w *srsWriter) { w.WriteByte(srsItemDomain); w.WriteByte(1); w.uvarint(huge) },
+	}
+	for name, write := range items {
+		var w srsWriter
+		w.uvarint(1)
+		w.WriteByte(0)
+		write(&w)
+
+		var list listMatcher
+		if err := parseSRS(w.file(), &list); err == nil {
+			t.Errorf("%s: expected an error for a count of %d", name, huge)
+		}
+	}
+}
+
+func TestRangeToNetworks(t *testing.T) {
+	got := rangeToNetworks(net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.10").To4())
+	want := []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10/32"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	all := rangeToNetworks(net.IPv4zero.To4(), net.IPv4bcast.To4())
+	if len(all) != 1 || all[0].String() != "0.0.0.0/0" {
+		t.Errorf("full range = %v, want [0.0.0.0/0]", all)
+	}
+}
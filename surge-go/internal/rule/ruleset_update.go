@@ -0,0 +1,332 @@
+package rule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultRuleSetInterval is the update interval of rule sets without update-interval
+const DefaultRuleSetInterval = 24 * time.Hour
+
+// ruleSetRetryInterval bounds the wait before retrying a failed update
+const ruleSetRetryInterval = 5 * time.Minute
+
+// Sources of a rule set's content
+const (
+	RuleSetSourceRemote = "remote"
+	RuleSetSourceCache  = "cache"
+	RuleSetSourceFile   = "file"
+)
+
+var ruleSetClient = &http.Client{Timeout: 60 * time.Second}
+
+// ruleSetState is the update state of a rule set, guarded by UpdateMu
+type ruleSetState struct {
+	etag         string
+	lastModified string
+	updated      time.Time // Last successful download or revalidation
+	source       string
+	err          error // Error of the last update, if it failed
+}
+
+// RuleSetStatus describes a rule set for the API
+type RuleSetStatus struct {
+	URL            string     `json:"url"`
+	Type           string     `json:"type"`
+	Policy         string     `json:"policy"`
+	Format         string     `json:"format,omitempty"`
+	Entries        int        `json:"entries"`
+	UpdateInterval int        `json:"update_interval"` // Seconds
+	LastUpdate     *time.Time `json:"last_update,omitempty"`
+	Source         string     `json:"source,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// Status returns the current state of the set
+func (r *RuleSetRule) Status() RuleSetStatus {
+	st := RuleSetStatus{
+		URL:            r.URL,
+		Type:           r.Type(),
+		Policy:         r.Adapter(),
+		Format:         r.Format,
+		Entries:        r.Size(),
+		UpdateInterval: int(r.UpdateInterval / time.Second),
+	}
+
+	r.UpdateMu.RLock()
+	defer r.UpdateMu.RUnlock()
+	if !r.status.updated.IsZero() {
+		updated := r.status.updated
+		st.LastUpdate = &updated
+	}
+	st.Source = r.status.source
+	if r.status.err != nil {
+		st.LastError = r.status.err.Error()
+	}
+	return st
+}
+
+// UpdateFromURL downloads and parses the rule set
+func (r *RuleSetRule) UpdateFromURL() error {
+	return r.Update(context.Background(), "")
+}
+
+// Update downloads the set and replaces its content. The request carries the
+// validators of the current content, and a 304 Not Modified answer keeps it.
+// With a cacheDir, downloaded content is also stored there for LoadCache.
+func (r *RuleSetRule) Update(ctx context.Context, cacheDir string) error {
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+
+	err := r.update(ctx, cacheDir)
+	r.UpdateMu.Lock()
+	r.status.err = err
+	r.UpdateMu.Unlock()
+	return err
+}
+
+func (r *RuleSetRule) update(ctx context.Context, cacheDir string) error {
+	if path, ok := strings.CutPrefix(r.URL, "file://"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := r.Load(data); err != nil {
+			return err
+		}
+		r.setState(ruleSetState{updated: time.Now(), source: RuleSetSourceFile})
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	r.UpdateMu.RLock()
+	prev := r.status
+	// Validators only describe content that is still loaded
+	loaded := !prev.updated.IsZero()
+	r.UpdateMu.RUnlock()
+	if loaded {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
+	resp, err := ruleSetClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && loaded:
+		prev.updated = time.Now()
+		prev.err = nil
+		r.setState(prev)
+		if cacheDir != "" {
+			if err := touchRuleSetCache(cacheDir, r.URL, prev.updated); err != nil {
+				log.Printf("Rule set %s: failed to update cache: %v", r.URL, err)
+			}
+		}
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("failed to download ruleset: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := r.Load(data); err != nil {
+		return err
+	}
+
+	st := ruleSetState{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		updated:      time.Now(),
+		source:       RuleSetSourceRemote,
+	}
+	r.setState(st)
+	if cacheDir != "" {
+		if err := writeRuleSetCache(cacheDir, r.URL, data, st); err != nil {
+			log.Printf("Rule set %s: failed to write cache: %v", r.URL, err)
+		}
+	}
+	return nil
+}
+
+func (r *RuleSetRule) setState(st ruleSetState) {
+	r.UpdateMu.Lock()
+	defer r.UpdateMu.Unlock()
+	r.status = st
+}
+
+// LoadCache loads the set from its copy in cacheDir. The copy's download time
+// becomes the set's last update, so a fresh copy delays the next download.
+func (r *RuleSetRule) LoadCache(cacheDir string) error {
+	data, meta, err := readRuleSetCache(cacheDir, r.URL)
+	if err != nil {
+		return err
+	}
+	if err := r.Load(data); err != nil {
+		return err
+	}
+	r.setState(ruleSetState{
+		etag:         meta.ETag,
+		lastModified: meta.LastModified,
+		updated:      meta.Updated,
+		source:       RuleSetSourceCache,
+	})
+	return nil
+}
+
+// run keeps the set up to date until ctx is canceled. The first update is due
+// one interval after the last one, immediately if the set was never loaded.
+func (r *RuleSetRule) run(ctx context.Context, cacheDir string) {
+	interval := r.UpdateInterval
+	if interval <= 0 {
+		interval = DefaultRuleSetInterval
+	}
+
+	var wait time.Duration
+	if st := r.Status(); st.LastUpdate != nil {
+		wait = max(time.Until(st.LastUpdate.Add(interval)), 0)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait = interval
+		if err := r.Update(ctx, cacheDir); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Rule set %s: update failed: %v", r.URL, err)
+			wait = min(interval, ruleSetRetryInterval)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// StartAutoUpdate starts a background routine to update rules
+func (r *RuleSetRule) StartAutoUpdate(interval time.Duration) {
+	r.UpdateInterval = interval
+	go r.run(context.Background(), "")
+}
+
+// ruleSetCacheMeta is stored next to a cached rule set
+type ruleSetCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Updated      time.Time `json:"updated"`
+}
+
+// ruleSetCachePaths returns the content and metadata files of url in dir
+func ruleSetCachePaths(dir, url string) (data, meta string) {
+	sum := sha256.Sum256([]byte(url))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:12]))
+	return base + ".rules", base + ".json"
+}
+
+func readRuleSetCache(dir, url string) ([]byte, ruleSetCacheMeta, error) {
+	var meta ruleSetCacheMeta
+	dataPath, metaPath := ruleSetCachePaths(dir, url)
+
+	raw, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, meta, fmt.Errorf("invalid cache metadata: %v", err)
+	}
+	if meta.URL != url {
+		return nil, meta, fmt.Errorf("cache belongs to %s", meta.URL)
+	}
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, meta, err
+	}
+	return data, meta, nil
+}
+
+func writeRuleSetCache(dir, url string, data []byte, st ruleSetState) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dataPath, _ := ruleSetCachePaths(dir, url)
+	if err := writeFileAtomic(dataPath, data); err != nil {
+		return err
+	}
+	return writeRuleSetCacheMeta(dir, ruleSetCacheMeta{
+		URL:          url,
+		ETag:         st.etag,
+		LastModified: st.lastModified,
+		Updated:      st.updated,
+	})
+}
+
+// touchRuleSetCache records a revalidation of the cached copy
+func touchRuleSetCache(dir, url string, updated time.Time) error {
+	_, meta, err := readRuleSetCache(dir, url)
+	if err != nil {
+		return err
+	}
+	meta.Updated = updated
+	return writeRuleSetCacheMeta(dir, meta)
+}
+
+func writeRuleSetCacheMeta(dir string, meta ruleSetCacheMeta) error {
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, metaPath := ruleSetCachePaths(dir, meta.URL)
+	return writeFileAtomic(metaPath, raw)
+}
+
+// writeFileAtomic replaces path with data through a temporary file. Each
+// call gets its own file, rule sets sharing a URL may be written at once.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package rule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+)
+
+// ruleSetServer serves a rule set with an ETag and counts the requests
+type ruleSetServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	body        string
+	etag        string
+	requests    atomic.Int32
+	notModified atomic.Int32
+}
+
+func newRuleSetServer(t *testing.T, body string) *ruleSetServer {
+	s := &ruleSetServer{body: body, etag: `"v1"`}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		body, etag := s.body, s.etag
+		s.mu.Unlock()
+
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *ruleSetServer) set(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func TestRuleSetUpdate_ETagAndCache(t *testing.T) {
+	srv := newRuleSetServer(t, "DOMAIN-SUFFIX,one.com\n")
+	cacheDir := t.TempDir()
+
+	rs, _ := NewRuleSetRule(srv.URL+"/set.list", "Proxy", nil)
+	if err := rs.Update(context.Background(), cacheDir); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	st := rs.Status()
+	if st.Entries != 1 || st.Source != RuleSetSourceRemote || st.LastUpdate == nil || st.LastError != "" {
+		t.Fatalf("unexpected status after download: %+v", st)
+	}
+
+	// Unchanged content is revalidated, not downloaded again
+	if err := rs.Update(context.Background(), cacheDir); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if srv.notModified.Load() != 1 {
+		t.Errorf("expected a 304 revalidation, got %d", srv.notModified.Load())
+	}
+	if !rs.Match(&RequestMetadata{Host: "a.one.com"}) {
+		t.Error("content should be kept after 304")
+	}
+
+	srv.set("DOMAIN-SUFFIX,two.com\nDOMAIN,x.com\n", `"v2"`)
+	if err := rs.Update(context.Background(), cacheDir); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if rs.Match(&RequestMetadata{Host: "a.one.com"}) || !rs.Match(&RequestMetadata{Host: "a.two.com"}) {
+		t.Error("content should be replaced after a change")
+	}
+
+	// A new set for the same URL starts from the cache
+	cold, _ := NewRuleSetRule(srv.URL+"/set.list", "Proxy", nil)
+	if err := cold.LoadCache(cacheDir); err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	if st := cold.Status(); st.Entries != 2 || st.Source != RuleSetSourceCache {
+		t.Errorf("unexpected status after cache load: %+v", st)
+	}
+	if err := cold.Update(context.Background(), cacheDir); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if srv.notModified.Load() != 2 {
+		t.Error("the cached ETag should be used for revalidation")
+	}
+
+	// Failures are reported and keep the content
+	srv.Close()
+	if err := cold.Update(context.Background(), cacheDir); err == nil {
+		t.Fatal("expected an error with the server down")
+	}
+	if st := cold.Status(); st.LastError == "" || st.Entries != 2 {
+		t.Errorf("unexpected status after failure: %+v", st)
+	}
+}
+
+func TestEngine_RuleSetLifecycle(t *testing.T) {
+	srv := newRuleSetServer(t, "DOMAIN,a.com\n")
+	cacheDir := t.TempDir()
+	configs := []*config.RuleConfig{
+		{Type: "RULE-SET", Value: srv.URL + "/a", Policy: "Proxy", Enabled: true, UpdateInterval: 3600},
+		{Type: "FINAL", Policy: "DIRECT", Enabled: true},
+	}
+
+	e := NewEngine()
+	e.SetRuleSetCacheDir(cacheDir)
+	if err := e.LoadRulesFromConfigs(configs); err != nil {
+		t.Fatalf("LoadRulesFromConfigs failed: %v", err)
+	}
+	waitFor(t, func() bool { return e.RuleSets()[0].Entries == 1 })
+
+	sets := e.RuleSets()
+	if len(sets) != 1 || sets[0].UpdateInterval != 3600 || sets[0].Policy != "Proxy" {
+		t.Fatalf("unexpected rule sets: %+v", sets)
+	}
+
+	// Reloading uses the fresh cache instead of downloading again
+	before := srv.requests.Load()
+	if err := e.LoadRulesFromConfigs(configs); err != nil {
+		t.Fatalf("LoadRulesFromConfigs failed: %v", err)
+	}
+	if st := e.RuleSets()[0]; st.Source != RuleSetSourceCache || st.Entries != 1 {
+		t.Errorf("unexpected status after reload: %+v", st)
+	}
+	if adapter, _ := e.Match(&RequestMetadata{Host: "a.com"}); adapter != "Proxy" {
+		t.Errorf("Match = %q before any download, want Proxy", adapter)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if srv.requests.Load() != before {
+		t.Error("a fresh cache should delay the download")
+	}
+
+	// Refresh revalidates now
+	statuses, err := e.RefreshRuleSet(srv.URL + "/a")
+	if err != nil || len(statuses) != 1 || statuses[0].Source != RuleSetSourceCache {
+		t.Fatalf("RefreshRuleSet = %+v, %v", statuses, err)
+	}
+	if srv.notModified.Load() != 1 {
+		t.Error("refresh should revalidate with the ETag")
+	}
+	if _, err := e.RefreshRuleSet("http://unknown.example/x"); err != ErrRuleSetNotFound {
+		t.Errorf("RefreshRuleSet of an unknown URL = %v, want ErrRuleSetNotFound", err)
+	}
+	e.Close()
+}
+
+func TestEngine_NestedRuleSet(t *testing.T) {
+	srv := newRuleSetServer(t, "DOMAIN,a.com\n")
+	e := NewEngine()
+	defer e.Close()
+	if err := e.LoadFromConfig([]string{
+		"AND,((RULE-SET," + srv.URL + "/a),(DEST-PORT,443)),Proxy",
+		"FINAL,DIRECT",
+	}); err != nil {
+		t.Fatalf("LoadFromConfig failed: %v", err)
+	}
+
+	// The set inside AND is downloaded like a top-level one
+	waitFor(t, func() bool {
+		sets := e.RuleSets()
+		return len(sets) == 1 && sets[0].Entries == 1
+	})
+	if adapter, _ := e.Match(&RequestMetadata{Host: "a.com", Port: 443}); adapter != "Proxy" {
+		t.Errorf("Match = %q, want Proxy", adapter)
+	}
+	if _, err := e.RefreshRuleSet(srv.URL + "/a"); err != nil {
+		t.Errorf("RefreshRuleSet failed: %v", err)
+	}
+}
+
+func TestRuleFromConfig_NestedUpdateInterval(t *testing.T) {
+	cfgs := config.ParseRules([]string{"AND,((RULE-SET,https://example.com/a.list),(DEST-PORT,443)),Proxy,update-interval=600"})
+	if len(cfgs) != 1 || cfgs[0].UpdateInterval != 600 {
+		t.Fatalf("unexpected config: %+v", cfgs)
+	}
+	r, err := ruleFromConfig(cfgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := ruleSets([]Rule{r})
+	if len(sets) != 1 || sets[0].UpdateInterval != 10*time.Minute {
+		t.Errorf("nested rule set: got %+v, want an update interval of 10m", sets)
+	}
+}
+
+func TestRuleSetRun_StopsOnCancel(t *testing.T) {
+	srv := newRuleSetServer(t, "DOMAIN,a.com\n")
+	rs, _ := NewRuleSetRule(srv.URL, "Proxy", nil)
+	rs.UpdateInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rs.run(ctx, "")
+		close(done)
+	}()
+	waitFor(t, func() bool { return srv.requests.Load() >= 3 })
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("run did not stop after cancel")
+	}
+	// A request canceled in flight may still reach the server
+	time.Sleep(20 * time.Millisecond)
+	n := srv.requests.Load()
+	time.Sleep(30 * time.Millisecond)
+	if srv.requests.Load() != n {
+		t.Error("updates continued after cancel")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWriteFileAtomic_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "set.list")
+	contents := []string{strings.Repeat("a", 1<<16), strings.Repeat("b", 1<<16)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			if err := writeFileAtomic(path, []byte(data)); err != nil {
+				t.Error(err)
+			}
+		}(contents[i%2])
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != contents[0] && string(got) != contents[1] {
+		t.Error("file holds a mix of two writes")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
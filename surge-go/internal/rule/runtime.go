@@ -0,0 +1,229 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrRuntimeRuleNotFound is returned for an unknown runtime rule id
+var ErrRuntimeRuleNotFound = errors.New("runtime rule not found")
+
+// runtimeRule is a rule added while running, evaluated before the config rules.
+// It is never written to the config unless promoted.
+type runtimeRule struct {
+	id       int
+	line     string
+	rule     Rule
+	comment  string
+	created  time.Time
+	expires  time.Time // Zero if the rule does not expire
+	promoted bool      // Written to the config, dropped on the next load
+}
+
+// RuntimeRuleStatus describes a runtime rule
+type RuntimeRuleStatus struct {
+	ID        int        `json:"id"`
+	Rule      string     `json:"rule"`
+	Policy    string     `json:"policy"`
+	Comment   string     `json:"comment,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Promoted  bool       `json:"promoted"`
+	StatsSnapshot
+}
+
+func (r *runtimeRule) status() RuntimeRuleStatus {
+	s := RuntimeRuleStatus{
+		ID:            r.id,
+		Rule:          r.line,
+		Policy:        r.rule.Adapter(),
+		Comment:       r.comment,
+		StatsSnapshot: r.rule.Stats().Snapshot(),
+		CreatedAt:     r.created,
+		Promoted:      r.promoted,
+	}
+	if !r.expires.IsZero() {
+		expires := r.expires
+		s.ExpiresAt = &expires
+	}
+	return s
+}
+
+// AddRuntimeRule parses a rule line and evaluates it before the config rules.
+// With a positive ttl the rule is removed once it elapsed. Rule sets are not
+// accepted, as they would have to be downloaded first.
+func (e *Engine) AddRuntimeRule(line string, ttl time.Duration, comment string) (RuntimeRuleStatus, error) {
+	r, err := ParseRule(line)
+	if err != nil {
+		return RuntimeRuleStatus{}, err
+	}
+	if r == nil {
+		return RuntimeRuleStatus{}, fmt.Errorf("empty rule")
+	}
+	if sets := ruleSets([]Rule{r}); len(sets) > 0 {
+		return RuntimeRuleStatus{}, fmt.Errorf("%s rules cannot be added at runtime", sets[0].Type())
+	}
+	if r.Adapter() == "" {
+		return RuntimeRuleStatus{}, fmt.Errorf("rule has no policy: %s", line)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.nextRuntimeID++
+	rr := &runtimeRule{
+		id:      e.nextRuntimeID,
+		line:    strings.TrimSpace(line),
+		rule:    r,
+		comment: comment,
+		created: now(),
+	}
+	if ttl > 0 {
+		rr.expires = rr.created.Add(ttl)
+	}
+	// Newest first, so that a new entry overrides older ones
+	e.runtime = append([]*runtimeRule{rr}, e.runtime...)
+	e.index = nil
+	e.scheduleExpiry()
+	return rr.status(), nil
+}
+
+// RuntimeRules returns the runtime rules in evaluation order
+func (e *Engine) RuntimeRules() []RuntimeRuleStatus {
+	e.expireRuntimeRules(now())
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	statuses := make([]RuntimeRuleStatus, 0, len(e.runtime))
+	for _, rr := range e.runtime {
+		statuses = append(statuses, rr.status())
+	}
+	return statuses
+}
+
+// RemoveRuntimeRule removes a runtime rule
+func (e *Engine) RemoveRuntimeRule(id int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, rr := range e.runtime {
+		if rr.id == id {
+			e.runtime = append(e.runtime[:i:i], e.runtime[i+1:]...)
+			e.index = nil
+			e.scheduleExpiry()
+			return nil
+		}
+	}
+	return ErrRuntimeRuleNotFound
+}
+
+// PromoteRuntimeRule marks a runtime rule as written to the config and
+// returns its status from before the promotion. The rule no longer expires
+// and is dropped when the config is loaded again, the config rule taking its
+// place. A rule that was already promoted is not found.
+func (e *Engine) PromoteRuntimeRule(id int) (RuntimeRuleStatus, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rr := range e.runtime {
+		if rr.id == id && !rr.promoted {
+			st := rr.status()
+			rr.promoted = true
+			rr.expires = time.Time{}
+			e.scheduleExpiry()
+			return st, nil
+		}
+	}
+	return RuntimeRuleStatus{}, ErrRuntimeRuleNotFound
+}
+
+// UnpromoteRuntimeRule undoes PromoteRuntimeRule when the config could not be
+// written. expires is the expiry the rule had, zero if it had none.
+func (e *Engine) UnpromoteRuntimeRule(id int, expires time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rr := range e.runtime {
+		if rr.id == id && rr.promoted {
+			rr.promoted = false
+			rr.expires = expires
+			e.scheduleExpiry()
+			return nil
+		}
+	}
+	return ErrRuntimeRuleNotFound
+}
+
+// TakeRuntimeRules moves the runtime rules of prev that are neither expired
+// nor promoted to e, so that they survive a config reload
+func (e *Engine) TakeRuntimeRules(prev *Engine) {
+	t := now()
+	prev.mu.Lock()
+	var kept []*runtimeRule
+	for _, rr := range prev.runtime {
+		if !rr.promoted && (rr.expires.IsZero() || t.Before(rr.expires)) {
+			kept = append(kept, rr)
+		}
+	}
+	nextID := prev.nextRuntimeID
+	prev.runtime = nil
+	prev.index = nil
+	prev.scheduleExpiry()
+	prev.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runtime = append(kept, e.runtime...)
+	e.nextRuntimeID = max(e.nextRuntimeID, nextID)
+	e.index = nil
+	e.scheduleExpiry()
+}
+
+// expireRuntimeRules removes the runtime rules whose TTL elapsed at t. Only the
+// time of the next expiry is checked when none did.
+func (e *Engine) expireRuntimeRules(t time.Time) {
+	e.mu.RLock()
+	due := !e.nextExpiry.IsZero() && !t.Before(e.nextExpiry)
+	e.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	kept := e.runtime[:0:0]
+	for _, rr := range e.runtime {
+		if !rr.expires.IsZero() && !t.Before(rr.expires) {
+			log.Printf("Runtime rule %d expired: %s", rr.id, rr.line)
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	if len(kept) != len(e.runtime) {
+		e.runtime = kept
+		e.index = nil
+	}
+	e.scheduleExpiry()
+}
+
+// scheduleExpiry records when the next runtime rule expires. e.mu must be held.
+func (e *Engine) scheduleExpiry() {
+	e.nextExpiry = time.Time{}
+	for _, rr := range e.runtime {
+		if !rr.expires.IsZero() && (e.nextExpiry.IsZero() || rr.expires.Before(e.nextExpiry)) {
+			e.nextExpiry = rr.expires
+		}
+	}
+}
+
+// evaluated returns the runtime rules followed by the config rules. e.mu must be held.
+func (e *Engine) evaluated() []Rule {
+	if len(e.runtime) == 0 {
+		return e.rules
+	}
+	rules := make([]Rule, 0, len(e.runtime)+len(e.rules))
+	for _, rr := range e.runtime {
+		rules = append(rules, rr.rule)
+	}
+	return append(rules, e.rules...)
+}
@@ -0,0 +1,109 @@
+package rule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngine_RuntimeRules(t *testing.T) {
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	setNow(t, start)
+
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{"DOMAIN-SUFFIX,example.com,Proxy", "FINAL,Proxy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, err := e.AddRuntimeRule("DOMAIN,bad.example.com,REJECT", time.Hour, "incident")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddRuntimeRule("DOMAIN-SUFFIX,example.com,DIRECT", 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddRuntimeRule("RULE-SET,https://example.com/set.list,DIRECT", 0, ""); err == nil {
+		t.Error("a rule set was accepted as runtime rule")
+	}
+
+	// The newest runtime rule comes first, runtime rules before config rules
+	if adapter, _ := e.Match(&RequestMetadata{Host: "bad.example.com"}); adapter != "DIRECT" {
+		t.Errorf("bad.example.com: got %q, want DIRECT", adapter)
+	}
+	if adapter, _ := e.Match(&RequestMetadata{Host: "other.org"}); adapter != "Proxy" {
+		t.Errorf("other.org: got %q, want Proxy", adapter)
+	}
+	if e.Count() != 2 || len(e.GetRules()) != 2 {
+		t.Errorf("runtime rules are counted as config rules")
+	}
+
+	list := e.RuntimeRules()
+	if len(list) != 2 || list[1].ID != blocked.ID || list[1].ExpiresAt == nil || list[0].ExpiresAt != nil {
+		t.Fatalf("unexpected runtime rules: %+v", list)
+	}
+	if err := e.RemoveRuntimeRule(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RemoveRuntimeRule(list[0].ID); !errors.Is(err, ErrRuntimeRuleNotFound) {
+		t.Errorf("removing twice: got %v", err)
+	}
+	if adapter, _ := e.Match(&RequestMetadata{Host: "bad.example.com"}); adapter != "REJECT" {
+		t.Errorf("bad.example.com: got %q, want REJECT", adapter)
+	}
+
+	// The TTL elapsed
+	setNow(t, start.Add(time.Hour))
+	if adapter, _ := e.Match(&RequestMetadata{Host: "bad.example.com"}); adapter != "Proxy" {
+		t.Errorf("after expiry: got %q, want Proxy", adapter)
+	}
+	if list := e.RuntimeRules(); len(list) != 0 {
+		t.Errorf("expired rules are listed: %+v", list)
+	}
+}
+
+func TestEngine_TakeRuntimeRules(t *testing.T) {
+	setNow(t, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+
+	prev := NewEngine()
+	kept, _ := prev.AddRuntimeRule("DOMAIN,a.com,REJECT", 0, "")
+	promoted, _ := prev.AddRuntimeRule("DOMAIN,b.com,REJECT", time.Minute, "")
+	if _, err := prev.PromoteRuntimeRule(promoted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{"DOMAIN,b.com,REJECT", "FINAL,Proxy"}); err != nil {
+		t.Fatal(err)
+	}
+	e.TakeRuntimeRules(prev)
+
+	list := e.RuntimeRules()
+	if len(list) != 1 || list[0].ID != kept.ID {
+		t.Fatalf("got %+v, want only the rule that was not promoted", list)
+	}
+	if adapter, _ := e.Match(&RequestMetadata{Host: "a.com"}); adapter != "REJECT" {
+		t.Errorf("a.com: got %q, want REJECT", adapter)
+	}
+	if next, _ := e.AddRuntimeRule("DOMAIN,c.com,DIRECT", 0, ""); next.ID <= promoted.ID {
+		t.Errorf("id %d reused", next.ID)
+	}
+}
+
+func TestEngine_MatchTrace_Runtime(t *testing.T) {
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{"DOMAIN,a.com,Proxy"}); err != nil {
+		t.Fatal(err)
+	}
+	rr, _ := e.AddRuntimeRule("DOMAIN-KEYWORD,zzz,REJECT", 0, "")
+
+	adapter, _, trace := e.MatchTrace(&RequestMetadata{Host: "a.com"})
+	if adapter != "Proxy" || len(trace.Steps) != 2 {
+		t.Fatalf("got %q, %+v", adapter, trace.Steps)
+	}
+	if s := trace.Steps[0]; !s.Runtime || s.Index != rr.ID || s.Matched {
+		t.Errorf("runtime step: %+v", s)
+	}
+	if s := trace.Steps[1]; s.Runtime || s.Index != 0 || !s.Matched {
+		t.Errorf("config step: %+v", s)
+	}
+}
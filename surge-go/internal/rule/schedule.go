@@ -0,0 +1,280 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedules limit rules to times of the week, through TIME rules or the
+// schedule= option of any rule. A schedule lists days, time ranges and a time
+// zone, separated by spaces and all optional:
+//
+//	Mon-Fri 09:00-18:00 Asia/Shanghai
+//	Sat Sun 10:00-12:00 14:00-16:00
+//	22:00-06:00 UTC+8
+//
+// Without days every day is included, without ranges the whole day. A range
+// ending before it starts runs past midnight, into the day after one of the
+// days. Times are local unless a zone is given.
+
+// now is the clock of schedules, replaced in tests
+var now = time.Now
+
+// Schedule is a parsed schedule
+type Schedule struct {
+	spec   string
+	days   [7]bool // Indexed by time.Weekday
+	ranges []clockRange
+	loc    *time.Location
+}
+
+// clockRange is a time range in minutes since midnight, the end excluded
+type clockRange struct {
+	start, end int
+}
+
+var weekdayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// ParseSchedule parses a schedule
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	s := &Schedule{spec: strings.Join(fields, " "), loc: time.Local}
+	hasDays, hasZone := false, false
+	for _, f := range fields {
+		if from, to, ok := parseDays(f); ok {
+			for d := from; ; d = (d + 1) % 7 {
+				s.days[d] = true
+				if d == to {
+					break
+				}
+			}
+			hasDays = true
+			continue
+		}
+		if r, ok, err := parseClockRange(f); ok {
+			if err != nil {
+				return nil, err
+			}
+			s.ranges = append(s.ranges, r)
+			continue
+		}
+		loc, err := parseZone(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		if hasZone {
+			return nil, fmt.Errorf("invalid schedule %q: more than one time zone", spec)
+		}
+		s.loc, hasZone = loc, true
+	}
+	if !hasDays {
+		s.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	return s, nil
+}
+
+// parseDays parses a day, e.g. Mon, or a range of days, e.g. Mon-Fri or Fri-Mon
+func parseDays(s string) (from, to int, ok bool) {
+	first, last, isRange := strings.Cut(s, "-")
+	if from = weekday(first); from < 0 {
+		return 0, 0, false
+	}
+	if !isRange {
+		return from, from, true
+	}
+	if to = weekday(last); to < 0 {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// weekday returns the day named by at least its first three letters, or -1
+func weekday(name string) int {
+	name = strings.ToLower(name)
+	if len(name) < 3 {
+		return -1
+	}
+	for i, full := range weekdayNames {
+		if strings.HasPrefix(full, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseClockRange parses HH:MM-HH:MM. ok is false if s does not look like a
+// range at all.
+func parseClockRange(s string) (r clockRange, ok bool, err error) {
+	first, last, found := strings.Cut(s, "-")
+	if !found || !strings.Contains(first, ":") || !strings.Contains(last, ":") {
+		return r, false, nil
+	}
+	if r.start, err = parseClock(first); err != nil || r.start == 24*60 {
+		return r, true, fmt.Errorf("invalid time range %q", s)
+	}
+	if r.end, err = parseClock(last); err != nil || r.end == r.start {
+		return r, true, fmt.Errorf("invalid time range %q", s)
+	}
+	return r, true, nil
+}
+
+// parseClock parses HH:MM into minutes since midnight, up to 24:00
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || len(m) != 2 || hour < 0 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if t := hour*60 + minute; t <= 24*60 {
+		return t, nil
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
+
+// parseZone parses Local, UTC, a fixed offset such as UTC+8 or UTC-03:30, or
+// an IANA zone such as Europe/Berlin
+func parseZone(s string) (*time.Location, error) {
+	switch {
+	case strings.EqualFold(s, "Local"):
+		return time.Local, nil
+	case strings.EqualFold(s, "UTC"), strings.EqualFold(s, "GMT"):
+		return time.UTC, nil
+	case len(s) > 3 && (strings.EqualFold(s[:3], "UTC") || strings.EqualFold(s[:3], "GMT")):
+		offset := s[3:]
+		sign := 1
+		switch offset[0] {
+		case '-':
+			sign = -1
+		case '+':
+		default:
+			return nil, fmt.Errorf("invalid time zone %q", s)
+		}
+		h, m, _ := strings.Cut(offset[1:], ":")
+		hours, err := strconv.Atoi(h)
+		minutes := 0
+		if err == nil && m != "" {
+			minutes, err = strconv.Atoi(m)
+		}
+		if err != nil || hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid time zone %q", s)
+		}
+		return time.FixedZone(s, sign*(hours*3600+minutes*60)), nil
+	case strings.Contains(s, "/"):
+		return time.LoadLocation(s)
+	}
+	return nil, fmt.Errorf("unknown item %q", s)
+}
+
+// Active reports whether t is within the schedule
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.loc)
+	day := t.Weekday()
+	if len(s.ranges) == 0 {
+		return s.days[day]
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	prev := (day + 6) % 7
+	for _, r := range s.ranges {
+		if r.start < r.end {
+			if s.days[day] && minute >= r.start && minute < r.end {
+				return true
+			}
+			continue
+		}
+		// Past midnight: the evening of a scheduled day or the morning after one
+		if (s.days[day] && minute >= r.start) || (s.days[prev] && minute < r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule as written, normalized to single spaces
+func (s *Schedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.spec
+}
+
+// inSchedule reports whether the schedule= option of r, if any, includes t
+func inSchedule(r Rule, t time.Time) bool {
+	s := r.Schedule()
+	return s == nil || s.Active(t)
+}
+
+// usableAt returns the filter of rules taking part in matching at t: enabled
+// rules within their schedule
+func usableAt(t time.Time) func(Rule) bool {
+	return func(r Rule) bool {
+		return r.IsEnabled() && inSchedule(r, t)
+	}
+}
+
+// IsActive reports whether r can match now: it is enabled, within its
+// schedule, and its TIME conditions do not rule a match out
+func IsActive(r Rule) bool {
+	t := now()
+	return r.IsEnabled() && inSchedule(r, t) && timeAllows(r, t)
+}
+
+// timeAllows reports false when the TIME conditions of r rule out a match at t,
+// whatever the request
+func timeAllows(r Rule, t time.Time) bool {
+	switch r := r.(type) {
+	case *TimeRule:
+		return r.when.Active(t)
+	case *AndRule:
+		for _, sub := range r.Rules {
+			if !timeAllows(sub, t) {
+				return false
+			}
+		}
+	case *OrRule:
+		for _, sub := range r.Rules {
+			if timeAllows(sub, t) {
+				return true
+			}
+		}
+		return false
+	case *NotRule:
+		if tr, ok := r.Rule.(*TimeRule); ok {
+			return !tr.when.Active(t)
+		}
+	}
+	return true
+}
+
+// TimeRule matches any request while its schedule is active
+type TimeRule struct {
+	BaseRule
+	when *Schedule
+}
+
+// NewTimeRule creates a TIME rule from a schedule
+func NewTimeRule(spec, adapter string) (*TimeRule, error) {
+	when, err := ParseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &TimeRule{
+		BaseRule: BaseRule{
+			RuleType:    "TIME",
+			RulePayload: when.String(),
+			AdapterName: adapter,
+		},
+		when: when,
+	}, nil
+}
+
+func (r *TimeRule) Match(metadata *RequestMetadata) bool {
+	return r.when.Active(now())
+}
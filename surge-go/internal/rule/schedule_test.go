@@ -0,0 +1,155 @@
+package rule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/config"
+)
+
+// setNow fixes the clock of schedules for a test
+func setNow(t *testing.T, at time.Time) {
+	t.Helper()
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestParseSchedule(t *testing.T) {
+	valid := []string{
+		"Mon-Fri 09:00-18:00",
+		"sat sunday",
+		"Fri-Mon 22:00-06:00 UTC+8",
+		"10:00-12:00 14:00-24:00 Europe/Berlin",
+		"Mon UTC-03:30",
+		"Wed GMT",
+	}
+	for _, spec := range valid {
+		if _, err := ParseSchedule(spec); err != nil {
+			t.Errorf("ParseSchedule(%q): %v", spec, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"Mo",
+		"Mon-Xyz",
+		"09:00-09:00",
+		"25:00-26:00",
+		"09:60-10:00",
+		"24:00-01:00",
+		"Mon UTC UTC+1",
+		"Mon UTC+8x",
+		"Mon Nowhere/City",
+		"weekdays",
+	}
+	for _, spec := range invalid {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	utc8 := time.FixedZone("UTC+8", 8*3600)
+	monday := func(hour, min int) time.Time { return time.Date(2026, 10, 19, hour, min, 0, 0, time.UTC) }
+	saturday := func(hour, min int) time.Time { return time.Date(2026, 10, 17, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"Mon-Fri 09:00-18:00 UTC", monday(9, 0), true},
+		{"Mon-Fri 09:00-18:00 UTC", monday(17, 59), true},
+		{"Mon-Fri 09:00-18:00 UTC", monday(18, 0), false},
+		{"Mon-Fri 09:00-18:00 UTC", saturday(12, 0), false},
+		{"Sat Sun UTC", saturday(0, 0), true},
+		{"Sat Sun UTC", monday(12, 0), false},
+		// 01:00 UTC on Monday is 09:00 in UTC+8
+		{"Mon 09:00-18:00 UTC+8", monday(1, 0), true},
+		{"Mon 09:00-18:00 UTC+8", monday(12, 0), false},
+		// Past midnight: Friday night runs into Saturday morning
+		{"Fri 22:00-06:00 UTC", saturday(5, 59), true},
+		{"Fri 22:00-06:00 UTC", saturday(6, 0), false},
+		{"Fri 22:00-06:00 UTC", saturday(23, 0), false},
+		{"Fri-Sun UTC", monday(0, 0), false},
+		{"Fri-Mon UTC", monday(0, 0), true},
+		{"00:00-24:00 UTC", monday(23, 59), true},
+		{"10:00-12:00 14:00-16:00 UTC", monday(15, 0), true},
+		{"10:00-12:00 14:00-16:00 UTC", monday(13, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Active(tt.at); got != tt.want {
+			t.Errorf("%q.Active(%s) = %v, want %v", tt.spec, tt.at.In(utc8), got, tt.want)
+		}
+	}
+}
+
+func TestTimeRule_Logical(t *testing.T) {
+	r, err := ParseRule("AND,((TIME,Mon-Fri 09:00-18:00 UTC),(DOMAIN-SUFFIX,corp.com)),Corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := &RequestMetadata{Host: "git.corp.com"}
+
+	setNow(t, time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC))
+	if !r.Match(metadata) || !IsActive(r) {
+		t.Error("AND with TIME should match and be active during work hours")
+	}
+	setNow(t, time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	if r.Match(metadata) || IsActive(r) {
+		t.Error("AND with TIME should not match nor be active on a Saturday")
+	}
+
+	not, err := ParseRule("NOT,((TIME,Sat Sun UTC)),Weekday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if not.Match(metadata) || IsActive(not) {
+		t.Error("NOT TIME should not match nor be active within its schedule")
+	}
+}
+
+func TestEngine_ScheduleOption(t *testing.T) {
+	configs := config.ParseRules([]string{
+		"DOMAIN-SUFFIX,corp.com,Corp,schedule=Mon-Fri 09:00-18:00 UTC",
+		"FINAL,DIRECT",
+	})
+	engine := NewEngine()
+	if err := engine.LoadRulesFromConfigs(configs); err != nil {
+		t.Fatal(err)
+	}
+	r := engine.GetRules()[0]
+	if got := r.Schedule().String(); got != "Mon-Fri 09:00-18:00 UTC" {
+		t.Errorf("Schedule() = %q", got)
+	}
+
+	setNow(t, time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC))
+	if adapter, _ := engine.Match(&RequestMetadata{Host: "git.corp.com"}); adapter != "Corp" {
+		t.Errorf("during the schedule got %q, want Corp", adapter)
+	}
+	if !IsActive(r) {
+		t.Error("rule should be active during its schedule")
+	}
+
+	setNow(t, time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC))
+	if adapter, _ := engine.Match(&RequestMetadata{Host: "git.corp.com"}); adapter != "DIRECT" {
+		t.Errorf("outside the schedule got %q, want DIRECT", adapter)
+	}
+	if IsActive(r) {
+		t.Error("rule should not be active outside its schedule")
+	}
+	_, _, trace := engine.MatchTrace(&RequestMetadata{Host: "git.corp.com"})
+	if trace.Steps[0].Skipped == "" {
+		t.Error("trace should show the rule skipped outside its schedule")
+	}
+
+	bad := config.ParseRules([]string{"DOMAIN,a.com,Corp,schedule=Someday"})
+	if err := NewEngine().LoadRulesFromConfigs(bad); err == nil {
+		t.Error("invalid schedule should fail to load")
+	}
+}
@@ -0,0 +1,159 @@
+package rule
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SrcIPRule matches the client address against a CIDR range
+type SrcIPRule struct {
+	BaseRule
+	ipNet *net.IPNet
+}
+
+func NewSrcIPRule(cidr, adapter string) (*SrcIPRule, error) {
+	ipNet, err := parseIPNet(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRC-IP: %s", cidr)
+	}
+	return &SrcIPRule{
+		BaseRule: BaseRule{
+			RuleType:    "SRC-IP",
+			RulePayload: cidr,
+			AdapterName: adapter,
+		},
+		ipNet: ipNet,
+	}, nil
+}
+
+func (r *SrcIPRule) Match(metadata *RequestMetadata) bool {
+	return metadata.SourceIP != nil && r.ipNet.Contains(metadata.SourceIP)
+}
+
+// portRange is a single port ("443") or an inclusive range ("8000-9000")
+type portRange struct {
+	low, high int
+}
+
+func parsePortRange(s string) (portRange, error) {
+	lowStr, highStr, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	if !isRange {
+		highStr = lowStr
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(lowStr))
+	high, err2 := strconv.Atoi(strings.TrimSpace(highStr))
+	if err1 != nil || err2 != nil || low < 0 || high > 65535 || low > high {
+		return portRange{}, fmt.Errorf("invalid port: %s", s)
+	}
+	return portRange{low: low, high: high}, nil
+}
+
+func (p portRange) contains(port int) bool {
+	return port >= p.low && port <= p.high
+}
+
+// SrcPortRule matches the client port
+type SrcPortRule struct {
+	BaseRule
+	ports portRange
+}
+
+func NewSrcPortRule(ports, adapter string) (*SrcPortRule, error) {
+	p, err := parsePortRange(ports)
+	if err != nil {
+		return nil, err
+	}
+	return &SrcPortRule{
+		BaseRule: BaseRule{
+			RuleType:    "SRC-PORT",
+			RulePayload: ports,
+			AdapterName: adapter,
+		},
+		ports: p,
+	}, nil
+}
+
+func (r *SrcPortRule) Match(metadata *RequestMetadata) bool {
+	return metadata.SourcePort != 0 && r.ports.contains(metadata.SourcePort)
+}
+
+// InPortRule matches the port of the listener the request arrived on
+type InPortRule struct {
+	BaseRule
+	ports portRange
+}
+
+func NewInPortRule(ports, adapter string) (*InPortRule, error) {
+	p, err := parsePortRange(ports)
+	if err != nil {
+		return nil, err
+	}
+	return &InPortRule{
+		BaseRule: BaseRule{
+			RuleType:    "IN-PORT",
+			RulePayload: ports,
+			AdapterName: adapter,
+		},
+		ports: p,
+	}, nil
+}
+
+func (r *InPortRule) Match(metadata *RequestMetadata) bool {
+	return metadata.InboundPort != 0 && r.ports.contains(metadata.InboundPort)
+}
+
+// inboundTypes are the values accepted by IN-TYPE
+var inboundTypes = []string{"HTTP", "SOCKS5", "TUN", "REDIR"}
+
+// InTypeRule matches the kind of listener the request arrived on
+type InTypeRule struct {
+	BaseRule
+	inType string
+}
+
+func NewInTypeRule(inType, adapter string) (*InTypeRule, error) {
+	t := strings.ToUpper(strings.TrimSpace(inType))
+	valid := false
+	for _, known := range inboundTypes {
+		if t == known {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid IN-TYPE %q, expected one of %s", inType, strings.Join(inboundTypes, ", "))
+	}
+	return &InTypeRule{
+		BaseRule: BaseRule{
+			RuleType:    "IN-TYPE",
+			RulePayload: inType,
+			AdapterName: adapter,
+		},
+		inType: t,
+	}, nil
+}
+
+func (r *InTypeRule) Match(metadata *RequestMetadata) bool {
+	return strings.EqualFold(metadata.InboundType, r.inType)
+}
+
+// InUserRule matches the user that authenticated to the inbound proxy
+type InUserRule struct {
+	BaseRule
+}
+
+func NewInUserRule(user, adapter string) *InUserRule {
+	return &InUserRule{
+		BaseRule: BaseRule{
+			RuleType:    "IN-USER",
+			RulePayload: user,
+			AdapterName: adapter,
+		},
+	}
+}
+
+func (r *InUserRule) Match(metadata *RequestMetadata) bool {
+	return metadata.InboundUser != "" && metadata.InboundUser == r.RulePayload
+}
@@ -0,0 +1,106 @@
+package rule
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSrcIPRule(t *testing.T) {
+	r, err := NewSrcIPRule("192.168.1.0/24", "DIRECT")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	if !r.Match(&RequestMetadata{SourceIP: net.ParseIP("192.168.1.20")}) {
+		t.Error("should match a client in the network")
+	}
+	if r.Match(&RequestMetadata{SourceIP: net.ParseIP("192.168.2.20"), IP: net.ParseIP("192.168.1.20")}) {
+		t.Error("should not match on the destination IP")
+	}
+	if r.Match(&RequestMetadata{}) {
+		t.Error("should not match without a source IP")
+	}
+
+	single, err := NewSrcIPRule("10.0.0.5", "DIRECT")
+	if err != nil {
+		t.Fatalf("failed to create single-IP rule: %v", err)
+	}
+	if !single.Match(&RequestMetadata{SourceIP: net.ParseIP("10.0.0.5")}) {
+		t.Error("single IP should match itself")
+	}
+
+	if _, err := NewSrcIPRule("not-an-ip", "DIRECT"); err == nil {
+		t.Error("expected error for invalid SRC-IP")
+	}
+}
+
+func TestPortRules(t *testing.T) {
+	src, err := NewSrcPortRule("50000-60000", "Proxy")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	if !src.Match(&RequestMetadata{SourcePort: 50000}) || !src.Match(&RequestMetadata{SourcePort: 60000}) {
+		t.Error("range should include both ends")
+	}
+	if src.Match(&RequestMetadata{SourcePort: 443, Port: 55000}) {
+		t.Error("SRC-PORT should not match on the destination port")
+	}
+
+	in, err := NewInPortRule("8889", "Proxy")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	if !in.Match(&RequestMetadata{InboundPort: 8889}) {
+		t.Error("should match the listener port")
+	}
+	if in.Match(&RequestMetadata{InboundPort: 8888, Port: 8889}) {
+		t.Error("IN-PORT should not match on the destination port")
+	}
+
+	for _, bad := range []string{"", "http", "70000", "9000-8000"} {
+		if _, err := NewInPortRule(bad, "Proxy"); err == nil {
+			t.Errorf("expected error for port %q", bad)
+		}
+	}
+}
+
+func TestInTypeRule(t *testing.T) {
+	r, err := NewInTypeRule("socks5", "Proxy")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	if !r.Match(&RequestMetadata{InboundType: "SOCKS5"}) {
+		t.Error("should match SOCKS5 case-insensitively")
+	}
+	if r.Match(&RequestMetadata{InboundType: "HTTP"}) {
+		t.Error("should not match HTTP")
+	}
+	if _, err := NewInTypeRule("FTP", "Proxy"); err == nil {
+		t.Error("expected error for unknown inbound type")
+	}
+}
+
+func TestInUserRule(t *testing.T) {
+	r := NewInUserRule("alice", "Proxy")
+	if !r.Match(&RequestMetadata{InboundUser: "alice"}) {
+		t.Error("should match alice")
+	}
+	if r.Match(&RequestMetadata{InboundUser: "bob"}) || r.Match(&RequestMetadata{}) {
+		t.Error("should only match alice")
+	}
+}
+
+func TestParseSourceRules(t *testing.T) {
+	lines := []string{
+		"SRC-IP,192.168.1.0/24,DIRECT",
+		"SRC-PORT,1234,DIRECT",
+		"IN-PORT,8888-8889,Proxy",
+		"IN-TYPE,TUN,Proxy",
+		"IN-USER,alice,Proxy",
+		"AND,((IN-TYPE,HTTP),(SRC-IP,10.0.0.0/8)),Proxy",
+	}
+	for _, line := range lines {
+		if _, err := ParseRule(line); err != nil {
+			t.Errorf("ParseRule(%q): %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"regexp"
+)
+
+// sing-box binary rule sets (.srs): "SRS", a version byte, then a zlib stream
+// holding a uvarint rule count and the rules. Only default rules made of
+// domain, keyword, regex and IP items can be expressed as a list; rules with
+// other conditions (ports, processes, logical rules...) are skipped.
+
+var srsMagic = []byte("SRS")
+
+const srsMaxVersion = 3
+
+// Rule item types
+const (
+	srsItemQueryType            = 0
+	srsItemNetwork              = 1
+	srsItemDomain               = 2
+	srsItemDomainKeyword        = 3
+	srsItemDomainRegex          = 4
+	srsItemSourceIPCIDR         = 5
+	srsItemIPCIDR               = 6
+	srsItemSourcePort           = 7
+	srsItemSourcePortRange      = 8
+	srsItemPort                 = 9
+	srsItemPortRange            = 10
+	srsItemProcessName          = 11
+	srsItemProcessPath          = 12
+	srsItemPackageName          = 13
+	srsItemWIFISSID             = 14
+	srsItemWIFIBSSID            = 15
+	srsItemAdGuardDomain        = 16
+	srsItemProcessPathRegex     = 17
+	srsItemNetworkType          = 18
+	srsItemNetworkIsExpensive   = 19
+	srsItemNetworkIsConstrained = 20
+	srsItemFinal                = 0xFF
+)
+
+// Labels marking suffix entries in the domain matcher's keys
+const (
+	srsPrefixLabel = '\r' // Followed by ".domain": subdomains only
+	srsRootLabel   = '\n' // Followed by "domain": the domain and its subdomains
+)
+
+// srsRule is what a default rule contributes to the list
+type srsRule struct {
+	domains  []srsDomain
+	keywords []string
+	regexes  []string
+	networks []*net.IPNet
+	other    bool // Has conditions a list cannot express
+}
+
+// srsMaxItems bounds the element counts read from a file before allocating,
+// so that a corrupt file fails instead of panicking
+const srsMaxItems = 1 << 24
+
+type srsDomain struct {
+	name string
+	kind domainKind
+}
+
+func parseSRS(data []byte, list *listMatcher) error {
+	if len(data) < len(srsMagic)+1 || !bytes.HasPrefix(data, srsMagic) {
+		return fmt.Errorf("not a sing-box rule set")
+	}
+	if version := data[len(srsMagic)]; version == 0 || version > srsMaxVersion {
+		return fmt.Errorf("unsupported sing-box rule set version: %d", version)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data[len(srsMagic)+1:]))
+	if err != nil {
+		return fmt.Errorf("invalid sing-box rule set: %v", err)
+	}
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("invalid sing-box rule set: %v", err)
+	}
+
+	skipped := 0
+	for i := uint64(0); i < count; i++ {
+		rule, err := readSRSRule(r)
+		if err != nil {
+			return fmt.Errorf("sing-box rule %d: %v", i+1, err)
+		}
+		if rule.other {
+			skipped++
+			continue
+		}
+		for _, d := range rule.domains {
+			list.addDomain(d.name, d.kind)
+		}
+		for _, k := range rule.keywords {
+			list.addKeyword(k)
+		}
+		for _, expr := range rule.regexes {
+			if re, err := regexp.Compile(expr); err == nil {
+				list.addRegex(re)
+			}
+		}
+		for _, n := range rule.networks {
+			list.addNetwork(n)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("Rule set: skipped %d sing-box rules with conditions other than domains and IPs", skipped)
+	}
+	return nil
+}
+
+func readSRSRule(r *bufio.Reader) (srsRule, error) {
+	var rule srsRule
+	ruleType, err := r.ReadByte()
+	if err != nil {
+		return rule, err
+	}
+
+	switch ruleType {
+	case 0: // Default
+		return readSRSDefaultRule(r)
+	case 1: // Logical: mode, sub-rules, invert
+		if _, err := r.ReadByte(); err != nil {
+			return rule, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return rule, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := readSRSRule(r); err != nil {
+				return rule, err
+			}
+		}
+		if _, err := r.ReadByte(); err != nil {
+			return rule, err
+		}
+		rule.other = true
+		return rule, nil
+	}
+	return rule, fmt.Errorf("unknown rule type %d", ruleType)
+}
+
+func readSRSDefaultRule(r *bufio.Reader) (srsRule, error) {
+	var rule srsRule
+	for {
+		itemType, err := r.ReadByte()
+		if err != nil {
+			return rule, err
+		}
+
+		switch itemType {
+		case srsItemDomain:
+			rule.domains, err = readSRSDomains(r)
+		case srsItemDomainKeyword:
+			rule.keywords, err = readSRSStrings(r)
+		case srsItemDomainRegex:
+			rule.regexes, err = readSRSStrings(r)
+		case srsItemIPCIDR:
+			rule.networks, err = readSRSIPSet(r)
+		case srsItemSourceIPCIDR:
+			_, err = readSRSIPSet(r)
+			rule.other = true
+		case srsItemQueryType, srsItemSourcePort, srsItemPort:
+			_, err = readSRSUint16s(r)
+			rule.other = true
+		case srsItemNetwork, srsItemSourcePortRange, srsItemPortRange, srsItemProcessName,
+			srsItemProcessPath, srsItemPackageName, srsItemWIFISSID, srsItemWIFIBSSID, srsItemProcessPathRegex:
+			_, err = readSRSStrings(r)
+			rule.other = true
+		case srsItemAdGuardDomain:
+			_, _, _, err = readSRSSuccinctSet(r)
+			rule.other = true
+		case srsItemNetworkType:
+			_, err = readSRSBytes(r)
+			rule.other = true
+		case srsItemNetworkIsExpensive, srsItemNetworkIsConstrained:
+			// Flags without a payload
+			rule.other = true
+		case srsItemFinal:
+			invert, err := r.ReadByte()
+			if err != nil {
+				return rule, err
+			}
+			if invert != 0 {
+				rule.other = true
+			}
+			return rule, nil
+		default:
+			return rule, fmt.Errorf("unsupported rule item type %d", itemType)
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+}
+
+func readSRSStrings(r *bufio.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > srsMaxItems {
+		return nil, fmt.Errorf("field too large: %d strings", n)
+	}
+	out := make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		b, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, string(b))
+	}
+	return out, nil
+}
+
+func readSRSBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > srsMaxItems {
+		return nil, fmt.Errorf("field too large: %d bytes", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func readSRSUint16s(r *bufio.Reader) ([]uint16, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > srsMaxItems {
+		return nil, fmt.Errorf("field too large: %d values", n)
+	}
+	out := make([]uint16, n)
+	for i := range out {
+		if err := binary.Read(r, binary.BigEndian, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func readSRSUint64s(r *bufio.Reader) ([]uint64, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > srsMaxItems {
+		return nil, fmt.Errorf("field too large: %d words", n)
+	}
+	out := make([]uint64, n)
+	for i := range out {
+		if err := binary.Read(r, binary.BigEndian, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// readSRSDomains reads a domain matcher: a version byte and a succinct trie
+// (LOUDS) over the reversed domains, given as leaf bits, label bits and labels
+func readSRSDomains(r *bufio.Reader) ([]srsDomain, error) {
+	leaves, labelBitmap, labels, err := readSRSSuccinctSet(r)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := succinctKeys(leaves, labelBitmap, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make([]srsDomain, 0, len(keys))
+	for _, key := range keys {
+		name := reverseString(key)
+		switch {
+		case len(name) > 1 && name[0] == srsPrefixLabel && name[1] == '.':
+			domains = append(domains, srsDomain{name: name[2:], kind: domainSubdomains})
+		case len(name) > 0 && name[0] == srsRootLabel:
+			domains = append(domains, srsDomain{name: name[1:], kind: domainSuffix})
+		default:
+			domains = append(domains, srsDomain{name: name, kind: domainExact})
+		}
+	}
+	return domains, nil
+}
+
+// succinctKeys lists the keys of a succinct trie. Nodes are numbered in
+// breadth-first order; each node's children are a run of 0 bits in the label
+// bitmap, ended by a 1 bit, and the n-th 0 bit is labelled labels[n] and
+// leads to node n+1. A leaf bit marks the nodes that end a key.
+func succinctKeys(leaves, labelBitmap []uint64, labels []byte) ([]string, error) {
+	bit := func(bm []uint64, i int) bool {
+		return i>>6 < len(bm) && bm[i>>6]>>(uint(i)&63)&1 != 0
+	}
+
+	// Children of node i are the nodes first[i] to first[i]+count[i]-1
+	var first, count []int
+	node, label := 0, 0
+	for pos := 0; node <= label; pos++ {
+		if pos >= len(labelBitmap)*64 {
+			return nil, fmt.Errorf("truncated domain matcher")
+		}
+		if len(first) == node {
+			first = append(first, label+1)
+			count = append(count, 0)
+		}
+		if bit(labelBitmap, pos) {
+			node++
+			continue
+		}
+		if label >= len(labels) {
+			return nil, fmt.Errorf("truncated domain matcher")
+		}
+		count[node]++
+		label++
+	}
+
+	var keys []string
+	var walk func(n int, prefix []byte)
+	walk = func(n int, prefix []byte) {
+		if bit(leaves, n) {
+			keys = append(keys, string(prefix))
+		}
+		for c := first[n]; c < first[n]+count[n]; c++ {
+			walk(c, append(prefix, labels[c-1]))
+		}
+	}
+	walk(0, nil)
+	return keys, nil
+}
+
+func reverseString(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// readSRSIPSet reads an IP set: a version byte, a big-endian uint64 range
+// count, then the first and last address of each range
+// readSRSSuccinctSet reads the succinct trie shared by the domain and AdGuard
+// matchers
+func readSRSSuccinctSet(r *bufio.Reader) (leaves, labelBitmap []uint64, labels []byte, err error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if version != 1 {
+		return nil, nil, nil, fmt.Errorf("unsupported domain matcher version %d", version)
+	}
+	if leaves, err = readSRSUint64s(r); err != nil {
+		return nil, nil, nil, err
+	}
+	if labelBitmap, err = readSRSUint64s(r); err != nil {
+		return nil, nil, nil, err
+	}
+	labels, err = readSRSBytes(r)
+	return leaves, labelBitmap, labels, err
+}
+
+func readSRSIPSet(r *bufio.Reader) ([]*net.IPNet, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported IP set version %d", version)
+	}
+	var n uint64
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+
+	var networks []*net.IPNet
+	for i := uint64(0); i < n; i++ {
+		from, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		to, err := readSRSBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(from) != len(to) || (len(from) != net.IPv4len && len(from) != net.IPv6len) {
+			return nil, fmt.Errorf("invalid IP range")
+		}
+		networks = append(networks, rangeToNetworks(from, to)...)
+	}
+	return networks, nil
+}
+
+// rangeToNetworks splits the inclusive range from-to into CIDR networks
+func rangeToNetworks(from, to net.IP) []*net.IPNet {
+	bits := len(from) * 8
+	start := new(big.Int).SetBytes(from)
+	end := new(big.Int).SetBytes(to)
+	one := big.NewInt(1)
+
+	var networks []*net.IPNet
+	for start.Cmp(end) <= 0 {
+		// The largest block aligned at start that stays within the range
+		host := int(start.TrailingZeroBits())
+		if start.Sign() == 0 || host > bits {
+			host = bits
+		}
+		for host > 0 {
+			last := new(big.Int).Lsh(one, uint(host))
+			last.Add(last, start).Sub(last, one)
+			if last.Cmp(end) <= 0 {
+				break
+			}
+			host--
+		}
+
+		ip := make(net.IP, len(from))
+		start.FillBytes(ip)
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-host, bits)})
+		start.Add(start, new(big.Int).Lsh(one, uint(host)))
+	}
+	return networks
+}
@@ -0,0 +1,108 @@
+package rule
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts the requests and traffic a rule routed. All methods are safe
+// for concurrent use. Stats are handed over to the same rule after a reload,
+// so connections opened before keep counting where they are shown.
+type Stats struct {
+	hits     atomic.Int64
+	lastHit  atomic.Int64 // Unix nanoseconds, 0 if never hit
+	upload   atomic.Int64
+	download atomic.Int64
+	active   atomic.Int64
+}
+
+// StatsSnapshot is the state of Stats at one point
+type StatsSnapshot struct {
+	HitCount          int64      `json:"hit_count"`
+	LastHit           *time.Time `json:"last_hit,omitempty"`
+	Upload            int64      `json:"upload"`
+	Download          int64      `json:"download"`
+	ActiveConnections int64      `json:"active_connections"`
+}
+
+// Hit counts a match at t
+func (s *Stats) Hit(t time.Time) {
+	s.hits.Add(1)
+	s.lastHit.Store(t.UnixNano())
+}
+
+// AddTraffic counts bytes sent and received by a connection the rule routed
+func (s *Stats) AddTraffic(upload, download int64) {
+	if upload != 0 {
+		s.upload.Add(upload)
+	}
+	if download != 0 {
+		s.download.Add(download)
+	}
+}
+
+// ConnOpened counts a new connection routed by the rule
+func (s *Stats) ConnOpened() {
+	s.active.Add(1)
+}
+
+// ConnClosed counts the end of a connection counted by ConnOpened
+func (s *Stats) ConnClosed() {
+	s.active.Add(-1)
+}
+
+// Reset clears the counters. Active connections are kept, they are still open.
+func (s *Stats) Reset() {
+	s.hits.Store(0)
+	s.lastHit.Store(0)
+	s.upload.Store(0)
+	s.download.Store(0)
+}
+
+// Snapshot returns the current values
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		HitCount:          s.hits.Load(),
+		Upload:            s.upload.Load(),
+		Download:          s.download.Load(),
+		ActiveConnections: s.active.Load(),
+	}
+	if ns := s.lastHit.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		snap.LastHit = &t
+	}
+	return snap
+}
+
+// TakeStats hands the statistics of the rules of prev over to the rules of e
+// written the same way. Among identical rules, they are handed over in order.
+func (e *Engine) TakeStats(prev *Engine) {
+	old := make(map[string][]*Stats)
+	for _, r := range prev.GetRules() {
+		key := statsKey(r)
+		old[key] = append(old[key], r.Stats())
+	}
+	for _, r := range e.GetRules() {
+		key := statsKey(r)
+		if s := old[key]; len(s) > 0 {
+			r.SetStats(s[0])
+			old[key] = s[1:]
+		}
+	}
+}
+
+// statsKey identifies a rule by what its line in the config sets
+func statsKey(r Rule) string {
+	parts := []string{r.Type(), r.Payload(), r.Adapter()}
+	if nr, ok := r.(interface{ noResolve() bool }); ok && nr.noResolve() {
+		parts = append(parts, "no-resolve")
+	}
+	if s := r.Schedule(); s != nil {
+		parts = append(parts, scheduleParam+s.String())
+	}
+	if rs, ok := r.(*RuleSetRule); ok && rs.UpdateInterval > 0 {
+		parts = append(parts, "update-interval="+rs.UpdateInterval.String())
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,86 @@
+package rule
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	setNow(t, at)
+
+	r := NewDomainRule("example.com", "Proxy")
+	if snap := r.Stats().Snapshot(); snap.HitCount != 0 || snap.LastHit != nil {
+		t.Fatalf("new rule has stats: %+v", snap)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.IncrementHitCount()
+			r.Stats().AddTraffic(10, 100)
+		}()
+	}
+	wg.Wait()
+	r.Stats().ConnOpened()
+
+	snap := r.Stats().Snapshot()
+	if snap.HitCount != 50 || r.HitCount() != 50 || snap.Upload != 500 || snap.Download != 5000 || snap.ActiveConnections != 1 {
+		t.Errorf("unexpected stats: %+v", snap)
+	}
+	if snap.LastHit == nil || !snap.LastHit.Equal(at) {
+		t.Errorf("last hit %v, want %v", snap.LastHit, at)
+	}
+
+	r.ResetHitCount()
+	if snap := r.Stats().Snapshot(); snap.HitCount != 0 || snap.Upload != 0 || snap.LastHit != nil || snap.ActiveConnections != 1 {
+		t.Errorf("after reset: %+v, want only the open connection", snap)
+	}
+}
+
+func TestEngine_TakeStats(t *testing.T) {
+	prev := NewEngine()
+	if err := prev.LoadFromConfig([]string{
+		"DOMAIN,a.com,Proxy",
+		"DOMAIN,b.com,Proxy",
+		"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve",
+		"DOMAIN,a.com,Proxy",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	old := prev.GetRules()
+	for i, r := range old {
+		for j := 0; j <= i; j++ {
+			r.IncrementHitCount()
+		}
+	}
+
+	e := NewEngine()
+	if err := e.LoadFromConfig([]string{
+		"DOMAIN,a.com,Proxy",
+		"DOMAIN,b.com,DIRECT",
+		"IP-CIDR,10.0.0.0/8,DIRECT",
+		"DOMAIN,a.com,Proxy",
+		"DOMAIN,a.com,Proxy",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	e.TakeStats(prev)
+
+	// Identical rules take the stats in order, changed and new rules start over
+	want := []int64{1, 0, 0, 4, 0}
+	for i, r := range e.GetRules() {
+		if r.HitCount() != want[i] {
+			t.Errorf("rule %d: %d hits, want %d", i, r.HitCount(), want[i])
+		}
+	}
+
+	// Connections of the previous rules keep counting on the rule in use
+	old[0].Stats().AddTraffic(5, 7)
+	if snap := e.GetRules()[0].Stats().Snapshot(); snap.Upload != 5 || snap.Download != 7 {
+		t.Errorf("traffic not shared: %+v", snap)
+	}
+}
@@ -0,0 +1,165 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Trace explains a match: every rule evaluated in order, what made the
+// matching rule match and whether the domain was resolved on the way
+type Trace struct {
+	Steps []TraceStep `json:"steps"`
+
+	// Resolved is set when a rule needing the IP of the domain triggered a lookup
+	Resolved   bool   `json:"resolved"`
+	ResolvedAt int    `json:"resolved_at,omitempty"` // Index of the rule that triggered it
+	ResolvedIP string `json:"resolved_ip,omitempty"` // Empty if the lookup failed
+}
+
+// TraceStep is one evaluated rule. Index is the position in the config rules,
+// or the id of a runtime rule.
+type TraceStep struct {
+	Index   int    `json:"index"`
+	Runtime bool   `json:"runtime,omitempty"`
+	Rule    string `json:"rule"`
+	Policy  string `json:"policy"`
+	Matched bool   `json:"matched"`
+	Skipped string `json:"skipped,omitempty"` // Why the rule was not evaluated
+	Detail  string `json:"detail,omitempty"`  // The entry or sub-rule that decided the result
+}
+
+// MatchTrace matches like Match, without counting a hit, and records how the
+// result was reached. Rules are evaluated one by one instead of through the
+// index, which gives the same result.
+func (e *Engine) MatchTrace(metadata *RequestMetadata) (string, Rule, *Trace) {
+	t := now()
+	e.expireRuntimeRules(t)
+	e.mu.RLock()
+	rules, resolver := e.evaluated(), e.resolver
+	runtimeIDs := make([]int, len(e.runtime))
+	for i, rr := range e.runtime {
+		runtimeIDs[i] = rr.id
+	}
+	e.mu.RUnlock()
+
+	trace := &Trace{Steps: make([]TraceStep, 0)}
+	resolveTried := false
+	for i, r := range rules {
+		step := TraceStep{
+			Index:  i - len(runtimeIDs),
+			Rule:   describeRule(r),
+			Policy: r.Adapter(),
+		}
+		if i < len(runtimeIDs) {
+			step.Index, step.Runtime = runtimeIDs[i], true
+		}
+		if !r.IsEnabled() {
+			step.Skipped = "disabled"
+			trace.Steps = append(trace.Steps, step)
+			continue
+		}
+		if !inSchedule(r, t) {
+			step.Skipped = "outside schedule " + r.Schedule().String()
+			trace.Steps = append(trace.Steps, step)
+			continue
+		}
+
+		step.Matched, step.Detail = explainMatch(r, metadata)
+		// Like Match, the domain is resolved at the first rule needing its IP
+		// that did not match without it
+		if !step.Matched && !resolveTried && resolver != nil && needsIP(metadata) && needsResolve(r) {
+			resolveTried = true
+			trace.Resolved = true
+			trace.ResolvedAt = step.Index
+			if ip := resolver(metadata.context(), metadata.Host); ip != nil {
+				metadata.DnsIP = ip
+				trace.ResolvedIP = ip.String()
+				step.Matched, step.Detail = explainMatch(r, metadata)
+			}
+		}
+		trace.Steps = append(trace.Steps, step)
+		if step.Matched {
+			return r.Adapter(), r, trace
+		}
+	}
+	return "", nil, trace
+}
+
+// describeRule writes a rule as TYPE,PAYLOAD
+func describeRule(r Rule) string {
+	if r.Payload() == "" {
+		return r.Type()
+	}
+	return r.Type() + "," + r.Payload()
+}
+
+// explainMatch reports whether r matches metadata and, for rules made of
+// other rules or entries, which of them decided it
+func explainMatch(r Rule, metadata *RequestMetadata) (bool, string) {
+	switch r := r.(type) {
+	case *RuleSetRule:
+		return r.explain(metadata)
+	case *GeoSiteRule:
+		idx := r.compiled()
+		if idx == nil || metadata.Host == "" {
+			return false, ""
+		}
+		if i := idx.match(metadata, nil, 0); i >= 0 {
+			return true, "entry " + describeRule(idx.rules[i])
+		}
+		return false, ""
+	case *AndRule:
+		parts := make([]string, 0, len(r.Rules))
+		for _, sub := range r.Rules {
+			ok, detail := explainMatch(sub, metadata)
+			if !ok {
+				return false, fmt.Sprintf("(%s) did not match", describeRule(sub))
+			}
+			parts = append(parts, subRuleDetail(sub, detail))
+		}
+		return true, "all matched: " + strings.Join(parts, ", ")
+	case *OrRule:
+		for _, sub := range r.Rules {
+			if ok, detail := explainMatch(sub, metadata); ok {
+				return true, "matched " + subRuleDetail(sub, detail)
+			}
+		}
+		return false, ""
+	case *NotRule:
+		if ok, detail := explainMatch(r.Rule, metadata); ok {
+			return false, "matched " + subRuleDetail(r.Rule, detail)
+		}
+		return true, fmt.Sprintf("(%s) did not match", describeRule(r.Rule))
+	}
+	return r.Match(metadata), ""
+}
+
+func subRuleDetail(r Rule, detail string) string {
+	if detail == "" {
+		return "(" + describeRule(r) + ")"
+	}
+	return "(" + describeRule(r) + ": " + detail + ")"
+}
+
+// explain returns whether the set matches and the entry or rule that did
+func (r *RuleSetRule) explain(metadata *RequestMetadata) (bool, string) {
+	r.UpdateMu.RLock()
+	list := r.list
+	r.UpdateMu.RUnlock()
+	if list != nil {
+		if entry := list.explain(metadata); entry != "" {
+			return true, "entry " + entry
+		}
+	}
+
+	idx := r.compiled()
+	i := idx.match(metadata, nil, 0)
+	if i < 0 {
+		return false, ""
+	}
+	sub := idx.rules[i]
+	if _, detail := explainMatch(sub, metadata); detail != "" {
+		return true, "entry " + describeRule(sub) + ": " + detail
+	}
+	return true, "entry " + describeRule(sub)
+}
@@ -0,0 +1,97 @@
+package rule
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestMatchTrace(t *testing.T) {
+	e := NewEngine()
+	lines := []string{
+		"DOMAIN,www.example.com,Off",
+		"DOMAIN-SUFFIX,other.com,Other",
+		"RULE-SET,http://example.com/set,Set",
+		"AND,((DOMAIN-SUFFIX,example.com),(DEST-PORT,8443)),Both",
+		"IP-CIDR,93.184.0.0/16,Resolved",
+		"FINAL,Default",
+	}
+	if err := e.LoadFromConfig(lines); err != nil {
+		t.Fatalf("LoadFromConfig failed: %v", err)
+	}
+	defer e.Close()
+
+	rules := e.GetRules()
+	rules[0].SetEnabled(false)
+	set := rules[2].(*RuleSetRule)
+	if err := set.Load([]byte("DOMAIN-SUFFIX,set.com\nIP-CIDR,192.168.0.0/16\nPROCESS-NAME,curl\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	resolves := 0
+	e.SetResolver(func(ctx context.Context, host string) net.IP {
+		resolves++
+		return net.ParseIP("93.184.216.34")
+	})
+
+	tests := []struct {
+		name     string
+		md       RequestMetadata
+		adapter  string
+		steps    int
+		detail   string
+		resolved bool
+	}{
+		{"rule set domain entry", RequestMetadata{Host: "a.set.com"}, "Set", 3, "entry DOMAIN-SUFFIX,set.com", false},
+		{"rule set network entry", RequestMetadata{Host: "192.168.1.1", IP: net.ParseIP("192.168.1.1")}, "Set", 3, "entry IP-CIDR,192.168.0.0/16", false},
+		{"rule set rule", RequestMetadata{Host: "x.net", ProcessPath: "/usr/bin/curl"}, "Set", 3, "entry PROCESS-NAME,curl", false},
+		{"and rule", RequestMetadata{Host: "www.example.com", Port: 8443}, "Both", 4, "all matched: (DOMAIN-SUFFIX,example.com), (DEST-PORT,8443)", true},
+		{"resolved", RequestMetadata{Host: "www.example.com", Port: 443}, "Resolved", 5, "", true},
+	}
+	for _, tt := range tests {
+		md := tt.md
+		adapter, r, trace := e.MatchTrace(&md)
+		if adapter != tt.adapter {
+			t.Errorf("%s: adapter = %q, want %q", tt.name, adapter, tt.adapter)
+			continue
+		}
+		if len(trace.Steps) != tt.steps {
+			t.Errorf("%s: %d steps, want %d: %+v", tt.name, len(trace.Steps), tt.steps, trace.Steps)
+			continue
+		}
+		last := trace.Steps[len(trace.Steps)-1]
+		if !last.Matched || last.Detail != tt.detail || last.Rule != describeRule(r) {
+			t.Errorf("%s: last step = %+v, want detail %q", tt.name, last, tt.detail)
+		}
+		if trace.Steps[0].Skipped != "disabled" {
+			t.Errorf("%s: disabled rule not reported: %+v", tt.name, trace.Steps[0])
+		}
+		if trace.Resolved != tt.resolved {
+			t.Errorf("%s: resolved = %v, want %v", tt.name, trace.Resolved, tt.resolved)
+		}
+
+		// The trace agrees with Match
+		md2 := tt.md
+		if want, _ := e.Match(&md2); want != adapter {
+			t.Errorf("%s: Match = %q, trace = %q", tt.name, want, adapter)
+		}
+	}
+
+	// The AND rule reports the sub-rule that failed
+	md := RequestMetadata{Host: "www.example.com", Port: 443}
+	_, _, trace := e.MatchTrace(&md)
+	if d := trace.Steps[3].Detail; !strings.Contains(d, "DEST-PORT,8443") {
+		t.Errorf("AND detail = %q, want the failing sub-rule", d)
+	}
+	if trace.ResolvedAt != 2 || trace.ResolvedIP != "93.184.216.34" {
+		t.Errorf("resolution at %d to %q, want the rule set at 2", trace.ResolvedAt, trace.ResolvedIP)
+	}
+
+	// Tracing does not count hits
+	hits := rules[4].HitCount()
+	e.MatchTrace(&RequestMetadata{Host: "www.example.com", Port: 443})
+	if rules[4].HitCount() != hits {
+		t.Error("MatchTrace should not count hits")
+	}
+}
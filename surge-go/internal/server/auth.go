@@ -0,0 +1,60 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Users maps inbound user names to their passwords
+type Users map[string]string
+
+// ParseUsers parses "user:password" entries, as written in the inbound-auth option
+func ParseUsers(entries []string) (Users, error) {
+	users := make(Users, len(entries))
+	for _, entry := range entries {
+		name, password, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid inbound user %q, expected user:password", entry)
+		}
+		users[name] = password
+	}
+	return users, nil
+}
+
+// verify reports whether the password is correct for the user
+func (u Users) verify(name, password string) bool {
+	want, ok := u[name]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(password)) == 1
+}
+
+// proxyAuthUser checks the Proxy-Authorization header of req and returns the user it names
+func (u Users) proxyAuthUser(req *http.Request) (string, bool) {
+	scheme, encoded, ok := strings.Cut(req.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", false
+	}
+	name, password, ok := strings.Cut(string(decoded), ":")
+	if !ok || !u.verify(name, password) {
+		return "", false
+	}
+	return name, true
+}
+
+// localPort returns the port of the listener that accepted conn, or 0
+func localPort(conn net.Conn) int {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+// recordingHandler remembers the inbound of the last request and rejects it
+type recordingHandler struct {
+	mu      sync.Mutex
+	inbound protocol.Inbound
+	calls   int
+}
+
+func (h *recordingHandler) HandleRequest(ctx context.Context, network, address, source string) protocol.Dialer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.inbound, _ = protocol.InboundFromContext(ctx)
+	h.calls++
+	return protocol.NewRejectDialer("REJECT")
+}
+
+func (h *recordingHandler) last() (protocol.Inbound, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.inbound, h.calls
+}
+
+func freeAddr(t *testing.T) (string, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return fmt.Sprintf("127.0.0.1:%d", port), port
+}
+
+func TestParseUsers(t *testing.T) {
+	users, err := ParseUsers([]string{"alice:secret", " bob:a:b "})
+	if err != nil {
+		t.Fatalf("ParseUsers: %v", err)
+	}
+	if !users.verify("alice", "secret") || !users.verify("bob", "a:b") {
+		t.Errorf("unexpected users: %v", users)
+	}
+	if users.verify("alice", "wrong") || users.verify("carol", "") {
+		t.Error("verify accepted wrong credentials")
+	}
+	if _, err := ParseUsers([]string{"nopassword"}); err == nil {
+		t.Error("expected error for entry without password")
+	}
+}
+
+func TestHTTPServer_Auth(t *testing.T) {
+	addr, port := freeAddr(t)
+	handler := &recordingHandler{}
+	server := NewHTTPServer(addr, handler, nil, nil, nil)
+	server.SetUsers(Users{"alice": "secret"})
+
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	connect := func(user, password string) *http.Response {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+
+		req, _ := http.NewRequest(http.MethodConnect, "http://example.com:443", nil)
+		req.Host = "example.com:443"
+		if user != "" {
+			req.SetBasicAuth(user, password)
+			req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+			req.Header.Del("Authorization")
+		}
+		req.Write(conn)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := connect("", ""); resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("without credentials: got %d, want 407", resp.StatusCode)
+	}
+	if resp := connect("alice", "wrong"); resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("with a wrong password: got %d, want 407", resp.StatusCode)
+	}
+	if _, calls := handler.last(); calls != 0 {
+		t.Fatalf("unauthenticated requests reached the handler %d times", calls)
+	}
+
+	connect("alice", "secret")
+	in, calls := handler.last()
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	want := protocol.Inbound{Type: protocol.InboundHTTP, Port: port, User: "alice"}
+	if in != want {
+		t.Errorf("inbound = %+v, want %+v", in, want)
+	}
+}
+
+func TestSOCKS5Server_Auth(t *testing.T) {
+	addr, port := freeAddr(t)
+	handler := &recordingHandler{}
+	server := NewSOCKS5Server(addr, handler)
+	server.SetUsers(Users{"alice": "secret"})
+
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	// dial negotiates username/password auth and returns the auth status, or -1
+	// when the server rejected the method
+	dial := func(user, password string) (net.Conn, int) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte{SOCKS5Version, 1, AuthPassword})
+		reply := make([]byte, 2)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("Failed to read method reply: %v", err)
+		}
+		if reply[1] != AuthPassword {
+			return conn, -1
+		}
+		msg := []byte{authPasswordVersion, byte(len(user))}
+		msg = append(msg, user...)
+		msg = append(msg, byte(len(password)))
+		msg = append(msg, password...)
+		conn.Write(msg)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("Failed to read auth reply: %v", err)
+		}
+		return conn, int(reply[1])
+	}
+
+	conn, status := dial("alice", "wrong")
+	conn.Close()
+	if status != 1 {
+		t.Errorf("wrong password: status %d, want 1", status)
+	}
+
+	conn, status = dial("alice", "secret")
+	defer conn.Close()
+	if status != 0 {
+		t.Fatalf("correct password: status %d, want 0", status)
+	}
+	conn.Write([]byte{SOCKS5Version, CmdConnect, 0x00, AddrTypeIPv4, 127, 0, 0, 1, 0x01, 0xBB})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Failed to read connect reply: %v", err)
+	}
+
+	in, calls := handler.last()
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	want := protocol.Inbound{Type: protocol.InboundSOCKS5, Port: port, User: "alice"}
+	if in != want {
+		t.Errorf("inbound = %+v, want %+v", in, want)
+	}
+
+	// Clients that only offer no authentication are turned away
+	noAuth, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer noAuth.Close()
+	noAuth.SetDeadline(time.Now().Add(5 * time.Second))
+	noAuth.Write([]byte{SOCKS5Version, 1, AuthNone})
+	methodReply := make([]byte, 2)
+	if _, err := io.ReadFull(noAuth, methodReply); err != nil {
+		t.Fatalf("Failed to read method reply: %v", err)
+	}
+	if methodReply[1] != AuthNoAccept {
+		t.Errorf("method = %#x, want no acceptable method", methodReply[1])
+	}
+}
+
+// fixedHandler sends every request through dialer
+type fixedHandler struct {
+	dialer protocol.Dialer
+}
+
+func (h *fixedHandler) HandleRequest(ctx context.Context, network, address, source string) protocol.Dialer {
+	return h.dialer
+}
+
+func TestHTTPServer_StripsProxyHeaders(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen upstream: %v", err)
+	}
+	defer ln.Close()
+	headers := make(chan http.Header, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		for {
+			req, err := http.ReadRequest(rd)
+			if err != nil {
+				return
+			}
+			headers <- req.Header
+			fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		}
+	}()
+
+	addr, _ := freeAddr(t)
+	server := NewHTTPServer(addr, &fixedHandler{dialer: &fixedDialer{name: "DIRECT", addr: ln.Addr().String()}}, nil, nil, nil)
+	server.SetUsers(Users{"alice": "secret"})
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Both requests share the connection, the proxy reads the second in its keep-alive loop
+	for i := range 2 {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+		req.SetBasicAuth("alice", "secret")
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+		req.Header.Set("Proxy-Connection", "keep-alive")
+		req.WriteProxy(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Fatalf("request %d: failed to read response: %v", i, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i, resp.StatusCode)
+		}
+
+		h := <-headers
+		for _, name := range []string{"Proxy-Authorization", "Proxy-Connection"} {
+			if v := h.Get(name); v != "" {
+				t.Errorf("request %d: origin received %s: %s", i, name, v)
+			}
+		}
+	}
+}
@@ -2,14 +2,19 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/surge-proxy/surge-go/internal/protocol"
 	"github.com/surge-proxy/surge-go/internal/rewrite"
 )
 
@@ -189,3 +194,179 @@ func TestHTTPServer_BodyRewrite(t *testing.T) {
 		t.Errorf("Expected 'rewritten body', got '%s'", string(body))
 	}
 }
+
+// fixedDialer sends every connection to addr, whatever the requested target
+type fixedDialer struct {
+	name string
+	addr string
+}
+
+func (d *fixedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return net.Dial(network, d.addr)
+}
+func (d *fixedDialer) Name() string                                        { return d.name }
+func (d *fixedDialer) Type() string                                        { return "fixed" }
+func (d *fixedDialer) Test(url string, timeout time.Duration) (int, error) { return 0, nil }
+func (d *fixedDialer) Close() error                                        { return nil }
+
+// pathRouter routes requests whose path starts with /b to b, the rest to a
+type pathRouter struct {
+	a, b protocol.Dialer
+	mu   sync.Mutex
+	seen []protocol.HTTPRequest
+}
+
+func (r *pathRouter) HandleRequest(ctx context.Context, network, address, source string) protocol.Dialer {
+	req, ok := protocol.HTTPRequestFromContext(ctx)
+	if !ok {
+		return r.a
+	}
+	r.mu.Lock()
+	r.seen = append(r.seen, req)
+	r.mu.Unlock()
+	if strings.HasPrefix(req.URL, "http://example.test/b") {
+		return r.b
+	}
+	return r.a
+}
+
+// namedUpstream answers every request with its name and counts its connections
+func namedUpstream(t *testing.T, name string) (string, *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen upstream: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := new(int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(conns, 1)
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					if _, err := http.ReadRequest(rd); err != nil {
+						return
+					}
+					fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(name), name)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), conns
+}
+
+func TestHTTPServer_RoutesEachRequest(t *testing.T) {
+	addrA, connsA := namedUpstream(t, "A")
+	addrB, connsB := namedUpstream(t, "B")
+	router := &pathRouter{a: &fixedDialer{name: "A", addr: addrA}, b: &fixedDialer{name: "B", addr: addrB}}
+
+	addr, _ := freeAddr(t)
+	server := NewHTTPServer(addr, router, nil, nil, nil)
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	paths := []string{"/a1", "/b1", "/a2", "/a3"}
+	want := []string{"A", "B", "A", "A"}
+	for i, path := range paths {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.test"+path, nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.WriteProxy(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Fatalf("%s: failed to read response: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want[i] {
+			t.Errorf("%s: served by %q, want %q", path, body, want[i])
+		}
+	}
+
+	// Switching policy needs a new connection, staying on one reuses it
+	if a, b := atomic.LoadInt32(connsA), atomic.LoadInt32(connsB); a != 2 || b != 1 {
+		t.Errorf("upstream connections = A:%d B:%d, want A:2 B:1", a, b)
+	}
+
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if len(router.seen) != len(paths) {
+		t.Fatalf("routed %d requests, want %d", len(router.seen), len(paths))
+	}
+	first := router.seen[0]
+	if first.Method != http.MethodGet || first.URL != "http://example.test/a1" || first.Header.Get("User-Agent") != "test-agent" {
+		t.Errorf("unexpected request metadata: %+v", first)
+	}
+}
+
+// reusingDialer records the connections it is asked to take over
+type reusingDialer struct {
+	fixedDialer
+	reused *int32
+}
+
+func (d *reusingDialer) Reuse(conn net.Conn) bool {
+	atomic.AddInt32(d.reused, 1)
+	return true
+}
+
+// reusingRouter routes every request through a new reusingDialer, as the
+// engine does with its tracking dialers
+type reusingRouter struct {
+	addr   string
+	reused int32
+}
+
+func (r *reusingRouter) HandleRequest(ctx context.Context, network, address, source string) protocol.Dialer {
+	return &reusingDialer{fixedDialer: fixedDialer{name: "A", addr: r.addr}, reused: &r.reused}
+}
+
+func TestHTTPServer_TracksReusedUpstream(t *testing.T) {
+	upstream, conns := namedUpstream(t, "A")
+	router := &reusingRouter{addr: upstream}
+
+	addr, _ := freeAddr(t)
+	server := NewHTTPServer(addr, router, nil, nil, nil)
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+		req.WriteProxy(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Fatalf("request %d: failed to read response: %v", i, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	// The first request dials, the others are accounted to their own dialer
+	if n := atomic.LoadInt32(conns); n != 1 {
+		t.Errorf("upstream connections = %d, want 1", n)
+	}
+	if n := atomic.LoadInt32(&router.reused); n != 2 {
+		t.Errorf("Reuse called %d times, want 2", n)
+	}
+}
@@ -33,6 +33,9 @@ type HTTPServer struct {
 	rewriter     Rewriter
 	bodyRewriter BodyRewriter
 	mitmManager  MITM
+
+	// users, when set, must authenticate with Proxy-Authorization
+	users Users
 }
 
 // BodyRewriter interface
@@ -77,6 +80,11 @@ func NewHTTPServerWithDialer(addr string, dialer protocol.Dialer) *HTTPServer {
 	}
 }
 
+// SetUsers requires clients to authenticate as one of users. It must be called before Start.
+func (s *HTTPServer) SetUsers(users Users) {
+	s.users = users
+}
+
 // rewriteAndWriteResponse applies body rewrite and writes response to writer
 func (s *HTTPServer) rewriteAndWriteResponse(resp *http.Response, req *http.Request, w io.Writer, isMITM bool) error {
 	if s.bodyRewriter != nil {
@@ -197,18 +205,30 @@ func (s *HTTPServer) handleConnection(clientConn net.Conn) {
 	// Reset deadline
 	clientConn.SetReadDeadline(time.Time{})
 
+	in := protocol.Inbound{Type: protocol.InboundHTTP, Port: localPort(clientConn)}
+	if len(s.users) > 0 {
+		user, ok := s.users.proxyAuthUser(req)
+		if !ok {
+			log.Printf("HTTP: Authentication failed for %s", clientConn.RemoteAddr())
+			clientConn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"surge\"\r\nContent-Length: 0\r\n\r\n"))
+			return
+		}
+		in.User = user
+	}
+	removeProxyHeaders(req.Header)
+
 	// Handle CONNECT method (for HTTPS)
 	if req.Method == http.MethodConnect {
-		s.handleConnect(clientConn, req)
+		s.handleConnect(clientConn, req, in)
 		return
 	}
 
 	// Handle regular HTTP requests
-	s.handleHTTP(clientConn, req, reader)
+	s.handleHTTP(clientConn, req, reader, in)
 }
 
 // handleConnect handles HTTP CONNECT requests (for HTTPS tunneling)
-func (s *HTTPServer) handleConnect(clientConn net.Conn, req *http.Request) {
+func (s *HTTPServer) handleConnect(clientConn net.Conn, req *http.Request, in protocol.Inbound) {
 	log.Printf("HTTP: Handling CONNECT for %s", req.Host)
 	log.Printf("HTTP: Header: %v", req.Header)
 	// Get target address
@@ -243,45 +263,12 @@ func (s *HTTPServer) handleConnect(clientConn net.Conn, req *http.Request) {
 		defer tlsConn.Close()
 		log.Printf("MITM Client Handshake success for %s", host)
 
-		// 3. Dial Target TLS
-		// Need to ensure we dial TLS to target
-		// Use empty context or propagate metadata?
-		// CONNECT headers were on 'req' which is passed to handleConnect.
-		// We should extract header earlier in handleConnect if we want it here.
-		// Let's copy the logic.
-		ctx := context.Background()
+		// 3. Route and forward each decrypted request
+		ctx := protocol.WithInbound(context.Background(), in)
 		if testName := req.Header.Get("X-Surge-Test-Proxy"); testName != "" {
 			ctx = context.WithValue(ctx, "TestProxyName", testName)
 		}
-
-		targetDialer := s.getDialer(ctx, "tcp", host, clientConn.RemoteAddr().String())
-		// We can't use standard DialContext here because we need TLS on top.
-		// If the dialer returns a proxy conn, we need to wrap it in TLS if it's not already?
-		// Usually dialer processes the "CONNECT" itself if it's a proxy.
-		// If it's DIRECT, we get a TCP conn.
-		// We need to wrap it in tls.Client.
-
-		rawConn, err := targetDialer.DialContext(context.Background(), "tcp", host)
-		if err != nil {
-			log.Printf("MITM Dial Target error (Proxy <-> Target): %v", err)
-			return
-		}
-		log.Printf("MITM Connected to target %s", host)
-
-		targetTLS := tls.Client(rawConn, &tls.Config{
-			InsecureSkipVerify: true, // TODO: Configurable
-			ServerName:         strings.Split(host, ":")[0],
-		})
-		if err := targetTLS.Handshake(); err != nil {
-			log.Printf("MITM Target Handshake error (Proxy <-> Target): %v", err)
-			rawConn.Close()
-			return
-		}
-		log.Printf("MITM Target TLS Handshake success for %s", host)
-		defer targetTLS.Close()
-
-		// 4. Process HTTP requests over the tunnel
-		s.processHTTPPair(tlsConn, targetTLS, true)
+		s.serveHTTP(ctx, tlsConn, bufio.NewReader(tlsConn), nil, host)
 		return
 	}
 	log.Printf("HTTP: Non-MITM tunnel for %s", host)
@@ -290,7 +277,7 @@ func (s *HTTPServer) handleConnect(clientConn net.Conn, req *http.Request) {
 	// CONNECT requests usually don't have custom headers easily set by clients except Proxy-Authorization
 	// However, standard Go client with ProxyConnectHeader splits them.
 	// We should check req.Header.
-	ctx := context.Background()
+	ctx := protocol.WithInbound(context.Background(), in)
 	if testName := req.Header.Get("X-Surge-Test-Proxy"); testName != "" {
 		ctx = context.WithValue(ctx, "TestProxyName", testName)
 	}
@@ -322,97 +309,159 @@ func (s *HTTPServer) handleConnect(clientConn net.Conn, req *http.Request) {
 }
 
 // handleHTTP handles regular HTTP requests
-func (s *HTTPServer) handleHTTP(clientConn net.Conn, req *http.Request, reader *bufio.Reader) {
-	// Handle URL Rewrite
-	if s.rewriter != nil {
-		newURL, action := s.rewriter.Rewrite(req.URL.String())
-		if action == rewrite.ActionRedirect302 {
-			clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 302 Found\r\nLocation: %s\r\n\r\n", newURL)))
-			return
-		} else if action == rewrite.ActionRedirect307 {
-			clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 307 Temporary Redirect\r\nLocation: %s\r\n\r\n", newURL)))
-			return
-		} else if action == rewrite.ActionReject {
-			clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n")) // Or 403
+func (s *HTTPServer) handleHTTP(clientConn net.Conn, req *http.Request, reader *bufio.Reader, in protocol.Inbound) {
+	s.serveHTTP(protocol.WithInbound(context.Background(), in), clientConn, reader, req, "")
+}
+
+// upstream is the target connection the previous request was sent over
+type upstream struct {
+	key    string   // Target address and policy the connection was dialed for
+	raw    net.Conn // As returned by the dialer, conn wraps it in TLS for MITM
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connReuser is implemented by dialers that track their connections, so that
+// a request sent over an upstream dialed for an earlier one is tracked as well
+type connReuser interface {
+	Reuse(conn net.Conn) bool
+}
+
+// serveHTTP proxies the requests read from clientConn, starting with first if set.
+// Every request is routed on its own, so rules can match its URL and headers.
+// Consecutive requests routed to the same target and policy share a connection.
+// tunnelHost is the CONNECT target of a MITM tunnel, "" for plain HTTP.
+func (s *HTTPServer) serveHTTP(ctx context.Context, clientConn net.Conn, clientReader *bufio.Reader, first *http.Request, tunnelHost string) {
+	isMITM := tunnelHost != ""
+	var up *upstream
+	defer func() {
+		if up != nil {
+			up.conn.Close()
+		}
+	}()
+
+	req := first
+	for ; ; req = nil {
+		// 1. Read Request from Client
+		if req == nil {
+			clientConn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			var err error
+			req, err = http.ReadRequest(clientReader)
+			if err != nil {
+				return
+			}
+			clientConn.SetReadDeadline(time.Time{})
+		}
+		// Credentials and hop-by-hop headers meant for the proxy stay here
+		removeProxyHeaders(req.Header)
+
+		if isMITM {
+			req.URL.Scheme = "https"
+			req.URL.Host = req.Host
+		}
+
+		// 2. URL Rewrite. Redirect and reject responses end the connection.
+		if s.rewriteRequest(req, clientConn) {
 			return
-		} else if action == rewrite.ActionNone && newURL != req.URL.String() {
-			// Rewrite URL but continue (e.g. slight mod)
-			// Need to parse back
-			if newU, err := url.Parse(newURL); err == nil {
-				req.URL = newU
-				req.Host = newU.Host // Update Host header usually required
+		}
+
+		// 3. Route the request, reusing the upstream connection if it still applies
+		address := tunnelHost
+		if !isMITM {
+			address = req.Host
+			if !strings.Contains(address, ":") {
+				address = address + ":80"
 			}
 		}
-	}
+		reqCtx := protocol.WithHTTPRequest(ctx, protocol.HTTPRequest{
+			URL:    req.URL.String(),
+			Method: req.Method,
+			Header: req.Header,
+		})
+		if testName := req.Header.Get("X-Surge-Test-Proxy"); testName != "" {
+			reqCtx = context.WithValue(reqCtx, "TestProxyName", testName)
+			// Clean up header so it's not sent to target
+			req.Header.Del("X-Surge-Test-Proxy")
+		}
+		dialer := s.getDialer(reqCtx, "tcp", address, clientConn.RemoteAddr().String())
 
-	// Get target address
-	host := req.Host
-	if !strings.Contains(host, ":") {
-		host = host + ":80"
-	}
+		key := address + "|" + dialer.Name()
+		if up == nil || up.key != key {
+			if up != nil {
+				up.conn.Close()
+				up = nil
+			}
+			raw, conn, err := s.dialUpstream(dialer, address, isMITM)
+			if err != nil {
+				log.Printf("Failed to connect to %s: %v", address, err)
+				clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n"))
+				return
+			}
+			up = &upstream{key: key, raw: raw, conn: conn, reader: bufio.NewReader(conn)}
+		} else if r, ok := dialer.(connReuser); ok {
+			// Account the request to the rule that routed it
+			r.Reuse(up.raw)
+		}
 
-	// Parse X-Surge-Test-Proxy header
-	ctx := context.Background()
-	if testName := req.Header.Get("X-Surge-Test-Proxy"); testName != "" {
-		ctx = context.WithValue(ctx, "TestProxyName", testName)
-		// Clean up header so it's not sent to target
-		req.Header.Del("X-Surge-Test-Proxy")
-	}
+		if req.Header.Get("Upgrade") != "" {
+			req.Write(up.conn)
+			s.relay(clientConn, up.conn)
+			return
+		}
 
-	// Get dialer for this request
-	dialer := s.getDialer(ctx, "tcp", host, clientConn.RemoteAddr().String())
+		// 4. Write Request to Target
+		if err := req.Write(up.conn); err != nil {
+			log.Printf("WriteReq err: %v", err)
+			return
+		}
 
-	// Connect to target
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+		// 5. Read Response from Target
+		up.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		resp, err := http.ReadResponse(up.reader, req)
+		if err != nil {
+			return
+		}
+		up.conn.SetReadDeadline(time.Time{})
 
-	targetConn, err := dialer.DialContext(ctx, "tcp", host)
-	if err != nil {
-		log.Printf("Failed to connect to %s: %v", host, err)
-		clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
-		return
-	}
-	defer targetConn.Close()
+		// 6. Body Rewrite
+		if err := s.rewriteAndWriteResponse(resp, req, clientConn, isMITM); err != nil {
+			return
+		}
 
-	// Write first request to target
-	// We use writeRequest helper which applies rewrite again safely (idempotent if no change or consistent change)
-	// Write first request to target
-	// We use processRequestWithRewrite helper which applies rewrite again safely (idempotent if no change or consistent change)
-	// Note: handleHTTP might have already applied rewrite, but applying again is safe for idempotent rules.
-	// If it was a redirect, handleHTTP returned early. So here it's likely ActionNone or no match.
-	handled, err := s.processRequestWithRewrite(req, targetConn, clientConn)
-	if err != nil {
-		log.Printf("Failed to write request: %v", err)
-		return
-	}
-	if handled {
-		return
+		if resp.Close || req.Close {
+			return
+		}
 	}
+}
 
-	// Start processing loop
-	// We just read the first request manually. We wrote it.
-	// Now we enter the loop for *subsequent* requests OR responses?
-	// Wait, processHTTPPair reading loop starts by reading request.
-	// But we already read the first one.
-	// We need to handle the RESPONSE for the first one.
+// removeProxyHeaders deletes the headers addressed to the proxy, which must
+// not be forwarded to the target
+func removeProxyHeaders(h http.Header) {
+	h.Del("Proxy-Authorization")
+	h.Del("Proxy-Authenticate")
+	h.Del("Proxy-Connection")
+}
 
-	// Option A: Pass the first request to processHTTPPair?
-	// Option B: Handle first response here, then enter loop?
+// dialUpstream connects to address through dialer, over TLS for MITM tunnels.
+// It returns the connection of the dialer and the one to use.
+func (s *HTTPServer) dialUpstream(dialer protocol.Dialer, address string, isMITM bool) (raw, conn net.Conn, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	// Let's handle first response here.
-	targetReader := bufio.NewReader(targetConn)
-	resp, err := http.ReadResponse(targetReader, req)
-	if err != nil {
-		log.Printf("Failed to read header response: %v", err)
-		return
-	}
-	if err := s.rewriteAndWriteResponse(resp, req, clientConn, false); err != nil {
-		return
+	rawConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil || !isMITM {
+		return rawConn, rawConn, err
 	}
 
-	if !resp.Close && !req.Close {
-		s.processHTTPPair(clientConn, targetConn, false)
+	targetTLS := tls.Client(rawConn, &tls.Config{
+		InsecureSkipVerify: true, // TODO: Configurable
+		ServerName:         strings.Split(address, ":")[0],
+	})
+	if err := targetTLS.Handshake(); err != nil {
+		rawConn.Close()
+		return nil, nil, fmt.Errorf("MITM target handshake: %v", err)
 	}
+	return rawConn, targetTLS, nil
 }
 
 // getDialer returns the appropriate dialer for the request
@@ -461,86 +510,30 @@ func (s *HTTPServer) relay(conn1, conn2 net.Conn) {
 	wg.Wait()
 }
 
-// processRequestWithRewrite applies URL rewrite. If redirect/reject, writes response to client and returns true (handled).
-// Otherwise writes request to target.
-func (s *HTTPServer) processRequestWithRewrite(req *http.Request, targetConn io.Writer, clientConn io.Writer) (bool, error) {
-	if s.rewriter != nil {
-		newURL, action := s.rewriter.Rewrite(req.URL.String())
-
-		if action == rewrite.ActionRedirect302 {
-			clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 302 Found\r\nLocation: %s\r\n\r\n", newURL)))
-			return true, nil
-		} else if action == rewrite.ActionRedirect307 {
-			clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 307 Temporary Redirect\r\nLocation: %s\r\n\r\n", newURL)))
-			return true, nil
-		} else if action == rewrite.ActionReject {
-			clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
-			return true, nil
-		}
-
-		// Modification
-		if action == rewrite.ActionNone && newURL != req.URL.String() {
-			if newU, err := url.Parse(newURL); err == nil {
-				req.URL = newU
-				req.Host = newU.Host
-			}
-		}
+// rewriteRequest applies URL rewrite. If redirect/reject, writes response to client and returns true (handled).
+func (s *HTTPServer) rewriteRequest(req *http.Request, clientConn io.Writer) bool {
+	if s.rewriter == nil {
+		return false
+	}
+	newURL, action := s.rewriter.Rewrite(req.URL.String())
+
+	if action == rewrite.ActionRedirect302 {
+		clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 302 Found\r\nLocation: %s\r\n\r\n", newURL)))
+		return true
+	} else if action == rewrite.ActionRedirect307 {
+		clientConn.Write([]byte(fmt.Sprintf("HTTP/1.1 307 Temporary Redirect\r\nLocation: %s\r\n\r\n", newURL)))
+		return true
+	} else if action == rewrite.ActionReject {
+		clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		return true
 	}
-	return false, req.Write(targetConn)
-}
-
-// processHTTPPair handles HTTP request/response loop between client and target
-func (s *HTTPServer) processHTTPPair(clientConn, targetConn net.Conn, isMITM bool) {
-	clientReader := bufio.NewReader(clientConn)
-	targetReader := bufio.NewReader(targetConn)
-
-	for {
-		// 1. Read Request from Client
-		clientConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		req, err := http.ReadRequest(clientReader)
-		if err != nil {
-			return
-		}
-		clientConn.SetReadDeadline(time.Time{})
-
-		if req.Header.Get("Upgrade") != "" {
-			req.Write(targetConn)
-			s.relay(clientConn, targetConn)
-			return
-		}
-
-		if isMITM {
-			req.URL.Scheme = "https"
-			req.URL.Host = req.Host
-		}
-
-		// 3. Write Request to Target
-		handled, err := s.processRequestWithRewrite(req, targetConn, clientConn)
-		if err != nil {
-			log.Printf("WriteReq err: %v", err)
-			return
-		}
-		if handled {
-			// If handled (e.g. redirected), we should continue to next request loop?
-			// Or usually we are done with this request.
-			continue
-		}
-
-		// 4. Read Response from Target
-		targetConn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		resp, err := http.ReadResponse(targetReader, req)
-		if err != nil {
-			return
-		}
-		targetConn.SetReadDeadline(time.Time{})
-
-		// 5. Body Rewrite
-		if err := s.rewriteAndWriteResponse(resp, req, clientConn, isMITM); err != nil {
-			return
-		}
 
-		if resp.Close || req.Close {
-			return
+	// Modification
+	if action == rewrite.ActionNone && newURL != req.URL.String() {
+		if newU, err := url.Parse(newURL); err == nil {
+			req.URL = newU
+			req.Host = newU.Host
 		}
 	}
+	return false
 }
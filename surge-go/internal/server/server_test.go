@@ -1,6 +1,10 @@
 package server
 
 import (
+	"context"
+	"io"
+	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -62,3 +66,115 @@ func TestSOCKS5ServerAddr(t *testing.T) {
 		t.Errorf("Addr() = %v, want 127.0.0.1:18891", server.Addr())
 	}
 }
+
+// sniffedHandler remembers what was sniffed from the last request and dials directly
+type sniffedHandler struct {
+	mu      sync.Mutex
+	sniffed protocol.Sniffed
+}
+
+func (h *sniffedHandler) HandleRequest(ctx context.Context, network, address, source string) protocol.Dialer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sniffed, _ = protocol.SniffedFromContext(ctx)
+	return protocol.NewDirectDialer("DIRECT")
+}
+
+func TestSOCKS5Server_Sniffing(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer target.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	addr, _ := freeAddr(t)
+	handler := &sniffedHandler{}
+	server := NewSOCKS5Server(addr, handler)
+	server.SetSniffing(true)
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{SOCKS5Version, 1, AuthNone})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Failed to read method reply: %v", err)
+	}
+	port := target.Addr().(*net.TCPAddr).Port
+	conn.Write([]byte{SOCKS5Version, CmdConnect, 0x00, AddrTypeIPv4, 127, 0, 0, 1, byte(port >> 8), byte(port)})
+	connectReply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, connectReply); err != nil {
+		t.Fatalf("Failed to read connect reply: %v", err)
+	}
+	if connectReply[1] != ReplySuccess {
+		t.Fatalf("reply = %#x, want success", connectReply[1])
+	}
+
+	request := "GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n"
+	conn.Write([]byte(request))
+	conn.(*net.TCPConn).CloseWrite()
+
+	select {
+	case got := <-received:
+		if got != request {
+			t.Errorf("target received %q, want %q", got, request)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("target received nothing")
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if want := (protocol.Sniffed{Protocol: "HTTP", Domain: "www.example.com"}); handler.sniffed != want {
+		t.Errorf("sniffed = %+v, want %+v", handler.sniffed, want)
+	}
+}
+
+func TestSOCKS5Server_SniffingDomainTarget(t *testing.T) {
+	addr, _ := freeAddr(t)
+	handler := &recordingHandler{}
+	server := NewSOCKS5Server(addr, handler)
+	server.SetSniffing(true)
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{SOCKS5Version, 1, AuthNone})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("Failed to read method reply: %v", err)
+	}
+
+	// Domain targets are not sniffed: the reply waits for the dial, which the handler rejects
+	host := "example.com"
+	req := append([]byte{SOCKS5Version, CmdConnect, 0x00, AddrTypeDomain, byte(len(host))}, host...)
+	conn.Write(append(req, 0x01, 0xbb))
+	connectReply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, connectReply); err != nil {
+		t.Fatalf("Failed to read connect reply: %v", err)
+	}
+	if connectReply[1] != ReplyHostUnreachable {
+		t.Errorf("reply = %#x, want host unreachable", connectReply[1])
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/surge-proxy/surge-go/internal/protocol"
+	"github.com/surge-proxy/surge-go/internal/sniff"
 )
 
 // SOCKS5 constants
@@ -23,6 +24,9 @@ const (
 	AuthPassword = 0x02
 	AuthNoAccept = 0xFF
 
+	// Version of the username/password sub-negotiation
+	authPasswordVersion = 0x01
+
 	// Commands
 	CmdConnect  = 0x01
 	CmdBind     = 0x02
@@ -54,6 +58,12 @@ type SOCKS5Server struct {
 	mu      sync.Mutex
 	closed  bool
 	wg      sync.WaitGroup
+
+	// users, when set, must authenticate with username/password (RFC 1929)
+	users Users
+
+	// sniffing reads the first client bytes before routing
+	sniffing bool
 }
 
 // NewSOCKS5Server creates a new SOCKS5 proxy server
@@ -72,6 +82,18 @@ func NewSOCKS5ServerWithDialer(addr string, dialer protocol.Dialer) *SOCKS5Serve
 	}
 }
 
+// SetUsers requires clients to authenticate as one of users. It must be called before Start.
+func (s *SOCKS5Server) SetUsers(users Users) {
+	s.users = users
+}
+
+// SetSniffing makes the server read the TLS SNI or HTTP Host of connections
+// before routing them. The client is then told the connection succeeded
+// before it is dialed. It must be called before Start.
+func (s *SOCKS5Server) SetSniffing(enabled bool) {
+	s.sniffing = enabled
+}
+
 // Start starts the SOCKS5 proxy server
 func (s *SOCKS5Server) Start() error {
 	ln, err := net.Listen("tcp", s.addr)
@@ -149,7 +171,8 @@ func (s *SOCKS5Server) handleConnection(clientConn net.Conn) {
 	clientConn.SetReadDeadline(time.Now().Add(30 * time.Second))
 
 	// 1. Authentication negotiation
-	if err := s.handleAuth(clientConn); err != nil {
+	user, err := s.handleAuth(clientConn)
+	if err != nil {
 		log.Printf("Auth failed: %v", err)
 		return
 	}
@@ -165,48 +188,89 @@ func (s *SOCKS5Server) handleConnection(clientConn net.Conn) {
 	clientConn.SetReadDeadline(time.Time{})
 
 	// 3. Connect to target
-	s.handleConnect(clientConn, targetAddr)
+	in := protocol.Inbound{Type: protocol.InboundSOCKS5, Port: localPort(clientConn), User: user}
+	s.handleConnect(clientConn, targetAddr, in)
 }
 
-// handleAuth handles SOCKS5 authentication
-func (s *SOCKS5Server) handleAuth(conn net.Conn) error {
+// handleAuth handles SOCKS5 authentication and returns the authenticated user
+func (s *SOCKS5Server) handleAuth(conn net.Conn) (string, error) {
 	// Read version and methods
 	buf := make([]byte, 2)
 	if _, err := io.ReadFull(conn, buf); err != nil {
-		return err
+		return "", err
 	}
 
 	version := buf[0]
 	nMethods := buf[1]
 
 	if version != SOCKS5Version {
-		return fmt.Errorf("unsupported SOCKS version: %d", version)
+		return "", fmt.Errorf("unsupported SOCKS version: %d", version)
 	}
 
 	// Read methods
 	methods := make([]byte, nMethods)
 	if _, err := io.ReadFull(conn, methods); err != nil {
-		return err
+		return "", err
 	}
 
-	// We only support no authentication
-	hasNoAuth := false
+	// Without users we only support no authentication, with users only username/password
+	want := byte(AuthNone)
+	if len(s.users) > 0 {
+		want = AuthPassword
+	}
+	supported := false
 	for _, method := range methods {
-		if method == AuthNone {
-			hasNoAuth = true
+		if method == want {
+			supported = true
 			break
 		}
 	}
 
-	if !hasNoAuth {
+	if !supported {
 		// No acceptable method
 		conn.Write([]byte{SOCKS5Version, AuthNoAccept})
-		return fmt.Errorf("no acceptable auth method")
+		return "", fmt.Errorf("no acceptable auth method")
 	}
 
-	// Accept no authentication
-	_, err := conn.Write([]byte{SOCKS5Version, AuthNone})
-	return err
+	if _, err := conn.Write([]byte{SOCKS5Version, want}); err != nil {
+		return "", err
+	}
+	if want == AuthNone {
+		return "", nil
+	}
+	return s.handlePasswordAuth(conn)
+}
+
+// handlePasswordAuth runs the username/password sub-negotiation (RFC 1929)
+func (s *SOCKS5Server) handlePasswordAuth(conn net.Conn) (string, error) {
+	// VER ULEN UNAME PLEN PASSWD
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return "", err
+	}
+	if buf[0] != authPasswordVersion {
+		return "", fmt.Errorf("unsupported auth version: %d", buf[0])
+	}
+	name := make([]byte, buf[1])
+	if _, err := io.ReadFull(conn, name); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+		return "", err
+	}
+	password := make([]byte, buf[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return "", err
+	}
+
+	if !s.users.verify(string(name), string(password)) {
+		conn.Write([]byte{authPasswordVersion, 0x01})
+		return "", fmt.Errorf("invalid credentials for user %q", name)
+	}
+	if _, err := conn.Write([]byte{authPasswordVersion, 0x00}); err != nil {
+		return "", err
+	}
+	return string(name), nil
 }
 
 // handleRequest handles SOCKS5 request and returns target address
@@ -278,9 +342,23 @@ func (s *SOCKS5Server) handleRequest(conn net.Conn) (string, error) {
 }
 
 // handleConnect connects to the target and relays data
-func (s *SOCKS5Server) handleConnect(clientConn net.Conn, targetAddr string) {
+func (s *SOCKS5Server) handleConnect(clientConn net.Conn, targetAddr string, in protocol.Inbound) {
+	reqCtx := protocol.WithInbound(context.Background(), in)
+	source := clientConn.RemoteAddr().String()
+	// Only connections to an IP are sniffed, for their domain. Clients send data
+	// once the connection succeeded, so the reply comes before the dial.
+	sniffing := s.sniffing && isIPAddress(targetAddr)
+	if sniffing {
+		s.sendReply(clientConn, ReplySuccess, "0.0.0.0", 0)
+		conn, res := sniff.Conn(clientConn, sniff.DefaultTimeout)
+		if res != nil {
+			reqCtx = protocol.WithSniffed(reqCtx, protocol.Sniffed{Protocol: res.Protocol, Domain: res.Domain})
+		}
+		clientConn = conn
+	}
+
 	// Get dialer
-	dialer := s.getDialer("tcp", targetAddr, clientConn.RemoteAddr().String())
+	dialer := s.getDialer(reqCtx, "tcp", targetAddr, source)
 
 	// Connect to target
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -289,18 +367,28 @@ func (s *SOCKS5Server) handleConnect(clientConn net.Conn, targetAddr string) {
 	targetConn, err := dialer.DialContext(ctx, "tcp", targetAddr)
 	if err != nil {
 		log.Printf("Failed to connect to %s: %v", targetAddr, err)
-		s.sendReply(clientConn, ReplyHostUnreachable, "", 0)
+		if !sniffing {
+			s.sendReply(clientConn, ReplyHostUnreachable, "", 0)
+		}
 		return
 	}
 	defer targetConn.Close()
 
 	// Send success reply
-	s.sendReply(clientConn, ReplySuccess, "0.0.0.0", 0)
+	if !sniffing {
+		s.sendReply(clientConn, ReplySuccess, "0.0.0.0", 0)
+	}
 
 	// Start bidirectional relay
 	s.relay(clientConn, targetConn)
 }
 
+// isIPAddress reports whether the host of a "host:port" address is an IP
+func isIPAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	return err == nil && net.ParseIP(host) != nil
+}
+
 // sendReply sends SOCKS5 reply
 func (s *SOCKS5Server) sendReply(conn net.Conn, reply byte, bindAddr string, bindPort uint16) {
 	// VER REP RSV ATYP BND.ADDR BND.PORT
@@ -315,10 +403,10 @@ func (s *SOCKS5Server) sendReply(conn net.Conn, reply byte, bindAddr string, bin
 }
 
 // getDialer returns the appropriate dialer for the request
-func (s *SOCKS5Server) getDialer(network, address, source string) protocol.Dialer {
+func (s *SOCKS5Server) getDialer(ctx context.Context, network, address, source string) protocol.Dialer {
 	// If handler is set, use it
 	if s.handler != nil {
-		if dialer := s.handler.HandleRequest(context.Background(), network, address, source); dialer != nil {
+		if dialer := s.handler.HandleRequest(ctx, network, address, source); dialer != nil {
 			return dialer
 		}
 	}
@@ -350,8 +438,9 @@ func (s *SOCKS5Server) relay(conn1, conn2 net.Conn) {
 	go func() {
 		defer wg.Done()
 		io.Copy(conn1, conn2)
-		if tcpConn, ok := conn1.(*net.TCPConn); ok {
-			tcpConn.CloseWrite()
+		// The client connection may be wrapped after sniffing
+		if cw, ok := conn1.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
 		}
 	}()
 
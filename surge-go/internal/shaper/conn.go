@@ -0,0 +1,62 @@
+package shaper
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// writeChunk bounds how much is written before waiting for tokens again,
+// so a large write does not burst past the limit
+const writeChunk = 16 * 1024
+
+// Conn shapes reads and writes of a connection through a set of limiters
+type Conn struct {
+	net.Conn
+	limiters []*Limiter
+	closed   atomic.Bool
+}
+
+// NewConn wraps conn so its traffic counts against all limiters
+func NewConn(conn net.Conn, limiters []*Limiter) net.Conn {
+	if len(limiters) == 0 {
+		return conn
+	}
+	for _, l := range limiters {
+		l.active.Add(1)
+	}
+	return &Conn{Conn: conn, limiters: limiters}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		WaitN(c.limiters, Download, n)
+	}
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		end := written + writeChunk
+		if end > len(b) {
+			end = len(b)
+		}
+		WaitN(c.limiters, Upload, end-written)
+		n, err := c.Conn.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *Conn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		for _, l := range c.limiters {
+			l.active.Add(-1)
+		}
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,180 @@
+package shaper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minBurst is the smallest bucket size, so slow limits still pass whole packets
+const minBurst = 16 * 1024
+
+// Direction tells uploaded from downloaded traffic, which are limited separately
+type Direction int
+
+const (
+	Upload Direction = iota
+	Download
+)
+
+// bucket holds the tokens of one direction
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter shapes throughput to a fixed rate in bytes per second, with a token
+// bucket per direction so that downloads do not starve uploads
+type Limiter struct {
+	name string
+	kind string
+
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets [2]bucket // Indexed by Direction
+
+	bytes     atomic.Uint64
+	throttled atomic.Int64 // Total time spent waiting for tokens (ns)
+	active    atomic.Int32
+}
+
+// NewLimiter creates a limiter allowing rate bytes per second
+func NewLimiter(name, kind string, rate int64) *Limiter {
+	l := &Limiter{name: name, kind: kind}
+	l.SetRate(rate)
+	now := time.Now()
+	for i := range l.buckets {
+		l.buckets[i] = bucket{tokens: l.burst, last: now}
+	}
+	return l
+}
+
+// SetRate changes the allowed rate, keeping accumulated counters
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = float64(rate)
+	// A quarter second of traffic smooths bursts without starving slow links
+	l.burst = l.rate / 4
+	if l.burst < minBurst {
+		l.burst = minBurst
+	}
+	for i := range l.buckets {
+		if b := &l.buckets[i]; b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+	}
+}
+
+// Rate returns the allowed rate in bytes per second
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// reserve takes n tokens of direction dir, going into debt if needed, and
+// returns how long the caller has to wait until the debt is paid off
+func (l *Limiter) reserve(dir Direction, n int) time.Duration {
+	l.bytes.Add(uint64(n))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	b := &l.buckets[dir]
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN blocks until n bytes in direction dir may pass all limiters
+func WaitN(limiters []*Limiter, dir Direction, n int) {
+	var wait time.Duration
+	for _, l := range limiters {
+		if d := l.reserve(dir, n); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		for _, l := range limiters {
+			l.throttled.Add(int64(wait))
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Status is a snapshot of a limiter's state
+type Status struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`  // "policy" or "device"
+	Limit       int64  `json:"limit"` // bytes per second
+	Bytes       uint64 `json:"bytes"`
+	ThrottledMs int64  `json:"throttled_ms"`
+	Active      int32  `json:"active"`
+}
+
+// Status returns the limiter's current state
+func (l *Limiter) Status() Status {
+	return Status{
+		Name:        l.name,
+		Kind:        l.kind,
+		Limit:       l.Rate(),
+		Bytes:       l.bytes.Load(),
+		ThrottledMs: time.Duration(l.throttled.Load()).Milliseconds(),
+		Active:      l.active.Load(),
+	}
+}
+
+var (
+	byteMultiples = map[string]float64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+	bitMultiples  = map[string]float64{"": 1, "K": 1e3, "M": 1e6, "G": 1e9}
+)
+
+// ParseRate parses a bandwidth such as "5MB/s", "500KB/s", "20Mbps" or "20Mb/s" into bytes per second.
+// An uppercase B counts bytes and a lowercase b bits, as in "Mb/s" and "Mbps".
+// Byte rates use binary multiples (1KB/s = 1024 bytes), bit rates decimal ones as usual for line rates.
+func ParseRate(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+
+	var num string
+	var multiples map[string]float64
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(v, "bps"), strings.HasSuffix(v, "b/s"):
+		num, multiples, unit = v[:len(v)-3], bitMultiples, 1.0/8
+	case strings.HasSuffix(strings.ToUpper(v), "B/S"):
+		num, multiples = v[:len(v)-3], byteMultiples
+	default:
+		return 0, fmt.Errorf("invalid bandwidth unit: %s", s)
+	}
+
+	if n := len(num); n > 0 {
+		if m, ok := multiples[strings.ToUpper(num[n-1:])]; ok {
+			num, unit = num[:n-1], unit*m
+		}
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth: %s", s)
+	}
+	return int64(f * unit), nil
+}
@@ -0,0 +1,87 @@
+package shaper
+
+import (
+	"sort"
+	"sync"
+)
+
+// Limiter kinds
+const (
+	KindPolicy = "policy"
+	KindDevice = "device"
+)
+
+// Manager holds the limiters of all policies and devices
+type Manager struct {
+	mu       sync.RWMutex
+	policies map[string]*Limiter
+	devices  map[string]*Limiter
+}
+
+// NewManager creates a manager without limits
+func NewManager() *Manager {
+	return &Manager{
+		policies: make(map[string]*Limiter),
+		devices:  make(map[string]*Limiter),
+	}
+}
+
+// Configure replaces the configured limits (bytes per second, keyed by policy name
+// and device IP). Limiters that stay configured keep their counters.
+func (m *Manager) Configure(policies, devices map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policies = reconfigure(m.policies, policies, KindPolicy)
+	m.devices = reconfigure(m.devices, devices, KindDevice)
+}
+
+func reconfigure(old map[string]*Limiter, limits map[string]int64, kind string) map[string]*Limiter {
+	next := make(map[string]*Limiter, len(limits))
+	for name, rate := range limits {
+		if l, ok := old[name]; ok {
+			l.SetRate(rate)
+			next[name] = l
+			continue
+		}
+		next[name] = NewLimiter(name, kind, rate)
+	}
+	return next
+}
+
+// Limiters returns the limiters applying to traffic through the given policies from device
+func (m *Manager) Limiters(policies []string, device string) []*Limiter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var list []*Limiter
+	for _, p := range policies {
+		if l, ok := m.policies[p]; ok {
+			list = append(list, l)
+		}
+	}
+	if l, ok := m.devices[device]; ok {
+		list = append(list, l)
+	}
+	return list
+}
+
+// Status returns the state of every limiter, policies first
+func (m *Manager) Status() []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Status, 0, len(m.policies)+len(m.devices))
+	for _, l := range m.policies {
+		list = append(list, l.Status())
+	}
+	for _, l := range m.devices {
+		list = append(list, l.Status())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind == KindPolicy
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,108 @@
+package shaper
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"5MB/s", 5 << 20},
+		{"512KB/s", 512 << 10},
+		{"100B/s", 100},
+		{"1.5MB/s", 3 << 19},
+		// A lowercase b counts bits, whichever spelling
+		{"20Mbps", 2500000},
+		{"20Mb/s", 2500000},
+		{"1.5mb/s", 187500},
+		{"800Kbps", 100000},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if err != nil {
+			t.Errorf("ParseRate(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "5MB", "fastMB/s", "-1MB/s", "10XB/s"} {
+		if _, err := ParseRate(bad); err == nil {
+			t.Errorf("ParseRate(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConn_ShapesWrites(t *testing.T) {
+	// 64KB/s with a 16KB bucket: writing 48KB needs about half a second
+	l := NewLimiter("Proxy", KindPolicy, 64<<10)
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := NewConn(client, []*Limiter{l})
+	if l.Status().Active != 1 {
+		t.Errorf("expected 1 active connection, got %d", l.Status().Active)
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 48<<10)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("write was not shaped, took %v", elapsed)
+	}
+
+	conn.Close()
+	conn.Close()
+	st := l.Status()
+	if st.Active != 0 || st.Bytes != 48<<10 || st.ThrottledMs == 0 {
+		t.Errorf("unexpected status after close: %+v", st)
+	}
+}
+
+func TestLimiter_DirectionsShapedSeparately(t *testing.T) {
+	l := NewLimiter("Proxy", KindPolicy, 64<<10)
+
+	// A second of download debt does not hold back uploads
+	if d := l.reserve(Download, 80<<10); d < 900*time.Millisecond {
+		t.Errorf("download wait = %v, want about 1s", d)
+	}
+	if d := l.reserve(Upload, 8<<10); d != 0 {
+		t.Errorf("upload waits %v behind downloads", d)
+	}
+	if st := l.Status(); st.Bytes != 88<<10 {
+		t.Errorf("counted %d bytes, want %d", st.Bytes, 88<<10)
+	}
+}
+
+func TestManager_Configure(t *testing.T) {
+	m := NewManager()
+	m.Configure(map[string]int64{"HK": 1 << 20}, map[string]int64{"192.168.1.20": 2 << 20})
+
+	hk := m.Limiters([]string{"Proxy", "HK"}, "192.168.1.20")
+	if len(hk) != 2 {
+		t.Fatalf("expected policy and device limiters, got %d", len(hk))
+	}
+
+	// Reconfiguring keeps the limiter and its counters
+	m.Configure(map[string]int64{"HK": 4 << 20}, nil)
+	again := m.Limiters([]string{"HK"}, "192.168.1.20")
+	if len(again) != 1 || again[0] != hk[0] || again[0].Rate() != 4<<20 {
+		t.Errorf("policy limiter should be updated in place: %+v", m.Status())
+	}
+}
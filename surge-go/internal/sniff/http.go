@@ -0,0 +1,61 @@
+package sniff
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+var httpMethods = []string{"GET", "POST", "HEAD", "PUT", "DELETE", "OPTIONS", "PATCH", "CONNECT", "TRACE"}
+
+// HTTP detects an HTTP/1.x request and reads its Host header
+func HTTP(data []byte) (*Result, error) {
+	if !startsWithMethod(data) {
+		return nil, ErrUnknown
+	}
+
+	head := data
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	complete := end >= 0
+	if complete {
+		head = data[:end]
+	}
+	lines := bytes.Split(head, []byte("\r\n"))
+	// The last line is incomplete unless the headers ended
+	if !complete {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil, ErrIncomplete
+	}
+	if fields := strings.Fields(string(lines[0])); len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") {
+		return nil, ErrUnknown
+	}
+
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(string(line), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Host") {
+			continue
+		}
+		host := strings.TrimSpace(value)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return &Result{Protocol: ProtocolHTTP, Domain: strings.ToLower(host)}, nil
+	}
+	if !complete {
+		return nil, ErrIncomplete
+	}
+	return &Result{Protocol: ProtocolHTTP}, nil
+}
+
+// startsWithMethod reports whether data may be the start of a request line
+func startsWithMethod(data []byte) bool {
+	for _, m := range httpMethods {
+		n := min(len(data), len(m)+1)
+		if string(data[:n]) == (m + " ")[:n] {
+			return true
+		}
+	}
+	return false
+}
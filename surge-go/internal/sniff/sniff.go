@@ -0,0 +1,107 @@
+// Package sniff detects the application protocol of a connection from its
+// first client bytes and extracts the domain it is for: the SNI of a TLS
+// ClientHello, or the Host of an HTTP request.
+package sniff
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Protocols detected
+const (
+	ProtocolHTTP  = "HTTP"
+	ProtocolHTTPS = "HTTPS" // TLS offering HTTP through ALPN
+	ProtocolTLS   = "TLS"
+)
+
+var (
+	// ErrIncomplete is returned when more data is needed to decide
+	ErrIncomplete = errors.New("sniff: incomplete data")
+	// ErrUnknown is returned when the data is not of a known protocol
+	ErrUnknown = errors.New("sniff: unknown protocol")
+)
+
+// DefaultTimeout is how long Conn waits for the client to speak first.
+// Protocols where the server speaks first are routed after it.
+const DefaultTimeout = 300 * time.Millisecond
+
+// maxSniffLen bounds the bytes read while sniffing: a TLS record, large
+// enough for ClientHellos with post-quantum key shares
+const maxSniffLen = 5 + 16384
+
+// Result is a detected protocol
+type Result struct {
+	Protocol string   // One of the Protocol* constants
+	Domain   string   // SNI or Host, "" if the client sent none
+	ALPN     []string // Protocols offered through TLS ALPN
+}
+
+// Stream detects the protocol of the start of a TCP stream
+func Stream(data []byte) (*Result, error) {
+	res, err := TLS(data)
+	if !errors.Is(err, ErrUnknown) {
+		return res, err
+	}
+	return HTTP(data)
+}
+
+// Conn reads the first bytes the client sends on conn until their protocol
+// is known, waiting up to timeout. It returns a connection replaying them
+// and the result, nil if the protocol was not detected.
+func Conn(conn net.Conn, timeout time.Duration) (net.Conn, *Result) {
+	buf := make([]byte, maxSniffLen)
+	n := 0
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var res *Result
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+		if m > 0 {
+			r, serr := Stream(buf[:n])
+			if serr == nil {
+				res = r
+				break
+			}
+			if !errors.Is(serr, ErrIncomplete) {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if n == 0 {
+		return conn, res
+	}
+	return &peekedConn{Conn: conn, peeked: buf[:n]}, res
+}
+
+// peekedConn returns the bytes read while sniffing before reading on
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		if len(c.peeked) == 0 {
+			c.peeked = nil
+		}
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// CloseWrite half-closes the underlying connection when it supports it
+func (c *peekedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
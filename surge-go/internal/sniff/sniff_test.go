@@ -0,0 +1,126 @@
+package sniff
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// clientHelloRecord returns the first record a TLS client sends
+func clientHelloRecord(t *testing.T, serverName string, alpn []string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		defer client.Close()
+		tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: alpn, InsecureSkipVerify: true}).Handshake()
+	}()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		t.Fatal(err)
+	}
+	return append(header, body...)
+}
+
+func TestTLS(t *testing.T) {
+	record := clientHelloRecord(t, "www.example.com", []string{"h2", "http/1.1"})
+	res, err := TLS(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Protocol != ProtocolHTTPS || res.Domain != "www.example.com" || len(res.ALPN) != 2 {
+		t.Errorf("got %+v", res)
+	}
+
+	res, err = TLS(clientHelloRecord(t, "mail.example.com", nil))
+	if err != nil || res.Protocol != ProtocolTLS || res.Domain != "mail.example.com" {
+		t.Errorf("without ALPN got %+v, %v", res, err)
+	}
+
+	if _, err := TLS(record[:len(record)/2]); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("half a record: got %v, want ErrIncomplete", err)
+	}
+
+	// The same ClientHello split over two records
+	msg := record[5:]
+	split := []byte{22, 3, 1, 0, 10}
+	split = append(split, msg[:10]...)
+	split = append(split, 22, 3, 1, byte((len(msg)-10)>>8), byte(len(msg)-10))
+	split = append(split, msg[10:]...)
+	if res, err := TLS(split); err != nil || res.Domain != "www.example.com" {
+		t.Errorf("split over records: got %+v, %v", res, err)
+	}
+
+	if _, err := TLS([]byte("GET / HTTP/1.1\r\n")); !errors.Is(err, ErrUnknown) {
+		t.Errorf("HTTP: got %v, want ErrUnknown", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	tests := []struct {
+		data   string
+		domain string
+		err    error
+	}{
+		{"GET /index.html HTTP/1.1\r\nHost: Example.com:8080\r\nAccept: */*\r\n\r\n", "example.com", nil},
+		{"POST / HTTP/1.1\r\nUser-Agent: x\r\nhost: api.example.com\r\n", "api.example.com", nil},
+		{"GET / HTTP/1.0\r\n\r\n", "", nil},
+		{"GET / HTTP/1.1\r\nHo", "", ErrIncomplete},
+		{"GE", "", ErrIncomplete},
+		{"SSH-2.0-OpenSSH_9.6\r\n", "", ErrUnknown},
+		{"GET / SPDY/3\r\n\r\n", "", ErrUnknown},
+	}
+	for _, tt := range tests {
+		res, err := HTTP([]byte(tt.data))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("HTTP(%q) error = %v, want %v", tt.data, err, tt.err)
+			continue
+		}
+		if err == nil && (res.Protocol != ProtocolHTTP || res.Domain != tt.domain) {
+			t.Errorf("HTTP(%q) = %+v, want domain %q", tt.data, res, tt.domain)
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		client.Write([]byte(request[:10]))
+		client.Write([]byte(request[10:] + "body"))
+		client.Close()
+	}()
+
+	conn, res := Conn(server, time.Second)
+	if res == nil || res.Protocol != ProtocolHTTP || res.Domain != "example.com" {
+		t.Fatalf("got %+v", res)
+	}
+	data, _ := io.ReadAll(conn)
+	if string(data) != request+"body" {
+		t.Errorf("replayed %q", data)
+	}
+}
+
+func TestConn_ServerFirst(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	start := time.Now()
+	conn, res := Conn(server, 50*time.Millisecond)
+	if res != nil || conn != server {
+		t.Errorf("got %+v, want no result and the connection unchanged", res)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sniffing did not time out")
+	}
+}
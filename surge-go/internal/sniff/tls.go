@@ -0,0 +1,121 @@
+package sniff
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// TLS record and handshake values (RFC 8446)
+const (
+	recordTypeHandshake     = 22
+	handshakeClientHello    = 1
+	extensionServerName     = 0
+	extensionALPN           = 16
+	serverNameTypeHostName  = 0
+	maxHandshakeRecordBytes = 1 << 14
+)
+
+// TLS detects a ClientHello at the start of a TLS stream. The message may
+// span several records.
+func TLS(data []byte) (*Result, error) {
+	var msg []byte
+	for {
+		if len(data) < 5 {
+			if len(data) > 0 && data[0] != recordTypeHandshake {
+				return nil, ErrUnknown
+			}
+			return nil, ErrIncomplete
+		}
+		length := int(data[3])<<8 | int(data[4])
+		if data[0] != recordTypeHandshake || data[1] != 3 || length == 0 || length > maxHandshakeRecordBytes {
+			return nil, ErrUnknown
+		}
+		if len(data) < 5+length {
+			// The start of the first record tells a ClientHello apart already
+			if msg == nil && len(data) > 5 && data[5] != handshakeClientHello {
+				return nil, ErrUnknown
+			}
+			return nil, ErrIncomplete
+		}
+		msg = append(msg, data[5:5+length]...)
+		data = data[5+length:]
+
+		if msg[0] != handshakeClientHello {
+			return nil, ErrUnknown
+		}
+		if len(msg) >= 4 {
+			size := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if len(msg) >= 4+size {
+				return parseClientHello(msg[4 : 4+size])
+			}
+		}
+	}
+}
+
+// parseClientHello reads the server name and ALPN protocols from the body of
+// a ClientHello message
+func parseClientHello(body []byte) (*Result, error) {
+	s := cryptobyte.String(body)
+	var random, sessionID, suites, compression cryptobyte.String
+	if !s.Skip(2) || // legacy_version
+		!s.ReadBytes((*[]byte)(&random), 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&suites) ||
+		!s.ReadUint8LengthPrefixed(&compression) {
+		return nil, ErrUnknown
+	}
+
+	res := &Result{Protocol: ProtocolTLS}
+	if s.Empty() {
+		// No extensions
+		return res, nil
+	}
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, ErrUnknown
+	}
+	for !extensions.Empty() {
+		var typ uint16
+		var ext cryptobyte.String
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&ext) {
+			return nil, ErrUnknown
+		}
+		switch typ {
+		case extensionServerName:
+			var names cryptobyte.String
+			if !ext.ReadUint16LengthPrefixed(&names) {
+				return nil, ErrUnknown
+			}
+			for !names.Empty() {
+				var nameType uint8
+				var name cryptobyte.String
+				if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+					return nil, ErrUnknown
+				}
+				if nameType == serverNameTypeHostName && res.Domain == "" {
+					res.Domain = strings.TrimSuffix(strings.ToLower(string(name)), ".")
+				}
+			}
+		case extensionALPN:
+			var protos cryptobyte.String
+			if !ext.ReadUint16LengthPrefixed(&protos) {
+				return nil, ErrUnknown
+			}
+			for !protos.Empty() {
+				var proto cryptobyte.String
+				if !protos.ReadUint8LengthPrefixed(&proto) {
+					return nil, ErrUnknown
+				}
+				res.ALPN = append(res.ALPN, string(proto))
+			}
+		}
+	}
+
+	for _, p := range res.ALPN {
+		if p == "h2" || p == "http/1.1" {
+			res.Protocol = ProtocolHTTPS
+		}
+	}
+	return res, nil
+}
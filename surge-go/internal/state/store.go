@@ -0,0 +1,201 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/surge-proxy/surge-go/internal/quota"
+)
+
+// State is the runtime state that survives restarts and config reloads
+type State struct {
+	Mode       string                 `json:"mode,omitempty"`
+	Selections map[string]string      `json:"selections"` // select group -> chosen member
+	Winners    map[string]string      `json:"winners"`    // url-test group -> last winner
+	Rules      map[string]bool        `json:"rules"`      // rule key -> enabled, only for rules toggled at runtime
+	Quotas     map[string]quota.Usage `json:"quotas"`     // proxy -> traffic used in the current quota periods
+}
+
+// Store keeps the runtime state in a JSON file
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	state State
+}
+
+// PathForConfig returns the state file path next to a config file,
+// e.g. /etc/surge/surge.conf -> /etc/surge/surge.state.json
+func PathForConfig(configPath string) string {
+	dir := filepath.Dir(configPath)
+	base := strings.TrimSuffix(filepath.Base(configPath), filepath.Ext(configPath))
+	return filepath.Join(dir, base+".state.json")
+}
+
+// NewStore creates a store backed by path and loads it if the file exists
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		state: newState(),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	st := newState()
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	// Files written by older versions may lack some maps
+	if st.Selections == nil {
+		st.Selections = make(map[string]string)
+	}
+	if st.Winners == nil {
+		st.Winners = make(map[string]string)
+	}
+	if st.Rules == nil {
+		st.Rules = make(map[string]bool)
+	}
+	if st.Quotas == nil {
+		st.Quotas = make(map[string]quota.Usage)
+	}
+	s.state = st
+	return s, nil
+}
+
+func newState() State {
+	return State{
+		Selections: make(map[string]string),
+		Winners:    make(map[string]string),
+		Rules:      make(map[string]bool),
+		Quotas:     make(map[string]quota.Usage),
+	}
+}
+
+// Path returns the state file path
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Snapshot returns a copy of the current state
+func (s *Store) Snapshot() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := newState()
+	st.Mode = s.state.Mode
+	for k, v := range s.state.Selections {
+		st.Selections[k] = v
+	}
+	for k, v := range s.state.Winners {
+		st.Winners[k] = v
+	}
+	for k, v := range s.state.Rules {
+		st.Rules[k] = v
+	}
+	for k, v := range s.state.Quotas {
+		st.Quotas[k] = v
+	}
+	return st
+}
+
+// SetMode records the proxy mode
+func (s *Store) SetMode(mode string) error {
+	return s.update(func(st *State) bool {
+		if st.Mode == mode {
+			return false
+		}
+		st.Mode = mode
+		return true
+	})
+}
+
+// SetSelection records the member chosen in a select group
+func (s *Store) SetSelection(group, proxy string) error {
+	return s.update(func(st *State) bool {
+		if st.Selections[group] == proxy {
+			return false
+		}
+		st.Selections[group] = proxy
+		return true
+	})
+}
+
+// SetWinner records the member an automatic group last picked
+func (s *Store) SetWinner(group, proxy string) error {
+	return s.update(func(st *State) bool {
+		if st.Winners[group] == proxy {
+			return false
+		}
+		st.Winners[group] = proxy
+		return true
+	})
+}
+
+// SetRuleEnabled records a runtime toggle of the rule identified by key
+func (s *Store) SetRuleEnabled(key string, enabled bool) error {
+	return s.update(func(st *State) bool {
+		if v, ok := st.Rules[key]; ok && v == enabled {
+			return false
+		}
+		st.Rules[key] = enabled
+		return true
+	})
+}
+
+// SetQuotaUsage records the traffic counted against quotas
+func (s *Store) SetQuotaUsage(usage map[string]quota.Usage) error {
+	return s.update(func(st *State) bool {
+		if reflect.DeepEqual(st.Quotas, usage) {
+			return false
+		}
+		st.Quotas = make(map[string]quota.Usage, len(usage))
+		for k, v := range usage {
+			st.Quotas[k] = v
+		}
+		return true
+	})
+}
+
+// update applies fn and writes the file if fn reports a change
+func (s *Store) update(fn func(st *State) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !fn(&s.state) {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// saveLocked writes the state atomically through a temporary file
+func (s *Store) saveLocked() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-proxy/surge-go/internal/quota"
+)
+
+func TestStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "surge.state.json")
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("store should not write a file before the first change")
+	}
+
+	s.SetMode("global")
+	s.SetSelection("Proxy", "HK")
+	s.SetWinner("Auto", "JP")
+	s.SetRuleEnabled("DOMAIN,example.com,DIRECT", false)
+	s.SetQuotaUsage(map[string]quota.Usage{"HK": {Day: "2026-03-10", DayBytes: 42}})
+
+	loaded, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	st := loaded.Snapshot()
+	if st.Mode != "global" {
+		t.Errorf("mode = %q, want global", st.Mode)
+	}
+	if st.Selections["Proxy"] != "HK" || st.Winners["Auto"] != "JP" {
+		t.Errorf("unexpected selections: %v %v", st.Selections, st.Winners)
+	}
+	if enabled, ok := st.Rules["DOMAIN,example.com,DIRECT"]; !ok || enabled {
+		t.Errorf("rule toggle not restored: %v", st.Rules)
+	}
+	if st.Quotas["HK"].DayBytes != 42 {
+		t.Errorf("quota usage not restored: %v", st.Quotas)
+	}
+}
+
+func TestPathForConfig(t *testing.T) {
+	got := PathForConfig(filepath.Join("etc", "surge", "surge.conf"))
+	want := filepath.Join("etc", "surge", "surge.state.json")
+	if got != want {
+		t.Errorf("PathForConfig = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the number of probe results kept per proxy
+const DefaultHistorySize = 100
+
+// ProbeResult is a single timestamped latency test of a proxy
+type ProbeResult struct {
+	Timestamp time.Time `json:"timestamp"`
+	Latency   int64     `json:"latency"`             // Total latency (ms)
+	TCP       int64     `json:"tcp,omitempty"`       // TCP connect time (ms), if measured
+	Handshake int64     `json:"handshake,omitempty"` // Proxy/TLS handshake time (ms), if measured
+	Error     string    `json:"error,omitempty"`
+	Source    string    `json:"source,omitempty"` // Who ran the test: "api" or the probing group
+}
+
+// Alive reports whether the probe succeeded
+func (r ProbeResult) Alive() bool {
+	return r.Error == ""
+}
+
+// probeRing is a fixed size ring buffer of probe results
+type probeRing struct {
+	buf  []ProbeResult
+	next int
+	full bool
+}
+
+func (r *probeRing) add(res ProbeResult) {
+	r.buf[r.next] = res
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the results oldest first
+func (r *probeRing) list() []ProbeResult {
+	if !r.full {
+		out := make([]ProbeResult, r.next)
+		copy(out, r.buf[:r.next])
+		return out
+	}
+	out := make([]ProbeResult, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+func (r *probeRing) latest() (ProbeResult, bool) {
+	if !r.full && r.next == 0 {
+		return ProbeResult{}, false
+	}
+	i := r.next - 1
+	if i < 0 {
+		i = len(r.buf) - 1
+	}
+	return r.buf[i], true
+}
+
+// LatencyHistory keeps the recent probe results of every proxy and group
+type LatencyHistory struct {
+	mu    sync.RWMutex
+	size  int
+	rings map[string]*probeRing
+}
+
+// NewLatencyHistory creates a history keeping up to size results per proxy
+func NewLatencyHistory(size int) *LatencyHistory {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &LatencyHistory{
+		size:  size,
+		rings: make(map[string]*probeRing),
+	}
+}
+
+// Record appends a probe result for the named proxy
+func (h *LatencyHistory) Record(name string, res ProbeResult) {
+	if res.Timestamp.IsZero() {
+		res.Timestamp = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.rings[name]
+	if !ok {
+		r = &probeRing{buf: make([]ProbeResult, h.size)}
+		h.rings[name] = r
+	}
+	r.add(res)
+}
+
+// Get returns the recorded results of the named proxy, oldest first
+func (h *LatencyHistory) Get(name string) []ProbeResult {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, ok := h.rings[name]
+	if !ok {
+		return []ProbeResult{}
+	}
+	return r.list()
+}
+
+// Latest returns the most recent result of the named proxy
+func (h *LatencyHistory) Latest(name string) (ProbeResult, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, ok := h.rings[name]
+	if !ok {
+		return ProbeResult{}, false
+	}
+	return r.latest()
+}
@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"testing"
+)
+
+func TestLatencyHistory_RingBuffer(t *testing.T) {
+	h := NewLatencyHistory(3)
+
+	if _, ok := h.Latest("A"); ok {
+		t.Fatal("unknown proxy should have no latest result")
+	}
+
+	for i := 1; i <= 5; i++ {
+		h.Record("A", ProbeResult{Latency: int64(i * 10)})
+	}
+
+	list := h.Get("A")
+	if len(list) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(list))
+	}
+	for i, want := range []int64{30, 40, 50} {
+		if list[i].Latency != want {
+			t.Errorf("result %d latency = %d, want %d", i, list[i].Latency, want)
+		}
+		if list[i].Timestamp.IsZero() {
+			t.Errorf("result %d missing timestamp", i)
+		}
+	}
+
+	h.Record("A", ProbeResult{Error: "timeout"})
+	latest, ok := h.Latest("A")
+	if !ok || latest.Alive() {
+		t.Errorf("latest result should be the failed probe: %+v", latest)
+	}
+}
@@ -0,0 +1,59 @@
+package system
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// GetDefaultGateway returns the default gateway IP and interface name
+func GetDefaultGateway() (string, string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	return parseProcNetRoute(f)
+}
+
+// parseProcNetRoute extracts the default route from /proc/net/route content.
+// Addresses in that file are little-endian hex, e.g. 0101A8C0 is 192.168.1.1.
+func parseProcNetRoute(r io.Reader) (string, string, error) {
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		if first {
+			// Skip header: Iface Destination Gateway Flags ...
+			first = false
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		if ip.IsUnspecified() {
+			// Point-to-point default route (e.g. VPN) has no gateway
+			continue
+		}
+		return ip.String(), fields[0], nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	return "", "", fmt.Errorf("gateway not found in routing table")
+}
@@ -0,0 +1,32 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetRoute(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+`
+	gw, iface, err := parseProcNetRoute(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if gw != "192.168.1.1" {
+		t.Errorf("gateway = %s, want 192.168.1.1", gw)
+	}
+	if iface != "eth0" {
+		t.Errorf("interface = %s, want eth0", iface)
+	}
+}
+
+func TestParseProcNetRoute_NoDefault(t *testing.T) {
+	table := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+	if _, _, err := parseProcNetRoute(strings.NewReader(table)); err == nil {
+		t.Error("expected error without default route")
+	}
+}
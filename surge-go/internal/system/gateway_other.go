@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package system
+
+import "fmt"
+
+// GetDefaultGateway stub for unsupported platforms
+func GetDefaultGateway() (string, string, error) {
+	return "", "", fmt.Errorf("default gateway lookup not supported on this platform")
+}
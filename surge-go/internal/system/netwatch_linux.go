@@ -0,0 +1,74 @@
+package system
+
+import (
+	"log"
+	"syscall"
+)
+
+// rtnetlink multicast groups (linux/rtnetlink.h), not exported by package syscall
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// routeChangeEvents subscribes to rtnetlink link, address and route notifications.
+// The returned channel receives a value per notification batch and is closed when
+// stop is closed or the socket fails. A nil channel means notifications are unavailable.
+func routeChangeEvents(stop <-chan struct{}) <-chan struct{} {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		log.Printf("Network watcher: netlink unavailable, polling only: %v", err)
+		return nil
+	}
+
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv4Route | rtmgrpIPv6IfAddr | rtmgrpIPv6Route,
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		log.Printf("Network watcher: netlink bind failed, polling only: %v", err)
+		return nil
+	}
+
+	// Periodic receive timeout so the reader notices stop
+	tv := syscall.Timeval{Sec: 1}
+	syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, 8192)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+					continue
+				}
+				log.Printf("Network watcher: netlink read failed: %v", err)
+				return
+			}
+			if n == 0 {
+				continue
+			}
+
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return events
+}
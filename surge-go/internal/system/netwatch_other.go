@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package system
+
+// routeChangeEvents is not implemented on this platform; WatchNetwork falls back to polling
+func routeChangeEvents(stop <-chan struct{}) <-chan struct{} {
+	return nil
+}
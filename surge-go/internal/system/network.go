@@ -0,0 +1,114 @@
+package system
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NetworkState describes the network the host is currently attached to
+type NetworkState struct {
+	Gateway   string       `json:"gateway"`   // Default gateway IP, empty if none
+	Interface string       `json:"interface"` // Interface of the default route
+	Addresses []*net.IPNet `json:"-"`         // Addresses assigned to local up interfaces
+}
+
+// GetNetworkState collects the default route and local interface addresses
+func GetNetworkState() (*NetworkState, error) {
+	state := &NetworkState{}
+
+	// A missing default route is a valid state (offline), not an error
+	state.Gateway, state.Interface, _ = GetDefaultGateway()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				state.Addresses = append(state.Addresses, ipNet)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// Fingerprint returns a stable string identifying the state, used to detect changes
+func (s *NetworkState) Fingerprint() string {
+	addrs := make([]string, 0, len(s.Addresses))
+	for _, a := range s.Addresses {
+		addrs = append(addrs, a.String())
+	}
+	sort.Strings(addrs)
+	return s.Gateway + "|" + s.Interface + "|" + strings.Join(addrs, ",")
+}
+
+// WatchNetwork calls onChange whenever the network state changes until stop is closed.
+// Platforms with route change notifications (netlink on Linux) react immediately;
+// the poll interval is used everywhere as a fallback.
+func WatchNetwork(interval time.Duration, stop <-chan struct{}, onChange func(*NetworkState)) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	var last string
+	if state, err := GetNetworkState(); err == nil {
+		last = state.Fingerprint()
+	}
+
+	check := func() {
+		state, err := GetNetworkState()
+		if err != nil {
+			return
+		}
+		if fp := state.Fingerprint(); fp != last {
+			last = fp
+			onChange(state)
+		}
+	}
+
+	events := routeChangeEvents(stop)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// Route updates arrive in bursts; let them settle before re-reading
+			time.Sleep(500 * time.Millisecond)
+			drain(events)
+			check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func drain(ch <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
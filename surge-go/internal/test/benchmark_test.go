@@ -2,6 +2,7 @@ package test
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"testing"
@@ -33,6 +34,92 @@ func BenchmarkRuleMatching(b *testing.B) {
 	}
 }
 
+// largeRuleList builds n domain, keyword and IP rules followed by FINAL,
+// similar to a config pulling in big rule sets
+func largeRuleList(n int) []rule.Rule {
+	rules := make([]rule.Rule, 0, n+1)
+	for i := 0; i < n; i++ {
+		switch i % 4 {
+		case 0:
+			rules = append(rules, rule.NewDomainSuffixRule(fmt.Sprintf("site%d.example", i), "Proxy"))
+		case 1:
+			rules = append(rules, rule.NewDomainRule(fmt.Sprintf("host%d.example", i), "Proxy"))
+		case 2:
+			rules = append(rules, rule.NewDomainKeywordRule(fmt.Sprintf("tracker%d", i), "Reject"))
+		case 3:
+			if r, err := rule.NewIPCIDRRule(fmt.Sprintf("10.%d.%d.0/24", (i>>8)&0xff, i&0xff), "Direct", false); err == nil {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return append(rules, rule.NewFinalRule("Final"))
+}
+
+// largeRuleMetadata hits rules near the end of the list and FINAL
+var largeRuleMetadata = []*rule.RequestMetadata{
+	{Type: "tcp", Host: "www.site49996.example", Port: 443},
+	{Type: "tcp", IP: net.ParseIP("10.195.79.1"), Port: 443},
+	{Type: "tcp", Host: "unmatched.test", Port: 443},
+}
+
+// BenchmarkRuleMatching_Linear50k scans the rules one by one, as Engine.Match used to
+func BenchmarkRuleMatching_Linear50k(b *testing.B) {
+	rules := largeRuleList(50000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		meta := largeRuleMetadata[i%len(largeRuleMetadata)]
+		for _, r := range rules {
+			if r.IsEnabled() && r.Match(meta) {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkRuleMatching_Indexed50k matches through the compiled rule index
+func BenchmarkRuleMatching_Indexed50k(b *testing.B) {
+	eng := rule.NewEngine()
+	for _, r := range largeRuleList(50000) {
+		eng.Add(r)
+	}
+	eng.Match(largeRuleMetadata[0]) // Compile outside the timed loop
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		eng.Match(largeRuleMetadata[i%len(largeRuleMetadata)])
+	}
+}
+
+// BenchmarkRuleSet_Linear50k checks a rule set the way RuleSetRule.Match used to
+func BenchmarkRuleSet_Linear50k(b *testing.B) {
+	rules := largeRuleList(50000)
+	rules = rules[:len(rules)-1]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		meta := largeRuleMetadata[i%len(largeRuleMetadata)]
+		for _, r := range rules {
+			if r.Match(meta) {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkRuleSet_Indexed50k checks a rule set through its compiled index
+func BenchmarkRuleSet_Indexed50k(b *testing.B) {
+	rules := largeRuleList(50000)
+	rs, _ := rule.NewRuleSetRule("file:///dev/null", "Proxy", nil)
+	rs.SetRules(rules[:len(rules)-1])
+	rs.Match(largeRuleMetadata[0])
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs.Match(largeRuleMetadata[i%len(largeRuleMetadata)])
+	}
+}
+
 func BenchmarkThroughput_Direct(b *testing.B) {
 	// Direct TCP throughput (baseline)
 	serverLn, _ := net.Listen("tcp", "127.0.0.1:0")
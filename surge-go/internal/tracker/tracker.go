@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/surge-proxy/surge-go/internal/capture"
@@ -18,11 +19,42 @@ type Connection struct {
 	ProcessName   string    `json:"process_name"`
 	SourceIP      string    `json:"source_ip"`
 	TargetAddress string    `json:"target_address"`
+	DestinationIP string    `json:"destination_ip,omitempty"` // IP the domain resolved to during rule matching
+	Protocol      string    `json:"protocol,omitempty"`       // Sniffed application protocol
+	SniffedHost   string    `json:"sniffed_host,omitempty"`   // Domain sniffed from the first client bytes
+	InboundType   string    `json:"inbound_type,omitempty"`   // Listener the connection arrived on: HTTP, SOCKS5, TUN or REDIR
+	InboundPort   int       `json:"inbound_port,omitempty"`
+	InboundUser   string    `json:"inbound_user,omitempty"` // Authenticated inbound user
 	Rule          string    `json:"rule"`
 	Policy        string    `json:"policy"`
 	StartTime     time.Time `json:"start_time"`
 	UploadBytes   uint64    `json:"upload"`
 	DownloadBytes uint64    `json:"download"`
+	// Attempts lists the dials tried, when more than one was needed
+	Attempts []DialAttempt `json:"attempts,omitempty"`
+	// Counter, if set, also receives the traffic of the connection, e.g. the
+	// statistics of the rule that routed it
+	Counter TrafficCounter `json:"-"`
+}
+
+// TrafficCounter aggregates the traffic of several connections
+type TrafficCounter interface {
+	AddTraffic(upload, download int64)
+	ConnOpened()
+	ConnClosed()
+}
+
+// DialAttempt is a single try to reach the target through a policy
+type DialAttempt struct {
+	Policy   string `json:"policy"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration"` // ms
+}
+
+// Fallback is a policy tried when the dials before it failed
+type Fallback struct {
+	Policy string
+	Dialer protocol.Dialer
 }
 
 // Tracker manages active connections
@@ -42,6 +74,13 @@ func NewTracker(store *capture.Store) *Tracker {
 
 // Track registers a new connection and returns a wrapper
 func (t *Tracker) Track(conn net.Conn, meta *Connection) net.Conn {
+	t.register(meta)
+	tracked := &TrackedConn{Conn: conn, tracker: t}
+	tracked.connObj.Store(meta)
+	return tracked
+}
+
+func (t *Tracker) register(meta *Connection) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -52,12 +91,8 @@ func (t *Tracker) Track(conn net.Conn, meta *Connection) net.Conn {
 	meta.StartTime = time.Now()
 
 	t.conns[meta.ID] = meta
-
-	return &TrackedConn{
-		Conn:    conn,
-		tracker: t,
-		id:      meta.ID,
-		connObj: meta,
+	if meta.Counter != nil {
+		meta.Counter.ConnOpened()
 	}
 }
 
@@ -105,14 +140,18 @@ func (t *Tracker) GetConnections() []*Connection {
 type TrackedConn struct {
 	net.Conn
 	tracker *Tracker
-	id      string
-	connObj *Connection
+	connObj atomic.Pointer[Connection] // Replaced when the connection is reused
+	closed  atomic.Bool
 }
 
 func (c *TrackedConn) Read(b []byte) (n int, err error) {
 	n, err = c.Conn.Read(b)
 	if n > 0 {
-		c.connObj.DownloadBytes += uint64(n)
+		meta := c.connObj.Load()
+		meta.DownloadBytes += uint64(n)
+		if meta.Counter != nil {
+			meta.Counter.AddTraffic(0, int64(n))
+		}
 	}
 	return
 }
@@ -120,38 +159,129 @@ func (c *TrackedConn) Read(b []byte) (n int, err error) {
 func (c *TrackedConn) Write(b []byte) (n int, err error) {
 	n, err = c.Conn.Write(b)
 	if n > 0 {
-		c.connObj.UploadBytes += uint64(n)
+		meta := c.connObj.Load()
+		meta.UploadBytes += uint64(n)
+		if meta.Counter != nil {
+			meta.Counter.AddTraffic(int64(n), 0)
+		}
 	}
 	return
 }
 
 func (c *TrackedConn) Close() error {
-	c.tracker.Unregister(c.id)
+	meta := c.connObj.Load()
+	// The counter sees each connection close once, however often Close is called
+	if !c.closed.Swap(true) && meta.Counter != nil {
+		meta.Counter.ConnClosed()
+	}
+	c.tracker.Unregister(meta.ID)
 	return c.Conn.Close()
 }
 
-// TrackingDialer implements protocol.Dialer and tracks connections
+// TrackingDialer implements protocol.Dialer and tracks connections.
+// When the dial fails, the Fallbacks are tried in order.
 type TrackingDialer struct {
-	Dialer  protocol.Dialer
-	Tracker *Tracker
-	Meta    *Connection
+	Dialer    protocol.Dialer
+	Tracker   *Tracker
+	Meta      *Connection
+	Fallbacks []Fallback
+	// Wrap decorates the connection established through policy, e.g. for
+	// bandwidth limits and traffic quotas
+	Wrap func(policy string, conn net.Conn) net.Conn
+	// Address, when set, is dialed instead of the address the caller asked
+	// for, e.g. the domain sniffed from the connection
+	Address string
 }
 
 func (d *TrackingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	conn, err := d.Dialer.DialContext(ctx, network, address)
+	if d.Address != "" {
+		address = d.Address
+	}
+	// Expose the client address to policy groups (e.g. sticky load balancing)
+	if d.Meta.SourceIP != "" && protocol.SourceAddrFromContext(ctx) == "" {
+		ctx = protocol.WithSourceAddr(ctx, d.Meta.SourceIP)
+	}
+	// Direct dials reuse the IP resolved for rule matching
+	if ip := net.ParseIP(d.Meta.DestinationIP); ip != nil {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			ctx = protocol.WithResolvedIP(ctx, host, ip)
+		}
+	}
+
+	candidates := make([]Fallback, 0, 1+len(d.Fallbacks))
+	candidates = append(candidates, Fallback{Policy: d.Meta.Policy, Dialer: d.Dialer})
+	candidates = append(candidates, d.Fallbacks...)
+
+	var attempts []DialAttempt
+	var conn net.Conn
+	var err error
+	used := candidates[0].Policy
+	for _, c := range candidates {
+		start := time.Now()
+		conn, err = c.Dialer.DialContext(ctx, network, address)
+		attempt := DialAttempt{Policy: c.Policy, Duration: time.Since(start).Milliseconds()}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		if err == nil {
+			used = c.Policy
+			break
+		}
+		// The client gave up, further attempts are pointless
+		if ctx.Err() != nil {
+			break
+		}
+	}
 	if err != nil {
+		if len(attempts) > 1 {
+			return nil, fmt.Errorf("all %d dial attempts failed, last: %w", len(attempts), err)
+		}
 		return nil, err
 	}
 
+	if d.Wrap != nil {
+		conn = d.Wrap(used, conn)
+	}
+
 	// Track connection
 	// We need a copy of Meta because it might be reused or modified
 	meta := *d.Meta
 	meta.TargetAddress = address // Ensure address is captured if not already
+	meta.Policy = used
+	if len(attempts) > 1 {
+		meta.Attempts = attempts
+	}
 
 	tracked := d.Tracker.Track(conn, &meta)
 	return tracked, nil
 }
 
+// Reuse accounts conn, a connection a TrackingDialer of the same tracker
+// returned earlier, to d: the entry of its previous use ends and one with the
+// rule and metadata of d starts. HTTP keep-alive connections carry requests
+// routed on their own this way. It reports false if conn is not tracked here.
+func (d *TrackingDialer) Reuse(conn net.Conn) bool {
+	tc, ok := conn.(*TrackedConn)
+	if !ok || tc.tracker != d.Tracker || tc.closed.Load() {
+		return false
+	}
+	prev := tc.connObj.Load()
+	if prev.Counter != nil {
+		prev.Counter.ConnClosed()
+	}
+	d.Tracker.Unregister(prev.ID)
+
+	meta := *d.Meta
+	meta.TargetAddress = prev.TargetAddress
+	meta.Policy = prev.Policy // A fallback may have been used
+	meta.UploadBytes, meta.DownloadBytes = 0, 0
+	d.Tracker.register(&meta)
+	tc.connObj.Store(&meta)
+	return true
+}
+
 func (d *TrackingDialer) Name() string {
 	return d.Dialer.Name()
 }
@@ -0,0 +1,181 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/surge-proxy/surge-go/internal/protocol"
+)
+
+// stubDialer fails the first fails dials, then returns one end of a pipe
+type stubDialer struct {
+	name   string
+	fails  int
+	calls  int
+	dialed string // Address after applying a resolved IP from the context
+}
+
+func (d *stubDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.calls++
+	d.dialed = protocol.ResolvedAddress(ctx, address)
+	if d.calls <= d.fails {
+		return nil, errors.New("connection refused")
+	}
+	c, _ := net.Pipe()
+	return c, nil
+}
+func (d *stubDialer) Name() string                                        { return d.name }
+func (d *stubDialer) Type() string                                        { return "stub" }
+func (d *stubDialer) Test(url string, timeout time.Duration) (int, error) { return 0, nil }
+func (d *stubDialer) Close() error                                        { return nil }
+
+func TestTrackingDialer_FallsBack(t *testing.T) {
+	tr := NewTracker(nil)
+	primary := &stubDialer{name: "Proxy", fails: 2}
+	backup := &stubDialer{name: "Backup"}
+
+	d := &TrackingDialer{
+		Dialer:  primary,
+		Tracker: tr,
+		Meta:    &Connection{Policy: "Proxy", Rule: "FINAL"},
+		Fallbacks: []Fallback{
+			{Policy: "Proxy", Dialer: primary},
+			{Policy: "Backup", Dialer: backup},
+		},
+	}
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("dial should succeed through the fallback: %v", err)
+	}
+	defer conn.Close()
+
+	conns := tr.GetConnections()
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 tracked connection, got %d", len(conns))
+	}
+	c := conns[0]
+	if c.Policy != "Backup" {
+		t.Errorf("policy = %s, want Backup", c.Policy)
+	}
+	if len(c.Attempts) != 3 || c.Attempts[0].Error == "" || c.Attempts[2].Error != "" {
+		t.Errorf("unexpected attempts: %+v", c.Attempts)
+	}
+}
+
+func TestTrackingDialer_StopsWhenCanceled(t *testing.T) {
+	primary := &stubDialer{name: "Proxy", fails: 10}
+	d := &TrackingDialer{
+		Dialer:    primary,
+		Tracker:   NewTracker(nil),
+		Meta:      &Connection{Policy: "Proxy"},
+		Fallbacks: []Fallback{{Policy: "Proxy", Dialer: primary}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DialContext(ctx, "tcp", "example.com:443"); err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	if primary.calls != 1 {
+		t.Errorf("canceled dial should not be retried, got %d calls", primary.calls)
+	}
+}
+
+func TestTrackingDialer_ReusesResolvedIP(t *testing.T) {
+	tr := NewTracker(nil)
+	direct := &stubDialer{name: "DIRECT"}
+
+	d := &TrackingDialer{
+		Dialer:  direct,
+		Tracker: tr,
+		Meta:    &Connection{Policy: "DIRECT", Rule: "IP-CIDR, 10.0.0.0/8", DestinationIP: "10.1.2.3"},
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", "intranet.corp:443")
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if direct.dialed != "10.1.2.3:443" {
+		t.Errorf("dialed %s, want the resolved IP", direct.dialed)
+	}
+	if got := tr.GetConnections(); len(got) != 1 || got[0].DestinationIP != "10.1.2.3" {
+		t.Errorf("tracked connection should show the resolved IP: %+v", got)
+	}
+}
+
+type countingCounter struct {
+	upload, download int64
+	opened, closed   int
+}
+
+func (c *countingCounter) AddTraffic(upload, download int64) {
+	c.upload += upload
+	c.download += download
+}
+func (c *countingCounter) ConnOpened() { c.opened++ }
+func (c *countingCounter) ConnClosed() { c.closed++ }
+
+func TestTracker_Counter(t *testing.T) {
+	tr := NewTracker(nil)
+	counter := &countingCounter{}
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := tr.Track(client, &Connection{Rule: "DOMAIN, example.com", Counter: counter})
+	go func() {
+		buf := make([]byte, 16)
+		n, _ := server.Read(buf)
+		server.Write([]byte("reply to " + string(buf[:n])))
+	}()
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 32)
+	n, _ := conn.Read(buf)
+	conn.Close()
+	conn.Close()
+
+	if counter.upload != 5 || counter.download != int64(n) || n != len("reply to hello") {
+		t.Errorf("counted %d up, %d down", counter.upload, counter.download)
+	}
+	if counter.opened != 1 || counter.closed != 1 {
+		t.Errorf("opened %d, closed %d times, want once each", counter.opened, counter.closed)
+	}
+}
+
+func TestTrackingDialer_Reuse(t *testing.T) {
+	tr := NewTracker(nil)
+	first, second := &countingCounter{}, &countingCounter{}
+	d1 := &TrackingDialer{Dialer: &stubDialer{name: "Proxy"}, Tracker: tr, Meta: &Connection{Rule: "URL-REGEX,a", Policy: "Proxy", Counter: first}}
+	d2 := &TrackingDialer{Dialer: &stubDialer{name: "Proxy"}, Tracker: tr, Meta: &Connection{Rule: "URL-REGEX,b", Policy: "Proxy", Counter: second}}
+
+	conn, err := d1.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !d2.Reuse(conn) {
+		t.Fatal("Reuse of a tracked connection failed")
+	}
+	list := tr.GetConnections()
+	if len(list) != 1 || list[0].Rule != "URL-REGEX,b" || list[0].TargetAddress != "example.com:80" || list[0].Policy != "Proxy" {
+		t.Fatalf("unexpected connections after reuse: %+v", list)
+	}
+	if first.opened != 1 || first.closed != 1 || second.opened != 1 {
+		t.Errorf("counters: first opened %d closed %d, second opened %d", first.opened, first.closed, second.opened)
+	}
+
+	conn.Close()
+	if len(tr.GetConnections()) != 0 || second.closed != 1 || first.closed != 1 {
+		t.Errorf("after close: %d connections, closed first %d second %d", len(tr.GetConnections()), first.closed, second.closed)
+	}
+	if d2.Reuse(conn) {
+		t.Error("Reuse of a closed connection succeeded")
+	}
+	if c, _ := net.Pipe(); d2.Reuse(c) {
+		t.Error("Reuse of an untracked connection succeeded")
+	}
+}